@@ -18,7 +18,9 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"strconv"
 	"xfsgo"
@@ -30,10 +32,11 @@ import (
 )
 
 type ChainAPIHandler struct {
-	BlockChain    *xfsgo.BlockChain
-	TxPendingPool *xfsgo.TxPool
-	LogStorage    vm.LogStorage
-	number        int
+	BlockChain     *xfsgo.BlockChain
+	TxPendingPool  *xfsgo.TxPool
+	LogStorage     vm.LogStorage
+	GasPriceOracle *xfsgo.GasPriceOracle
+	number         int
 }
 
 type GetBlockByNumArgs struct {
@@ -154,9 +157,20 @@ func (handler *ChainAPIHandler) GetBlockHashes(args GetBlockHashesArgs, resp *[]
 // 	return coverBlocks2Resp(gotBlocks, resp)
 // }
 
+// coverBlockHeader2Resp converts the header of block along with the cumulative work of its chain.
+func (handler *ChainAPIHandler) coverBlockHeader2Resp(block *xfsgo.Block, dst **BlockHeaderResp) error {
+	if err := coverBlockHeader2Resp(block, dst); err != nil || *dst == nil {
+		return err
+	}
+	if work := handler.BlockChain.GetTotalWork(block.HeaderHash()); work != nil {
+		(*dst).TotalWork = work.Text(10)
+	}
+	return nil
+}
+
 func (handler *ChainAPIHandler) GetHead(_ EmptyArgs, resp **BlockHeaderResp) error {
 	gotBlock := handler.BlockChain.GetHead()
-	return coverBlockHeader2Resp(gotBlock, resp)
+	return handler.coverBlockHeader2Resp(gotBlock, resp)
 }
 
 func (handler *ChainAPIHandler) GetBlockHeaderByNumber(args GetBlockHeaderByNumberArgs, resp **BlockHeaderResp) error {
@@ -171,7 +185,103 @@ func (handler *ChainAPIHandler) GetBlockHeaderByNumber(args GetBlockHeaderByNumb
 		last = number.Uint64()
 	}
 	gotBlock := handler.BlockChain.GetBlockByNumber(last)
-	return coverBlockHeader2Resp(gotBlock, resp)
+	return handler.coverBlockHeader2Resp(gotBlock, resp)
+}
+
+type GetBlockRewardArgs struct {
+	Height string `json:"height"`
+}
+
+type BlockRewardResp struct {
+	Height  uint64 `json:"height"`
+	Subsidy string `json:"subsidy"`
+	Fees    string `json:"fees"`
+	Total   string `json:"total"`
+}
+
+// GetBlockReward returns the subsidy and the transaction fees credited to the
+// coinbase of the block at the given height, the head block by default.
+func (handler *ChainAPIHandler) GetBlockReward(args GetBlockRewardArgs, resp **BlockRewardResp) error {
+	var height uint64
+	if args.Height == "" {
+		height = handler.BlockChain.CurrentBHeader().Height
+	} else {
+		number, ok := new(big.Int).SetString(args.Height, 0)
+		if !ok {
+			return xfsgo.NewRPCError(-1006, "string to big.Int error")
+		}
+		height = number.Uint64()
+	}
+	reward := handler.BlockChain.GetBlockReward(height)
+	if reward == nil {
+		return xfsgo.NewRPCError(-1006, "Not found block")
+	}
+	*resp = &BlockRewardResp{
+		Height:  height,
+		Subsidy: reward.Subsidy.Text(10),
+		Fees:    reward.Fees.Text(10),
+		Total:   reward.Total().Text(10),
+	}
+	return nil
+}
+
+type ChainConfigResp struct {
+	Subsidy          string            `json:"subsidy"`
+	HalvingInterval  *uint64           `json:"halving_interval"`
+	TargetBlockTime  int64             `json:"target_block_time"`
+	RetargetTimespan int64             `json:"retarget_timespan"`
+	AdjustmentFactor int64             `json:"adjustment_factor"`
+	GenesisGasLimit  string            `json:"genesis_gas_limit"`
+	BlockGasLimit    string            `json:"block_gas_limit"`
+	Forks            map[string]uint64 `json:"forks"`
+	ActiveForks      []string          `json:"active_forks"`
+	ProtocolVersion  uint32            `json:"protocol_version"`
+}
+
+// GetChainConfig returns the parameters of the chain, along with the forks
+// active at the head block.
+func (handler *ChainAPIHandler) GetChainConfig(_ EmptyArgs, resp **ChainConfigResp) error {
+	config := handler.BlockChain.Config()
+	height := handler.BlockChain.CurrentBHeader().Height
+	*resp = &ChainConfigResp{
+		Subsidy:          config.Subsidy.Text(10),
+		HalvingInterval:  config.HalvingInterval,
+		TargetBlockTime:  config.TargetBlockTime,
+		RetargetTimespan: config.RetargetTimespan,
+		AdjustmentFactor: config.AdjustmentFactor,
+		GenesisGasLimit:  config.GenesisGasLimit.Text(10),
+		BlockGasLimit:    config.BlockGasLimit.Text(10),
+		Forks:            config.Forks,
+		ActiveForks:      config.ActiveForks(height),
+		ProtocolVersion:  config.ProtocolVersion(height),
+	}
+	return nil
+}
+
+type BadBlockResp struct {
+	Hash     common.Hash      `json:"hash"`
+	Header   *BlockHeaderResp `json:"header"`
+	Reason   string           `json:"reason"`
+	Received int64            `json:"received"`
+}
+
+// GetBadBlocks returns the blocks recently rejected by the block validator, the latest first.
+func (handler *ChainAPIHandler) GetBadBlocks(_ EmptyArgs, resp *[]*BadBlockResp) error {
+	badBlocks := handler.BlockChain.GetBadBlocks()
+	result := make([]*BadBlockResp, 0, len(badBlocks))
+	for _, bad := range badBlocks {
+		item := &BadBlockResp{
+			Hash:     bad.Hash,
+			Reason:   bad.Reason,
+			Received: bad.Received.Unix(),
+		}
+		if err := coverBlockHeader2Resp(&xfsgo.Block{Header: bad.Header}, &item.Header); err != nil {
+			return err
+		}
+		result = append(result, item)
+	}
+	*resp = result
+	return nil
 }
 
 func (handler *ChainAPIHandler) GetBlockHeaderByHash(args GetBlockHeaderByHashArgs, resp **BlockHeaderResp) error {
@@ -182,7 +292,7 @@ func (handler *ChainAPIHandler) GetBlockHeaderByHash(args GetBlockHeaderByHashAr
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
 	goBlock := handler.BlockChain.GetBlockByHash(common.Hex2Hash(args.Hash))
-	return coverBlockHeader2Resp(goBlock, resp)
+	return handler.coverBlockHeader2Resp(goBlock, resp)
 }
 
 func (handler *ChainAPIHandler) GetBlockByHash(args GetBlockByHashArgs, resp **BlockResp) error {
@@ -272,6 +382,154 @@ func (handler *ChainAPIHandler) GetTransaction(args GetTransactionArgs, resp **T
 	return coverTx2Resp(data, resp)
 }
 
+// SuggestGasPrice returns a gas price in atto which is expected to get a transaction
+// included in a timely manner, based on recent blocks and the pending transactions.
+func (handler *ChainAPIHandler) SuggestGasPrice(_ EmptyArgs, resp *string) error {
+	price := handler.GasPriceOracle.SuggestPrice()
+	*resp = price.Text(10)
+	return nil
+}
+
+type SimulateTransactionArgs struct {
+	EstimateGasArgs
+	Nonce  string `json:"nonce"`
+	Raw    string `json:"raw"`
+	Height string `json:"height"`
+}
+
+type StorageDiffResp struct {
+	Key    common.Hash `json:"key"`
+	Before string      `json:"before"`
+	After  string      `json:"after"`
+}
+
+type AccountDiffResp struct {
+	Address       common.Address     `json:"address"`
+	BalanceBefore string             `json:"balance_before"`
+	BalanceAfter  string             `json:"balance_after"`
+	NonceBefore   uint64             `json:"nonce_before"`
+	NonceAfter    uint64             `json:"nonce_after"`
+	Storage       []*StorageDiffResp `json:"storage"`
+}
+
+type SimulateEventResp struct {
+	EventHash  common.Hash    `json:"event_hash"`
+	EventValue string         `json:"event_value"`
+	Address    common.Address `json:"address"`
+}
+
+type SimulateTransactionResp struct {
+	Receipt *ReceiptResp         `json:"receipt"`
+	GasUsed string               `json:"gas_used"`
+	Events  []*SimulateEventResp `json:"events"`
+	Diff    []*AccountDiffResp   `json:"diff"`
+}
+
+// SimulateTransaction runs a transaction on top of the state at the given height
+// (the head by default) without persisting anything. The transaction is either
+// a signed raw transaction as accepted by TxPool.SendRawTransaction, or an
+// unsigned one described by the remaining fields.
+func (handler *ChainAPIHandler) SimulateTransaction(args SimulateTransactionArgs, resp **SimulateTransactionResp) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
+	header := handler.BlockChain.CurrentBHeader()
+	if args.Height != "" {
+		height, err := strconv.ParseUint(args.Height, 10, 64)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+		block := handler.BlockChain.GetBlockByNumber(height)
+		if block == nil {
+			return xfsgo.NewRPCError(-1006, "Not found block")
+		}
+		header = block.Header
+	}
+	var (
+		tx   *xfsgo.Transaction
+		from common.Address
+		err  error
+	)
+	if args.Raw != "" {
+		databytes, err := base64.StdEncoding.DecodeString(args.Raw)
+		if err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, fmt.Errorf("failed to parse raw: %s", err))
+		}
+		rawtx := &StringRawTransaction{}
+		if err = json.Unmarshal(databytes, rawtx); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, fmt.Errorf("failed to parse raw: %s", err))
+		}
+		if tx, err = CoverTransaction(rawtx); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+		if from, err = tx.FromAddr(); err != nil {
+			return xfsgo.NewRPCErrorCause(-32001, err)
+		}
+	} else {
+		var stdTx *xfsgo.StdTransaction
+		from, stdTx, err = parseCallTransaction(args.EstimateGasArgs, header.GasLimit)
+		if err != nil {
+			return err
+		}
+		if args.Nonce != "" {
+			if stdTx.Nonce, err = strconv.ParseUint(args.Nonce, 10, 64); err != nil {
+				return xfsgo.ParamsParseError("Parse param 'nonce' error: %s", err)
+			}
+		} else {
+			stateTree, err := handler.BlockChain.StateTreeAt(header)
+			if err != nil {
+				return xfsgo.LoadStateTreeError("Load status tree error: %s", err)
+			}
+			stdTx.Nonce = stateTree.GetNonce(from)
+		}
+		tx = xfsgo.NewTransactionByStd(stdTx)
+	}
+	rec, events, diffs, err := handler.BlockChain.SimulateTransaction(header, from, tx)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	result := &SimulateTransactionResp{
+		Receipt: &ReceiptResp{
+			Version:     rec.Version,
+			Status:      rec.Status,
+			TxHash:      rec.TxHash,
+			GasUsed:     rec.GasUsed.Text(10),
+			BlockHeight: header.Height + 1,
+			Logs:        rec.Logs,
+		},
+		GasUsed: rec.GasUsed.Text(10),
+		Events:  make([]*SimulateEventResp, 0),
+		Diff:    make([]*AccountDiffResp, 0),
+	}
+	for _, event := range events {
+		result.Events = append(result.Events, &SimulateEventResp{
+			EventHash:  event.Hash,
+			EventValue: common.BytesToHexString(event.Value),
+			Address:    event.Address,
+		})
+	}
+	for _, diff := range diffs {
+		item := &AccountDiffResp{
+			Address:       diff.Address,
+			BalanceBefore: diff.BalanceBefore.Text(10),
+			BalanceAfter:  diff.BalanceAfter.Text(10),
+			NonceBefore:   diff.NonceBefore,
+			NonceAfter:    diff.NonceAfter,
+			Storage:       make([]*StorageDiffResp, 0),
+		}
+		for _, slot := range diff.Storage {
+			item.Storage = append(item.Storage, &StorageDiffResp{
+				Key:    slot.Key,
+				Before: common.BytesToHexString(slot.Before),
+				After:  common.BytesToHexString(slot.After),
+			})
+		}
+		result.Diff = append(result.Diff, item)
+	}
+	*resp = result
+	return nil
+}
+
 // Syncing returns false in case the node is currently not syncing with the network. It can be up to date or has not
 // yet received the latest block headers from its pears. In case it is synchronizing:
 // - startingBlock: block number this node started to synchronise from
@@ -295,6 +553,20 @@ func (handler *ChainAPIHandler) GetSyncStatus(_ EmptyArgs, resp **ChainStatusRes
 	result.StartingBlock = new(big.Int).SetUint64(origin).Text(10)
 	result.CurrentBlock = new(big.Int).SetUint64(current).Text(10)
 	result.HighestBlock = new(big.Int).SetUint64(height).Text(10)
+	if cp := handler.BlockChain.LastCheckpoint(); cp != nil {
+		result.LastCheckpoint = &CheckpointResp{
+			Height: cp.Height,
+			Hash:   cp.Hash,
+		}
+	}
+	if progress := handler.BlockChain.StateSyncProgress(); progress != nil {
+		result.StateSync = &StateSyncResp{
+			Pivot:        progress.Pivot,
+			PivotHash:    progress.PivotHash,
+			NodesDone:    progress.NodesDone,
+			NodesPending: progress.NodesPending,
+		}
+	}
 
 	*resp = result
 
@@ -15,3 +15,13 @@ func errorcase(err error) error {
 	}
 	return nil
 }
+
+// requireFullState refuses the calls reading the state beyond accounts on a
+// light chain, which retrieves accounts with their proofs only, and the calls
+// to the miner and transaction pool a light node does not run.
+func requireFullState(chain *xfsgo.BlockChain) error {
+	if chain.IsLight() {
+		return xfsgo.LoadStateTreeError("Not supported by a light node, which does not keep the contract state")
+	}
+	return nil
+}
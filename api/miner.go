@@ -27,7 +27,8 @@ import (
 )
 
 type MinerAPIHandler struct {
-	Miner *miner.Miner
+	Miner      *miner.Miner
+	BlockChain *xfsgo.BlockChain
 }
 
 // type MinerSetGasLimitArgs struct {
@@ -47,6 +48,9 @@ type MinerSetWorkerArgs struct {
 }
 
 func (handler *MinerAPIHandler) Start(args MinerStartArgs, resp **string) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	num, err := strconv.ParseUint(args.Num, 10, 32)
 	if err != nil {
 		return errorcase(err)
@@ -57,11 +61,17 @@ func (handler *MinerAPIHandler) Start(args MinerStartArgs, resp **string) error
 }
 
 func (handler *MinerAPIHandler) Stop(_ EmptyArgs, resp **string) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	handler.Miner.Stop()
 	return nil
 }
 
 func (handler *MinerAPIHandler) SetWorkers(args MinerSetWorkerArgs, resp **string) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	var err error
 	var num int64
 	if num, err = strconv.ParseInt(args.Num, 10, 64); err != nil {
@@ -71,6 +81,9 @@ func (handler *MinerAPIHandler) SetWorkers(args MinerSetWorkerArgs, resp **strin
 }
 
 func (handler *MinerAPIHandler) SetGasPrice(args MinerSetGasPriceArgs, resp **string) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	gaspriceBig, ok := new(big.Int).SetString(args.Value, 10)
 	if !ok {
 		return xfsgo.NewRPCError(-1006, "string to big.Int error")
@@ -88,6 +101,9 @@ func (handler *MinerAPIHandler) SetGasPrice(args MinerSetGasPriceArgs, resp **st
 // }
 
 func (handler *MinerAPIHandler) Status(_ EmptyArgs, resp **MinerStatusResp) error {
+	if err := requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	mMiner := handler.Miner
 	gasLimit := handler.Miner.GetGasLimit()
 	gasPrice := handler.Miner.GetGasPrice()
@@ -108,7 +124,26 @@ func (handler *MinerAPIHandler) Status(_ EmptyArgs, resp **MinerStatusResp) erro
 		Coinbase:         MinCoinbase.B58String(),
 		HashRate:         fmt.Sprintf("%.2f", float64(hashRate)),
 		Workers:          strconv.Itoa(int(MinWorkers)),
+		Policy:           coverPolicyStatus2Resp(mMiner.GetPolicy().Status()),
 	}
 	*resp = result
 	return nil
 }
+
+func coverPolicyStatus2Resp(status *miner.PolicyStatus) *MinerPolicyResp {
+	bigText := func(n *big.Int) string {
+		if n == nil {
+			return ""
+		}
+		return n.Text(10)
+	}
+	return &MinerPolicyResp{
+		Name:                 status.Name,
+		MinGasPrice:          bigText(status.MinGasPrice),
+		BlacklistedSenders:   status.BlacklistedSenders,
+		BlacklistedContracts: status.BlacklistedContracts,
+		LocalSenders:         status.LocalSenders,
+		ReservedGas:          bigText(status.ReservedGas),
+		TargetGasLimit:       bigText(status.TargetGasLimit),
+	}
+}
@@ -1,13 +1,71 @@
 package api
 
 import (
+	"sort"
+	"time"
 	"xfsgo"
+	"xfsgo/common"
 	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
 )
 
 type NetAPIHandler struct {
 	NetServer p2p.Server
+	SyncState PeerSyncReader
+}
+
+// PeerSyncState is the chain sync state of a peer known to the backend.
+type PeerSyncState struct {
+	Version uint32
+	Head    common.Hash
+	Height  uint64
+	// SyncRate is the blocks per second imported in the last sync from the peer.
+	SyncRate float64
+}
+
+// PeerSyncReader provides the sync state of the connected peers.
+type PeerSyncReader interface {
+	PeerSyncState(id discover.NodeId) *PeerSyncState
+}
+
+type MessageTrafficResp struct {
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+	MsgsIn   uint64 `json:"msgs_in"`
+	MsgsOut  uint64 `json:"msgs_out"`
+}
+
+type PeerInfoResp struct {
+	Id              string                                   `json:"id"`
+	RemoteAddr      string                                   `json:"remote_addr"`
+	Inbound         bool                                     `json:"inbound"`
+	Outbound        bool                                     `json:"outbound"`
+	Static          bool                                     `json:"static"`
+	Dynamic         bool                                     `json:"dynamic"`
+	P2PVersion      uint8                                    `json:"p2p_version"`
+	ProtocolVersion uint32                                   `json:"protocol_version"`
+	Protocols       []string                                 `json:"protocols"`
+	Head            *common.Hash                             `json:"head"`
+	Height          uint64                                   `json:"height"`
+	ConnectedSince  int64                                    `json:"connected_since"`
+	Traffic         map[string]map[uint8]*MessageTrafficResp `json:"traffic"`
+	SyncRate        float64                                  `json:"sync_rate"`
+}
+
+type PeerSlotsResp struct {
+	MaxPeers   int `json:"max_peers"`
+	MaxInbound int `json:"max_inbound"`
+	MaxDialed  int `json:"max_dialed"`
+	MaxPending int `json:"max_pending"`
+	Peers      int `json:"peers"`
+	Inbound    int `json:"inbound"`
+	Outbound   int `json:"outbound"`
+	Pending    int `json:"pending"`
+}
+
+type PeersInfoResp struct {
+	Slots *PeerSlotsResp  `json:"slots"`
+	Peers []*PeerInfoResp `json:"peers"`
 }
 
 type AddPeerArgs struct {
@@ -18,6 +76,16 @@ type DelPeerArgs struct {
 	Id string `json:"id"`
 }
 
+type BanPeerArgs struct {
+	Id string `json:"id"`
+	// Duration of the ban in seconds, the default of the server if zero.
+	Duration int64 `json:"duration"`
+}
+
+type UnbanPeerArgs struct {
+	Id string `json:"id"`
+}
+
 func (net *NetAPIHandler) GetPeers(_ EmptyArgs, resp *[]string) error {
 	peer := net.NetServer.Peers()
 	peersid := make([]string, 0)
@@ -28,6 +96,64 @@ func (net *NetAPIHandler) GetPeers(_ EmptyArgs, resp *[]string) error {
 	return nil
 }
 
+func (net *NetAPIHandler) GetPeersInfo(_ EmptyArgs, resp **PeersInfoResp) error {
+	infos := net.NetServer.PeersInfo()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	result := make([]*PeerInfoResp, 0, len(infos))
+	for _, info := range infos {
+		item := &PeerInfoResp{
+			Id:             info.ID.String(),
+			RemoteAddr:     info.RemoteAddr,
+			Inbound:        info.Inbound,
+			Outbound:       info.Outbound,
+			Static:         info.Static,
+			Dynamic:        info.Dynamic,
+			P2PVersion:     info.Version,
+			Protocols:      info.Protocols,
+			ConnectedSince: info.ConnectedAt.Unix(),
+			Traffic:        make(map[string]map[uint8]*MessageTrafficResp),
+		}
+		for name, traffic := range info.Traffic {
+			item.Traffic[name] = make(map[uint8]*MessageTrafficResp)
+			for code, stats := range traffic {
+				item.Traffic[name][code] = &MessageTrafficResp{
+					BytesIn:  stats.BytesIn,
+					BytesOut: stats.BytesOut,
+					MsgsIn:   stats.MsgsIn,
+					MsgsOut:  stats.MsgsOut,
+				}
+			}
+		}
+		if net.SyncState != nil {
+			if state := net.SyncState.PeerSyncState(info.ID); state != nil {
+				head := state.Head
+				item.ProtocolVersion = state.Version
+				item.Head = &head
+				item.Height = state.Height
+				item.SyncRate = state.SyncRate
+			}
+		}
+		result = append(result, item)
+	}
+	slots := net.NetServer.Slots()
+	*resp = &PeersInfoResp{
+		Slots: &PeerSlotsResp{
+			MaxPeers:   slots.MaxPeers,
+			MaxInbound: slots.MaxInbound,
+			MaxDialed:  slots.MaxDialed,
+			MaxPending: slots.MaxPending,
+			Peers:      slots.Peers,
+			Inbound:    slots.Inbound,
+			Outbound:   slots.Outbound,
+			Pending:    slots.Pending,
+		},
+		Peers: result,
+	}
+	return nil
+}
+
 func (net *NetAPIHandler) AddPeer(args AddPeerArgs, resp **string) error {
 	if args.Url == "" {
 		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
@@ -57,3 +183,63 @@ func (net *NetAPIHandler) GetNodeId(_ EmptyArgs, resp **string) error {
 	*resp = &nodeid
 	return nil
 }
+
+func (net *NetAPIHandler) GetPeerScores(_ EmptyArgs, resp *map[string]int) error {
+	scores := make(map[string]int)
+	for id, score := range net.NetServer.PeerScores() {
+		scores[id.String()] = score
+	}
+	*resp = scores
+	return nil
+}
+
+func (net *NetAPIHandler) BanPeer(args BanPeerArgs, resp **interface{}) error {
+	if args.Id == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	if args.Duration < 0 {
+		return xfsgo.NewRPCError(-1006, "Duration cannot be negative")
+	}
+	nodeid, err := discover.Hex2NodeId(args.Id)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	net.NetServer.BanPeer(nodeid, time.Duration(args.Duration)*time.Second)
+	return nil
+}
+
+func (net *NetAPIHandler) UnbanPeer(args UnbanPeerArgs, resp **interface{}) error {
+	if args.Id == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	nodeid, err := discover.Hex2NodeId(args.Id)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	net.NetServer.UnbanPeer(nodeid)
+	return nil
+}
+
+func (net *NetAPIHandler) AddTrustedPeer(args AddPeerArgs, resp **interface{}) error {
+	if args.Url == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	node, err := discover.ParseNode(args.Url)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	net.NetServer.AddTrustedPeer(node)
+	return nil
+}
+
+func (net *NetAPIHandler) RemoveTrustedPeer(args DelPeerArgs, resp **interface{}) error {
+	if args.Id == "" {
+		return xfsgo.NewRPCError(-1006, "Parameter cannot be empty")
+	}
+	nodeid, err := discover.Hex2NodeId(args.Id)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	net.NetServer.RemoveTrustedPeer(nodeid)
+	return nil
+}
@@ -65,10 +65,15 @@ func (state *StateAPIHandler) GetBalance(args GetBalanceArgs, resp *string) erro
 
 	rootHashByte := rootHash.Bytes()
 
-	stateTree := xfsgo.NewStateTree(state.StateDb, rootHashByte)
-
 	address := common.B58ToAddress([]byte(args.Address))
 
+	// a light chain fetches the account from its peers first.
+	if err := state.BlockChain.RetrieveAccount(rootHash, address); err != nil {
+		return xfsgo.LoadStateTreeError("Retrieve account error: %s", err)
+	}
+
+	stateTree := xfsgo.NewStateTree(state.StateDb, rootHashByte)
+
 	data := stateTree.GetStateObj(address)
 
 	if data == (&xfsgo.StateObj{}) || data == nil || data.GetBalance() == nil {
@@ -100,15 +105,22 @@ func (state *StateAPIHandler) GetAccount(args GetAccountArgs, resp **StateObjRes
 		return xfsgo.NewRPCErrorCause(-32001, err)
 	}
 
-	stateTree := xfsgo.NewStateTree(state.StateDb, statehash)
-
 	address := common.B58ToAddress([]byte(args.Address))
 
+	if err := state.BlockChain.RetrieveAccount(common.Bytes2Hash(statehash), address); err != nil {
+		return xfsgo.LoadStateTreeError("Retrieve account error: %s", err)
+	}
+
+	stateTree := xfsgo.NewStateTree(state.StateDb, statehash)
+
 	data := stateTree.GetStateObj(address)
 	return coverState2Resp(data, resp)
 }
 
 func (state *StateAPIHandler) GetStorageAt(args GetStorageAtArgs, resp **string) error {
+	if err := requireFullState(state.BlockChain); err != nil {
+		return err
+	}
 	currentHeader := state.BlockChain.CurrentBHeader()
 	stateRoot := currentHeader.StateRoot
 	var err error
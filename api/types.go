@@ -55,6 +55,7 @@ type BlockHeaderResp struct {
 	Nonce      uint32      `json:"nonce"`
 	ExtraNonce string      `json:"extranonce"`
 	Hash       common.Hash `json:"hash"`
+	TotalWork  string      `json:"total_work"`
 }
 
 type BlockResp struct {
@@ -95,16 +96,27 @@ type MinerStartArgs struct {
 }
 
 type MinerStatusResp struct {
-	Status           bool   `json:"status"`
-	LastStartTime    string `json:"last_start_time"`
-	Workers          string `json:"workers"`
-	Coinbase         string `json:"coinbase"`
-	GasPrice         string `json:"gas_price"`
-	GasLimit         string `json:"gas_limit"`
-	TargetHeight     string `json:"target_height"`
-	TargetDifficulty string `json:"target_difficulty"`
-	TargetHashRate   string `json:"target_hash_rate"`
-	HashRate         string `json:"hash_rate"`
+	Status           bool             `json:"status"`
+	LastStartTime    string           `json:"last_start_time"`
+	Workers          string           `json:"workers"`
+	Coinbase         string           `json:"coinbase"`
+	GasPrice         string           `json:"gas_price"`
+	GasLimit         string           `json:"gas_limit"`
+	TargetHeight     string           `json:"target_height"`
+	TargetDifficulty string           `json:"target_difficulty"`
+	TargetHashRate   string           `json:"target_hash_rate"`
+	HashRate         string           `json:"hash_rate"`
+	Policy           *MinerPolicyResp `json:"policy"`
+}
+
+type MinerPolicyResp struct {
+	Name                 string `json:"name"`
+	MinGasPrice          string `json:"min_gas_price"`
+	BlacklistedSenders   int    `json:"blacklisted_senders"`
+	BlacklistedContracts int    `json:"blacklisted_contracts"`
+	LocalSenders         int    `json:"local_senders"`
+	ReservedGas          string `json:"reserved_gas"`
+	TargetGasLimit       string `json:"target_gas_limit"`
 }
 
 type ReceiptResp struct {
@@ -120,10 +132,25 @@ type ReceiptResp struct {
 }
 
 type ChainStatusResp struct {
-	Status        bool   `json:"status"`
-	CurrentBlock  string `json:"current_block"`
-	HighestBlock  string `json:"highest_block"`
-	StartingBlock string `json:"starting_block"`
+	Status         bool            `json:"status"`
+	CurrentBlock   string          `json:"current_block"`
+	HighestBlock   string          `json:"highest_block"`
+	StartingBlock  string          `json:"starting_block"`
+	LastCheckpoint *CheckpointResp `json:"last_checkpoint"`
+	StateSync      *StateSyncResp  `json:"state_sync"`
+}
+
+// StateSyncResp is the progress of the state download of a fast sync.
+type StateSyncResp struct {
+	Pivot        uint64      `json:"pivot"`
+	PivotHash    common.Hash `json:"pivot_hash"`
+	NodesDone    uint64      `json:"nodes_done"`
+	NodesPending uint64      `json:"nodes_pending"`
+}
+
+type CheckpointResp struct {
+	Height uint64      `json:"height"`
+	Hash   common.Hash `json:"hash"`
 }
 
 // type GetBlockChains []*xfsgo.Block
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"fmt"
+	"math/big"
 	"xfsgo"
 	"xfsgo/common"
 	"xfsgo/storage/badger"
@@ -19,6 +21,9 @@ type VMCallData struct {
 }
 
 func (v *VMHandler) Call(args VMCallData, result **string) error {
+	if err := requireFullState(v.Chain); err != nil {
+		return err
+	}
 	currentHeader := v.Chain.CurrentBHeader()
 	stateRoot := currentHeader.StateRoot
 	var err error
@@ -29,7 +34,10 @@ func (v *VMHandler) Call(args VMCallData, result **string) error {
 	if err != nil {
 		return xfsgo.LoadStateTreeError("Load status tree error: %s, from: %x", err, stateTree)
 	}
-	vmo := vm.NewXVM(stateTree)
+	config := v.Chain.Config()
+	vmo := vm.NewXVMWithForks(stateTree, func(name string) bool {
+		return config.IsForkActive(name, currentHeader.Height+1)
+	})
 	var fromAddress common.Address
 	if args.From != "" {
 		fromAddress = common.StrB58ToAddress(args.From)
@@ -59,3 +67,91 @@ func (v *VMHandler) Call(args VMCallData, result **string) error {
 	*result = &resultstring
 	return nil
 }
+
+type EstimateGasArgs struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Data     string `json:"data"`
+	GasLimit string `json:"gas_limit"`
+	GasPrice string `json:"gas_price"`
+}
+
+// parseCallTransaction builds an unsigned transaction from args, gasLimit is
+// used when args does not specify one. The nonce is left for the caller to fill.
+func parseCallTransaction(args EstimateGasArgs, gasLimit *big.Int) (common.Address, *xfsgo.StdTransaction, error) {
+	var fromAddress common.Address
+	if args.From == "" {
+		return fromAddress, nil, xfsgo.RequireParamError("Require param 'from'")
+	}
+	if err := common.AddrCalibrator(args.From); err != nil {
+		return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'from' error: %s", err)
+	}
+	fromAddress = common.StrB58ToAddress(args.From)
+	stdTx := &xfsgo.StdTransaction{
+		GasLimit: gasLimit,
+		GasPrice: new(big.Int),
+		Value:    new(big.Int),
+	}
+	if args.To != "" {
+		if err := common.AddrCalibrator(args.To); err != nil {
+			return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'to' error: %s", err)
+		}
+		stdTx.To = common.StrB58ToAddress(args.To)
+	}
+	var ok bool
+	if args.Value != "" {
+		if stdTx.Value, ok = new(big.Int).SetString(args.Value, 10); !ok {
+			return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'value' error")
+		}
+	}
+	if args.GasLimit != "" {
+		if stdTx.GasLimit, ok = new(big.Int).SetString(args.GasLimit, 10); !ok {
+			return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'gas_limit' error")
+		}
+	}
+	if args.GasPrice != "" {
+		if stdTx.GasPrice, ok = new(big.Int).SetString(args.GasPrice, 10); !ok {
+			return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'gas_price' error")
+		}
+	}
+	if args.Data != "" {
+		data, err := common.HexToBytes(args.Data)
+		if err != nil {
+			return fromAddress, nil, xfsgo.ParamsParseError("Parse param 'data' error: %s", err)
+		}
+		stdTx.Data = data
+	}
+	if args.To == "" && len(stdTx.Data) == 0 {
+		return fromAddress, nil, xfsgo.RequireParamError("Require param 'to' or 'data'")
+	}
+	return fromAddress, stdTx, nil
+}
+
+// EstimateGas dry-runs the transaction on top of the current head state
+// and returns the amount of gas it used. The transaction runs with the gas
+// limit given, the block gas limit by default, so the estimate is the gas
+// used at that limit rather than the minimal limit that succeeds. A
+// transaction that fails at that limit returns an error.
+func (v *VMHandler) EstimateGas(args EstimateGasArgs, result *string) error {
+	if err := requireFullState(v.Chain); err != nil {
+		return err
+	}
+	header := v.Chain.CurrentBHeader()
+	fromAddress, stdTx, err := parseCallTransaction(args, header.GasLimit)
+	if err != nil {
+		return err
+	}
+	stdTx.Nonce = v.Chain.GetNonce(fromAddress)
+	tx := xfsgo.NewTransactionByStd(stdTx)
+	rec, _, _, err := v.Chain.DryRunTransaction(header, fromAddress, tx)
+	if err != nil {
+		return xfsgo.NewRPCErrorCause(-32001, err)
+	}
+	if rec.Status == 0 {
+		return xfsgo.NewRPCError(-32001, fmt.Sprintf("Transaction execution failed with gas limit %s", stdTx.GasLimit))
+	}
+	gas := rec.GasUsed.Text(10)
+	*result = gas
+	return nil
+}
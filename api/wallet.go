@@ -192,6 +192,9 @@ func (handler *WalletHandler) SendTransaction(args SendTransactionArgs, resp **s
 		err   error
 		stdTx = new(xfsgo.StdTransaction)
 	)
+	if err = requireFullState(handler.BlockChain); err != nil {
+		return err
+	}
 	// Judgment target address cannot be empty
 	if args.To == "" {
 		return xfsgo.NewRPCError(-1006, "to addr not be empty")
@@ -0,0 +1,136 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package avlmerkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+)
+
+var (
+	ErrInvalidProof = errors.New("invalid tree proof")
+)
+
+// Prove returns the encoded nodes a lookup of k walks through: the nodes on
+// the path from the root to the leaf k ends at, and the left children k is
+// compared with on the way. They prove the value of k or its absence.
+func (t *Tree) Prove(k []byte) ([][]byte, error) {
+	proof := make([][]byte, 0)
+	add := func(n *TreeNode) error {
+		data, err := n.Encode()
+		if err != nil {
+			return err
+		}
+		proof = append(proof, data)
+		return nil
+	}
+	for n := t.root; n != nil; {
+		if err := add(n); err != nil {
+			return nil, err
+		}
+		if n.isLeaf() {
+			break
+		}
+		left, err := t.loadLeft(n)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(k, left.key) <= common.Zero {
+			n = left
+			continue
+		}
+		if err = add(left); err != nil {
+			return nil, err
+		}
+		if n, err = t.loadRight(n); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// VerifyProof looks k up in the tree of root using only the nodes of proof.
+// It returns the value of k and whether k is in the tree, or ErrInvalidProof
+// if the lookup needs a node the proof does not hold.
+func VerifyProof(root, k []byte, proof [][]byte) ([]byte, bool, error) {
+	var zero [32]byte
+	if len(root) == 0 || bytes.Equal(root, zero[:]) {
+		return nil, false, nil
+	}
+	nodes := make(map[[32]byte]*TreeNode, len(proof))
+	for _, data := range proof {
+		n := &TreeNode{}
+		if err := n.Decode(data); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+		}
+		var id [32]byte
+		copy(id[:], n.id)
+		nodes[id] = n
+	}
+	get := func(id []byte) (*TreeNode, error) {
+		var key [32]byte
+		copy(key[:], id)
+		if n, exists := nodes[key]; exists {
+			return n, nil
+		}
+		return nil, fmt.Errorf("%w: missing node %x", ErrInvalidProof, id)
+	}
+	n, err := get(root)
+	if err != nil {
+		return nil, false, err
+	}
+	for !n.isLeaf() {
+		left, err := get(n.left)
+		if err != nil {
+			return nil, false, err
+		}
+		if bytes.Compare(k, left.key) <= common.Zero {
+			n = left
+			continue
+		}
+		if n, err = get(n.right); err != nil {
+			return nil, false, err
+		}
+	}
+	if !bytes.Equal(k, n.key) {
+		return nil, false, nil
+	}
+	return n.value, true, nil
+}
+
+// WriteProof stores the nodes of a verified proof in db, so that a tree
+// opened on db can look up the key proven. The tree is partial: looking up
+// another key may need nodes db does not hold.
+func WriteProof(db badger.IStorage, proof [][]byte) error {
+	for _, data := range proof {
+		n := &TreeNode{}
+		if err := n.Decode(data); err != nil {
+			return err
+		}
+		enc, err := n.Encode()
+		if err != nil {
+			return err
+		}
+		if err = db.SetData(append([]byte("tree:"), n.id...), enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package avlmerkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"xfsgo/test"
+)
+
+func TestTree_Prove(t *testing.T) {
+	src := NewTree(nil, nil)
+	for i := 0; i < 100; i++ {
+		src.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	root := src.Checksum()
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%02d", i))
+		proof, err := src.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := VerifyProof(root, key, proof)
+		if err != nil || !ok || !bytes.Equal(got, []byte(fmt.Sprintf("value%d", i))) {
+			t.Fatalf("key%02d: got %q, %v, %v", i, got, ok, err)
+		}
+		// The partial tree written from the proof can look the key up.
+		db := test.NewMemStorage()
+		if err = WriteProof(db, proof); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok = NewTree(db, root).Get(key); !ok || !bytes.Equal(got, []byte(fmt.Sprintf("value%d", i))) {
+			t.Fatalf("key%02d: got %q from proof db", i, got)
+		}
+	}
+	missing := []byte("key50a")
+	proof, err := src.Prove(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := VerifyProof(root, missing, proof); err != nil || ok {
+		t.Fatalf("want absent key proven, got %v, %v", ok, err)
+	}
+	// A proof missing a node on the path does not verify.
+	proof, _ = src.Prove([]byte("key10"))
+	if _, _, err = VerifyProof(root, []byte("key10"), proof[:len(proof)-1]); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("want err %v, got %v", ErrInvalidProof, err)
+	}
+	// A proof of another tree does not verify against root.
+	other := NewTree(nil, nil)
+	other.Put([]byte("key10"), []byte("forged"))
+	proof, _ = other.Prove([]byte("key10"))
+	if _, _, err = VerifyProof(root, []byte("key10"), proof); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("want err %v, got %v", ErrInvalidProof, err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package avlmerkle
+
+import (
+	"bytes"
+	"errors"
+	"xfsgo/common/ahash"
+	"xfsgo/storage/badger"
+)
+
+var (
+	errUnrequestedNode = errors.New("unrequested tree node")
+)
+
+// ReadNodeData returns the encoded tree node of id stored in db.
+func ReadNodeData(db badger.IStorage, id []byte) ([]byte, error) {
+	return db.GetData(append([]byte("tree:"), id...))
+}
+
+func hasNode(db badger.IStorage, id []byte) bool {
+	data, err := ReadNodeData(db, id)
+	return err == nil && len(data) > 0
+}
+
+// syncRequest is a node being downloaded, it is written to the db once
+// all the nodes below it are, so that a stored node always roots a
+// complete subtree. A node shared by several trees, such as the storage
+// trees of two contracts with the same storage, has several parents.
+type syncRequest struct {
+	id      [32]byte
+	data    []byte
+	parents []*syncRequest
+	deps    int
+}
+
+// LeafCallback returns the roots of the trees the value of a leaf refers
+// to, which are downloaded along with the tree of the leaf.
+type LeafCallback func(value []byte) [][]byte
+
+// TreeSync downloads the tree of a root from remote peers node by node,
+// verifying each node against the hash its parent refers to it by.
+type TreeSync struct {
+	db       badger.IStorage
+	queue    []*syncRequest
+	pending  map[[32]byte]*syncRequest
+	requests map[[32]byte]*syncRequest
+	done     uint64
+	onLeaf   LeafCallback
+}
+
+// NewTreeSync creates a download of the tree of root into db, nothing is
+// fetched if root is already stored. The trees onLeaf returns for the
+// leaves are downloaded too, a leaf is stored once they are complete. The
+// root is thus only stored when all the trees below it are.
+func NewTreeSync(db badger.IStorage, root []byte, onLeaf LeafCallback) *TreeSync {
+	s := &TreeSync{
+		db:       db,
+		pending:  make(map[[32]byte]*syncRequest),
+		requests: make(map[[32]byte]*syncRequest),
+		onLeaf:   onLeaf,
+	}
+	s.schedule(root, nil)
+	return s
+}
+
+// schedule requests the node of id below parent unless there is no such
+// node or it is stored, and reports whether parent has to wait for it.
+func (s *TreeSync) schedule(id []byte, parent *syncRequest) bool {
+	var zero [32]byte
+	if len(id) != 32 || bytes.Equal(id, zero[:]) || hasNode(s.db, id) {
+		return false
+	}
+	var key [32]byte
+	copy(key[:], id)
+	req, ok := s.requests[key]
+	if !ok {
+		req = &syncRequest{id: key}
+		s.requests[key] = req
+		s.queue = append(s.queue, req)
+	}
+	if parent != nil {
+		req.parents = append(req.parents, parent)
+	}
+	return true
+}
+
+// Missing returns the ids of at most max nodes to fetch next and marks
+// them requested. The tree is walked depth first to keep few nodes waiting
+// for their children.
+func (s *TreeSync) Missing(max int) [][]byte {
+	ids := make([][]byte, 0, max)
+	for len(ids) < max && len(s.queue) > 0 {
+		req := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.pending[req.id] = req
+		ids = append(ids, append([]byte{}, req.id[:]...))
+	}
+	return ids
+}
+
+// Retry schedules requested nodes which were not delivered to be fetched again.
+func (s *TreeSync) Retry(ids [][]byte) {
+	for _, id := range ids {
+		var key [32]byte
+		copy(key[:], id)
+		if req, ok := s.pending[key]; ok && req.data == nil {
+			delete(s.pending, key)
+			s.queue = append(s.queue, req)
+		}
+	}
+}
+
+// Process verifies the data of a requested node, and schedules the nodes
+// below it which are not stored yet, or the roots its value refers to for
+// a leaf.
+func (s *TreeSync) Process(data []byte) error {
+	var id [32]byte
+	copy(id[:], ahash.SHA256(data))
+	req, ok := s.pending[id]
+	if !ok || req.data != nil {
+		return errUnrequestedNode
+	}
+	node := &TreeNode{}
+	if err := node.Decode(data); err != nil {
+		return err
+	}
+	req.data = data
+	children := [][]byte{node.left, node.right}
+	if node.isLeaf() {
+		children = nil
+		if s.onLeaf != nil {
+			children = s.onLeaf(node.value)
+		}
+	}
+	for _, child := range children {
+		if s.schedule(child, req) {
+			req.deps++
+		}
+	}
+	if req.deps > 0 {
+		return nil
+	}
+	return s.commit(req)
+}
+
+// commit stores the node of req, and then the parents it completes.
+func (s *TreeSync) commit(req *syncRequest) error {
+	if err := s.db.SetData(append([]byte("tree:"), req.id[:]...), req.data); err != nil {
+		return err
+	}
+	delete(s.pending, req.id)
+	delete(s.requests, req.id)
+	s.done++
+	for _, parent := range req.parents {
+		if parent.deps--; parent.deps == 0 {
+			if err := s.commit(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of nodes not stored yet.
+func (s *TreeSync) Pending() int {
+	return len(s.requests)
+}
+
+// Done returns the number of nodes stored.
+func (s *TreeSync) Done() uint64 {
+	return s.done
+}
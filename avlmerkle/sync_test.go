@@ -0,0 +1,103 @@
+package avlmerkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"xfsgo/test"
+)
+
+func TestTreeSync(t *testing.T) {
+	src := NewTree(test.NewMemStorage(), nil)
+	for i := 0; i < 100; i++ {
+		src.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	nodes := make(map[string][]byte)
+	err := src.root.dfsCall(src, func(node *TreeNode) error {
+		data, err := node.Encode()
+		nodes[string(node.id)] = data
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := test.NewMemStorage()
+	s := NewTreeSync(db, src.Checksum(), nil)
+	if err = s.Process(nodes[string(src.Checksum())]); err != errUnrequestedNode {
+		t.Fatalf("want err %v, got %v", errUnrequestedNode, err)
+	}
+	for s.Pending() > 0 {
+		ids := s.Missing(16)
+		if len(ids) == 0 {
+			t.Fatalf("no nodes to fetch, %d pending", s.Pending())
+		}
+		for _, id := range ids {
+			if err = s.Process(nodes[string(id)]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if s.Done() != uint64(len(nodes)) {
+		t.Fatalf("want %d nodes, got %d", len(nodes), s.Done())
+	}
+	dst, err := NewTreeN(db, src.Checksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		got, ok := dst.Get([]byte(fmt.Sprintf("key%d", i)))
+		if !ok || !bytes.Equal(got, []byte(fmt.Sprintf("value%d", i))) {
+			t.Fatalf("key%d: got %q", i, got)
+		}
+	}
+	if NewTreeSync(db, src.Checksum(), nil).Pending() != 0 {
+		t.Fatalf("want nothing to fetch for a stored tree")
+	}
+}
+
+func TestTreeSync_leafTrees(t *testing.T) {
+	db := test.NewMemStorage()
+	sub := NewTree(db, nil)
+	sub.Put([]byte("key"), []byte("value"))
+	// Both leaves refer to the same tree.
+	src := NewTree(db, nil)
+	src.Put([]byte("a"), sub.Checksum())
+	src.Put([]byte("b"), sub.Checksum())
+	nodes := make(map[string][]byte)
+	for _, tree := range []*Tree{sub, src} {
+		err := tree.root.dfsCall(tree, func(node *TreeNode) error {
+			data, err := node.Encode()
+			nodes[string(node.id)] = data
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := test.NewMemStorage()
+	s := NewTreeSync(dst, src.Checksum(), func(value []byte) [][]byte {
+		return [][]byte{value}
+	})
+	for s.Pending() > 0 {
+		ids := s.Missing(1)
+		if len(ids) == 0 {
+			t.Fatalf("no nodes to fetch, %d pending", s.Pending())
+		}
+		if hasNode(dst, src.Checksum()) {
+			t.Fatalf("root stored before the trees below it")
+		}
+		if err := s.Process(nodes[string(ids[0])]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Done() != uint64(len(nodes)) {
+		t.Fatalf("want %d nodes, got %d", len(nodes), s.Done())
+	}
+	tree, err := NewTreeN(dst, sub.Checksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := tree.Get([]byte("key")); !ok || string(got) != "value" {
+		t.Fatalf("key: got %q", got)
+	}
+}
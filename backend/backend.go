@@ -23,10 +23,12 @@ import (
 	"os"
 	"time"
 	"xfsgo"
+	"xfsgo/api"
 	"xfsgo/common"
 	"xfsgo/miner"
 	"xfsgo/node"
 	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
 	"xfsgo/storage/badger"
 
 	"github.com/sirupsen/logrus"
@@ -48,6 +50,10 @@ type Backend struct {
 	eventBus   *xfsgo.EventBus
 	txPool     *xfsgo.TxPool
 	syncMgr    *syncMgr
+	// a light node runs the light client instead of the sync manager,
+	// a full node serves light clients besides.
+	lightServer *lightServer
+	lightClient *lightClient
 }
 
 type Params struct {
@@ -55,12 +61,16 @@ type Params struct {
 	ProtocolConfig *ProtocolConfig
 	MinerConfig    *MinerConfig
 	TxPoolConfig   *TxPoolConfig
+	Checkpoints    []xfsgo.Checkpoint
+	SyncMode       SyncMode
+	Light          bool
 }
 
 type MinerConfig struct {
 	MinGasPrice *big.Int
 	Numworkers  uint32
 	Coinbase    common.Address
+	Policy      *miner.PolicyConfig
 }
 
 type TxPoolConfig struct {
@@ -86,10 +96,20 @@ type Config struct {
 	LogsDB  *badger.Storage
 }
 
+// chainSyncProtocol syncs blocks and transactions with the full nodes,
+// light clients do not offer it.
 type chainSyncProtocol struct {
 	syncMgr *syncMgr
 }
 
+func (c *chainSyncProtocol) Name() string   { return discover.ProtocolFull }
+func (c *chainSyncProtocol) Version() uint8 { return fullProtocolVersion }
+func (c *chainSyncProtocol) Length() uint8  { return fullProtocolLength }
+
+func (c *chainSyncProtocol) MaxMessageSize(mType uint8) uint32 {
+	return syncMessageSize(mType)
+}
+
 func (c *chainSyncProtocol) Run(p p2p.Peer) error {
 	return c.syncMgr.onNewPeer(p)
 }
@@ -136,19 +156,55 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 	} else {
 		return nil, ErrInitialGenesis
 	}
-	if back.blockchain, err = xfsgo.NewBlockChainN(
-		back.config.StateDB, back.config.ChainDB,
-		back.config.ExtraDB, back.config.LogsDB,
-		back.eventBus, config.Debug); err != nil {
+	if config.Light {
+		back.blockchain, err = xfsgo.NewLightChain(
+			back.config.StateDB, back.config.ChainDB,
+			back.config.ExtraDB, back.config.LogsDB,
+			back.eventBus, config.Debug)
+	} else {
+		back.blockchain, err = xfsgo.NewBlockChainN(
+			back.config.StateDB, back.config.ChainDB,
+			back.config.ExtraDB, back.config.LogsDB,
+			back.eventBus, config.Debug)
+	}
+	if err != nil {
 		return nil, err
 	}
+	for _, cp := range config.Checkpoints {
+		if err = back.blockchain.AddCheckpoint(cp); err != nil {
+			return nil, err
+		}
+	}
 	back.wallet = xfsgo.NewWallet(back.config.KeysDB)
+	if config.Light {
+		// A light node keeps no state to check transactions or mine
+		// blocks against, it runs neither a transaction pool nor a miner.
+		if err = stack.RegisterBackend(
+			back.eventBus,
+			back.config.StateDB,
+			back.config.LogsDB,
+			back.blockchain,
+			nil,
+			back.wallet,
+			nil,
+			back); err != nil {
+			return nil, err
+		}
+		back.lightClient = newLightClient(protocolConfig.NetworkID, back.blockchain)
+		back.blockchain.SetLightBackend(back.lightClient)
+		back.p2pServer.Bind(back.lightClient)
+		if err = back.p2pServer.SetRecord(back.nodeRecord()); err != nil {
+			return nil, err
+		}
+		return back, nil
+	}
 
 	xfstxpoolconfig := &xfsgo.TxPoolConfig{
 		TxPoolMaxSize:    txpoolConfig.TxPoolMaxSize,
 		PriceBump:        txpoolConfig.PriceBump,
 		Lifetime:         time.Duration(txpoolConfig.Lifetime) * time.Hour,
 		EvictionInterval: time.Duration(txpoolConfig.EvictionInterval) * time.Minute,
+		TxVersionFn:      back.blockchain.NextProtocolVersion,
 	}
 
 	back.txPool = xfsgo.NewTxPool(
@@ -167,18 +223,24 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 			return nil, err
 		}
 	}
+	policy, err := miner.NewPolicy(minerLoadConfig.Policy)
+	if err != nil {
+		return nil, err
+	}
 	//constructs Miner instance.
 	minerconfig := &miner.Config{
 		Coinbase:   back.wallet.GetDefault(),
 		Numworkers: minerLoadConfig.Numworkers,
+		Policy:     policy,
 	}
+	gasLimit := back.blockchain.Config().BlockGasLimit
 	back.miner = miner.NewMiner(minerconfig,
 		back.config.LogsDB, back.config.StateDB, back.blockchain,
 		back.eventBus, back.txPool,
-		minerLoadConfig.MinGasPrice, common.TxPoolGasLimit)
+		minerLoadConfig.MinGasPrice, gasLimit)
 
-	logrus.Debugf("Initial miner: coinbase=%s, gasPrice=%s, gasLimit=%s",
-		minerconfig.Coinbase.B58String(), minerLoadConfig.MinGasPrice, common.TxPoolGasLimit)
+	logrus.Debugf("Initial miner: coinbase=%s, gasPrice=%s, gasLimit=%s, policy=%s",
+		minerconfig.Coinbase.B58String(), minerLoadConfig.MinGasPrice, gasLimit, policy.Name())
 	//Node resgisters apis of baclend on the node  for RPC service.
 	if err = stack.RegisterBackend(
 		back.eventBus,
@@ -187,23 +249,67 @@ func NewBackend(stack *node.Node, config *Config) (*Backend, error) {
 		back.blockchain,
 		back.miner,
 		back.wallet,
-		back.txPool); err != nil {
+		back.txPool,
+		back); err != nil {
 		return nil, err
 	}
 	back.syncMgr = newSyncMgr(
 		protocolConfig.ProtocolVersion, protocolConfig.NetworkID,
 		back.blockchain, back.eventBus, back.txPool)
+	back.syncMgr.mode = config.SyncMode
+	back.syncMgr.scorer = back.p2pServer
+	back.lightServer = newLightServer(protocolConfig.NetworkID, back.blockchain, back.eventBus)
 	back.p2pServer.Bind(&chainSyncProtocol{
 		syncMgr: back.syncMgr,
 	})
+	back.p2pServer.Bind(back.lightServer)
+	if err = back.p2pServer.SetRecord(back.nodeRecord()); err != nil {
+		return nil, err
+	}
 	return back, nil
 }
 
+// nodeRecord returns the record advertising the chain of the node and the
+// protocols it serves in discovery. Light clients serve none.
+func (b *Backend) nodeRecord() *discover.Record {
+	r := &discover.Record{
+		NetworkID: b.config.ProtocolConfig.NetworkID,
+		Genesis:   b.blockchain.GenesisBHeader().HeaderHash(),
+		Client:    xfsgo.VersionString(),
+	}
+	if b.lightClient == nil {
+		r.Protocols = []string{discover.ProtocolFull, discover.ProtocolLight, discover.ProtocolSnap}
+	}
+	return r
+}
+
 func (b *Backend) Start() error {
+	if b.lightClient != nil {
+		b.lightClient.Start()
+		return nil
+	}
 	b.syncMgr.Start()
+	b.lightServer.Start()
 	return nil
 }
 
+// PeerSyncState returns the sync state of a connected peer, nil if the
+// peer does not sync the chain with the node.
+func (b *Backend) PeerSyncState(id discover.NodeId) *api.PeerSyncState {
+	if b.lightClient != nil {
+		p := b.lightClient.peers.get(id)
+		if p == nil {
+			return nil
+		}
+		return &api.PeerSyncState{
+			Version: lightProtocolVersion,
+			Head:    p.Head(),
+			Height:  p.Height(),
+		}
+	}
+	return b.syncMgr.peerSyncState(id)
+}
+
 func (b *Backend) BlockChain() *xfsgo.BlockChain {
 	return b.blockchain
 }
@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyncMode is how a node catches up with the chain of its peers.
+type SyncMode string
+
+const (
+	// FullSync executes every block from the genesis block on.
+	FullSync SyncMode = "full"
+	// FastSync downloads the state at a recent pivot block and only
+	// executes the blocks after it.
+	FastSync SyncMode = "fast"
+)
+
+// fastSyncPivotGap is how far below the head of the peer the pivot is
+// chosen, so that the state at the pivot is still kept by the peers.
+var fastSyncPivotGap = uint64(64)
+
+// ParseSyncMode parses the name of a sync mode, empty names full.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case "":
+		return FullSync, nil
+	case FullSync, FastSync:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sync mode %q, want %s or %s", s, FullSync, FastSync)
+	}
+}
+
+// fastSync stores the chain of p up to pivot without executing it, while
+// the state tree at the pivot is downloaded from all peers. The pivot
+// becomes the head once both are complete.
+func (mgr *syncMgr) fastSync(p syncpeer, pivot uint64) error {
+	header, err := mgr.fetchPivot(p, pivot)
+	if err != nil {
+		return err
+	}
+	hash := header.HeaderHash()
+	logrus.Infof("Fast sync to pivot: height=%d, hash=%x, stateRoot=%x", pivot, hash[len(hash)-4:], header.StateRoot)
+	errc := make(chan error, 3)
+	go func() {
+		errc <- mgr.fetchHeaders(p, 1, pivot)
+	}()
+	go func() {
+		errc <- mgr.fetchBodies(1, p.ID(), mgr.chain.InsertFastBlock)
+	}()
+	go func() {
+		errc <- mgr.fetchState(header)
+	}()
+	for i := 0; i < 3; i++ {
+		if err = <-errc; err != nil {
+			mgr.cancel()
+			for ; i < 2; i++ {
+				<-errc
+			}
+			return err
+		}
+	}
+	// Bodies delivered last may still be queued for insertion.
+	mgr.processQueue(mgr.chain.InsertFastBlock)
+	return mgr.chain.CommitFastSync(hash)
+}
+
+// fetchPivot retrieves the header at pivot from p, the chain it belongs
+// to is verified once downloaded.
+func (mgr *syncMgr) fetchPivot(p syncpeer, pivot uint64) (*xfsgo.BlockHeader, error) {
+	pid := p.ID()
+	if err := p.RequestHeadersFromNumber(pivot, 1); err != nil {
+		return nil, err
+	}
+	timeout := time.After(timeoutTTL)
+	for {
+		select {
+		case <-mgr.cancelCh:
+			return nil, errCancelHeaderFetch
+		case <-timeout:
+			return nil, errTimeout
+		case pack := <-mgr.headerPackCh:
+			if pack.peerId != pid {
+				break
+			}
+			if len(pack.headers) != 1 {
+				return nil, errInvalidHeaders
+			}
+			var header *xfsgo.BlockHeader
+			if err := common.Objcopy(pack.headers[0], &header); err != nil || header == nil {
+				return nil, errInvalidHeaders
+			}
+			hash := header.HeaderHash()
+			if header.Height != pivot || hash != pack.headers[0].Hash {
+				return nil, errInvalidHeaders
+			}
+			if err := xfsgo.CheckProofOfWork(hash, header.Bits, mgr.chain.GenesisBHeader().Bits); err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidHeaders, err)
+			}
+			return header, nil
+		}
+	}
+}
+
+// nodeRequest is a batch of state tree nodes requested from a peer.
+type nodeRequest struct {
+	ids  [][]byte
+	time time.Time
+}
+
+// fetchState downloads the state tree of pivot from all the peers.
+func (mgr *syncMgr) fetchState(pivot *xfsgo.BlockHeader) error {
+	sched := mgr.chain.NewStateSync(pivot.StateRoot)
+	var (
+		pending = make(map[discover.NodeId]*nodeRequest)
+		useless = make(map[discover.NodeId]struct{})
+	)
+	report := func() {
+		mgr.chain.SetStateSyncProgress(&xfsgo.StateSyncProgress{
+			Pivot:        pivot.Height,
+			PivotHash:    pivot.HeaderHash(),
+			NodesDone:    sched.Done(),
+			NodesPending: uint64(sched.Pending()),
+		})
+	}
+	defer report()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	for sched.Pending() > 0 {
+		peers := mgr.peers.listAndShort()
+		for _, sp := range peers {
+			id := sp.ID()
+			if _, busy := pending[id]; busy {
+				continue
+			}
+			if _, bad := useless[id]; bad {
+				continue
+			}
+			ids := sched.Missing(maxNodesFetch)
+			if len(ids) == 0 {
+				break
+			}
+			hashes := make(RemoteHashes, 0, len(ids))
+			for _, nodeId := range ids {
+				hashes = append(hashes, common.Bytes2Hash(nodeId))
+			}
+			if err := sp.RequestNodeData(hashes); err != nil {
+				sched.Retry(ids)
+				continue
+			}
+			pending[id] = &nodeRequest{ids: ids, time: time.Now()}
+		}
+		if len(pending) == 0 && len(useless) >= len(peers) {
+			return errPeersUnavailable
+		}
+		select {
+		case <-mgr.cancelCh:
+			return errCancelStateFetch
+		case pack := <-mgr.nodeDataPackCh:
+			request := pending[pack.peerId]
+			if request == nil {
+				break
+			}
+			delete(pending, pack.peerId)
+			delivered := 0
+			for _, data := range pack.data {
+				if err := sched.Process(data); err == nil {
+					delivered++
+				}
+			}
+			sched.Retry(request.ids)
+			// Peers which no longer have the state are not asked again.
+			if delivered == 0 {
+				useless[pack.peerId] = struct{}{}
+			} else {
+				mgr.adjustScore(pack.peerId, scoreUseful)
+			}
+		case <-ticker.C:
+			for id, request := range pending {
+				if time.Since(request.time) > timeoutTTL {
+					mgr.adjustScore(id, scoreTimeout)
+					delete(pending, id)
+					sched.Retry(request.ids)
+					useless[id] = struct{}{}
+				}
+			}
+		}
+		if time.Since(lastReport) > time.Second {
+			report()
+			logrus.Infof("State sync in progress: pivot=%d, done=%d, pending=%d",
+				pivot.Height, sched.Done(), sched.Pending())
+			lastReport = time.Now()
+		}
+	}
+	return nil
+}
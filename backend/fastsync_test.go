@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/storage/badger"
+	"xfsgo/test"
+)
+
+// newTestFastSyncChain returns a chain from the easy test genesis block.
+func newTestFastSyncChain(t *testing.T) (*xfsgo.BlockChain, *xfsgo.Block, badger.IStorage) {
+	// Committing a state needs a write batch, which the memory storage
+	// lacks.
+	stateDb, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = stateDb.Close() })
+	chainDb := test.NewMemStorage()
+	genesis, err := xfsgo.WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 2147483680, "timestamp": "1000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := xfsgo.NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), xfsgo.NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, genesis, stateDb
+}
+
+func TestSyncMgr_fetchStateStorage(t *testing.T) {
+	src, genesis, srcDb := newTestFastSyncChain(t)
+	dst, _, _ := newTestFastSyncChain(t)
+
+	// The pivot state holds a contract with storage.
+	st, err := xfsgo.NewStateTreeN(srcDb, genesis.Header.StateRoot.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, key, value := common.Address{1}, [32]byte{2}, []byte("value")
+	st.AddBalance(contract, big.NewInt(1))
+	st.SetState(contract, key, value)
+	st.UpdateAll()
+	if err = st.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	header := &xfsgo.BlockHeader{
+		Height:           1,
+		HashPrevBlock:    genesis.HeaderHash(),
+		Timestamp:        genesis.Header.Timestamp + 60,
+		Coinbase:         crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey),
+		StateRoot:        common.Bytes2Hash(st.Root()),
+		TransactionsRoot: xfsgo.CalcTxsRootHash(nil),
+		GasLimit:         new(big.Int),
+		GasUsed:          new(big.Int),
+		Bits:             genesis.Bits(),
+	}
+	for xfsgo.CheckProofOfWork(header.HeaderHash(), header.Bits, header.Bits) != nil {
+		header.Nonce++
+	}
+	pivot := xfsgo.NewBlock(header, nil, nil)
+	if err = dst.InsertFastBlock(pivot); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := newSyncMgr(testVersion, testNetwork, dst, testEventBus, nil)
+	pipe, remote := newTestPipePeers(testNodes[0].nodeId, testNodes[1].nodeId)
+	defer pipe.Close()
+	p := newPeer(pipe, testVersion, testNetwork)
+	mgr.peers.appendPeer(p)
+	atomic.StoreInt32(&mgr.synchronising, 1)
+	// The remote peer serves the nodes from the source chain.
+	go func() {
+		for {
+			select {
+			case <-remote.close:
+				return
+			case msg := <-remote.in:
+				if msg.Type() != GetNodeDataMsg {
+					continue
+				}
+				bs, err := msg.ReadAll()
+				if err != nil {
+					continue
+				}
+				var hashes RemoteHashes
+				if err = json.Unmarshal(bs, &hashes); err != nil {
+					continue
+				}
+				data := make(RemoteNodeData, 0, len(hashes))
+				for _, hash := range hashes {
+					if node := src.GetStateNodeData(hash); node != nil {
+						data = append(data, node)
+					}
+				}
+				mgr.handleNodeData(p.ID(), data)
+			}
+		}
+	}()
+	if err = mgr.fetchState(pivot.Header); err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.CommitFastSync(pivot.HeaderHash()); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.CurrentStateTree().GetStateValue(contract, key); !bytes.Equal(got, value) {
+		t.Fatalf("want storage value %q, got %q", value, got)
+	}
+}
@@ -3,10 +3,14 @@ package backend
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"xfsgo/p2p/discover"
 )
 
+var errMalformedMsg = errors.New("malformed message")
+
 type handlerMgr interface {
 	Handle(t uint8, cb handlerFn)
 }
@@ -25,7 +29,10 @@ func (r *request) dataString() string {
 }
 
 func (r *request) jsonObj(v interface{}) error {
-	return json.Unmarshal(r.data, v)
+	if err := json.Unmarshal(r.data, v); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedMsg, err)
+	}
+	return nil
 }
 
 type handlerFn func(req *request, sp sender) error
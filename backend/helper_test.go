@@ -9,9 +9,11 @@ import (
 	"testing"
 	"time"
 	"xfsgo"
+	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
+	"xfsgo/test"
 )
 
 type testPackReader struct {
@@ -287,12 +289,50 @@ func (t *testChainMgr) GetBlockByHash(hash common.Hash) *xfsgo.Block {
 	}
 	return block
 }
+func (t *testChainMgr) GetTotalWork(hash common.Hash) *big.Int {
+	return nil
+}
+
+func (t *testChainMgr) Config() *xfsgo.ChainConfig {
+	return xfsgo.DefaultMainNetChainConfig()
+}
+
+func (t *testChainMgr) CheckpointAt(height uint64) *xfsgo.Checkpoint {
+	return nil
+}
+
+func (t *testChainMgr) ValidateHeaders(parent *xfsgo.BlockHeader, headers []*xfsgo.BlockHeader) error {
+	return nil
+}
+
+func (t *testChainMgr) LastCheckpoint() *xfsgo.Checkpoint {
+	return nil
+}
+
 func (t *testChainMgr) InsertChain(block *xfsgo.Block) error {
 	header := block.Header
 	_ = header
 	return t.writeBlock(block)
 }
 
+func (t *testChainMgr) InsertFastBlock(block *xfsgo.Block) error {
+	return t.writeBlock(block)
+}
+
+func (t *testChainMgr) CommitFastSync(hash common.Hash) error {
+	return nil
+}
+
+func (t *testChainMgr) GetStateNodeData(hash common.Hash) []byte {
+	return nil
+}
+
+func (t *testChainMgr) NewStateSync(root common.Hash) *avlmerkle.TreeSync {
+	return avlmerkle.NewTreeSync(test.NewMemStorage(), root[:], nil)
+}
+
+func (t *testChainMgr) SetStateSyncProgress(progress *xfsgo.StateSyncProgress) {}
+
 func (t *testChainMgr) Slice(start, end uint64) *testChainMgr {
 	mgr := &testChainMgr{
 		genesis:  t.genesis,
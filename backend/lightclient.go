@@ -0,0 +1,288 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	lightRequestTTL     = 5 * time.Second
+	lightSyncInterval   = 10 * time.Second
+	errLightUnavailable = errors.New("no light server available")
+	errNotLightServer   = errors.New("peer is no light server")
+)
+
+type lightClientChain interface {
+	CurrentBHeader() *xfsgo.BlockHeader
+	GenesisBHeader() *xfsgo.BlockHeader
+	GetTotalWork(hash common.Hash) *big.Int
+	InsertHeaderChain(headers []*xfsgo.BlockHeader) (int, error)
+}
+
+type lightRequest struct {
+	peerId discover.NodeId
+	resp   chan []byte
+}
+
+// lightClient keeps the header chain of a light node in sync with the light
+// servers, and retrieves the data the chain does not keep from them. It
+// implements xfsgo.LightBackend.
+type lightClient struct {
+	chain   lightClientChain
+	network uint32
+	peers   *lightPeerSet
+	hm      *mHandlerMgr
+	reqID   uint64
+	mu      sync.Mutex
+	pending map[uint64]*lightRequest
+	syncCh  chan struct{}
+}
+
+func newLightClient(network uint32, chain lightClientChain) *lightClient {
+	c := &lightClient{
+		chain:   chain,
+		network: network,
+		peers:   newLightPeerSet(),
+		pending: make(map[uint64]*lightRequest),
+		syncCh:  make(chan struct{}, 1),
+	}
+	hm := newHandlerMgr()
+	hm.Handle(LightAnnounceMsg, c.handleAnnounce)
+	hm.Handle(LightHeadersMsg, c.handleResponse)
+	hm.Handle(AccountProofMsg, c.handleResponse)
+	hm.Handle(ReceiptProofMsg, c.handleResponse)
+	c.hm = hm
+	return c
+}
+
+func (c *lightClient) Name() string   { return discover.ProtocolLight }
+func (c *lightClient) Version() uint8 { return uint8(lightProtocolVersion) }
+func (c *lightClient) Length() uint8  { return lightProtocolLength }
+
+func (c *lightClient) MaxMessageSize(mType uint8) uint32 {
+	return lightMessageSize(mType)
+}
+
+func (c *lightClient) Run(p2ppeer p2p.Peer) error {
+	p := newLightPeer(p2ppeer)
+	if err := p.handshake(newLightStatus(c.chain, c.network, true)); err != nil {
+		return err
+	}
+	if p.IsLight() {
+		return errNotLightServer
+	}
+	c.peers.add(p)
+	defer c.peers.remove(p.ID())
+	logrus.Debugf("Light server connected: peerId=%s, height=%d", p.ID(), p.Height())
+	c.notifySync()
+	return p.serve(c.hm)
+}
+
+func (c *lightClient) Start() {
+	go c.syncLoop()
+}
+
+func (c *lightClient) notifySync() {
+	select {
+	case c.syncCh <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop syncs the header chain with the best light server whenever a
+// server connects or announces a new head, and periodically otherwise.
+func (c *lightClient) syncLoop() {
+	ticker := time.NewTicker(lightSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.syncCh:
+		case <-ticker.C:
+		}
+		servers := c.peers.servers()
+		if len(servers) == 0 {
+			continue
+		}
+		if err := c.synchronise(servers[0]); err != nil {
+			logrus.Warnf("Light sync failed: peerId=%s, err=%s", servers[0].ID(), err)
+			if errors.Is(err, errInvalidHeaders) {
+				servers[0].Close()
+			}
+		}
+	}
+}
+
+// synchronise fetches the headers past the local head from p until the
+// local chain carries as much work as the one of p. If the chain of p
+// forks from the local one, the fetch steps back exponentially to the
+// height the chains join at.
+func (c *lightClient) synchronise(p *lightPeer) error {
+	from := c.chain.CurrentBHeader().Height + 1
+	back := uint64(1)
+	for {
+		head := c.chain.CurrentBHeader()
+		if work, peerWork := c.chain.GetTotalWork(head.HeaderHash()), p.TotalWork(); peerWork != nil && work != nil && work.Cmp(peerWork) >= 0 {
+			return nil
+		}
+		var resp lightHeadersData
+		id := c.nextReqID()
+		if err := c.request(p, GetLightHeadersMsg, id, &getLightHeadersData{
+			ReqID: id,
+			From:  from,
+			Count: maxHeadersFetch,
+		}, &resp); err != nil {
+			return err
+		}
+		if len(resp.Headers) == 0 {
+			return nil
+		}
+		headers, err := convertRemoteHeaders(resp.Headers)
+		if err != nil {
+			return err
+		}
+		n, err := c.chain.InsertHeaderChain(headers)
+		if n == 0 && err == xfsgo.ErrOrphansBlock {
+			if from == 0 {
+				return fmt.Errorf("%w: no common ancestor", errInvalidHeaders)
+			}
+			if back > from {
+				back = from
+			}
+			from -= back
+			back *= 2
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: height=%d, %v", errInvalidHeaders, headers[n].Height, err)
+		}
+		from = headers[len(headers)-1].Height + 1
+	}
+}
+
+// convertRemoteHeaders converts headers received from a peer, each must
+// hash to the hash the peer sent.
+func convertRemoteHeaders(remotes RemoteBlockHeaders) ([]*xfsgo.BlockHeader, error) {
+	headers := make([]*xfsgo.BlockHeader, 0, len(remotes))
+	for _, remote := range remotes {
+		var header *xfsgo.BlockHeader
+		if err := common.Objcopy(remote, &header); err != nil || header == nil {
+			return nil, errInvalidHeaders
+		}
+		if header.HeaderHash() != remote.Hash {
+			return nil, fmt.Errorf("%w: hash mismatch at height %d", errInvalidHeaders, header.Height)
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+func (c *lightClient) nextReqID() uint64 {
+	return atomic.AddUint64(&c.reqID, 1)
+}
+
+// request sends the request data of id to p and decodes the response into out.
+func (c *lightClient) request(p *lightPeer, mType uint8, id uint64, data interface{}, out interface{}) error {
+	pending := &lightRequest{
+		peerId: p.ID(),
+		resp:   make(chan []byte, 1),
+	}
+	c.mu.Lock()
+	c.pending[id] = pending
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := p.SendObject(mType, data); err != nil {
+		return err
+	}
+	select {
+	case resp := <-pending.resp:
+		return json.Unmarshal(resp, out)
+	case <-time.After(lightRequestTTL):
+		return errTimeout
+	}
+}
+
+func (c *lightClient) handleResponse(req *request, _ sender) error {
+	var args struct {
+		ReqID uint64 `json:"req_id"`
+	}
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	pending, exists := c.pending[args.ReqID]
+	c.mu.Unlock()
+	if !exists || pending.peerId != req.peerId {
+		return nil
+	}
+	select {
+	case pending.resp <- req.data:
+	default:
+	}
+	return nil
+}
+
+func (c *lightClient) handleAnnounce(req *request, _ sender) error {
+	var args lightAnnounceData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	p := c.peers.get(req.peerId)
+	if p == nil {
+		return errUnKnowPeer
+	}
+	p.setHead(args.Head, args.Height, args.TotalWork)
+	c.notifySync()
+	return nil
+}
+
+func (c *lightClient) GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error) {
+	for _, p := range c.peers.servers() {
+		var resp accountProofData
+		id := c.nextReqID()
+		if err := c.request(p, GetAccountProofMsg, id, &getAccountProofData{
+			ReqID:   id,
+			Root:    root,
+			Address: addr,
+		}, &resp); err != nil {
+			logrus.Debugf("Request account proof err: peerId=%s, err=%s", p.ID(), err)
+			continue
+		}
+		if resp.Proof != nil {
+			return resp.Proof, nil
+		}
+	}
+	return nil, errLightUnavailable
+}
+
+func (c *lightClient) GetReceiptProof(txHash common.Hash) (*xfsgo.ReceiptProof, error) {
+	for _, p := range c.peers.servers() {
+		var resp receiptProofData
+		id := c.nextReqID()
+		if err := c.request(p, GetReceiptProofMsg, id, &getReceiptProofData{
+			ReqID:  id,
+			TxHash: txHash,
+		}, &resp); err != nil {
+			logrus.Debugf("Request receipt proof err: peerId=%s, err=%s", p.ID(), err)
+			continue
+		}
+		if resp.Proof != nil {
+			return resp.Proof, nil
+		}
+	}
+	return nil, errLightUnavailable
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+)
+
+// testPipePeer is one end of an in-memory connection between two peers.
+type testPipePeer struct {
+	id    discover.NodeId
+	in    chan p2p.MessageReader
+	out   chan p2p.MessageReader
+	close chan struct{}
+	once  *sync.Once
+}
+
+func newTestPipePeers(a, b discover.NodeId) (*testPipePeer, *testPipePeer) {
+	ab, ba := make(chan p2p.MessageReader, 16), make(chan p2p.MessageReader, 16)
+	closeCh, once := make(chan struct{}), new(sync.Once)
+	// The peer seen by a is b, and the other way round.
+	return &testPipePeer{id: b, in: ba, out: ab, close: closeCh, once: once},
+		&testPipePeer{id: a, in: ab, out: ba, close: closeCh, once: once}
+}
+
+func (p *testPipePeer) Is(int) bool                { return false }
+func (p *testPipePeer) ID() discover.NodeId        { return p.id }
+func (p *testPipePeer) RemoteNode() *discover.Node { return nil }
+func (p *testPipePeer) RemoteAddr() *net.TCPAddr   { return nil }
+func (p *testPipePeer) Run()                       {}
+func (p *testPipePeer) Close() {
+	p.once.Do(func() { close(p.close) })
+}
+func (p *testPipePeer) WriteMessage(mType uint8, data []byte) error {
+	select {
+	case p.out <- newTestPackReader(mType, data):
+		return nil
+	case <-p.close:
+		return errors.New("peer closed")
+	}
+}
+func (p *testPipePeer) WriteMessageObj(mType uint8, data interface{}) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.WriteMessage(mType, bs)
+}
+func (p *testPipePeer) GetProtocolMsgCh() (chan p2p.MessageReader, error) {
+	select {
+	case <-p.close:
+		return nil, errors.New("peer closed")
+	default:
+	}
+	return p.in, nil
+}
+
+type testLightServerChain struct {
+	*testChainMgr
+	proofs map[common.Address][][]byte
+}
+
+func (c *testLightServerChain) GetAccountProof(_ common.Hash, addr common.Address) ([][]byte, error) {
+	if proof, exists := c.proofs[addr]; exists {
+		return proof, nil
+	}
+	return nil, errors.New("unknown account")
+}
+
+func (c *testLightServerChain) GetReceiptProof(txHash common.Hash) (*xfsgo.ReceiptProof, error) {
+	return nil, errors.New("unknown transaction")
+}
+
+type testLightClientChain struct {
+	*testChainMgr
+}
+
+func (c *testLightClientChain) InsertHeaderChain(headers []*xfsgo.BlockHeader) (int, error) {
+	for i, header := range headers {
+		if header.HashPrevBlock != c.last.HeaderHash() {
+			return i, xfsgo.ErrOrphansBlock
+		}
+		if err := c.writeBlock(xfsgo.NewBlock(header, nil, nil)); err != nil {
+			return i, err
+		}
+	}
+	return len(headers), nil
+}
+
+func TestLightClient(t *testing.T) {
+	full := newTestChainMgr(testGenesis, common.Address{})
+	local := full.Copy()
+	full.NewEmptyBlocks(10)
+	addr := common.Address{1}
+	server := newLightServer(1, &testLightServerChain{
+		testChainMgr: full,
+		proofs:       map[common.Address][][]byte{addr: {[]byte("proof")}},
+	}, xfsgo.NewEventBus())
+	client := newLightClient(1, &testLightClientChain{local})
+
+	serverSide, clientSide := newTestPipePeers(testNodes[0].nodeId, testNodes[1].nodeId)
+	defer serverSide.Close()
+	go func() { _ = server.Run(serverSide) }()
+	go func() { _ = client.Run(clientSide) }()
+	var p *lightPeer
+	for i := 0; i < 100 && p == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		p = client.peers.get(clientSide.ID())
+	}
+	if p == nil || p.IsLight() || p.Height() != 10 {
+		t.Fatalf("want light server at height 10, got %+v", p)
+	}
+	if !server.isLightPeer(serverSide.ID()) {
+		t.Fatalf("want client served by the light server")
+	}
+
+	if err := client.synchronise(p); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := local.CurrentBHeader().HeaderHash(), full.CurrentBHeader().HeaderHash(); got != want {
+		t.Fatalf("want head %x, got %x", want, got)
+	}
+	proof, err := client.GetAccountProof(common.Hash{}, addr)
+	if err != nil || len(proof) != 1 || string(proof[0]) != "proof" {
+		t.Fatalf("unexpected account proof: %q, %v", proof, err)
+	}
+	if _, err = client.GetAccountProof(common.Hash{}, common.Address{2}); err != errLightUnavailable {
+		t.Fatalf("want err %v, got %v", errLightUnavailable, err)
+	}
+	if _, err = client.GetReceiptProof(common.Hash{1}); err != errLightUnavailable {
+		t.Fatalf("want err %v, got %v", errLightUnavailable, err)
+	}
+}
@@ -0,0 +1,328 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lightProtocolVersion is the version of the protocol serving light clients.
+const lightProtocolVersion uint32 = 1
+
+// Messages of the light protocol, the peer maps them to a message space
+// apart from the one of the chain sync protocol.
+const (
+	LightStatusMsg     uint8 = 0
+	LightAnnounceMsg   uint8 = 1
+	GetLightHeadersMsg uint8 = 2
+	LightHeadersMsg    uint8 = 3
+	GetAccountProofMsg uint8 = 4
+	AccountProofMsg    uint8 = 5
+	GetReceiptProofMsg uint8 = 6
+	ReceiptProofMsg    uint8 = 7
+
+	lightProtocolLength = ReceiptProofMsg + 1
+)
+
+const (
+	maxLightRequestSize  = 4 << 10
+	maxLightResponseSize = 2 << 20
+)
+
+// lightMessageSize returns the bound of the data of the light messages of
+// mType, only responses carry much.
+func lightMessageSize(mType uint8) uint32 {
+	switch mType {
+	case LightHeadersMsg, AccountProofMsg, ReceiptProofMsg:
+		return maxLightResponseSize
+	}
+	return maxLightRequestSize
+}
+
+type lightStatusData struct {
+	Version   uint32      `json:"version"`
+	Network   uint32      `json:"network"`
+	Genesis   common.Hash `json:"genesis"`
+	Head      common.Hash `json:"head"`
+	Height    uint64      `json:"height"`
+	TotalWork *big.Int    `json:"total_work"`
+	// Light is set by light clients, which serve nothing.
+	Light bool `json:"light"`
+}
+
+type lightAnnounceData struct {
+	Head      common.Hash `json:"head"`
+	Height    uint64      `json:"height"`
+	TotalWork *big.Int    `json:"total_work"`
+}
+
+// Requests carry an id their response is matched by.
+type getLightHeadersData struct {
+	ReqID uint64 `json:"req_id"`
+	From  uint64 `json:"from"`
+	Count uint64 `json:"count"`
+}
+
+type lightHeadersData struct {
+	ReqID   uint64             `json:"req_id"`
+	Headers RemoteBlockHeaders `json:"headers"`
+}
+
+type getAccountProofData struct {
+	ReqID   uint64         `json:"req_id"`
+	Root    common.Hash    `json:"root"`
+	Address common.Address `json:"address"`
+}
+
+type accountProofData struct {
+	ReqID uint64   `json:"req_id"`
+	Proof [][]byte `json:"proof"`
+}
+
+type getReceiptProofData struct {
+	ReqID  uint64      `json:"req_id"`
+	TxHash common.Hash `json:"tx_hash"`
+}
+
+type receiptProofData struct {
+	ReqID uint64              `json:"req_id"`
+	Proof *xfsgo.ReceiptProof `json:"proof"`
+}
+
+type lightStatusChain interface {
+	CurrentBHeader() *xfsgo.BlockHeader
+	GenesisBHeader() *xfsgo.BlockHeader
+	GetTotalWork(hash common.Hash) *big.Int
+}
+
+func newLightStatus(chain lightStatusChain, network uint32, light bool) *lightStatusData {
+	head := chain.CurrentBHeader()
+	return &lightStatusData{
+		Version:   lightProtocolVersion,
+		Network:   network,
+		Genesis:   chain.GenesisBHeader().HeaderHash(),
+		Head:      head.HeaderHash(),
+		Height:    head.Height,
+		TotalWork: chain.GetTotalWork(head.HeaderHash()),
+		Light:     light,
+	}
+}
+
+// lightPeer is a peer speaking the light protocol.
+type lightPeer struct {
+	lock      sync.RWMutex
+	p2pPeer   p2p.Peer
+	head      common.Hash
+	height    uint64
+	totalWork *big.Int
+	light     bool
+}
+
+func newLightPeer(p p2p.Peer) *lightPeer {
+	return &lightPeer{
+		p2pPeer: p,
+	}
+}
+
+func (p *lightPeer) ID() discover.NodeId {
+	return p.p2pPeer.ID()
+}
+
+func (p *lightPeer) Head() common.Hash {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.head
+}
+
+func (p *lightPeer) Height() uint64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.height
+}
+
+// TotalWork returns the cumulative work of the peer's chain, nil if the peer did not announce it.
+func (p *lightPeer) TotalWork() *big.Int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.totalWork
+}
+
+// IsLight reports whether the peer is a light client.
+func (p *lightPeer) IsLight() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.light
+}
+
+func (p *lightPeer) setHead(head common.Hash, height uint64, work *big.Int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.head = head
+	p.height = height
+	p.totalWork = work
+}
+
+func (p *lightPeer) Close() {
+	p.p2pPeer.Close()
+}
+
+func (p *lightPeer) SendData(mType uint8, data []byte) error {
+	return p.p2pPeer.WriteMessage(mType, data)
+}
+
+func (p *lightPeer) SendObject(mType uint8, data interface{}) error {
+	return p2p.SendMsgData(p.p2pPeer, mType, data)
+}
+
+// handshake exchanges the status of the light protocol with the peer, which
+// must be on the same network and genesis block.
+func (p *lightPeer) handshake(local *lightStatusData) error {
+	go func() {
+		if err := p.SendObject(LightStatusMsg, local); err != nil {
+			return
+		}
+	}()
+	msgCh, err := p.p2pPeer.GetProtocolMsgCh()
+	if err != nil {
+		return err
+	}
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case msg := <-msgCh:
+			if msg.Type() != LightStatusMsg {
+				continue
+			}
+			data, _ := msg.ReadAll()
+			status := lightStatusData{}
+			if err = json.Unmarshal(data, &status); err != nil {
+				return err
+			}
+			if status.Version != local.Version || status.Network != local.Network || status.Genesis != local.Genesis {
+				logrus.Debugf("Light peer handshake failed: version=%d, network=%d, genesis=%x, from=%s",
+					status.Version, status.Network, status.Genesis, p.ID())
+				return errHandshakeFailed
+			}
+			p.lock.Lock()
+			p.head = status.Head
+			p.height = status.Height
+			p.totalWork = status.TotalWork
+			p.light = status.Light
+			p.lock.Unlock()
+			return nil
+		case <-timeout:
+			return errors.New("time out")
+		}
+	}
+}
+
+// serve dispatches the messages of the peer to the handlers of hm until
+// the peer is closed or a handler fails.
+func (p *lightPeer) serve(hm *mHandlerMgr) error {
+	for {
+		msgCh, err := p.p2pPeer.GetProtocolMsgCh()
+		if err != nil {
+			return err
+		}
+		select {
+		case msg := <-msgCh:
+			data, err := msg.ReadAll()
+			if err != nil {
+				return err
+			}
+			if err = hm.OnMessage(p.ID(), p, msg.Type(), data); err != nil {
+				return err
+			}
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+type lightPeerSet struct {
+	mu    sync.RWMutex
+	peers map[discover.NodeId]*lightPeer
+}
+
+func newLightPeerSet() *lightPeerSet {
+	return &lightPeerSet{
+		peers: make(map[discover.NodeId]*lightPeer),
+	}
+}
+
+func (ps *lightPeerSet) add(p *lightPeer) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.peers[p.ID()] = p
+}
+
+func (ps *lightPeerSet) remove(id discover.NodeId) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.peers, id)
+}
+
+func (ps *lightPeerSet) get(id discover.NodeId) *lightPeer {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.peers[id]
+}
+
+func (ps *lightPeerSet) count() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.peers)
+}
+
+// clients returns the peers which are light clients.
+func (ps *lightPeerSet) clients() []*lightPeer {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	all := make([]*lightPeer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if p.IsLight() {
+			all = append(all, p)
+		}
+	}
+	return all
+}
+
+// servers returns the peers serving the light protocol, the one whose
+// chain carries the most work first.
+func (ps *lightPeerSet) servers() []*lightPeer {
+	ps.mu.RLock()
+	all := make([]*lightPeer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if !p.IsLight() {
+			all = append(all, p)
+		}
+	}
+	ps.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return moreLightPeerWork(all[i], all[j])
+	})
+	return all
+}
+
+// moreLightPeerWork reports whether the chain of a carries more work than the one of b.
+func moreLightPeerWork(a, b *lightPeer) bool {
+	aw, bw := a.TotalWork(), b.TotalWork()
+	if aw == nil {
+		aw = new(big.Int)
+	}
+	if bw == nil {
+		bw = new(big.Int)
+	}
+	if c := aw.Cmp(bw); c != 0 {
+		return c > 0
+	}
+	return a.Height() > b.Height()
+}
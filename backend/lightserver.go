@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"math/big"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+
+	"github.com/sirupsen/logrus"
+)
+
+type lightServerChain interface {
+	CurrentBHeader() *xfsgo.BlockHeader
+	GenesisBHeader() *xfsgo.BlockHeader
+	GetBlockByNumber(num uint64) *xfsgo.Block
+	GetTotalWork(hash common.Hash) *big.Int
+	GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error)
+	GetReceiptProof(txHash common.Hash) (*xfsgo.ReceiptProof, error)
+}
+
+// lightServer serves headers, accounts and receipts to light clients on
+// a full node.
+type lightServer struct {
+	chain    lightServerChain
+	network  uint32
+	eventBus *xfsgo.EventBus
+	peers    *lightPeerSet
+	hm       *mHandlerMgr
+}
+
+func newLightServer(network uint32, chain lightServerChain, eventBus *xfsgo.EventBus) *lightServer {
+	s := &lightServer{
+		chain:    chain,
+		network:  network,
+		eventBus: eventBus,
+		peers:    newLightPeerSet(),
+	}
+	hm := newHandlerMgr()
+	hm.Handle(GetLightHeadersMsg, s.handleGetHeaders)
+	hm.Handle(GetAccountProofMsg, s.handleGetAccountProof)
+	hm.Handle(GetReceiptProofMsg, s.handleGetReceiptProof)
+	s.hm = hm
+	return s
+}
+
+func (s *lightServer) Name() string   { return discover.ProtocolLight }
+func (s *lightServer) Version() uint8 { return uint8(lightProtocolVersion) }
+func (s *lightServer) Length() uint8  { return lightProtocolLength }
+
+func (s *lightServer) MaxMessageSize(mType uint8) uint32 {
+	return lightMessageSize(mType)
+}
+
+func (s *lightServer) Run(p2ppeer p2p.Peer) error {
+	p := newLightPeer(p2ppeer)
+	if err := p.handshake(newLightStatus(s.chain, s.network, false)); err != nil {
+		return err
+	}
+	if !p.IsLight() {
+		// Full peers sync through the chain sync protocol.
+		return nil
+	}
+	s.peers.add(p)
+	defer s.peers.remove(p.ID())
+	logrus.Debugf("Light client connected: peerId=%s", p.ID())
+	return p.serve(s.hm)
+}
+
+// isLightPeer reports whether id is a light client the server is serving.
+func (s *lightServer) isLightPeer(id discover.NodeId) bool {
+	return s.peers.get(id) != nil
+}
+
+func (s *lightServer) Start() {
+	go s.announceLoop()
+}
+
+// announceLoop announces the new heads of the chain to the light clients.
+func (s *lightServer) announceLoop() {
+	sub := s.eventBus.Subscript(xfsgo.ChainHeadEvent{})
+	defer sub.Unsubscribe()
+	for e := range sub.Chan() {
+		event, ok := e.(xfsgo.ChainHeadEvent)
+		if !ok || event.Block == nil {
+			continue
+		}
+		hash := event.Block.HeaderHash()
+		data := &lightAnnounceData{
+			Head:      hash,
+			Height:    event.Block.Height(),
+			TotalWork: s.chain.GetTotalWork(hash),
+		}
+		for _, p := range s.peers.clients() {
+			if err := p.SendObject(LightAnnounceMsg, data); err != nil {
+				logrus.Debugf("Announce head to light client err: %s", err)
+			}
+		}
+	}
+}
+
+func (s *lightServer) handleGetHeaders(req *request, p sender) error {
+	var args getLightHeadersData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	headers := make(RemoteBlockHeaders, 0)
+	count := args.Count
+	if count > maxHeadersFetch {
+		count = maxHeadersFetch
+	}
+	for i := uint64(0); i < count; i++ {
+		block := s.chain.GetBlockByNumber(args.From + i)
+		if block == nil {
+			break
+		}
+		headers = append(headers, coverBlockHeader2RemoteBlockHeader(block.Header))
+	}
+	return p.SendObject(LightHeadersMsg, &lightHeadersData{
+		ReqID:   args.ReqID,
+		Headers: headers,
+	})
+}
+
+// handleGetAccountProof replies a nil proof if the account cannot be proven,
+// the client then asks another server.
+func (s *lightServer) handleGetAccountProof(req *request, p sender) error {
+	var args getAccountProofData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	proof, err := s.chain.GetAccountProof(args.Root, args.Address)
+	if err != nil {
+		logrus.Debugf("Get account proof err: root=%x, address=%s, err=%s", args.Root, args.Address.B58String(), err)
+	}
+	return p.SendObject(AccountProofMsg, &accountProofData{
+		ReqID: args.ReqID,
+		Proof: proof,
+	})
+}
+
+func (s *lightServer) handleGetReceiptProof(req *request, p sender) error {
+	var args getReceiptProofData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	proof, err := s.chain.GetReceiptProof(args.TxHash)
+	if err != nil {
+		logrus.Debugf("Get receipt proof err: txHash=%x, err=%s", args.TxHash, err)
+	}
+	return p.SendObject(ReceiptProofMsg, &receiptProofData{
+		ReqID: args.ReqID,
+		Proof: proof,
+	})
+}
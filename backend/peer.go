@@ -33,17 +33,25 @@ type syncpeer interface {
 	Head() common.Hash
 	ID() discover.NodeId
 	Height() uint64
+	TotalWork() *big.Int
 	SetHead(hash common.Hash)
 	SetHeight(height uint64)
+	SetTotalWork(work *big.Int)
 	P2PPeer() p2p.Peer
 	Close()
 	SendData(mType uint8, data []byte) error
 	SendObject(mType uint8, data interface{}) error
-	Handshake(head common.Hash, height uint64, genesis common.Hash) error
+	Handshake(local *statusData) error
 	RequestHashesFromNumber(from uint64, count uint64) error
 	SendBlockHashes(hashes RemoteHashes) error
 	RequestBlocks(hashes RemoteHashes) error
 	SendBlocks(blocks RemoteBlocks) error
+	RequestHeadersFromNumber(from uint64, count uint64) error
+	SendBlockHeaders(headers RemoteBlockHeaders) error
+	RequestBodies(hashes RemoteHashes) error
+	SendBlockBodies(bodies RemoteBlockBodies) error
+	RequestNodeData(hashes RemoteHashes) error
+	SendNodeData(data RemoteNodeData) error
 	SendNewBlock(data *RemoteBlock) error
 	SendTransactions(data RemoteTxs) error
 	SendTxhash(data TxHashs) error
@@ -55,6 +63,10 @@ type syncpeer interface {
 	AddBlock(common.Hash)
 	AddTx(common.Hash)
 	HasTx(common.Hash) bool
+	// AddReceivedBlock and AddReceivedTx record a hash received from the
+	// peer as known to it, and report whether the peer sent it before.
+	AddReceivedBlock(common.Hash) bool
+	AddReceivedTx(common.Hash) bool
 	Reset()
 }
 
@@ -65,11 +77,16 @@ type peer struct {
 	network         uint32
 	head            common.Hash
 	height          uint64
+	totalWork       *big.Int
 	ignoreHashes    map[common.Hash]struct{}
 	knownBlocksLock sync.RWMutex
 	knownBlocks     map[common.Hash]struct{}
 	knownTxsLock    sync.RWMutex
 	knownTxs        map[common.Hash]struct{}
+	// The hashes known to the peer because it sent them, the others were
+	// sent to it.
+	receivedBlocks map[common.Hash]struct{}
+	receivedTxs    map[common.Hash]struct{}
 }
 
 const (
@@ -82,8 +99,49 @@ const (
 	TxMsg                       uint8 = 11
 	GetReceipts                 uint8 = 12
 	ReceiptsData                uint8 = 13
+	GetBlockHeadersMsg          uint8 = 14
+	BlockHeadersMsg             uint8 = 15
+	GetBlockBodiesMsg           uint8 = 16
+	BlockBodiesMsg              uint8 = 17
+	GetNodeDataMsg              uint8 = 18
+	NodeDataMsg                 uint8 = 19
 )
 
+// fullProtocolVersion is the version of the chain sync protocol offered in
+// the p2p handshake. Its message types below MsgCodeVersion are unused.
+const (
+	fullProtocolVersion uint8 = 1
+	fullProtocolLength        = NodeDataMsg + 1
+)
+
+const (
+	maxSyncStatusSize   = 4 << 10
+	maxSyncRequestSize  = 64 << 10
+	maxSyncHashesSize   = 64 << 10
+	maxSyncHeadersSize  = 1 << 20
+	maxSyncNodeDataSize = 4 << 20
+)
+
+// syncMessageSize returns the bound of the data of the chain sync messages
+// of mType. The status and the requests carry little, the replies are sized
+// by the number of items fetched at once. Blocks and transactions take the
+// default bound of the p2p layer.
+func syncMessageSize(mType uint8) uint32 {
+	switch mType {
+	case MsgCodeVersion:
+		return maxSyncStatusSize
+	case BlockHashesMsg:
+		return maxSyncHashesSize
+	case BlockHeadersMsg:
+		return maxSyncHeadersSize
+	case NodeDataMsg:
+		return maxSyncNodeDataSize
+	case BlocksMsg, BlockBodiesMsg, NewBlockMsg, TxMsg, ReceiptsData:
+		return 0
+	}
+	return maxSyncRequestSize
+}
+
 var (
 	errHandshakeFailed = errors.New("protocol handshake failed")
 )
@@ -96,6 +154,9 @@ func newPeer(p p2p.Peer, version uint32, network uint32) *peer {
 		ignoreHashes: make(map[common.Hash]struct{}),
 		knownBlocks:  make(map[common.Hash]struct{}),
 		knownTxs:     make(map[common.Hash]struct{}),
+
+		receivedBlocks: make(map[common.Hash]struct{}),
+		receivedTxs:    make(map[common.Hash]struct{}),
 	}
 	return pt
 }
@@ -118,6 +179,28 @@ func (p *peer) HasTx(hash common.Hash) (r bool) {
 func (p *peer) AddTx(hash common.Hash) {
 	p.addKnownTx(hash)
 }
+
+func (p *peer) AddReceivedBlock(hash common.Hash) bool {
+	p.knownBlocksLock.Lock()
+	defer p.knownBlocksLock.Unlock()
+	p.knownBlocks[hash] = struct{}{}
+	if _, exists := p.receivedBlocks[hash]; exists {
+		return true
+	}
+	p.receivedBlocks[hash] = struct{}{}
+	return false
+}
+
+func (p *peer) AddReceivedTx(hash common.Hash) bool {
+	p.knownTxsLock.Lock()
+	defer p.knownTxsLock.Unlock()
+	p.knownTxs[hash] = struct{}{}
+	if _, exists := p.receivedTxs[hash]; exists {
+		return true
+	}
+	p.receivedTxs[hash] = struct{}{}
+	return false
+}
 func (p *peer) GetProtocolMsgCh() (chan p2p.MessageReader, error) {
 	return p.p2pPeer.GetProtocolMsgCh()
 }
@@ -138,6 +221,13 @@ func (p *peer) Height() uint64 {
 	defer p.lock.RUnlock()
 	return p.height
 }
+
+// TotalWork returns the cumulative work of the peer's chain, nil if the peer did not announce it.
+func (p *peer) TotalWork() *big.Int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.totalWork
+}
 func (p *peer) SetHead(hash common.Hash) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -150,6 +240,12 @@ func (p *peer) SetHeight(height uint64) {
 	p.height = height
 }
 
+func (p *peer) SetTotalWork(work *big.Int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.totalWork = work
+}
+
 func (p *peer) P2PPeer() p2p.Peer {
 	return p.p2pPeer
 }
@@ -173,11 +269,13 @@ func (p *peer) Reset() {
 }
 
 type statusData struct {
-	Version uint32      `json:"version"`
-	Network uint32      `json:"network"`
-	Head    common.Hash `json:"head"`
-	Height  uint64      `json:"height"`
-	Genesis common.Hash `json:"genesis"`
+	Version   uint32            `json:"version"`
+	Network   uint32            `json:"network"`
+	Head      common.Hash       `json:"head"`
+	Height    uint64            `json:"height"`
+	TotalWork *big.Int          `json:"total_work"`
+	Genesis   common.Hash       `json:"genesis"`
+	Forks     map[string]uint64 `json:"forks"`
 }
 
 type getBlockHashesFromNumberData struct {
@@ -185,6 +283,11 @@ type getBlockHashesFromNumberData struct {
 	Count uint64 `json:"count"`
 }
 
+type getBlockHeadersData struct {
+	From  uint64 `json:"from"`
+	Count uint64 `json:"count"`
+}
+
 type AllSyncData struct {
 	ID     string      `json:"id"`
 	Head   common.Hash `json:"head"`
@@ -230,9 +333,18 @@ type RemoteBlock struct {
 	Receipts     []*xfsgo.Receipt   `json:"receipts"`
 }
 
+// RemoteBlockBody holds the transactions of the block of hash.
+type RemoteBlockBody struct {
+	Hash         common.Hash `json:"hash"`
+	Transactions RemoteTxs   `json:"transactions"`
+}
+
 type ReceiptsSet []*xfsgo.Receipt
 type RemoteHashes []common.Hash
 type RemoteBlocks []*RemoteBlock
+type RemoteBlockHeaders []*RemoteBlockHeader
+type RemoteBlockBodies []*RemoteBlockBody
+type RemoteNodeData [][]byte
 
 type TxHashs []common.Hash
 
@@ -290,16 +402,14 @@ func coverBlock2RemoteBlock(block *xfsgo.Block) (re *RemoteBlock) {
 
 // Handshake runs the protocol handshake using messages(hash value and height of current block).
 // to verifies whether the peer matchs the prptocol that attempts to add the connection as a peer.
-func (p *peer) Handshake(head common.Hash, height uint64, genesis common.Hash) error {
-
+// The version and network of local are the ones of the peer.
+func (p *peer) Handshake(local *statusData) error {
+	mine := *local
+	mine.Version = p.version
+	mine.Network = p.network
+	genesis := mine.Genesis
 	go func() {
-		if err := p2p.SendMsgData(p.p2pPeer, MsgCodeVersion, &statusData{
-			Version: p.version,
-			Network: p.network,
-			Head:    head,
-			Height:  height,
-			Genesis: genesis,
-		}); err != nil {
+		if err := p2p.SendMsgData(p.p2pPeer, MsgCodeVersion, &mine); err != nil {
 			return
 		}
 	}()
@@ -334,8 +444,16 @@ func (p *peer) Handshake(head common.Hash, height uint64, genesis common.Hash) e
 						p.network, status.Network, p.P2PPeer().RemoteNode().ID)
 					return errHandshakeFailed
 				}
+				// Peers which do not announce their forks predate the fork schedule.
+				if status.Forks != nil {
+					if err := xfsgo.CheckForkCompatible(local.Forks, status.Forks, local.Height, status.Height); err != nil {
+						logrus.Debugf("Sync peer handshake failed: %s, from=%s", err, p.P2PPeer().RemoteNode().ID)
+						return errHandshakeFailed
+					}
+				}
 				p.head = status.Head
 				p.height = status.Height
+				p.totalWork = status.TotalWork
 				pid := p.P2PPeer().RemoteNode().ID
 				logrus.Debugf("Successfully handshake by sync transport: height=%d, head=%x, id=%x", status.Height, p.head[len(p.head)-4:], pid[len(pid)-4:])
 				return nil
@@ -381,6 +499,57 @@ func (p *peer) SendBlocks(blocks RemoteBlocks) error {
 	return nil
 }
 
+// RequestHeadersFromNumber fetches a batch of main chain headers from a peer, starting at from, getting count
+func (p *peer) RequestHeadersFromNumber(from uint64, count uint64) error {
+	if err := p2p.SendMsgData(p.p2pPeer, GetBlockHeadersMsg, &getBlockHeadersData{
+		From:  from,
+		Count: count,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendBlockHeaders sends a batch of headers
+func (p *peer) SendBlockHeaders(headers RemoteBlockHeaders) error {
+	if err := p2p.SendMsgData(p.p2pPeer, BlockHeadersMsg, &headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestBodies fetches the bodies of a batch of blocks based on the hash values
+func (p *peer) RequestBodies(hashes RemoteHashes) error {
+	if err := p2p.SendMsgData(p.p2pPeer, GetBlockBodiesMsg, &hashes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendBlockBodies sends a batch of block bodies
+func (p *peer) SendBlockBodies(bodies RemoteBlockBodies) error {
+	if err := p2p.SendMsgData(p.p2pPeer, BlockBodiesMsg, &bodies); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestNodeData fetches a batch of state tree nodes based on the hash values
+func (p *peer) RequestNodeData(hashes RemoteHashes) error {
+	if err := p2p.SendMsgData(p.p2pPeer, GetNodeDataMsg, &hashes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendNodeData sends a batch of encoded state tree nodes
+func (p *peer) SendNodeData(data RemoteNodeData) error {
+	if err := p2p.SendMsgData(p.p2pPeer, NodeDataMsg, &data); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (p *peer) addKnownBlock(hash common.Hash) {
 	p.knownBlocksLock.Lock()
 	defer p.knownBlocksLock.Unlock()
@@ -497,6 +666,15 @@ func (ps *peerSet) setHeight(id discover.NodeId, height uint64) {
 	ps.peers[id].SetHeight(height)
 }
 
+func (ps *peerSet) setTotalWork(id discover.NodeId, work *big.Int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if _, exists := ps.peers[id]; !exists {
+		return
+	}
+	ps.peers[id].SetTotalWork(work)
+}
+
 func (ps *peerSet) setHead(id discover.NodeId, head common.Hash) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
@@ -521,17 +699,33 @@ func (ps *peerSet) count() int {
 	return len(ps.peers)
 }
 
+// morePeerWork reports whether the chain of a carries more work than the one of b.
+// Peers which did not announce their work are compared by height.
+func morePeerWork(a, b syncpeer) bool {
+	aw, bw := a.TotalWork(), b.TotalWork()
+	if aw == nil {
+		aw = new(big.Int)
+	}
+	if bw == nil {
+		bw = new(big.Int)
+	}
+	if c := aw.Cmp(bw); c != 0 {
+		return c > 0
+	}
+	return a.Height() > b.Height()
+}
+
+// basePeer returns the peer whose chain carries the most work.
 func (ps *peerSet) basePeer() syncpeer {
-	var (
-		base       syncpeer = nil
-		baseHeight          = uint64(0)
-	)
+	var base syncpeer = nil
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 	for _, v := range ps.peers {
-		if ph := v.Height(); ph > baseHeight {
+		if v.Height() == 0 {
+			continue
+		}
+		if base == nil || morePeerWork(v, base) {
 			base = v
-			baseHeight = ph
 		}
 	}
 	return base
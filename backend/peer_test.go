@@ -5,7 +5,11 @@ import (
 	"math/rand"
 	"net"
 	"testing"
+	"time"
 	"xfsgo/common"
+	"xfsgo/common/rawencode"
+	"xfsgo/crypto"
+	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
 	"xfsgo/test"
 )
@@ -60,7 +64,7 @@ func TestPeer_Handshake(t *testing.T) {
 	np := test.NewBufferPeer(selfNodeId.nodeId, remoteNode, handshakeFn)
 	for _, sd := range testStatusData {
 		p := newPeer(np, sd.Version, sd.Network)
-		err := p.Handshake(sd.Head, sd.Height, sd.Genesis)
+		err := p.Handshake(sd)
 		if sd.Genesis != wantStatusData.Genesis && err == nil {
 			t.Fatal("test err")
 		} else if sd.Version != wantStatusData.Version && err == nil {
@@ -79,3 +83,64 @@ func TestPeer_Handshake(t *testing.T) {
 //func Test_a(t *testing.T) {
 //	t.Fatal("abc")
 //}
+
+func TestChainSyncProtocol_oversizedStatus(t *testing.T) {
+	srv := p2p.NewServer(p2p.Config{
+		Key:        crypto.MustGenPrvKey(),
+		ListenAddr: "127.0.0.1:0",
+		Discover:   true,
+		NodeDBPath: t.TempDir(),
+		MaxPeers:   10,
+		// Dialing no peer, the server runs no discovery lookup which would
+		// outlive Stop.
+		DialRatio: 100,
+		Encoder:   new(rawencode.StdEncoder),
+	})
+	mgr := newSyncMgr(testVersion, testNetwork, newTestChainMgr(testGenesis, common.Address{}), testEventBus, nil)
+	srv.Bind(&chainSyncProtocol{syncMgr: mgr})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	key := crypto.MustGenPrvKey()
+	conn, err := p2p.Dial(key, srv.Node(), 5*time.Second, []p2p.Protocol{&chainSyncProtocol{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	statusType := -1
+	for i := 0; i < 256; i++ {
+		if name, code, ok := conn.Protocol(uint8(i)); ok && name == discover.ProtocolFull && code == MsgCodeVersion {
+			statusType = i
+		}
+	}
+	if statusType < 0 {
+		t.Fatalf("no status message type shared")
+	}
+	if err = conn.WriteMessage(uint8(statusType), make([]byte, maxSyncStatusSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for err == nil {
+		_, err = conn.ReadMessage()
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("want peer dropped for an oversized status")
+	}
+	// The peer broke the protocol rather than sent a bad status, it is
+	// banned and not served again.
+	if conn, err = p2p.Dial(key, srv.Node(), 5*time.Second, []p2p.Protocol{&chainSyncProtocol{}}); err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if int(msg.Type()) == statusType {
+			t.Fatalf("want banned peer refused, got status")
+		}
+	}
+}
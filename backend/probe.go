@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"time"
+	"xfsgo/common"
+	"xfsgo/p2p"
+	"xfsgo/p2p/discover"
+)
+
+// NodeStatus is the chain status a node announces to its peers.
+type NodeStatus struct {
+	P2PVersion      uint8
+	ProtocolVersion uint32
+	Network         uint32
+	Genesis         common.Hash
+	Head            common.Hash
+	Height          uint64
+	// Light is set for light clients, which announce the status of the
+	// light protocol only.
+	Light bool
+}
+
+// ProbeNode connects to node and reads the status it announces, without
+// joining it as a peer. The node is given timeout to announce it.
+func ProbeNode(key *ecdsa.PrivateKey, node *discover.Node, timeout time.Duration) (*NodeStatus, error) {
+	// The protocols are offered only, the status is read of the first
+	// message of each.
+	protocols := []p2p.Protocol{new(chainSyncProtocol), new(lightServer)}
+	conn, err := p2p.Dial(key, node, timeout, protocols)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		name, code, ok := conn.Protocol(msg.Type())
+		if !ok {
+			continue
+		}
+		switch {
+		case name == discover.ProtocolFull && code == MsgCodeVersion:
+			data, err := msg.ReadAll()
+			if err != nil {
+				return nil, err
+			}
+			status := statusData{}
+			if err = json.Unmarshal(data, &status); err != nil {
+				return nil, err
+			}
+			return &NodeStatus{
+				P2PVersion:      conn.Version(),
+				ProtocolVersion: status.Version,
+				Network:         status.Network,
+				Genesis:         status.Genesis,
+				Head:            status.Head,
+				Height:          status.Height,
+			}, nil
+		case name == discover.ProtocolLight && code == LightStatusMsg:
+			data, err := msg.ReadAll()
+			if err != nil {
+				return nil, err
+			}
+			status := lightStatusData{}
+			if err = json.Unmarshal(data, &status); err != nil {
+				return nil, err
+			}
+			// Full nodes announce the status of the sync protocol besides.
+			if !status.Light {
+				continue
+			}
+			return &NodeStatus{
+				P2PVersion:      conn.Version(),
+				ProtocolVersion: status.Version,
+				Network:         status.Network,
+				Genesis:         status.Genesis,
+				Head:            status.Head,
+				Height:          status.Height,
+				Light:           true,
+			}, nil
+		}
+	}
+}
@@ -17,6 +17,7 @@ var (
 	blockCacheLimit         = maxBlocksFetch * 8
 	errNotFoundFetchPending = errors.New("not found fetch pending")
 	errInvalidChain         = errors.New("retrieved hash chain is invalid")
+	errInvalidBody          = errors.New("block body does not match header")
 )
 
 type queueBlock struct {
@@ -28,6 +29,7 @@ type syncQueue struct {
 	hashCounter int
 	hashPool    map[common.Hash]int
 	blockPool   map[common.Hash]int
+	headerPool  map[common.Hash]*xfsgo.BlockHeader
 	pendPool    map[discover.NodeId]*fetchBlockRequest
 	hashQueue   *priqueue.Priqueue
 	blockCache  []*queueBlock
@@ -45,6 +47,7 @@ func newSyncQueue() *syncQueue {
 		hashCounter: 0,
 		hashPool:    make(map[common.Hash]int),
 		blockPool:   make(map[common.Hash]int),
+		headerPool:  make(map[common.Hash]*xfsgo.BlockHeader),
 		pendPool:    make(map[discover.NodeId]*fetchBlockRequest),
 		hashQueue:   priqueue.New(int(queueBlockSize)),
 		blockCache:  make([]*queueBlock, blockCacheLimit),
@@ -58,6 +61,7 @@ func (queue *syncQueue) Reset() {
 	queue.hashCounter = 0
 	queue.hashPool = make(map[common.Hash]int)
 	queue.blockPool = make(map[common.Hash]int)
+	queue.headerPool = make(map[common.Hash]*xfsgo.BlockHeader)
 	queue.pendPool = make(map[discover.NodeId]*fetchBlockRequest)
 	queue.hashQueue.Reset()
 	queue.blockCache = make([]*queueBlock, blockCacheLimit)
@@ -66,6 +70,26 @@ func (queue *syncQueue) Reset() {
 func (queue *syncQueue) Insert(hashes []common.Hash) []common.Hash {
 	queue.lock.Lock()
 	defer queue.lock.Unlock()
+	return queue.insert(hashes)
+}
+
+// InsertHeaders schedules the bodies of verified headers for fetching, the
+// bodies delivered must match these headers.
+func (queue *syncQueue) InsertHeaders(headers []*xfsgo.BlockHeader) []common.Hash {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	hashes := make([]common.Hash, 0, len(headers))
+	for _, header := range headers {
+		hash := header.HeaderHash()
+		if _, ok := queue.hashPool[hash]; !ok {
+			queue.headerPool[hash] = header
+		}
+		hashes = append(hashes, hash)
+	}
+	return queue.insert(hashes)
+}
+
+func (queue *syncQueue) insert(hashes []common.Hash) []common.Hash {
 	inserts := make([]common.Hash, 0, len(hashes))
 	for _, hash := range hashes {
 		// Skip anything we already have
@@ -197,6 +221,47 @@ func (queue *syncQueue) Expire(timeout time.Duration) []discover.NodeId {
 func (queue *syncQueue) Deliver(p syncpeer, blocks []*xfsgo.Block) error {
 	queue.lock.Lock()
 	defer queue.lock.Unlock()
+	return queue.deliver(p, blocks)
+}
+
+// DeliverBodies assembles blocks from the scheduled headers and the bodies
+// p sent, bodies whose transactions don't match the header are refused and
+// their blocks fetched again from another peer.
+func (queue *syncQueue) DeliverBodies(p syncpeer, bodies []*RemoteBlockBody) error {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	blocks := make([]*xfsgo.Block, 0, len(bodies))
+	var bad []common.Hash
+	for _, body := range bodies {
+		header, ok := queue.headerPool[body.Hash]
+		if !ok {
+			continue
+		}
+		txs := make([]*xfsgo.Transaction, 0, len(body.Transactions))
+		for _, tx := range body.Transactions {
+			var mTx *xfsgo.Transaction
+			_ = common.Objcopy(tx, &mTx)
+			txs = append(txs, mTx)
+		}
+		if xfsgo.CalcTxsRootHash(txs) != header.TransactionsRoot {
+			bad = append(bad, body.Hash)
+			continue
+		}
+		blocks = append(blocks, &xfsgo.Block{Header: header, Transactions: txs})
+	}
+	for _, hash := range bad {
+		p.AddIgnoreHash(hash)
+	}
+	if err := queue.deliver(p, blocks); err != nil {
+		return err
+	}
+	if len(bad) != 0 {
+		return fmt.Errorf("%w: %x", errInvalidBody, bad)
+	}
+	return nil
+}
+
+func (queue *syncQueue) deliver(p syncpeer, blocks []*xfsgo.Block) error {
 	pid := p.ID()
 	request := queue.pendPool[pid]
 	if request == nil {
@@ -227,6 +292,7 @@ func (queue *syncQueue) Deliver(p syncpeer, blocks []*xfsgo.Block) error {
 		}
 		delete(request.hashes, hash)
 		delete(queue.hashPool, hash)
+		delete(queue.headerPool, hash)
 		queue.blockPool[hash] = int(block.Height())
 	}
 	for hash, index := range request.hashes {
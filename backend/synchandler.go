@@ -10,6 +10,9 @@ type handlerHashesFn func(id discover.NodeId, hashes RemoteHashes)
 type handlerBlocksFn func(id discover.NodeId, hashes RemoteBlocks)
 type handlerNewBlockFn func(id discover.NodeId, block *RemoteBlock) error
 type handlerTransactionsFn func(id discover.NodeId, txs RemoteTxs) error
+type handlerHeadersFn func(id discover.NodeId, headers RemoteBlockHeaders)
+type handlerBodiesFn func(id discover.NodeId, bodies RemoteBlockBodies)
+type handlerNodeDataFn func(id discover.NodeId, data RemoteNodeData)
 
 type syncHandler struct {
 	chain                chainMgr
@@ -17,17 +20,24 @@ type syncHandler struct {
 	handlerBlocksFn      handlerBlocksFn
 	handlerNewBlockFn    handlerNewBlockFn
 	handlerTransactionFn handlerTransactionsFn
+	handlerHeadersFn     handlerHeadersFn
+	handlerBodiesFn      handlerBodiesFn
+	handlerNodeDataFn    handlerNodeDataFn
 }
 
 func newSyncHandler(chain chainMgr, hashesFn handlerHashesFn,
 	blocksFn handlerBlocksFn, newBlockFn handlerNewBlockFn,
-	transactionsFn handlerTransactionsFn) *syncHandler {
+	transactionsFn handlerTransactionsFn, headersFn handlerHeadersFn,
+	bodiesFn handlerBodiesFn, nodeDataFn handlerNodeDataFn) *syncHandler {
 	return &syncHandler{
 		chain:                chain,
 		handlerHashesFn:      hashesFn,
 		handlerBlocksFn:      blocksFn,
 		handlerNewBlockFn:    newBlockFn,
 		handlerTransactionFn: transactionsFn,
+		handlerHeadersFn:     headersFn,
+		handlerBodiesFn:      bodiesFn,
+		handlerNodeDataFn:    nodeDataFn,
 	}
 }
 
@@ -127,3 +137,89 @@ func (handler *syncHandler) handleGotReceipts(req *request, _ sender) error {
 	}
 	return nil
 }
+
+func (handler *syncHandler) handleGetBlockHeaders(req *request, p sender) error {
+	var args *getBlockHeadersData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	headers := make(RemoteBlockHeaders, 0)
+	if args == nil {
+		return p.SendObject(BlockHeadersMsg, &headers)
+	}
+	count := args.Count
+	if count > maxHeadersFetch {
+		count = maxHeadersFetch
+	}
+	for i := uint64(0); i < count; i++ {
+		block := handler.chain.GetBlockByNumber(args.From + i)
+		if block == nil {
+			break
+		}
+		headers = append(headers, coverBlockHeader2RemoteBlockHeader(block.Header))
+	}
+	return p.SendObject(BlockHeadersMsg, &headers)
+}
+
+func (handler *syncHandler) handleGotBlockHeaders(req *request, _ sender) error {
+	var args RemoteBlockHeaders
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	handler.handlerHeadersFn(req.peerId, args)
+	return nil
+}
+
+func (handler *syncHandler) handleGetBlockBodies(req *request, p sender) error {
+	var args RemoteHashes
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	bodies := make(RemoteBlockBodies, 0)
+	for _, hash := range args {
+		block := handler.chain.GetBlockByHashWithoutRec(hash)
+		if block == nil {
+			break
+		}
+		bodies = append(bodies, &RemoteBlockBody{
+			Hash:         hash,
+			Transactions: coverTxs2RemoteBlockTxs(block.Transactions),
+		})
+	}
+	return p.SendObject(BlockBodiesMsg, &bodies)
+}
+
+func (handler *syncHandler) handleGotBlockBodies(req *request, _ sender) error {
+	var args RemoteBlockBodies
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	handler.handlerBodiesFn(req.peerId, args)
+	return nil
+}
+
+func (handler *syncHandler) handleGetNodeData(req *request, p sender) error {
+	var args RemoteHashes
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	data := make(RemoteNodeData, 0)
+	for i, hash := range args {
+		if i >= maxNodesFetch {
+			break
+		}
+		if node := handler.chain.GetStateNodeData(hash); node != nil {
+			data = append(data, node)
+		}
+	}
+	return p.SendObject(NodeDataMsg, &data)
+}
+
+func (handler *syncHandler) handleGotNodeData(req *request, _ sender) error {
+	var args RemoteNodeData
+	if err := req.jsonObj(&args); err != nil {
+		return err
+	}
+	handler.handlerNodeDataFn(req.peerId, args)
+	return nil
+}
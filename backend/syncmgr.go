@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"sync"
 	"sync/atomic"
 	"time"
 	"xfsgo"
+	"xfsgo/api"
+	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
@@ -17,23 +20,46 @@ import (
 )
 
 var (
-	maxHashesFetch      = uint64(512)
-	maxBlocksFetch      = uint64(128)
-	timeoutTTL          = 10 * time.Second
-	blockFetchTTL       = 10 * time.Second
-	errUnKnowPeer       = errors.New("unKnow peer")
-	errTimeout          = errors.New("timeout")
-	errEmptyHashes      = errors.New("empty hashes")
-	errBadHashes        = errors.New("bad hashes")
-	errBadPeer          = errors.New("peer is bad")
-	errNoPeers          = errors.New("no peers to keep download active")
-	errPeersUnavailable = errors.New("no peers available or all peers tried for block download process")
-	errCancelHashFetch  = errors.New("hash fetching canceled (requested)")
-	errCancelBlockFetch = errors.New("block fetching canceled (requested)")
-	errBusy             = errors.New("busy")
+	maxHashesFetch       = uint64(512)
+	maxBlocksFetch       = uint64(128)
+	maxHeadersFetch      = uint64(192)
+	maxBodiesFetch       = 20
+	maxNodesFetch        = 384
+	timeoutTTL           = 10 * time.Second
+	blockFetchTTL        = 10 * time.Second
+	errUnKnowPeer        = errors.New("unKnow peer")
+	errTimeout           = errors.New("timeout")
+	errEmptyHashes       = errors.New("empty hashes")
+	errBadHashes         = errors.New("bad hashes")
+	errBadPeer           = errors.New("peer is bad")
+	errNoPeers           = errors.New("no peers to keep download active")
+	errPeersUnavailable  = errors.New("no peers available or all peers tried for block download process")
+	errCancelHashFetch   = errors.New("hash fetching canceled (requested)")
+	errCancelBlockFetch  = errors.New("block fetching canceled (requested)")
+	errCancelHeaderFetch = errors.New("header fetching canceled (requested)")
+	errBusy              = errors.New("busy")
+	errCheckpointFork    = errors.New("peer chain forks below checkpoint")
+	errInvalidHeaders    = errors.New("retrieved header chain is invalid")
+	errCancelStateFetch  = errors.New("state fetching canceled (requested)")
 	//errEmptyHashSet = errors.New("empty hash set by peer")
 )
 
+// Score adjustments of the behaviour of sync peers, see p2p.Server.
+const (
+	scoreInvalidBlock = -50
+	scoreBadHashes    = -50
+	scoreMalformed    = -50
+	scoreTimeout      = -10
+	scoreSpam         = -2
+	scoreUseful       = 1
+)
+
+// peerScorer keeps the reputation of peers, disconnecting and banning
+// the ones of too low a score.
+type peerScorer interface {
+	AdjustScore(id discover.NodeId, delta int)
+}
+
 type chainMgr interface {
 	CurrentBHeader() *xfsgo.BlockHeader
 	GenesisBHeader() *xfsgo.BlockHeader
@@ -42,7 +68,17 @@ type chainMgr interface {
 	GetBlockByHashWithoutRec(hash common.Hash) *xfsgo.Block
 	GetReceiptByHash(hash common.Hash) *xfsgo.Receipt
 	GetBlockByHash(hash common.Hash) *xfsgo.Block
+	GetTotalWork(hash common.Hash) *big.Int
+	Config() *xfsgo.ChainConfig
+	CheckpointAt(height uint64) *xfsgo.Checkpoint
+	ValidateHeaders(parent *xfsgo.BlockHeader, headers []*xfsgo.BlockHeader) error
+	LastCheckpoint() *xfsgo.Checkpoint
 	InsertChain(block *xfsgo.Block) error
+	InsertFastBlock(block *xfsgo.Block) error
+	CommitFastSync(hash common.Hash) error
+	GetStateNodeData(hash common.Hash) []byte
+	NewStateSync(root common.Hash) *avlmerkle.TreeSync
+	SetStateSyncProgress(progress *xfsgo.StateSyncProgress)
 	SetBoundaries(syncStatsOrigin, syncStatsHeight uint64) error
 }
 type hashPack struct {
@@ -54,6 +90,20 @@ type blockPack struct {
 	blocks RemoteBlocks
 }
 
+type headerPack struct {
+	peerId  discover.NodeId
+	headers RemoteBlockHeaders
+}
+type bodyPack struct {
+	peerId discover.NodeId
+	bodies RemoteBlockBodies
+}
+
+type nodeDataPack struct {
+	peerId discover.NodeId
+	data   RemoteNodeData
+}
+
 type txPack struct {
 	peerId discover.NodeId
 	txs    RemoteTxs
@@ -66,13 +116,17 @@ type syncMgr struct {
 	peers     *peerSet
 	hm        *mHandlerMgr
 	txPool    *xfsgo.TxPool
+	scorer    peerScorer
 	newPeerCh chan syncpeer
 	// chs
-	hashPackCh  chan hashPack
-	blockPackCh chan blockPack
-	txPackCh    chan txPack
-	processCh   chan bool
-	cancelCh    chan struct{}
+	hashPackCh     chan hashPack
+	blockPackCh    chan blockPack
+	headerPackCh   chan headerPack
+	bodyPackCh     chan bodyPack
+	nodeDataPackCh chan nodeDataPack
+	txPackCh       chan txPack
+	processCh      chan bool
+	cancelCh       chan struct{}
 	// lock
 	//syncLock    sync.Mutex
 	processLock      sync.Mutex
@@ -84,6 +138,9 @@ type syncMgr struct {
 	synchronising    int32
 	lastRecord       uint64
 	syncStartTime    time.Time
+	mode             SyncMode
+	// syncRates holds the blocks per second of the last sync from each peer.
+	syncRates map[discover.NodeId]float64
 }
 
 func newSyncMgr(
@@ -92,23 +149,28 @@ func newSyncMgr(
 	eventBus *xfsgo.EventBus,
 	txPool *xfsgo.TxPool) *syncMgr {
 	mgr := &syncMgr{
-		chain:       chain,
-		version:     version,
-		network:     network,
-		peers:       newPeerSet(),
-		eventBus:    eventBus,
-		txPool:      txPool,
-		newPeerCh:   make(chan syncpeer, 1),
-		hashPackCh:  make(chan hashPack, 1),
-		blockPackCh: make(chan blockPack, 1),
-		txPackCh:    make(chan txPack, 1),
-		processCh:   make(chan bool, 1),
-		cancelCh:    make(chan struct{}),
-		queue:       newSyncQueue(),
+		chain:          chain,
+		version:        version,
+		network:        network,
+		peers:          newPeerSet(),
+		eventBus:       eventBus,
+		txPool:         txPool,
+		newPeerCh:      make(chan syncpeer, 1),
+		syncRates:      make(map[discover.NodeId]float64),
+		hashPackCh:     make(chan hashPack, 1),
+		blockPackCh:    make(chan blockPack, 1),
+		headerPackCh:   make(chan headerPack, 1),
+		bodyPackCh:     make(chan bodyPack, 1),
+		nodeDataPackCh: make(chan nodeDataPack, 1),
+		txPackCh:       make(chan txPack, 1),
+		processCh:      make(chan bool, 1),
+		cancelCh:       make(chan struct{}),
+		queue:          newSyncQueue(),
 	}
 	hm := newHandlerMgr()
 	syncHanlder := newSyncHandler(chain, mgr.handleHashes,
-		mgr.handleBlocks, mgr.handleNewBlock, mgr.handleTransactions)
+		mgr.handleBlocks, mgr.handleNewBlock, mgr.handleTransactions,
+		mgr.handleHeaders, mgr.handleBodies, mgr.handleNodeData)
 	hm.Handle(GetBlockHashesFromNumberMsg, syncHanlder.handleGetBlockHashes)
 	hm.Handle(BlockHashesMsg, syncHanlder.handleGotBlockHashes)
 	hm.Handle(GetBlocksMsg, syncHanlder.handleGetBlocks)
@@ -117,6 +179,12 @@ func newSyncMgr(
 	hm.Handle(TxMsg, syncHanlder.handleTransactions)
 	hm.Handle(GetReceipts, syncHanlder.handleGetReceipts)
 	hm.Handle(ReceiptsData, syncHanlder.handleGotReceipts)
+	hm.Handle(GetBlockHeadersMsg, syncHanlder.handleGetBlockHeaders)
+	hm.Handle(BlockHeadersMsg, syncHanlder.handleGotBlockHeaders)
+	hm.Handle(GetBlockBodiesMsg, syncHanlder.handleGetBlockBodies)
+	hm.Handle(BlockBodiesMsg, syncHanlder.handleGotBlockBodies)
+	hm.Handle(GetNodeDataMsg, syncHanlder.handleGetNodeData)
+	hm.Handle(NodeDataMsg, syncHanlder.handleGotNodeData)
 	mgr.hm = hm
 	return mgr
 }
@@ -125,6 +193,13 @@ func (mgr *syncMgr) Handler() handlerMgr {
 	return mgr.hm
 }
 
+// adjustScore reports the behaviour of a peer to the scorer, if any.
+func (mgr *syncMgr) adjustScore(id discover.NodeId, delta int) {
+	if mgr.scorer != nil {
+		mgr.scorer.AdjustScore(id, delta)
+	}
+}
+
 func (mgr *syncMgr) onNewPeer(p2ppeer p2p.Peer) error {
 	p := newPeer(p2ppeer, mgr.version, mgr.network)
 	return mgr.handlePeer(p)
@@ -134,14 +209,23 @@ func (mgr *syncMgr) handleTransactions(p discover.NodeId, txs RemoteTxs) error {
 	if pn == nil {
 		return errUnKnowPeer
 	}
+	repeated := 0
 	for _, tx := range txs {
-		pn.AddTx(tx.Hash)
+		if pn.AddReceivedTx(tx.Hash) {
+			repeated++
+			continue
+		}
 		var targetTx *xfsgo.Transaction
 		_ = common.Objcopy(tx, &targetTx)
 		if err := mgr.txPool.Add(targetTx); err != nil {
 			logrus.Debugf("handle transactions msg err: %s", err)
 		}
 	}
+	// A peer sends a transaction only once. The ones relayed to it may
+	// cross its own relay, they are not repeats.
+	if repeated > 0 {
+		mgr.adjustScore(p, scoreSpam)
+	}
 	return nil
 }
 func (mgr *syncMgr) handleHashes(p discover.NodeId, hashes RemoteHashes) {
@@ -160,7 +244,8 @@ func (mgr *syncMgr) handleHashes(p discover.NodeId, hashes RemoteHashes) {
 }
 
 func (mgr *syncMgr) handleNewBlock(p discover.NodeId, block *RemoteBlock) error {
-	if block == nil {
+	if block == nil || block.Header == nil {
+		mgr.adjustScore(p, scoreMalformed)
 		return fmt.Errorf("block is null")
 	}
 	blockHash := block.Header.Hash
@@ -169,12 +254,27 @@ func (mgr *syncMgr) handleNewBlock(p discover.NodeId, block *RemoteBlock) error
 	if pn == nil {
 		return errUnKnowPeer
 	}
-	if blockHeight > pn.Height() {
+	// A peer announces a block only once, the blocks relayed to it may
+	// cross its announcement.
+	if pn.AddReceivedBlock(blockHash) {
+		mgr.adjustScore(p, scoreSpam)
+		return nil
+	}
+	// The work of the announced chain is known if we have the parent block.
+	var work *big.Int
+	if parentWork := mgr.chain.GetTotalWork(block.Header.HashPrevBlock); parentWork != nil {
+		work = new(big.Int).Add(parentWork, xfsgo.CalcWorkloadByBits(block.Header.Bits))
+	}
+	peerWork := pn.TotalWork()
+	if (work != nil && peerWork != nil && work.Cmp(peerWork) > 0) ||
+		((work == nil || peerWork == nil) && blockHeight > pn.Height()) {
 		mgr.peers.setHeight(p, blockHeight)
 		mgr.peers.setHead(p, blockHash)
+		if work != nil {
+			mgr.peers.setTotalWork(p, work)
+		}
 		go mgr.Synchronise(pn)
 	}
-	pn.AddBlock(block.Header.Hash)
 	go mgr.BroadcastBlock(block)
 	return nil
 }
@@ -194,15 +294,76 @@ func (mgr *syncMgr) handleBlocks(p discover.NodeId, blocks RemoteBlocks) {
 	}
 }
 
+func (mgr *syncMgr) handleHeaders(p discover.NodeId, headers RemoteBlockHeaders) {
+	// Packs are only read while synchronising, drop unsolicited ones.
+	if atomic.LoadInt32(&mgr.synchronising) == 0 {
+		return
+	}
+	mgr.cancelLock.RLock()
+	cancel := mgr.cancelCh
+	mgr.cancelLock.RUnlock()
+	select {
+	case <-cancel:
+		return
+	case mgr.headerPackCh <- headerPack{
+		peerId:  p,
+		headers: headers,
+	}:
+	}
+}
+
+func (mgr *syncMgr) handleBodies(p discover.NodeId, bodies RemoteBlockBodies) {
+	// Packs are only read while synchronising, drop unsolicited ones.
+	if atomic.LoadInt32(&mgr.synchronising) == 0 {
+		return
+	}
+	mgr.cancelLock.RLock()
+	cancel := mgr.cancelCh
+	mgr.cancelLock.RUnlock()
+	select {
+	case <-cancel:
+		return
+	case mgr.bodyPackCh <- bodyPack{
+		peerId: p,
+		bodies: bodies,
+	}:
+	}
+}
+
+func (mgr *syncMgr) handleNodeData(p discover.NodeId, data RemoteNodeData) {
+	// Packs are only read while synchronising, drop unsolicited ones.
+	if atomic.LoadInt32(&mgr.synchronising) == 0 {
+		return
+	}
+	mgr.cancelLock.RLock()
+	cancel := mgr.cancelCh
+	mgr.cancelLock.RUnlock()
+	select {
+	case <-cancel:
+		return
+	case mgr.nodeDataPackCh <- nodeDataPack{
+		peerId: p,
+		data:   data,
+	}:
+	}
+}
+
 func (mgr *syncMgr) handlePeer(p syncpeer) error {
 	var err error = nil
 	head := mgr.chain.CurrentBHeader()
 	genesis := mgr.chain.GenesisBHeader()
-	if err = p.Handshake(head.HeaderHash(), head.Height, genesis.HeaderHash()); err != nil {
+	if err = p.Handshake(&statusData{
+		Head:      head.HeaderHash(),
+		Height:    head.Height,
+		TotalWork: mgr.chain.GetTotalWork(head.HeaderHash()),
+		Genesis:   genesis.HeaderHash(),
+		Forks:     mgr.chain.Config().Forks,
+	}); err != nil {
 		return err
 	}
 	mgr.peers.appendPeer(p)
 	mgr.newPeerCh <- p
+	defer mgr.forgetSyncRate(p.ID())
 	defer mgr.peers.dropPeer(p.ID())
 	// Send local transaction to remote synchronization
 	mgr.syncTransactions(p)
@@ -237,6 +398,9 @@ func (mgr *syncMgr) handleMsg(s sender, p protocolMsgReader) error {
 			return err
 		}
 		if err = mgr.hm.OnMessage(p.ID(), s, msgCode, data); err != nil {
+			if errors.Is(err, errMalformedMsg) {
+				mgr.adjustScore(p.ID(), scoreMalformed)
+			}
 			return err
 		}
 	default:
@@ -322,7 +486,7 @@ func (mgr *syncMgr) findAncestor(p syncpeer) (uint64, error) {
 	if !bytes.Equal(haveHash[:], common.HashZ[:]) {
 		//logrus.Debugf("Found ancestor block: height=%d, hash=%x...%x, peerId=%x...%x",
 		//	number, haveHash[:4], haveHash[len(haveHash)-4:], pid[:4], pid[len(pid)-4:])
-		return number, nil
+		return mgr.checkAncestor(number, height)
 	}
 	logrus.Warnf("Not found ancestor: currentHeight=%d, from=%d, count=%d, peerId=%x",
 		height, from, maxHashesFetch, pid[len(pid)-4:])
@@ -349,6 +513,7 @@ func (mgr *syncMgr) findAncestor(p syncpeer) (uint64, error) {
 				}
 				hashes := pack.hashes
 				if len(hashes) != 1 {
+					mgr.adjustScore(pack.peerId, scoreBadHashes)
 					return 0, errBadHashes
 				}
 				arrived = true
@@ -360,70 +525,214 @@ func (mgr *syncMgr) findAncestor(p syncpeer) (uint64, error) {
 			}
 		}
 	}
-	return left, nil
+	return mgr.checkAncestor(left, height)
 }
 
-func (mgr *syncMgr) fetchHashes(p syncpeer, from uint64) error {
+// checkAncestor refuses a common ancestor below the last checkpoint our
+// chain of height has reached, the peer is on a fork the checkpoint rules out.
+func (mgr *syncMgr) checkAncestor(number, height uint64) (uint64, error) {
+	if cp := mgr.chain.LastCheckpoint(); cp != nil && cp.Height <= height && number < cp.Height {
+		logrus.Warnf("Refuse fork below checkpoint: ancestor=%d, checkpoint=%d", number, cp.Height)
+		return 0, errCheckpointFork
+	}
+	return number, nil
+}
+
+// headerRequest is a batch of headers requested from a peer.
+type headerRequest struct {
+	from  uint64
+	count uint64
+	time  time.Time
+}
+
+// fetchHeaders downloads the header chain of p from from up to to. The batches
+// are spread over the peers high enough to serve them, each must continue
+// the verified chain with valid proof of work before the bodies of its
+// blocks are scheduled. Only p may end the chain, a batch another peer
+// can't serve in full is fetched again elsewhere.
+func (mgr *syncMgr) fetchHeaders(p syncpeer, from, to uint64) error {
 	pid := p.ID()
-	timeout := time.NewTimer(0)
-	<-timeout.C
-	defer timeout.Stop()
-	getHashes := func(num uint64) {
-		logrus.Debugf("Fetching Hashes: from=%d, count=%d, peerId=%x", from, maxHashesFetch, pid[len(pid)-4:])
-		go func() {
-			if err := p.RequestHashesFromNumber(from, maxHashesFetch); err != nil {
-				logrus.Warnf("Requst fetch hashes from number err: from=%d, count=%d, err=%s, peerId=%x",
-					from, maxHashesFetch, err, pid[len(pid)-4:])
-			}
-		}()
-		timeout.Reset(timeoutTTL)
+	parent := mgr.chain.GetBlockByNumber(from - 1)
+	if parent == nil {
+		return errInvalidHeaders
+	}
+	var (
+		last    = parent.Header
+		next    = from
+		end     = to + 1
+		retries = make([]uint64, 0)
+		pending = make(map[discover.NodeId]*headerRequest)
+		results = make(map[uint64]headerPack)
+		useless = make(map[discover.NodeId]struct{})
+	)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	// reject stops fetching headers from a peer other than p and fetches
+	// its batch again.
+	reject := func(id discover.NodeId, start uint64) {
+		useless[id] = struct{}{}
+		retries = append(retries, start)
+	}
+	assign := func(sp syncpeer) {
+		id := sp.ID()
+		if _, busy := pending[id]; busy {
+			return
+		}
+		if _, bad := useless[id]; bad {
+			return
+		}
+		fits := func(start uint64) bool {
+			return id == pid || start+maxHeadersFetch-1 <= sp.Height()
+		}
+		var start uint64
+		switch {
+		case len(retries) > 0 && fits(retries[0]):
+			start, retries = retries[0], retries[1:]
+		case len(retries) == 0 && next < end && fits(next):
+			start, next = next, next+maxHeadersFetch
+		default:
+			return
+		}
+		logrus.Debugf("Fetching headers: from=%d, count=%d, peerId=%x", start, maxHeadersFetch, id[len(id)-4:])
+		if err := sp.RequestHeadersFromNumber(start, maxHeadersFetch); err != nil {
+			retries = append(retries, start)
+			return
+		}
+		pending[id] = &headerRequest{
+			from:  start,
+			count: maxHeadersFetch,
+			time:  time.Now(),
+		}
 	}
-	getHashes(from)
-	//gotHashes := false
 	for {
 		select {
 		case <-mgr.cancelCh:
-			return errCancelHashFetch
-		case <-timeout.C:
-			logrus.Warnf("Fetch hashes timeout: from=%d, count: %d, peerId=%x...%x",
-				from, maxHashesFetch, pid[0:4], pid[len(pid)-4:])
-			return errTimeout
-		case pack := <-mgr.hashPackCh:
-			wanId := p.ID()
-			wantPeerId := wanId[:]
-			gotPeerId := pack.peerId[:]
-			if !bytes.Equal(wantPeerId, gotPeerId) {
+			return errCancelHeaderFetch
+		case pack := <-mgr.headerPackCh:
+			request := pending[pack.peerId]
+			if request == nil {
 				break
 			}
-			timeout.Stop()
-			hashes := pack.hashes
-			if len(hashes) == 0 {
-				//headBlock := h.blockchain.CurrentBHeader()
-				//headHeight := headBlock.Height
-				select {
-				case mgr.processCh <- false:
+			delete(pending, pack.peerId)
+			n := uint64(len(pack.headers))
+			switch {
+			case n > request.count && pack.peerId == pid:
+				mgr.adjustScore(pid, scoreInvalidBlock)
+				return errBadPeer
+			case n > request.count:
+				mgr.adjustScore(pack.peerId, scoreInvalidBlock)
+				reject(pack.peerId, request.from)
+			case n < request.count && pack.peerId != pid:
+				reject(pack.peerId, request.from)
+			default:
+				if n < request.count && request.from+n < end {
+					end = request.from + n
 				}
-				//if !gotHashes {
-				//	return errBadPeer
-				//}
-				return nil
+				results[request.from] = pack
 			}
-			//gotHashes = true
-			inserts := mgr.queue.Insert(hashes)
-			if len(inserts) != len(pack.hashes) {
-				return errBadPeer
+		case <-ticker.C:
+			for id, request := range pending {
+				if time.Since(request.time) < timeoutTTL {
+					continue
+				}
+				mgr.adjustScore(id, scoreTimeout)
+				if id == pid {
+					logrus.Warnf("Fetch headers timeout: from=%d, count: %d, peerId=%x...%x",
+						request.from, request.count, pid[0:4], pid[len(pid)-4:])
+					return errTimeout
+				}
+				delete(pending, id)
+				reject(id, request.from)
+			}
+		}
+		// Verify the batches continuing the chain in order.
+		for {
+			start := last.Height + 1
+			pack, ok := results[start]
+			if !ok || start >= end {
+				break
+			}
+			delete(results, start)
+			headers, err := mgr.verifyHeaders(last, pack.headers)
+			if err != nil {
+				if !errors.Is(err, xfsgo.ErrBlockTimeTooNew) {
+					mgr.adjustScore(pack.peerId, scoreInvalidBlock)
+				}
+				if pack.peerId == pid {
+					return err
+				}
+				logrus.Warnf("Refuse headers: from=%d, err=%v, peerId=%x", start, err, pack.peerId[len(pack.peerId)-4:])
+				reject(pack.peerId, start)
+				break
+			}
+			if len(headers) == 0 {
+				break
 			}
+			mgr.adjustScore(pack.peerId, scoreUseful)
+			mgr.queue.InsertHeaders(headers)
+			last = headers[len(headers)-1]
 			select {
 			case mgr.processCh <- true:
 			default:
 			}
-			from += uint64(len(pack.hashes))
-			getHashes(from)
 		}
+		if last.Height+1 >= end {
+			select {
+			case mgr.processCh <- false:
+			case <-mgr.cancelCh:
+				return errCancelHeaderFetch
+			}
+			return nil
+		}
+		// Don't run further ahead of the body download than the queue holds.
+		if mgr.queue.Pending() >= int(queueBlockSize) {
+			continue
+		}
+		assign(p)
+		for _, sp := range mgr.peers.listAndShort() {
+			if sp.ID() != pid {
+				assign(sp)
+			}
+		}
+	}
+}
+
+// verifyHeaders checks headers continue the chain of parent, match the
+// checkpoints and pass the header checks of the chain, the proof of work
+// and the timestamps included. A header ahead of the local clock fails
+// with xfsgo.ErrBlockTimeTooNew, any other invalid one with errInvalidHeaders.
+func (mgr *syncMgr) verifyHeaders(parent *xfsgo.BlockHeader, headers RemoteBlockHeaders) ([]*xfsgo.BlockHeader, error) {
+	first := parent
+	parentHash := parent.HeaderHash()
+	result := make([]*xfsgo.BlockHeader, 0, len(headers))
+	for _, remote := range headers {
+		var header *xfsgo.BlockHeader
+		if err := common.Objcopy(remote, &header); err != nil || header == nil {
+			return nil, errInvalidHeaders
+		}
+		hash := header.HeaderHash()
+		if hash != remote.Hash {
+			return nil, fmt.Errorf("%w: hash mismatch at height %d", errInvalidHeaders, header.Height)
+		}
+		if header.Height != parent.Height+1 || header.HashPrevBlock != parentHash {
+			return nil, fmt.Errorf("%w: unlinked header at height %d", errInvalidHeaders, header.Height)
+		}
+		if cp := mgr.chain.CheckpointAt(header.Height); cp != nil && cp.Hash != hash {
+			return nil, errCheckpointFork
+		}
+		result = append(result, header)
+		parent, parentHash = header, hash
 	}
+	if err := mgr.chain.ValidateHeaders(first, result); err != nil {
+		if errors.Is(err, xfsgo.ErrBlockTimeTooNew) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errInvalidHeaders, err)
+	}
+	return result, nil
 }
 
-func (mgr *syncMgr) processQueue() {
+func (mgr *syncMgr) processQueue(insert func(block *xfsgo.Block) error) {
 	mgr.processLock.Lock()
 	defer mgr.processLock.Unlock()
 	blocks := mgr.queue.TakeBlocks()
@@ -448,7 +757,7 @@ func (mgr *syncMgr) processQueue() {
 		ignoreBlocks := 0
 		orphanBlocks := 0
 		for lastIndex, lastBlock = range raw {
-			if err = mgr.chain.InsertChain(lastBlock); err != nil {
+			if err = insert(lastBlock); err != nil {
 				switch err {
 				case xfsgo.ErrBlockIgnored:
 					ignoreBlocks += 1
@@ -466,7 +775,12 @@ func (mgr *syncMgr) processQueue() {
 		if err != nil {
 			logrus.Errorf("Insert block to chain failed: %v", err)
 			mgr.cancel()
-			mgr.peers.dropPeer(blocks[lastIndex].originPeer)
+			// Only a block breaking the consensus rules is the fault of the
+			// peer, not a local failure nor a timestamp ahead of our clock.
+			if xfsgo.IsInvalidBlockError(err) {
+				mgr.adjustScore(blocks[lastIndex].originPeer, scoreInvalidBlock)
+				mgr.peers.dropPeer(blocks[lastIndex].originPeer)
+			}
 			return
 		}
 		if len(raw) <= 0 {
@@ -479,18 +793,20 @@ func (mgr *syncMgr) processQueue() {
 	}
 }
 
-func (mgr *syncMgr) fetchBlocks(from uint64, id discover.NodeId) error {
+// fetchBodies downloads the bodies of the scheduled headers in parallel
+// across the peers.
+func (mgr *syncMgr) fetchBodies(from uint64, id discover.NodeId, insert func(block *xfsgo.Block) error) error {
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 	sendFetchRequest := func(p syncpeer, request *fetchBlockRequest) error {
 		pid := p.ID()
 		requestHashes := request.hashes
-		logrus.Debugf("Fetch blocks: count=%d, peerId=%x", len(requestHashes), pid[len(pid)-4:])
+		logrus.Debugf("Fetch bodies: count=%d, peerId=%x", len(requestHashes), pid[len(pid)-4:])
 		hashes := make([]common.Hash, 0)
 		for k := range requestHashes {
 			hashes = append(hashes, k)
 		}
-		return p.RequestBlocks(hashes)
+		return p.RequestBodies(hashes)
 	}
 	update := make(chan struct{}, 1)
 	mgr.queue.Prepare(from)
@@ -517,8 +833,27 @@ func (mgr *syncMgr) fetchBlocks(from uint64, id discover.NodeId) error {
 				err := mgr.queue.Deliver(p, blocks)
 				if err != nil {
 					logrus.Errorf("Fetch block err: %v", err)
+				} else if len(blocks) > 0 {
+					mgr.adjustScore(pack.peerId, scoreUseful)
 				}
-				go mgr.processQueue()
+				go mgr.processQueue(insert)
+			}
+			select {
+			case update <- struct{}{}:
+			default:
+			}
+		case pack := <-mgr.bodyPackCh:
+			if p := mgr.peers.get(pack.peerId); p != nil {
+				switch err := mgr.queue.DeliverBodies(p, pack.bodies); {
+				case errors.Is(err, errInvalidBody):
+					mgr.adjustScore(pack.peerId, scoreInvalidBlock)
+					logrus.Warnf("Fetch bodies err: %v, peerId=%x", err, pack.peerId[len(pack.peerId)-4:])
+				case err != nil:
+					logrus.Warnf("Fetch bodies err: %v, peerId=%x", err, pack.peerId[len(pack.peerId)-4:])
+				case len(pack.bodies) > 0:
+					mgr.adjustScore(pack.peerId, scoreUseful)
+				}
+				go mgr.processQueue(insert)
 			}
 			select {
 			case update <- struct{}{}:
@@ -538,8 +873,8 @@ func (mgr *syncMgr) fetchBlocks(from uint64, id discover.NodeId) error {
 			}
 			for _, pid := range mgr.queue.Expire(blockFetchTTL) {
 				if p := mgr.peers.get(pid); p != nil {
-					// TODO: down
 					logrus.Warnf("block delivery timeout: %x", pid[len(pid)-4:])
+					mgr.adjustScore(pid, scoreTimeout)
 				}
 			}
 			if mgr.queue.Pending() == 0 {
@@ -552,7 +887,7 @@ func (mgr *syncMgr) fetchBlocks(from uint64, id discover.NodeId) error {
 				if mgr.queue.Throttle() {
 					break
 				}
-				request := mgr.queue.Reserve(p, 20)
+				request := mgr.queue.Reserve(p, maxBodiesFetch)
 				if request == nil {
 					continue
 				}
@@ -592,6 +927,9 @@ func (mgr *syncMgr) report(v uint64, t time.Time, id discover.NodeId) {
 	if err != nil {
 		return
 	}
+	mgr.reportMu.Lock()
+	mgr.syncRates[id] = syncSpeed
+	mgr.reportMu.Unlock()
 	//logrus.Infof("Sync in progress: start=%.2f%%, with=...%x", progress, id[len(id)-4:])
 	logrus.Infof("Sync in progress: localHead=%d, start=%d, end=%d, complete=%d/%d(%.2f%%), speed=%.4f/s, from=%s",
 		nowHeight, v, mgr.lastRecord, compileNumber, syncTotal, compile*100, syncSpeed, p)
@@ -606,6 +944,28 @@ func (mgr *syncMgr) peerReportString(id discover.NodeId) (string, error) {
 	paddr := p.P2PPeer().RemoteNode().TcpAddr()
 	return fmt.Sprintf("%x@%s", id[:4], paddr.String()), nil
 }
+func (mgr *syncMgr) forgetSyncRate(id discover.NodeId) {
+	mgr.reportMu.Lock()
+	defer mgr.reportMu.Unlock()
+	delete(mgr.syncRates, id)
+}
+
+// peerSyncState returns the sync state of a connected peer, nil if unknown.
+func (mgr *syncMgr) peerSyncState(id discover.NodeId) *api.PeerSyncState {
+	p := mgr.peers.get(id)
+	if p == nil {
+		return nil
+	}
+	mgr.reportMu.RLock()
+	defer mgr.reportMu.RUnlock()
+	return &api.PeerSyncState{
+		Version:  mgr.version,
+		Head:     p.Head(),
+		Height:   p.Height(),
+		SyncRate: mgr.syncRates[id],
+	}
+}
+
 func (mgr *syncMgr) syncWithPeer(p syncpeer) error {
 	if p == nil {
 		return nil
@@ -629,6 +989,15 @@ func (mgr *syncMgr) syncWithPeer(p syncpeer) error {
 	if number, err = mgr.findAncestor(p); err != nil {
 		return err
 	}
+	// A new node downloads the state at a recent pivot instead of
+	// executing the blocks below it.
+	if head := mgr.chain.CurrentBHeader(); mgr.mode == FastSync && head.Height == 0 && p.Height() > fastSyncPivotGap {
+		pivot := p.Height() - fastSyncPivotGap
+		if err = mgr.fastSync(p, pivot); err != nil {
+			return err
+		}
+		number = pivot
+	}
 	_ = mgr.chain.SetBoundaries(number, p.Height())
 
 	mgr.syncStartTime = time.Now()
@@ -636,10 +1005,10 @@ func (mgr *syncMgr) syncWithPeer(p syncpeer) error {
 	logrus.Infof("Successfully find ancestor: number=%d, peerId=%x", number, pId[len(pId)-4:])
 	errc := make(chan error, 2)
 	go func() {
-		errc <- mgr.fetchHashes(p, number+1)
+		errc <- mgr.fetchHeaders(p, number+1, math.MaxUint64-1)
 	}()
 	go func() {
-		errc <- mgr.fetchBlocks(number+1, pId)
+		errc <- mgr.fetchBodies(number+1, pId, mgr.chain.InsertChain)
 	}()
 	if err = <-errc; err != nil {
 		mgr.cancel()
@@ -674,7 +1043,15 @@ func (mgr *syncMgr) Synchronise(p syncpeer) {
 	chainHead := mgr.chain.CurrentBHeader()
 	currentHeight := chainHead.Height
 	//logrus.Infof("chainHead: %d, pheight: %d", currentHeight, p.Height())
-	if p.Height() <= currentHeight {
+	// Only a chain with more work than ours is worth syncing, peers
+	// which did not announce their work are compared by height.
+	peerWork := p.TotalWork()
+	currentWork := mgr.chain.GetTotalWork(chainHead.HeaderHash())
+	if peerWork != nil && currentWork != nil {
+		if peerWork.Cmp(currentWork) <= 0 {
+			return
+		}
+	} else if p.Height() <= currentHeight {
 		return
 	}
 	switch err := mgr.synchronise(p.ID()); err {
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 	"xfsgo"
@@ -413,3 +415,234 @@ func TestHandleMsg_handleGetReceipts(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHandleMsg_handleGetBlockHeaders(t *testing.T) {
+	chain := newTestChainMgr(testGenesis, common.Address{})
+	maxChain := chain.Copy()
+	maxChain.NewEmptyBlocks(10)
+	txpool := newTestTxPool(maxChain, maxChain.genesis.Header.GasLimit, testGasPrice)
+	mgr := newSyncMgrTester(t, maxChain, txpool)
+	send := newResultCheckSender(func(tt uint8, data []byte) error {
+		if tt != BlockHeadersMsg {
+			return fmt.Errorf("check type err: want=%d, got=%d", BlockHeadersMsg, tt)
+		}
+		var args RemoteBlockHeaders
+		if err := json.Unmarshal(data, &args); err != nil {
+			return err
+		}
+		if len(args) != 6 {
+			return fmt.Errorf("check result lenght err: want:%d, got=%d", 6, len(args))
+		}
+		for i, header := range args {
+			want := maxChain.GetBlockByNumber(uint64(5 + i)).HeaderHash()
+			if !bytes.Equal(want[:], header.Hash[:]) {
+				return fmt.Errorf("check result hashes err: index=%d, wantHash: %x, gotHash: %x", i, want, header.Hash)
+			}
+		}
+		return nil
+	})
+	reader := newMsgOnceSendTester(testNodes[0].nodeId, testSendTTL)
+	go func() {
+		_ = reader.SendObject(GetBlockHeadersMsg, &getBlockHeadersData{From: 5, Count: 10})
+	}()
+	err := mgr.handleMsg(send, reader)
+	if err != nil && err != errEOF {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncMgr_verifyHeaders(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	// The difficulty is retargeted every 4 blocks.
+	genesis, err := xfsgo.WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{
+		"bits": 2147483680,
+		"timestamp": "1000",
+		"config": {"target_block_time": 60, "retarget_timespan": 240, "adjustment_factor": 4}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := xfsgo.NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), xfsgo.NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey)
+	mine := func(parent *xfsgo.BlockHeader, bits uint32, timestamp uint64) *xfsgo.BlockHeader {
+		header := &xfsgo.BlockHeader{
+			Height:        parent.Height + 1,
+			HashPrevBlock: parent.HeaderHash(),
+			Timestamp:     timestamp,
+			Coinbase:      coinbase,
+			GasLimit:      new(big.Int),
+			GasUsed:       new(big.Int),
+			Bits:          bits,
+		}
+		for xfsgo.CheckProofOfWork(header.HeaderHash(), bits, genesis.Bits()) != nil {
+			header.Nonce++
+		}
+		return header
+	}
+	// The blocks come every 45 seconds, the target of the fourth one is
+	// lowered by the 135 seconds of the three blocks before it over 240.
+	target := new(big.Int).Mul(xfsgo.BitsUnzip(genesis.Bits()), big.NewInt(135))
+	retarget := xfsgo.BigByZip(target.Div(target, big.NewInt(240)))
+	headers := make(RemoteBlockHeaders, 0)
+	parent := genesis.Header
+	for i := 1; i <= 5; i++ {
+		bits := genesis.Bits()
+		if i >= 4 {
+			bits = retarget
+		}
+		parent = mine(parent, bits, parent.Timestamp+45)
+		headers = append(headers, coverBlockHeader2RemoteBlockHeader(parent))
+	}
+	mgr := newSyncMgr(testVersion, testNetwork, chain, testEventBus, nil)
+	got, err := mgr.verifyHeaders(genesis.Header, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(headers) || got[4].HeaderHash() != headers[4].Hash {
+		t.Fatalf("unexpected verified headers: %d", len(got))
+	}
+	unlinked := append(RemoteBlockHeaders{headers[0]}, headers[2:]...)
+	if _, err = mgr.verifyHeaders(genesis.Header, unlinked); !errors.Is(err, errInvalidHeaders) {
+		t.Fatalf("want err %v, got %v", errInvalidHeaders, err)
+	}
+	first := mine(genesis.Header, genesis.Bits(), genesis.Header.Timestamp+45)
+	if _, err = mgr.verifyHeaders(first, headers[:1]); !errors.Is(err, errInvalidHeaders) {
+		t.Fatalf("want err %v, got %v", errInvalidHeaders, err)
+	}
+	// A header without enough work is refused even if it links up.
+	for xfsgo.CheckProofOfWork(first.HeaderHash(), first.Bits, first.Bits) == nil {
+		first.Nonce++
+	}
+	if _, err = mgr.verifyHeaders(genesis.Header, RemoteBlockHeaders{coverBlockHeader2RemoteBlockHeader(first)}); !errors.Is(err, errInvalidHeaders) {
+		t.Fatalf("want err %v, got %v", errInvalidHeaders, err)
+	}
+	// Neither is a header keeping the bits past the retarget, nor one
+	// older than the median time of its parents.
+	stale := append(RemoteBlockHeaders{}, headers[:3]...)
+	stale = append(stale, coverBlockHeader2RemoteBlockHeader(mine(got[2], genesis.Bits(), got[2].Timestamp+45)))
+	if _, err = mgr.verifyHeaders(genesis.Header, stale); !errors.Is(err, errInvalidHeaders) {
+		t.Fatalf("want err %v, got %v", errInvalidHeaders, err)
+	}
+	old := append(RemoteBlockHeaders{}, headers[:3]...)
+	old = append(old, coverBlockHeader2RemoteBlockHeader(mine(got[2], retarget, got[0].Timestamp)))
+	if _, err = mgr.verifyHeaders(genesis.Header, old); !errors.Is(err, errInvalidHeaders) {
+		t.Fatalf("want err %v, got %v", errInvalidHeaders, err)
+	}
+	// A header ahead of the local clock is not held against the peer.
+	future := uint64(time.Now().Add(3 * time.Hour).Unix())
+	ahead := RemoteBlockHeaders{coverBlockHeader2RemoteBlockHeader(mine(genesis.Header, genesis.Bits(), future))}
+	if _, err = mgr.verifyHeaders(genesis.Header, ahead); !errors.Is(err, xfsgo.ErrBlockTimeTooNew) {
+		t.Fatalf("want err %v, got %v", xfsgo.ErrBlockTimeTooNew, err)
+	}
+}
+
+type testScorer struct {
+	mu     sync.Mutex
+	scores map[discover.NodeId]int
+}
+
+func (s *testScorer) AdjustScore(id discover.NodeId, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scores[id] += delta
+}
+
+func TestHandleMsg_malformed(t *testing.T) {
+	chain := newTestChainMgr(testGenesis, common.Address{})
+	txpool := newTestTxPool(chain, chain.genesis.Header.GasLimit, testGasPrice)
+	mgr := newSyncMgrTester(t, chain, txpool)
+	scorer := &testScorer{scores: make(map[discover.NodeId]int)}
+	mgr.mgr.scorer = scorer
+	reader := newMsgOnceSendTester(testNodes[0].nodeId, testSendTTL)
+	go func() {
+		_ = reader.SendData(NewBlockMsg, []byte("{"))
+	}()
+	if err := mgr.handleMsg(reader, reader); !errors.Is(err, errMalformedMsg) {
+		t.Fatalf("want err %v, got %v", errMalformedMsg, err)
+	}
+	scorer.mu.Lock()
+	defer scorer.mu.Unlock()
+	if got := scorer.scores[testNodes[0].nodeId]; got != scoreMalformed {
+		t.Fatalf("want score %d, got %d", scoreMalformed, got)
+	}
+}
+
+func TestSyncMgr_crossingRelays(t *testing.T) {
+	chain := newTestChainMgr(testGenesis, common.Address{})
+	mgr := newSyncMgr(testVersion, testNetwork, chain, testEventBus,
+		newTestTxPool(chain, chain.genesis.Header.GasLimit, testGasPrice))
+	scorer := &testScorer{scores: make(map[discover.NodeId]int)}
+	mgr.scorer = scorer
+	pipe, _ := newTestPipePeers(testNodes[0].nodeId, testNodes[1].nodeId)
+	p := newPeer(pipe, testVersion, testNetwork)
+	mgr.peers.appendPeer(p)
+	txs := coverTxs2RemoteBlockTxs([]*xfsgo.Transaction{
+		xfsgo.NewTransactionByStdAndSign(&xfsgo.StdTransaction{
+			GasLimit: chain.genesis.Header.GasLimit,
+			GasPrice: testGasPrice,
+			Value:    new(big.Int),
+		}, crypto.MustGenPrvKey()),
+	})
+	block := coverBlock2RemoteBlock(chain.genesis)
+	score := func() int {
+		scorer.mu.Lock()
+		defer scorer.mu.Unlock()
+		return scorer.scores[p.ID()]
+	}
+	// The peer relays the transactions and the block while we relay them
+	// to it.
+	if err := p.SendTransactions(txs); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SendNewBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.handleTransactions(p.ID(), txs); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.handleNewBlock(p.ID(), block); err != nil {
+		t.Fatal(err)
+	}
+	if got := score(); got != 0 {
+		t.Fatalf("want crossing relays not penalized, got score %d", got)
+	}
+	// Sending them again is spam.
+	_ = mgr.handleTransactions(p.ID(), txs)
+	_ = mgr.handleNewBlock(p.ID(), block)
+	if got := score(); got != 2*scoreSpam {
+		t.Fatalf("want score %d for repeats, got %d", 2*scoreSpam, got)
+	}
+}
+
+func TestSyncMgr_processQueueScore(t *testing.T) {
+	mgr := newSyncMgr(testVersion, testNetwork, newTestChainMgr(testGenesis, common.Address{}), testEventBus, nil)
+	scorer := &testScorer{scores: make(map[discover.NodeId]int)}
+	mgr.scorer = scorer
+	block := xfsgo.NewBlock(&xfsgo.BlockHeader{
+		Height:   1,
+		GasLimit: new(big.Int),
+		GasUsed:  new(big.Int),
+	}, nil, nil)
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{xfsgo.ErrWriteBlock, 0},
+		{xfsgo.ErrApplyTransactions, 0},
+		{fmt.Errorf("%w: timestamp=2, limit=1", xfsgo.ErrBlockTimeTooNew), 0},
+		{fmt.Errorf("%w: nonce", xfsgo.ErrInvalidPow), scoreInvalidBlock},
+		{xfsgo.ErrBadBlock, scoreInvalidBlock},
+	}
+	for i, tt := range tests {
+		origin := testNodes[i].nodeId
+		mgr.queue.blockCache[0] = &queueBlock{rawBlock: block, originPeer: origin}
+		mgr.processQueue(func(*xfsgo.Block) error { return tt.err })
+		if got := scorer.scores[origin]; got != tt.want {
+			t.Errorf("%v: want score %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
 	"time"
@@ -55,8 +56,6 @@ const (
 )
 
 var (
-	baseSubsidy, _        = new(big.Int).SetString("93755722410000000000", 10)
-	baseTestSubsidy, _    = common.BaseCoin2Atto("14")
 	GasPoolOutErr         = errors.New("gas pool out err")
 	ErrBlockIgnored       = errors.New("block hash ignore")
 	ErrBadBlock           = errors.New("bad block")
@@ -64,6 +63,7 @@ var (
 	ErrWriteBlock         = errors.New("write block err")
 	ErrOrphansBlock       = errors.New("block is orphans")
 	ErrDifficultyOverflow = errors.New("difficulty overflow")
+	ErrTxVersionNotActive = errors.New("transaction version not active")
 )
 
 type orphanBlock struct {
@@ -83,6 +83,8 @@ type IBlockChain interface {
 	GetBlocksFromHash(hash common.Hash, n int) []*Block
 	GenesisBHeader() *BlockHeader
 	CurrentBHeader() *BlockHeader
+	GetTotalWork(hash common.Hash) *big.Int
+	CurrentTotalWork() *big.Int
 	LatestGasLimit() *big.Int
 	LastBlockHash() common.Hash
 	setLastState() error
@@ -118,6 +120,7 @@ type IBlockChain interface {
 	CalcNextRequiredBitsByHeight(height uint64, hash common.Hash) (uint32, error)
 	CurrentStateTree() *StateTree
 	CommitLogs(block *Block) error
+	Config() *ChainConfig
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -130,12 +133,17 @@ type BlockChain struct {
 	extraDB        *extraDB
 	logStorage     vm.LogStorage
 	genesisBHeader *BlockHeader
+	config         *ChainConfig
 	currentBHeader *BlockHeader
 	lastBlockHash  common.Hash
 	stateTree      *StateTree
 	mu             sync.RWMutex
 	chainmu        sync.RWMutex
 	eventBus       *EventBus
+	validator      *BlockValidator
+	badBlocks      *badBlockCache
+	checkpoints    checkpointList
+	checkpointsMu  sync.RWMutex
 	// orphans
 	orphans      map[common.Hash]*orphanBlock
 	prevOrphans  map[common.Hash][]*orphanBlock
@@ -145,18 +153,29 @@ type BlockChain struct {
 	syncStatsOrigin uint64       // Origin block number where syncing started at
 	syncStatsHeight uint64       // Highest block number known when syncing started
 	syncStatsLock   sync.RWMutex // Lock protecting the sync stats fields
+	stateSync       *StateSyncProgress
+	// light chains keep headers only, see light_chain.go
+	light        bool
+	lightBackend LightBackend
 }
 
 func NewBlockChainN(stateDB, chainDB, extraDB, logDB badger.IStorage, eventBus *EventBus, debug bool) (*BlockChain, error) {
+	return newBlockChain(stateDB, chainDB, extraDB, logDB, eventBus, debug, false)
+}
+
+func newBlockChain(stateDB, chainDB, extraDB, logDB badger.IStorage, eventBus *EventBus, debug, light bool) (*BlockChain, error) {
 	bc := &BlockChain{
 		chainDB:    newChainDBN(chainDB, debug),
 		stateDB:    stateDB,
 		extraDB:    newExtraDB(extraDB),
 		eventBus:   eventBus,
 		logStorage: vm.NewLogStorage(logDB),
+		light:      light,
 	}
 	bc.orphans = make(map[common.Hash]*orphanBlock)
 	bc.prevOrphans = make(map[common.Hash][]*orphanBlock)
+	bc.validator = newBlockValidator(bc)
+	bc.badBlocks = newBadBlockCache()
 
 	genesisBlock := bc.GetBlockByNumber(0)
 	if genesisBlock == nil {
@@ -164,12 +183,24 @@ func NewBlockChainN(stateDB, chainDB, extraDB, logDB badger.IStorage, eventBus *
 	}
 
 	bc.genesisBHeader = genesisBlock.Header
+	for _, cp := range networkCheckpoints[bc.genesisBHeader.HeaderHash()] {
+		bc.checkpoints = bc.checkpoints.add(cp)
+	}
+	// Configs stored by older versions lack the fields added since.
+	bc.config = defaultChainConfigByBits(bc.genesisBHeader.Bits)
+	if stored := bc.chainDB.GetChainConfig(bc.genesisBHeader.HeaderHash()); stored != nil {
+		bc.config = stored.withDefaults(bc.config)
+	}
+	// The public networks follow the fork schedule of this release, which
+	// may have scheduled forks since their config was stored.
+	if network := networkChainConfig(bc.genesisBHeader.HeaderHash()); network != nil {
+		bc.config.Forks = network.Forks
+	}
 
 	if err := bc.setLastState(); err != nil {
 		return nil, err
 	}
-	stateRootHash := bc.currentBHeader.StateRoot
-	bc.stateTree = NewStateTree(stateDB, stateRootHash.Bytes())
+	bc.stateTree = bc.headStateTree(bc.currentBHeader)
 	return bc, nil
 }
 
@@ -230,9 +261,18 @@ func (bc *BlockChain) GetBlockByHashWithoutRec(hash common.Hash) *Block {
 	return block
 }
 
+// GetReceiptByHash returns the receipt of the transaction of hash. A light
+// chain retrieves the receipts it does not store from the light backend.
 func (bc *BlockChain) GetReceiptByHash(hash common.Hash) *Receipt {
-	return bc.extraDB.GetReceipt(hash)
-
+	if receipt := bc.extraDB.GetReceipt(hash); receipt != nil || !bc.light {
+		return receipt
+	}
+	receipt, err := bc.retrieveReceipt(hash)
+	if err != nil {
+		logrus.Debugf("Failed retrieve receipt: hash=%x, err=%v", hash, err)
+		return nil
+	}
+	return receipt
 }
 
 func (bc *BlockChain) GetReceiptByHashIndex(hash common.Hash) *TxIndex {
@@ -280,6 +320,40 @@ func (bc *BlockChain) CurrentBHeader() *BlockHeader {
 	defer bc.mu.RUnlock()
 	return bc.currentBHeader
 }
+
+// AddCheckpoint pins the main chain block at the height of cp to its hash.
+// It fails if the main chain already has another block at that height.
+func (bc *BlockChain) AddCheckpoint(cp Checkpoint) error {
+	if block := bc.GetBlockByNumber(cp.Height); block != nil && block.HeaderHash() != cp.Hash {
+		return fmt.Errorf("%w: height=%d, want=%x, got=%x",
+			ErrCheckpointMismatch, cp.Height, cp.Hash, block.HeaderHash())
+	}
+	bc.checkpointsMu.Lock()
+	defer bc.checkpointsMu.Unlock()
+	bc.checkpoints = bc.checkpoints.add(cp)
+	return nil
+}
+
+// CheckpointAt returns the checkpoint at height, or nil if there is none.
+func (bc *BlockChain) CheckpointAt(height uint64) *Checkpoint {
+	bc.checkpointsMu.RLock()
+	defer bc.checkpointsMu.RUnlock()
+	return bc.checkpoints.at(height)
+}
+
+// LastCheckpoint returns the highest checkpoint, or nil if there is none.
+func (bc *BlockChain) LastCheckpoint() *Checkpoint {
+	bc.checkpointsMu.RLock()
+	defer bc.checkpointsMu.RUnlock()
+	return bc.checkpoints.last(math.MaxUint64)
+}
+
+// NextProtocolVersion returns the version of the block on top of the head,
+// given by the forks active at its height.
+func (bc *BlockChain) NextProtocolVersion() uint32 {
+	return bc.config.ProtocolVersion(bc.CurrentBHeader().Height + 1)
+}
+
 func (bc *BlockChain) LatestGasLimit() *big.Int {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
@@ -343,6 +417,43 @@ func (bc *BlockChain) WriteBlock(block *Block) error {
 	return bc.writeBlock(block)
 }
 
+// GetTotalWork returns the cumulative work of the chain ending with the block
+// of hash, or nil if the block is unknown.
+func (bc *BlockChain) GetTotalWork(hash common.Hash) *big.Int {
+	if work := bc.chainDB.GetTotalWork(hash); work != nil {
+		return work
+	}
+	// The work of blocks stored before it was recorded is summed up
+	// from the nearest ancestor whose work is known.
+	var (
+		headers []*BlockHeader
+		work    *big.Int
+	)
+	for next := hash; work == nil; {
+		header := bc.chainDB.GetBlockHeaderByHash(next)
+		if header == nil {
+			return nil
+		}
+		headers = append(headers, header)
+		if header.Height == 0 {
+			work = new(big.Int)
+			break
+		}
+		next = header.HashPrevBlock
+		work = bc.chainDB.GetTotalWork(next)
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		work = new(big.Int).Add(work, CalcWorkloadByBits(headers[i].Bits))
+		_ = bc.chainDB.WriteTotalWork(headers[i].HeaderHash(), work)
+	}
+	return work
+}
+
+// CurrentTotalWork returns the cumulative work of the main chain.
+func (bc *BlockChain) CurrentTotalWork() *big.Int {
+	return bc.GetTotalWork(bc.CurrentBHeader().HeaderHash())
+}
+
 // WriteBlock stores the block inputed to the local database.
 func (bc *BlockChain) writeBlock(block *Block) error {
 	bc.mu.RLock()
@@ -352,8 +463,17 @@ func (bc *BlockChain) writeBlock(block *Block) error {
 	if bHeader == nil {
 		return fmt.Errorf("current chain has no head")
 	}
-
-	if block.Height() > bHeader.Height {
+	parentWork := bc.GetTotalWork(block.HashPrevBlock())
+	if parentWork == nil {
+		return fmt.Errorf("unknown parent block")
+	}
+	work := new(big.Int).Add(parentWork, CalcWorkloadByBits(block.Bits()))
+	if err := bc.chainDB.WriteTotalWork(block.HeaderHash(), work); err != nil {
+		return err
+	}
+	// The chain with the most work is the main chain, on a tie
+	// the block seen first stays the head.
+	if work.Cmp(bc.GetTotalWork(bHeader.HeaderHash())) > 0 {
 		curHash := bHeader.HeaderHash()
 		bhash := block.HeaderHash()
 		prehash := block.HashPrevBlock()
@@ -370,6 +490,7 @@ func (bc *BlockChain) writeBlock(block *Block) error {
 		}
 		bc.mu.Lock()
 		if err := bc.insertBHeader2Chain(block.Header); err != nil {
+			bc.mu.Unlock()
 			return err
 		}
 		bc.mu.Unlock()
@@ -392,28 +513,70 @@ func (bc *BlockChain) insertBHeader2Chain(bHeader *BlockHeader) error {
 	}
 	bc.currentBHeader = bHeader
 	bc.lastBlockHash = bHeader.HeaderHash()
-	lastStateRoot := bHeader.StateRoot
-	bc.stateTree = NewStateTree(bc.stateDB, lastStateRoot.Bytes())
+	bc.stateTree = bc.headStateTree(bHeader)
 	return nil
 }
 
+// setHead makes the stored header the head of the chain, linking the
+// heights from it down to where it joins the main chain. The caller
+// holds bc.mu.
+func (bc *BlockChain) setHead(header *BlockHeader) error {
+	var branch []*BlockHeader
+	fork := header
+	for fork.Height > 0 {
+		if main := bc.chainDB.GetBlockHeaderByHeight(fork.Height); main != nil && main.HeaderHash() == fork.HeaderHash() {
+			break
+		}
+		branch = append(branch, fork)
+		if fork = bc.chainDB.GetBlockHeaderByHash(fork.HashPrevBlock); fork == nil {
+			return fmt.Errorf("invalid new chain")
+		}
+	}
+	// Blocks below a checkpoint the chain has reached are final.
+	bc.checkpointsMu.RLock()
+	cp := bc.checkpoints.last(bc.currentBHeader.Height)
+	bc.checkpointsMu.RUnlock()
+	if cp != nil && fork.Height < cp.Height {
+		return fmt.Errorf("%w: fork=%d, checkpoint=%d", ErrReorgBelowCheckpoint, fork.Height, cp.Height)
+	}
+	for height := header.Height + 1; height <= bc.currentBHeader.Height; height++ {
+		if err := bc.chainDB.DelBHeaderHashWithHeight(height); err != nil {
+			return err
+		}
+	}
+	for _, h := range branch {
+		if err := bc.chainDB.WriteBHeaderHashWithHeight(h.Height, h.HeaderHash()); err != nil {
+			return err
+		}
+	}
+	return bc.insertBHeader2Chain(header)
+}
+
 func (bc *BlockChain) reorg(oldBlock, newBlock *Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	var newBlocks []*Block
-	var mNewBlock *Block
-	//logrus.Debugf("Find newblocks: from=%d, to=%d", newBlock.Height(), oldBlock.Height())
-	for mNewBlock = newBlock; mNewBlock != nil && mNewBlock.Height() != oldBlock.Height(); mNewBlock = bc.GetBlockByHash(mNewBlock.HashPrevBlock()) {
-		//nhash := mNewBlock.Hash()
-		//logrus.Debugf("Append newblock: height=%d, hash=%x", mNewBlock.Height(), nhash[len(nhash)-4:])
-		newBlocks = append(newBlocks, newBlock)
-	}
-	if newBlock == nil {
-		return fmt.Errorf("invalid new chain")
-	}
-	mOldBlock := oldBlock
-	var deletedTxs []*Transaction
-	var deletedBlocks []*Block
+	var (
+		newBlocks     []*Block
+		deletedTxs    []*Transaction
+		deletedBlocks []*Block
+		mOldBlock     = oldBlock
+		mNewBlock     = newBlock
+	)
+	// The new chain may be shorter than the old one if it carries more work,
+	// bring both to the same height before looking for the common block.
+	for mNewBlock.Height() > mOldBlock.Height() {
+		newBlocks = append(newBlocks, mNewBlock)
+		if mNewBlock = bc.GetBlockByHash(mNewBlock.HashPrevBlock()); mNewBlock == nil {
+			return fmt.Errorf("invalid new chain")
+		}
+	}
+	for mOldBlock.Height() > mNewBlock.Height() {
+		deletedTxs = append(deletedTxs, mOldBlock.Transactions...)
+		deletedBlocks = append(deletedBlocks, mOldBlock)
+		if mOldBlock = bc.GetBlockByHash(mOldBlock.HashPrevBlock()); mOldBlock == nil {
+			return fmt.Errorf("invalid old chain")
+		}
+	}
 	for {
 		oldhash := mOldBlock.HeaderHash()
 		newhash := mNewBlock.HeaderHash()
@@ -436,6 +599,13 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *Block) error {
 			return fmt.Errorf("invalid new chain")
 		}
 	}
+	// Blocks below a checkpoint the chain has reached are final.
+	bc.checkpointsMu.RLock()
+	cp := bc.checkpoints.last(oldBlock.Height())
+	bc.checkpointsMu.RUnlock()
+	if cp != nil && mOldBlock.Height() < cp.Height {
+		return fmt.Errorf("%w: fork=%d, checkpoint=%d", ErrReorgBelowCheckpoint, mOldBlock.Height(), cp.Height)
+	}
 
 	for _, block := range deletedBlocks {
 
@@ -452,8 +622,15 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *Block) error {
 		}
 	}
 
+	// Heights above the new head no longer belong to the main chain.
+	for height := newBlock.Height() + 1; height <= oldBlock.Height(); height++ {
+		if err := bc.chainDB.DelBHeaderHashWithHeight(height); err != nil {
+			return err
+		}
+	}
 	var addedTxs []*Transaction
-	for _, block := range newBlocks {
+	for i := len(newBlocks) - 1; i >= 0; i-- {
+		block := newBlocks[i]
 		_ = bc.insertBHeader2Chain(block.Header)
 		//blkhash := block.Hash()
 		//logrus.Debugf("Successfully new insert block: height=%d, hash: %x", block.Height(), blkhash[len(blkhash)-4:])
@@ -587,19 +764,65 @@ func (bc *BlockChain) DelBHeaderByBHash(hash common.Hash) error {
 // 	return rec
 // }
 
-func calcBlockSubsidy(height uint64) *big.Int {
-	if GenesisBits == TestNetGenesisBits {
-		return baseTestSubsidy
+// calcBlockFees sums up gasUsed * gasPrice of the transactions in a block.
+func calcBlockFees(txs []*Transaction, receipts []*Receipt) *big.Int {
+	prices := make(map[common.Hash]*big.Int, len(txs))
+	for _, tx := range txs {
+		prices[tx.Hash()] = tx.GasPrice
+	}
+	fees := new(big.Int)
+	for _, rec := range receipts {
+		price, exists := prices[rec.TxHash]
+		if !exists || rec.GasUsed == nil {
+			continue
+		}
+		fees.Add(fees, new(big.Int).Mul(rec.GasUsed, price))
+	}
+	return fees
+}
+
+// blockFees returns the fees credited to the coinbase of the block at
+// height, none before ForkBlockFees.
+func blockFees(config *ChainConfig, height uint64, txs []*Transaction, receipts []*Receipt) *big.Int {
+	if !config.IsForkActive(ForkBlockFees, height) {
+		return new(big.Int)
 	}
-	return new(big.Int).Rsh(baseSubsidy, uint(height/480))
+	return calcBlockFees(txs, receipts)
 }
 
 // AccumulateRewards calculates the rewards and add it to the miner's account.
-func AccumulateRewards(stateTree *StateTree, header *BlockHeader) {
-	subsidy := calcBlockSubsidy(header.Height)
+// The rewards are made up of the block subsidy and, once ForkBlockFees is
+// active, the fees paid by txs.
+func AccumulateRewards(config *ChainConfig, stateTree *StateTree, header *BlockHeader, txs []*Transaction, receipts []*Receipt) {
+	subsidy := config.BlockSubsidy(header.Height)
+	reward := new(big.Int).Add(subsidy, blockFees(config, header.Height, txs, receipts))
 
 	//logrus.Debugf("Current height of the blockchain %d, reward: %d", header.Height, subsidy)
-	stateTree.AddBalance(header.Coinbase, subsidy)
+	stateTree.AddBalance(header.Coinbase, reward)
+}
+
+// BlockReward is the amount credited to the coinbase of a block.
+type BlockReward struct {
+	Subsidy *big.Int
+	Fees    *big.Int
+}
+
+// Total returns the sum of the subsidy and the fees.
+func (r *BlockReward) Total() *big.Int {
+	return new(big.Int).Add(r.Subsidy, r.Fees)
+}
+
+// GetBlockReward returns the reward of the block at height in the main chain,
+// or nil if there is no such block.
+func (bc *BlockChain) GetBlockReward(height uint64) *BlockReward {
+	block := bc.GetBlockByNumber(height)
+	if block == nil {
+		return nil
+	}
+	return &BlockReward{
+		Subsidy: bc.config.BlockSubsidy(height),
+		Fees:    blockFees(bc.config, height, block.Transactions, block.Receipts),
+	}
 }
 
 func (bc *BlockChain) MaybeAcceptBlock(block *Block) error {
@@ -608,40 +831,38 @@ func (bc *BlockChain) MaybeAcceptBlock(block *Block) error {
 
 func (bc *BlockChain) maybeAcceptBlock(block *Block) error {
 	header := block.GetHeader()
-	//blockHash := block.Hash()
-	txsRoot := block.TransactionRoot()
 	txs := block.Transactions
-	rsRoot := block.ReceiptsRoot()
-	targetTxsRoot := CalcTxsRootHash(block.Transactions)
-	if !bytes.Equal(targetTxsRoot.Bytes(), txsRoot.Bytes()) {
-		return ErrBadBlock
-	}
-
 	parent := bc.GetBlockByHash(block.HashPrevBlock())
+	if parent == nil {
+		return ErrOrphansBlock
+	}
+	if err := bc.validator.ValidateHeader(parent.Header, header); err != nil {
+		return bc.reportBadBlock(block, err)
+	}
+	if err := bc.validator.ValidateBody(block); err != nil {
+		return bc.reportBadBlock(block, err)
+	}
 	//parenthash := parent.Hash()
 	parentStateRoot := parent.StateRoot()
 	//logrus.Debugf("New state tree: parentHeight=%d, parentHash=%x, parentStateRoot=%x",
 	//	parent.Height(), parenthash[len(blockHash)-4:], parentStateRoot[len(parentStateRoot)-4:])
+	// Failing to load the state of the parent is a local failure, the block
+	// is not cached as bad and may be delivered again.
 	stateTree, err := NewStateTreeN(bc.stateDB, parentStateRoot.Bytes())
 	if err != nil {
 		logrus.Errorf("Accept block err: %v", err)
-		return ErrBadBlock
+		return ErrApplyTransactions
 	}
 	gas, rec, err := bc.ApplyTransactions(stateTree, header, txs)
 	if err != nil {
-		logrus.Errorf("Accept block err: %v", err)
-		return ErrApplyTransactions
+		return bc.reportBadBlock(block, fmt.Errorf("%w: %v", ErrInvalidTransactions, err))
 	}
 	block.Receipts = rec
-	if gas.Cmp(header.GasUsed) != 0 {
-		return ErrBadBlock
-	}
-	targetRsRoot := CalcReceiptRootHash(rec)
-	if !bytes.Equal(rsRoot[:], targetRsRoot[:]) {
-		return ErrBadBlock
-	}
-	AccumulateRewards(stateTree, header)
+	AccumulateRewards(bc.config, stateTree, header, txs, rec)
 	stateTree.UpdateAll()
+	if err = bc.validator.ValidateState(header, stateTree, rec, gas); err != nil {
+		return bc.reportBadBlock(block, err)
+	}
 	if err = stateTree.Commit(); err != nil {
 		logrus.Errorf("Accept block err: %v", err)
 		return ErrWriteBlock
@@ -657,6 +878,28 @@ func (bc *BlockChain) maybeAcceptBlock(block *Block) error {
 	return nil
 }
 
+// reportBadBlock records a block rejected for reason in the bad block cache,
+// unless the block may be valid when delivered again.
+func (bc *BlockChain) reportBadBlock(block *Block, reason error) error {
+	hash := block.HeaderHash()
+	logrus.Warnf("Rejected bad block: height=%d, hash=%x, reason=%v", block.Height(), hash[len(hash)-4:], reason)
+	if !isRetryableBlockError(reason) {
+		bc.badBlocks.add(block.Header, reason)
+	}
+	return reason
+}
+
+// ValidateHeaders checks a chain of headers on top of parent before their
+// blocks are fetched.
+func (bc *BlockChain) ValidateHeaders(parent *BlockHeader, headers []*BlockHeader) error {
+	return bc.validator.ValidateHeaders(parent, headers)
+}
+
+// GetBadBlocks returns the most recently rejected blocks, the latest first.
+func (bc *BlockChain) GetBadBlocks() []*BadBlock {
+	return bc.badBlocks.list()
+}
+
 // Boundaries retrieves the synchronisation boundaries, specifically the origin
 // block where synchronisation started at (may have failed/suspended) and the
 // latest known block which the synchonisation targets.
@@ -685,7 +928,6 @@ func (bc *BlockChain) InsertChain(block *Block) error {
 	bc.chainmu.Lock()
 	defer bc.chainmu.Unlock()
 	blockHash := block.HeaderHash()
-	header := block.GetHeader()
 	//logrus.Debugf("Processing block: height=%d, hash=%x", block.Height(), blockHash[len(blockHash)-4:])
 	if old := bc.GetBlockByHash(blockHash); old != nil {
 		return ErrBlockIgnored
@@ -693,6 +935,13 @@ func (bc *BlockChain) InsertChain(block *Block) error {
 	if _, exists := bc.orphans[blockHash]; exists {
 		return ErrBlockIgnored
 	}
+	if bc.badBlocks.has(blockHash) {
+		return ErrBadBlock
+	}
+	// Descendants of a bad block can't be valid either.
+	if bc.badBlocks.has(block.HashPrevBlock()) {
+		return bc.reportBadBlock(block, fmt.Errorf("%w: bad parent block", ErrBadBlock))
+	}
 	var parent *Block
 	if parent = bc.GetBlockByHash(block.HashPrevBlock()); parent == nil {
 		cp := block.HashPrevBlock()
@@ -701,9 +950,6 @@ func (bc *BlockChain) InsertChain(block *Block) error {
 		bc.addOrphanBlock(block)
 		return ErrOrphansBlock
 	}
-	if err := bc.checkBlockHeaderSanity(parent.Header, header, blockHash); err != nil {
-		return ErrBadBlock
-	}
 	if err := bc.maybeAcceptBlock(block); err != nil {
 		logrus.Errorf("Insert Chain err: %s", err)
 		return err
@@ -842,27 +1088,15 @@ func (bc *BlockChain) ApplyTransactions(stateTree *StateTree, header *BlockHeade
 	return totalUsedGas, receipts, nil
 }
 
-func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHash common.Hash) error {
-	target := BitsUnzip(header.Bits)
-	if target.Sign() <= 0 {
-		return fmt.Errorf("bits must be a non-negative integer")
-	}
-	max := BitsUnzip(bc.genesisBHeader.Bits)
+// checkBlockHeaderSanity checks the proof of work of header on top of prev,
+// whose ancestors are looked up by getHeader.
+func (bc *BlockChain) checkBlockHeaderSanity(prev, header *BlockHeader, blockHash common.Hash, getHeader headerReader) error {
 	//target difficuty should be less than the minimum difficuty based on the genesisBlock
-	if target.Cmp(max) > 0 {
-		return fmt.Errorf("pow check err")
-	}
-	current := new(big.Int).SetBytes(blockHash[:])
-	// the current hash can not be larger than the target hash value
-	if current.Cmp(target) > 0 {
-		return fmt.Errorf("pow check err")
-	}
-	last, err := bc.calcNextRequiredBitsByHeight(prev.Height, prev.HeaderHash())
-	if err != nil {
+	if err := CheckProofOfWork(blockHash, header.Bits, bc.genesisBHeader.Bits); err != nil {
 		return err
 	}
-	if last != header.Bits {
-		return fmt.Errorf("pow check err")
+	if bc.calcNextRequiredBits(prev, getHeader) != header.Bits {
+		return errPowCheck
 	}
 	return nil
 }
@@ -918,17 +1152,13 @@ func buyGas(sender *StateObj, tx *Transaction, gp *GasPool, gas *big.Int) error
 	return nil
 }
 
-func txPreCheck(stateTree *StateTree, tx *Transaction, gp *GasPool, gas *big.Int) (*StateObj, error) {
-	fromaddr, err := tx.FromAddr()
-	if err != nil {
-		return nil, err
-	}
-	sender := stateTree.GetOrNewStateObj(fromaddr)
+func txPreCheck(stateTree *StateTree, from common.Address, tx *Transaction, gp *GasPool, gas *big.Int) (*StateObj, error) {
+	sender := stateTree.GetOrNewStateObj(from)
 
 	if sender.GetNonce() != tx.Nonce {
 		return sender, fmt.Errorf("nonce err: want=%d, got=%d", sender.GetNonce(), tx.Nonce)
 	}
-	if err = buyGas(sender, tx, gp, gas); err != nil {
+	if err := buyGas(sender, tx, gp, gas); err != nil {
 		return sender, err
 	}
 	return sender, nil
@@ -950,36 +1180,68 @@ func makeAddress(addr common.Address, nonce uint64) common.Address {
 	fromAddressHash := common.Bytes2Hash(fromAddressHashBytes)
 	return crypto.CreateAddress(fromAddressHash, nonce)
 }
+
+// eventSink receives the events emitted by the vm while a transaction is applied.
+type eventSink interface {
+	PutAllEvents(tx common.Hash, address common.Address, events []vm.Event)
+}
+
+// eventCollector is an eventSink which keeps the events in memory,
+// it is used by dry runs so that nothing leaks into the log storage.
+type eventCollector struct {
+	events []vm.Event
+}
+
+func (c *eventCollector) PutAllEvents(_ common.Hash, address common.Address, events []vm.Event) {
+	for i := range events {
+		events[i].Address = address
+	}
+	c.events = append(c.events, events...)
+}
+
 func (bc *BlockChain) ApplyTransaction(
-	stateTree *StateTree, _ *BlockHeader,
+	stateTree *StateTree, header *BlockHeader,
 	tx *Transaction, gp *GasPool, totalGas *big.Int) (*Receipt, error) {
+	if err := bc.checkTransactionSanity(tx); err != nil {
+		return nil, err
+	}
+	fromaddr, err := tx.FromAddr()
+	if err != nil {
+		return nil, err
+	}
+	return bc.applyTransaction(stateTree, header, tx, fromaddr, gp, totalGas, bc.logStorage)
+}
+
+func (bc *BlockChain) applyTransaction(
+	stateTree *StateTree, header *BlockHeader,
+	tx *Transaction, from common.Address, gp *GasPool, totalGas *big.Int, sink eventSink) (*Receipt, error) {
 	var (
 		err    error
 		sender *StateObj
 		gas    = new(big.Int).SetInt64(0)
 		status uint32
 	)
-
-	if err = bc.checkTransactionSanity(tx); err != nil {
-		return nil, err
+	if tx.Version > bc.config.ProtocolVersion(header.Height) {
+		return nil, ErrTxVersionNotActive
 	}
 
-	if sender, err = txPreCheck(stateTree, tx, gp, gas); err != nil {
+	if sender, err = txPreCheck(stateTree, from, tx, gp, gas); err != nil {
 		return nil, err
 	}
 
 	if err = useGas(gas, common.CalcTxInitialCost(tx.Data)); err != nil {
 		return nil, err
 	}
-	mVm := vm.NewXVM(stateTree)
+	mVm := vm.NewXVMWithForks(stateTree, func(name string) bool {
+		return bc.config.IsForkActive(name, header.Height)
+	})
 	if TxToAddrNotSet(tx) {
 		if err = mVm.Create(sender.address, tx.Data); err == nil {
 			status = 1
 		}
 	} else {
-		fromaddr, _ := tx.FromAddr()
 		txhash := tx.Hash()
-		logrus.Debugf("Transfer: from=%s, to=%s, value=%s, txhash=%x", fromaddr.B58String(), tx.To.B58String(), tx.Value, txhash[len(txhash)-4:])
+		logrus.Debugf("Transfer: from=%s, to=%s, value=%s, txhash=%x", from.B58String(), tx.To.B58String(), tx.Value, txhash[len(txhash)-4:])
 		if err = bc.transfer(stateTree, sender, tx.To, tx.Value); err != nil {
 			return nil, err
 		}
@@ -1002,7 +1264,7 @@ func (bc *BlockChain) ApplyTransaction(
 	} else {
 		logaddr = tx.To
 	}
-	bc.logStorage.PutAllEvents(tx.Hash(), logaddr, events)
+	sink.PutAllEvents(tx.Hash(), logaddr, events)
 
 	stateTree.AddNonce(sender.address, 1)
 
@@ -1023,6 +1285,51 @@ func (bc *BlockChain) ApplyTransaction(
 	return receipt, nil
 }
 
+// StateTreeAt loads a fresh state tree at the state root of header.
+func (bc *BlockChain) StateTreeAt(header *BlockHeader) (*StateTree, error) {
+	return NewStateTreeN(bc.stateDB, header.StateRoot.Bytes())
+}
+
+// DryRunTransaction applies tx sent by from on top of the state of header,
+// as if it was included in the next block. The signature of tx is not checked,
+// and neither the state changes nor the emitted events are persisted.
+// The state tree holding the changes is returned along with the receipt.
+// A transaction whose execution fails is no error, its receipt has status 0.
+func (bc *BlockChain) DryRunTransaction(header *BlockHeader, from common.Address, tx *Transaction) (*Receipt, []vm.Event, *StateTree, error) {
+	stateTree, err := bc.StateTreeAt(header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	next := &BlockHeader{
+		Height:        header.Height + 1,
+		HashPrevBlock: header.HeaderHash(),
+		Timestamp:     uint64(time.Now().Unix()),
+		GasLimit:      header.GasLimit,
+		GasUsed:       new(big.Int),
+	}
+	gp := (*GasPool)(new(big.Int).Set(next.GasLimit))
+	sink := new(eventCollector)
+	rec, err := bc.applyTransaction(stateTree, next, tx, from, gp, new(big.Int), sink)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return rec, sink.events, stateTree, nil
+}
+
+// SimulateTransaction dry-runs tx on top of the state of header and returns
+// the receipt, the emitted events and the accounts changed by the transaction.
+func (bc *BlockChain) SimulateTransaction(header *BlockHeader, from common.Address, tx *Transaction) (*Receipt, []vm.Event, []*AccountDiff, error) {
+	rec, events, stateTree, err := bc.DryRunTransaction(header, from, tx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	base, err := bc.StateTreeAt(header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return rec, events, stateTree.DiffFrom(base), nil
+}
+
 func (bc *BlockChain) transfer(st *StateTree, seder *StateObj, to common.Address, amount *big.Int) error {
 	toObj := st.GetOrNewStateObj(to)
 	if seder.balance.Cmp(amount) < 0 {
@@ -1093,39 +1400,52 @@ func (bc *BlockChain) FindAncestor(bHeader *BlockHeader, height uint64) *BlockHe
 }
 
 func (bc *BlockChain) findAncestor(bHeader *BlockHeader, height uint64) *BlockHeader {
+	return findAncestor(bHeader, height, bc.GetBlockHeaderByBHash)
+}
+
+// headerReader looks a header up by its hash, nil if it is unknown.
+type headerReader func(hash common.Hash) *BlockHeader
+
+func findAncestor(bHeader *BlockHeader, height uint64, getHeader headerReader) *BlockHeader {
 	if bHeader == nil {
 		return nil
 	}
 
 	indexFirst := bHeader
 	for i := 0; indexFirst != nil && i < int(height); i++ {
-		indexFirst = bc.GetBlockHeaderByBHash(indexFirst.HashPrevBlock)
+		indexFirst = getHeader(indexFirst.HashPrevBlock)
 	}
 	return indexFirst
 }
 func (bc *BlockChain) calcNextRequiredBitsByHeight(height uint64, hash common.Hash) (uint32, error) {
-	lastBlock := bc.GetBlockByHash(hash)
-	if lastBlock == nil {
+	lastHeader := bc.GetBlockHeaderByBHash(hash)
+	if lastHeader == nil {
 		return 0, errors.New("not found block")
 	}
-	lastHeader := lastBlock.Header
-	lastHeight := lastBlock.Height()
+	return bc.calcNextRequiredBits(lastHeader, bc.GetBlockHeaderByBHash), nil
+}
+
+// calcNextRequiredBits returns the bits of the block after lastHeader, whose
+// ancestors are looked up by getHeader.
+func (bc *BlockChain) calcNextRequiredBits(lastHeader *BlockHeader, getHeader headerReader) uint32 {
+	lastHeight := lastHeader.Height
 
-	blocksPerRetarget := uint64(targetTimespan / targetTimePerBlock)
+	blocksPerRetarget := bc.config.BlocksPerRetarget()
 	// if the height of the next block is not an integral multiple of the target，no changes.
 	if (lastHeight+1)%blocksPerRetarget != 0 {
-		return lastHeader.Bits, nil
+		return lastHeader.Bits
 	}
-	first := bc.findAncestor(lastHeader, blocksPerRetarget-1)
+	first := findAncestor(lastHeader, blocksPerRetarget-1, getHeader)
 	if first == nil {
 		//logrus.Infof("need bbb")
-		return lastHeader.Bits, nil
+		return lastHeader.Bits
 	}
 	//logrus.Infof("need aaa")
 	firstTime := first.Timestamp
 	lastTime := lastHeader.Timestamp
-	minRetargetTimespan := targetTimespan / adjustmentFactor
-	maxRetargetTimespan := targetTimespan * adjustmentFactor
+	targetTimespan := bc.config.RetargetTimespan
+	minRetargetTimespan := targetTimespan / bc.config.AdjustmentFactor
+	maxRetargetTimespan := targetTimespan * bc.config.AdjustmentFactor
 	actualTimespan := int64(lastTime - firstTime)
 	adjustedTimespan := actualTimespan
 	if actualTimespan < minRetargetTimespan {
@@ -1138,7 +1458,7 @@ func (bc *BlockChain) calcNextRequiredBitsByHeight(height uint64, hash common.Ha
 	newTarget.Div(newTarget, big.NewInt(targetTimespan))
 	newTarget.Set(common.BigMin(newTarget, BitsUnzip(bc.genesisBHeader.Bits)))
 	newTargetBits := BigByZip(newTarget)
-	return newTargetBits, nil
+	return newTargetBits
 }
 
 func (bc *BlockChain) CalcNextRequiredDifficulty() (uint32, error) {
@@ -1154,6 +1474,11 @@ func (bc *BlockChain) CalcNextRequiredBitsByHeight(height uint64, hash common.Ha
 	return bc.calcNextRequiredBitsByHeight(height, hash)
 }
 
+// Config returns the chain config stored with the genesis block.
+func (bc *BlockChain) Config() *ChainConfig {
+	return bc.config
+}
+
 func (bc *BlockChain) CurrentStateTree() *StateTree {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
@@ -0,0 +1,231 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/storage/badger"
+	"xfsgo/test"
+)
+
+func TestAccumulateRewardsWithFees(t *testing.T) {
+	newTx := func(price int64) *Transaction {
+		return NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: new(big.Int).Set(common.TxGas),
+			Value:    new(big.Int),
+		})
+	}
+	txs := []*Transaction{newTx(2), newTx(3)}
+	receipts := []*Receipt{
+		{TxHash: txs[0].Hash(), GasUsed: big.NewInt(100)},
+		{TxHash: txs[1].Hash(), GasUsed: big.NewInt(10)},
+	}
+	fees := calcBlockFees(txs, receipts)
+	if fees.Int64() != 230 {
+		t.Fatalf("want fees 230, got %s", fees)
+	}
+	stateTree, err := NewStateTreeN(test.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultMainNetChainConfig()
+	config.Forks[ForkBlockFees] = 2
+	// Only the subsidy is credited before the fork.
+	header := &BlockHeader{Height: 1, Coinbase: common.Bytes2Address([]byte{1})}
+	AccumulateRewards(config, stateTree, header, txs, receipts)
+	want := config.BlockSubsidy(header.Height)
+	if got := stateTree.GetBalance(header.Coinbase); got.Cmp(want) != 0 {
+		t.Fatalf("want coinbase balance %s, got %s", want, got)
+	}
+	header = &BlockHeader{Height: 2, Coinbase: common.Bytes2Address([]byte{2})}
+	AccumulateRewards(config, stateTree, header, txs, receipts)
+	want = new(big.Int).Add(config.BlockSubsidy(header.Height), fees)
+	if got := stateTree.GetBalance(header.Coinbase); got.Cmp(want) != 0 {
+		t.Fatalf("want coinbase balance %s, got %s", want, got)
+	}
+}
+
+func TestBlockChain_ForkChoiceByTotalWork(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 534773790}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBlock := func(parent *Block, bits uint32, timestamp uint64) *Block {
+		header := &BlockHeader{
+			Height:        parent.Height() + 1,
+			HashPrevBlock: parent.HeaderHash(),
+			Timestamp:     timestamp,
+			StateRoot:     genesis.Header.StateRoot,
+			GasLimit:      new(big.Int),
+			GasUsed:       new(big.Int),
+			Bits:          bits,
+		}
+		block := NewBlock(header, nil, nil)
+		if err := bc.writeBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	bits := genesis.Bits()
+	a1 := newBlock(genesis, bits, 1)
+	a2 := newBlock(a1, bits, 2)
+	// A sibling with the same work does not replace the block seen first.
+	newBlock(a1, bits, 3)
+	if got := bc.CurrentBHeader().HeaderHash(); got != a2.HeaderHash() {
+		t.Fatalf("want head %x on a tie, got %x", a2.HeaderHash(), got)
+	}
+	want := new(big.Int).Mul(CalcWorkloadByBits(bits), big.NewInt(3))
+	if got := bc.CurrentTotalWork(); got.Cmp(want) != 0 {
+		t.Fatalf("want total work %s, got %s", want, got)
+	}
+	// A shorter chain with a harder block carries more work.
+	b1 := newBlock(genesis, bits-1, 4)
+	if got := bc.CurrentBHeader().HeaderHash(); got != b1.HeaderHash() {
+		t.Fatalf("want head %x after reorg, got %x", b1.HeaderHash(), got)
+	}
+	if got := bc.GetBlockByNumber(1); got == nil || got.HeaderHash() != b1.HeaderHash() {
+		t.Fatalf("want block %x at height 1", b1.HeaderHash())
+	}
+	if got := bc.GetBlockByNumber(2); got != nil {
+		t.Fatalf("want no block at height 2, got %x", got.HeaderHash())
+	}
+}
+
+func TestBlockChain_InsertChainBadBlocks(t *testing.T) {
+	// Accepting a block commits its state with a write batch, which the
+	// memory storage lacks.
+	stateDb, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDb.Close()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 2147483680, "timestamp": "1000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine := func(stateRoot common.Hash) *Block {
+		header := &BlockHeader{
+			Height:           1,
+			HashPrevBlock:    genesis.HeaderHash(),
+			Timestamp:        genesis.Header.Timestamp + 60,
+			Coinbase:         crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey),
+			StateRoot:        stateRoot,
+			TransactionsRoot: CalcTxsRootHash(nil),
+			GasLimit:         new(big.Int),
+			GasUsed:          new(big.Int),
+			Bits:             genesis.Bits(),
+		}
+		if stateRoot == (common.Hash{}) {
+			stateTree, err := NewStateTreeN(stateDb, genesis.Header.StateRoot.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			AccumulateRewards(bc.config, stateTree, header, nil, nil)
+			stateTree.UpdateAll()
+			header.StateRoot = common.Bytes2Hash(stateTree.Root())
+		}
+		for CheckProofOfWork(header.HeaderHash(), header.Bits, header.Bits) != nil {
+			header.Nonce++
+		}
+		return NewBlock(header, nil, nil)
+	}
+
+	// A block with a wrong state root is invalid whatever is delivered
+	// along its header.
+	bad := mine(common.Hash{1})
+	if err = bc.InsertChain(bad); !errors.Is(err, ErrInvalidStateRoot) {
+		t.Fatalf("want err %v, got %v", ErrInvalidStateRoot, err)
+	}
+	if err = bc.InsertChain(bad); err != ErrBadBlock {
+		t.Fatalf("want err %v, got %v", ErrBadBlock, err)
+	}
+
+	block := mine(common.Hash{})
+	// The header does not cover the transactions, the block is still
+	// accepted once delivered with its own.
+	tampered := &Block{Header: block.Header, Transactions: []*Transaction{NewTransactionByStd(&StdTransaction{
+		GasPrice: new(big.Int),
+		GasLimit: new(big.Int),
+		Value:    new(big.Int),
+	})}}
+	if err = bc.InsertChain(tampered); !errors.Is(err, ErrInvalidTxsRoot) {
+		t.Fatalf("want err %v, got %v", ErrInvalidTxsRoot, err)
+	}
+	// Neither is a block ahead of the local clock cached.
+	bc.validator.now = func() time.Time {
+		return time.Unix(int64(block.Header.Timestamp), 0).Add(-maxTimeDrift - time.Second)
+	}
+	if err = bc.InsertChain(block); !errors.Is(err, ErrBlockTimeTooNew) {
+		t.Fatalf("want err %v, got %v", ErrBlockTimeTooNew, err)
+	}
+	bc.validator.now = time.Now
+	if err = bc.InsertChain(block); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.CurrentBHeader().HeaderHash(); got != block.HeaderHash() {
+		t.Fatalf("want head %x, got %x", block.HeaderHash(), got)
+	}
+}
+
+func TestBlockChain_InsertChainBadTransactions(t *testing.T) {
+	stateDb, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDb.Close()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 2147483680, "timestamp": "1000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The transaction is not signed, it can't be applied on any state.
+	txs := []*Transaction{NewTransactionByStd(&StdTransaction{
+		GasPrice: big.NewInt(1),
+		GasLimit: big.NewInt(25000),
+		Value:    big.NewInt(1),
+	})}
+	header := &BlockHeader{
+		Height:           1,
+		HashPrevBlock:    genesis.HeaderHash(),
+		Timestamp:        genesis.Header.Timestamp + 60,
+		Coinbase:         crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey),
+		StateRoot:        genesis.Header.StateRoot,
+		TransactionsRoot: CalcTxsRootHash(txs),
+		GasLimit:         big.NewInt(25000),
+		GasUsed:          new(big.Int),
+		Bits:             genesis.Bits(),
+	}
+	for CheckProofOfWork(header.HeaderHash(), header.Bits, header.Bits) != nil {
+		header.Nonce++
+	}
+	block := NewBlock(header, txs, nil)
+	if err = bc.InsertChain(block); !errors.Is(err, ErrInvalidTransactions) {
+		t.Fatalf("want err %v, got %v", ErrInvalidTransactions, err)
+	}
+	if !IsInvalidBlockError(err) {
+		t.Fatalf("want %v to reject the block as invalid", err)
+	}
+	if err = bc.InsertChain(block); err != ErrBadBlock {
+		t.Fatalf("want err %v, got %v", ErrBadBlock, err)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+const (
+	// medianTimeBlocks is the number of previous blocks the median time past is taken from.
+	medianTimeBlocks = 11
+	// maxTimeDrift is how far in the future a block timestamp may be.
+	maxTimeDrift = 2 * time.Hour
+	// maxBadBlocks is the number of rejected blocks kept in the bad block cache.
+	maxBadBlocks = 64
+)
+
+var (
+	ErrInvalidBlockVersion = errors.New("invalid block version")
+	ErrBlockTimeTooOld     = errors.New("block timestamp not after median time past")
+	ErrBlockTimeTooNew     = errors.New("block timestamp too far in the future")
+	ErrInvalidCoinbase     = errors.New("invalid coinbase address")
+	ErrGasLimitExceeded    = errors.New("block gas used exceeds gas limit")
+	ErrInvalidPow          = errors.New("invalid proof of work")
+	ErrInvalidTxsRoot      = errors.New("invalid transactions root")
+	ErrInvalidTransactions = errors.New("invalid transactions")
+	ErrInvalidReceiptsRoot = errors.New("invalid receipts root")
+	ErrInvalidGasUsed      = errors.New("invalid gas used")
+	ErrInvalidStateRoot    = errors.New("invalid state root")
+)
+
+// invalidBlockErrors are the errors of blocks breaking the consensus rules.
+var invalidBlockErrors = []error{
+	ErrInvalidBlockVersion, ErrBlockTimeTooOld, ErrInvalidCoinbase,
+	ErrGasLimitExceeded, ErrInvalidPow, ErrInvalidTxsRoot, ErrInvalidTransactions,
+	ErrInvalidReceiptsRoot, ErrInvalidGasUsed, ErrInvalidStateRoot, ErrCheckpointMismatch, ErrBadBlock,
+}
+
+// IsInvalidBlockError reports whether err rejects a block for breaking the
+// consensus rules, rather than for a local failure or a timestamp ahead of
+// the local clock.
+func IsInvalidBlockError(err error) bool {
+	for _, target := range invalidBlockErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableBlockError reports whether a block rejected with err may still
+// be valid, as err is not bound to its hash: the header does not cover the
+// transactions relayed along, and the local clock may be late. Such blocks
+// are not cached as bad.
+func isRetryableBlockError(err error) bool {
+	return errors.Is(err, ErrInvalidTxsRoot) || errors.Is(err, ErrBlockTimeTooNew)
+}
+
+// BlockValidator checks blocks against the consensus rules before they are
+// accepted into the chain.
+type BlockValidator struct {
+	chain *BlockChain
+	// now returns the local time the timestamps are checked against.
+	now func() time.Time
+}
+
+func newBlockValidator(chain *BlockChain) *BlockValidator {
+	return &BlockValidator{
+		chain: chain,
+		now:   time.Now,
+	}
+}
+
+// ValidateHeader checks the header of a block on top of parent, the
+// proof of work included.
+func (v *BlockValidator) ValidateHeader(parent, header *BlockHeader) error {
+	return v.validateHeader(parent, header, v.chain.GetBlockHeaderByBHash)
+}
+
+// ValidateHeaders checks a chain of headers on top of parent which are not
+// stored yet, each as ValidateHeader would once the ones before it are.
+func (v *BlockValidator) ValidateHeaders(parent *BlockHeader, headers []*BlockHeader) error {
+	pending := make(map[common.Hash]*BlockHeader, len(headers))
+	getHeader := func(hash common.Hash) *BlockHeader {
+		if header, ok := pending[hash]; ok {
+			return header
+		}
+		return v.chain.GetBlockHeaderByBHash(hash)
+	}
+	for _, header := range headers {
+		if err := v.validateHeader(parent, header, getHeader); err != nil {
+			return fmt.Errorf("height=%d: %w", header.Height, err)
+		}
+		pending[header.HeaderHash()] = header
+		parent = header
+	}
+	return nil
+}
+
+func (v *BlockValidator) validateHeader(parent, header *BlockHeader, getHeader headerReader) error {
+	if cp := v.chain.CheckpointAt(header.Height); cp != nil && cp.Hash != header.HeaderHash() {
+		return fmt.Errorf("%w: height=%d, want=%x", ErrCheckpointMismatch, cp.Height, cp.Hash)
+	}
+	if want := v.chain.config.ProtocolVersion(header.Height); header.Version != want {
+		return fmt.Errorf("%w: want=%d, got=%d", ErrInvalidBlockVersion, want, header.Version)
+	}
+	if mtp := medianTimePast(parent, getHeader); header.Timestamp <= mtp {
+		return fmt.Errorf("%w: timestamp=%d, median=%d", ErrBlockTimeTooOld, header.Timestamp, mtp)
+	}
+	if limit := v.now().Add(maxTimeDrift).Unix(); int64(header.Timestamp) > limit {
+		return fmt.Errorf("%w: timestamp=%d, limit=%d", ErrBlockTimeTooNew, header.Timestamp, limit)
+	}
+	if !crypto.VerifyAddress(header.Coinbase) {
+		return fmt.Errorf("%w: %s", ErrInvalidCoinbase, header.Coinbase.B58String())
+	}
+	if header.GasLimit == nil || header.GasUsed == nil || header.GasUsed.Cmp(header.GasLimit) > 0 {
+		return ErrGasLimitExceeded
+	}
+	if err := v.chain.checkBlockHeaderSanity(parent, header, header.HeaderHash(), getHeader); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPow, err)
+	}
+	return nil
+}
+
+// ValidateBody checks the transactions of a block match its header.
+func (v *BlockValidator) ValidateBody(block *Block) error {
+	txsRoot := block.TransactionRoot()
+	if target := CalcTxsRootHash(block.Transactions); !bytes.Equal(target[:], txsRoot[:]) {
+		return ErrInvalidTxsRoot
+	}
+	return nil
+}
+
+// ValidateState checks the result of executing the transactions of a
+// block, stateTree must have the rewards of the block accumulated.
+func (v *BlockValidator) ValidateState(header *BlockHeader, stateTree *StateTree, receipts []*Receipt, gasUsed *big.Int) error {
+	if gasUsed.Cmp(header.GasUsed) != 0 {
+		return fmt.Errorf("%w: header=%s, got=%s", ErrInvalidGasUsed, header.GasUsed, gasUsed)
+	}
+	if target := CalcReceiptRootHash(receipts); !bytes.Equal(target[:], header.ReceiptsRoot[:]) {
+		return ErrInvalidReceiptsRoot
+	}
+	if root := stateTree.Root(); !bytes.Equal(root, header.StateRoot[:]) {
+		return fmt.Errorf("%w: header=%x, got=%x", ErrInvalidStateRoot, header.StateRoot, root)
+	}
+	return nil
+}
+
+// medianTimePast returns the median timestamp of the last medianTimeBlocks
+// blocks ending with header.
+func medianTimePast(header *BlockHeader, getHeader headerReader) uint64 {
+	timestamps := make([]uint64, 0, medianTimeBlocks)
+	for h := header; h != nil && len(timestamps) < medianTimeBlocks; {
+		timestamps = append(timestamps, h.Timestamp)
+		if h.Height == 0 {
+			break
+		}
+		h = getHeader(h.HashPrevBlock)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2]
+}
+
+// BadBlock is a block rejected by the validator.
+type BadBlock struct {
+	Hash     common.Hash
+	Header   *BlockHeader
+	Reason   string
+	Received time.Time
+}
+
+// badBlockCache keeps the most recently rejected blocks.
+type badBlockCache struct {
+	mu     sync.RWMutex
+	blocks []*BadBlock
+	hashes map[common.Hash]struct{}
+}
+
+func newBadBlockCache() *badBlockCache {
+	return &badBlockCache{
+		hashes: make(map[common.Hash]struct{}),
+	}
+}
+
+func (c *badBlockCache) add(header *BlockHeader, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash := header.HeaderHash()
+	if _, exists := c.hashes[hash]; exists {
+		return
+	}
+	if len(c.blocks) >= maxBadBlocks {
+		delete(c.hashes, c.blocks[0].Hash)
+		c.blocks = c.blocks[1:]
+	}
+	c.blocks = append(c.blocks, &BadBlock{
+		Hash:     hash,
+		Header:   header,
+		Reason:   reason.Error(),
+		Received: time.Now(),
+	})
+	c.hashes[hash] = struct{}{}
+}
+
+func (c *badBlockCache) has(hash common.Hash) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, exists := c.hashes[hash]
+	return exists
+}
+
+// list returns the bad blocks, the most recent first.
+func (c *badBlockCache) list() []*BadBlock {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]*BadBlock, 0, len(c.blocks))
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		result = append(result, c.blocks[i])
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/test"
+)
+
+func TestBlockValidator_ValidateHeader(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 534773790, "timestamp": "1000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := bc.validator
+	validator.now = func() time.Time { return time.Unix(2000, 0) }
+	coinbase := crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey)
+	newHeader := func() *BlockHeader {
+		return &BlockHeader{
+			Height:        1,
+			HashPrevBlock: genesis.HeaderHash(),
+			Timestamp:     1500,
+			Coinbase:      coinbase,
+			GasLimit:      big.NewInt(100),
+			GasUsed:       big.NewInt(50),
+			Bits:          genesis.Bits(),
+		}
+	}
+	tests := []struct {
+		modify func(h *BlockHeader)
+		want   error
+	}{
+		{func(h *BlockHeader) { h.Version = 1 }, ErrInvalidBlockVersion},
+		{func(h *BlockHeader) { h.Timestamp = genesis.Header.Timestamp }, ErrBlockTimeTooOld},
+		{func(h *BlockHeader) { h.Timestamp = 2000 + uint64(maxTimeDrift/time.Second) + 1 }, ErrBlockTimeTooNew},
+		{func(h *BlockHeader) { h.Coinbase = common.Address{} }, ErrInvalidCoinbase},
+		{func(h *BlockHeader) { h.GasUsed = big.NewInt(101) }, ErrGasLimitExceeded},
+		{func(h *BlockHeader) { h.Bits = genesis.Bits() + 1 }, ErrInvalidPow},
+	}
+	for i, tt := range tests {
+		header := newHeader()
+		tt.modify(header)
+		if err := validator.ValidateHeader(genesis.Header, header); !errors.Is(err, tt.want) {
+			t.Fatalf("case %d: want err %v, got %v", i, tt.want, err)
+		}
+	}
+}
+
+func TestBlockValidator_ValidateState(t *testing.T) {
+	stateTree, err := NewStateTreeN(test.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateTree.AddBalance(common.Address{1}, big.NewInt(10))
+	stateTree.UpdateAll()
+	header := &BlockHeader{
+		GasUsed:      new(big.Int),
+		ReceiptsRoot: CalcReceiptRootHash(nil),
+		StateRoot:    common.Bytes2Hash(stateTree.Root()),
+	}
+	validator := &BlockValidator{}
+	if err = validator.ValidateState(header, stateTree, nil, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	if err = validator.ValidateState(header, stateTree, nil, big.NewInt(1)); !errors.Is(err, ErrInvalidGasUsed) {
+		t.Fatalf("want err %v, got %v", ErrInvalidGasUsed, err)
+	}
+	stateTree.AddBalance(common.Address{1}, big.NewInt(1))
+	stateTree.UpdateAll()
+	if err = validator.ValidateState(header, stateTree, nil, new(big.Int)); !errors.Is(err, ErrInvalidStateRoot) {
+		t.Fatalf("want err %v, got %v", ErrInvalidStateRoot, err)
+	}
+}
+
+func TestBadBlockCache(t *testing.T) {
+	cache := newBadBlockCache()
+	var first common.Hash
+	for i := 0; i < maxBadBlocks+1; i++ {
+		header := &BlockHeader{Height: uint64(i), GasLimit: new(big.Int), GasUsed: new(big.Int)}
+		if i == 0 {
+			first = header.HeaderHash()
+		}
+		cache.add(header, ErrInvalidStateRoot)
+		cache.add(header, ErrInvalidStateRoot)
+	}
+	list := cache.list()
+	if len(list) != maxBadBlocks {
+		t.Fatalf("want %d bad blocks, got %d", maxBadBlocks, len(list))
+	}
+	if list[0].Header.Height != maxBadBlocks {
+		t.Fatalf("want latest bad block first, got height %d", list[0].Header.Height)
+	}
+	if cache.has(first) {
+		t.Fatalf("want oldest bad block evicted")
+	}
+}
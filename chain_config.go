@@ -0,0 +1,258 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"xfsgo/common"
+	"xfsgo/vm"
+)
+
+const (
+	// ForkNFToken makes the non-fungible token builtin contract available.
+	ForkNFToken = vm.ForkNFToken
+	// ForkVersion1 raises the version of blocks, transactions and receipts to 1.
+	ForkVersion1 = "version1"
+	// ForkBlockFees credits the fees paid by the transactions of a block to
+	// its coinbase along with the subsidy, the blocks before it only credited
+	// the subsidy.
+	ForkBlockFees = "blockfees"
+)
+
+// The heights ForkBlockFees activates at on the main and test networks.
+const (
+	mainNetBlockFeesHeight = uint64(1200000)
+	testNetBlockFeesHeight = uint64(600000)
+)
+
+// knownForks maps the forks this node implements to the protocol version
+// required once they are active.
+var knownForks = map[string]uint32{
+	ForkNFToken:   version0,
+	ForkVersion1:  1,
+	ForkBlockFees: version0,
+}
+
+var errIncompatibleForks = errors.New("incompatible fork schedule")
+
+var (
+	baseSubsidy, _     = new(big.Int).SetString("93755722410000000000", 10)
+	baseTestSubsidy, _ = common.BaseCoin2Atto("14")
+	defaultHalving     = uint64(480)
+)
+
+// ChainConfig holds the economic and difficulty parameters of a chain. It is
+// given by the "config" object of the genesis file and stored along with the
+// genesis block, fields which are not set take the defaults of the network.
+type ChainConfig struct {
+	// Subsidy is the reward (in atto) of a block before the first halving.
+	Subsidy *big.Int `json:"subsidy"`
+	// HalvingInterval is the number of blocks after which the subsidy is halved,
+	// the subsidy never changes if it is zero. Unset (nil), it takes the
+	// interval of the network.
+	HalvingInterval *uint64 `json:"halving_interval"`
+	// TargetBlockTime is the expected time between two blocks in seconds.
+	TargetBlockTime int64 `json:"target_block_time"`
+	// RetargetTimespan is the time in seconds between two difficulty adjustments.
+	RetargetTimespan int64 `json:"retarget_timespan"`
+	// AdjustmentFactor bounds a difficulty adjustment to a factor of the last one.
+	AdjustmentFactor int64 `json:"adjustment_factor"`
+	// GenesisGasLimit is the gas limit of the genesis block.
+	GenesisGasLimit *big.Int `json:"genesis_gas_limit"`
+	// BlockGasLimit is the gas limit of mined blocks unless the miner policy sets one.
+	BlockGasLimit *big.Int `json:"block_gas_limit"`
+	// Forks maps the names of the scheduled forks to their activation heights.
+	Forks map[string]uint64 `json:"forks"`
+}
+
+// DefaultMainNetChainConfig returns the parameters of the main network.
+func DefaultMainNetChainConfig() *ChainConfig {
+	return &ChainConfig{
+		Subsidy:          new(big.Int).Set(baseSubsidy),
+		HalvingInterval:  newUint64(defaultHalving),
+		TargetBlockTime:  targetTimePerBlock,
+		RetargetTimespan: targetTimespan,
+		AdjustmentFactor: adjustmentFactor,
+		GenesisGasLimit:  new(big.Int).Set(common.GenesisGasLimit),
+		BlockGasLimit:    new(big.Int).Set(common.TxPoolGasLimit),
+		Forks: map[string]uint64{
+			ForkNFToken:   0,
+			ForkBlockFees: mainNetBlockFeesHeight,
+		},
+	}
+}
+
+// DefaultTestNetChainConfig returns the parameters of the test network,
+// which has a fixed block subsidy.
+func DefaultTestNetChainConfig() *ChainConfig {
+	config := DefaultMainNetChainConfig()
+	config.Subsidy = new(big.Int).Set(baseTestSubsidy)
+	config.HalvingInterval = newUint64(0)
+	config.Forks[ForkBlockFees] = testNetBlockFeesHeight
+	return config
+}
+
+// networkChainConfig returns the config of the public network whose genesis
+// block has hash, nil for the other chains.
+func networkChainConfig(hash common.Hash) *ChainConfig {
+	switch hash {
+	case MainNetGenesisHash:
+		return DefaultMainNetChainConfig()
+	case TestNetGenesisHash:
+		return DefaultTestNetChainConfig()
+	}
+	return nil
+}
+
+// defaultChainConfigByBits returns the default config of the network whose genesis block has bits.
+func defaultChainConfigByBits(bits uint32) *ChainConfig {
+	if bits == TestNetGenesisBits {
+		return DefaultTestNetChainConfig()
+	}
+	return DefaultMainNetChainConfig()
+}
+
+// withDefaults fills the fields which are not set with the ones of def.
+func (c *ChainConfig) withDefaults(def *ChainConfig) *ChainConfig {
+	result := *c
+	if result.Subsidy == nil {
+		result.Subsidy = def.Subsidy
+	}
+	if result.HalvingInterval == nil {
+		result.HalvingInterval = def.HalvingInterval
+	}
+	if result.TargetBlockTime == 0 {
+		result.TargetBlockTime = def.TargetBlockTime
+	}
+	if result.RetargetTimespan == 0 {
+		result.RetargetTimespan = def.RetargetTimespan
+	}
+	if result.AdjustmentFactor == 0 {
+		result.AdjustmentFactor = def.AdjustmentFactor
+	}
+	if result.GenesisGasLimit == nil {
+		result.GenesisGasLimit = def.GenesisGasLimit
+	}
+	if result.BlockGasLimit == nil {
+		result.BlockGasLimit = def.BlockGasLimit
+	}
+	if result.Forks == nil {
+		result.Forks = def.Forks
+	}
+	return &result
+}
+
+// Validate checks the parameters are usable.
+func (c *ChainConfig) Validate() error {
+	if c.Subsidy == nil || c.Subsidy.Sign() < 0 {
+		return errors.New("chain config: subsidy must not be negative")
+	}
+	if c.TargetBlockTime <= 0 {
+		return errors.New("chain config: target block time must be positive")
+	}
+	if c.RetargetTimespan < c.TargetBlockTime {
+		return errors.New("chain config: retarget timespan shorter than target block time")
+	}
+	if c.AdjustmentFactor < 1 {
+		return errors.New("chain config: adjustment factor must be at least 1")
+	}
+	if c.GenesisGasLimit == nil || c.GenesisGasLimit.Cmp(common.MinGasLimit) < 0 {
+		return errors.New("chain config: genesis gas limit too low")
+	}
+	if c.BlockGasLimit == nil || c.BlockGasLimit.Cmp(common.MinGasLimit) < 0 {
+		return errors.New("chain config: block gas limit too low")
+	}
+	for name := range c.Forks {
+		if _, exists := knownForks[name]; !exists {
+			return fmt.Errorf("chain config: unknown fork %s", name)
+		}
+	}
+	return nil
+}
+
+// IsForkActive reports whether the fork of name is active at height.
+func (c *ChainConfig) IsForkActive(name string, height uint64) bool {
+	activation, exists := c.Forks[name]
+	return exists && height >= activation
+}
+
+// ActiveForks returns the names of the forks active at height, sorted.
+func (c *ChainConfig) ActiveForks(height uint64) []string {
+	forks := make([]string, 0, len(c.Forks))
+	for name := range c.Forks {
+		if c.IsForkActive(name, height) {
+			forks = append(forks, name)
+		}
+	}
+	sort.Strings(forks)
+	return forks
+}
+
+// ProtocolVersion returns the version of the blocks at height, which is also
+// the highest version of the transactions they may include.
+func (c *ChainConfig) ProtocolVersion(height uint64) uint32 {
+	version := version0
+	for name := range c.Forks {
+		if v := knownForks[name]; v > version && c.IsForkActive(name, height) {
+			version = v
+		}
+	}
+	return version
+}
+
+// CheckForkCompatible checks the fork schedule of a peer whose chain is at
+// remoteHeight against ours at localHeight. The schedules conflict if a fork
+// is scheduled at different heights, or if a fork only one side knows is
+// already active on the chain of the other side.
+func CheckForkCompatible(local, remote map[string]uint64, localHeight, remoteHeight uint64) error {
+	for name, height := range local {
+		remoteActivation, exists := remote[name]
+		if exists && remoteActivation != height {
+			return fmt.Errorf("%w: fork %s at %d, remote at %d", errIncompatibleForks, name, height, remoteActivation)
+		}
+		if !exists && height <= remoteHeight {
+			return fmt.Errorf("%w: fork %s at %d unknown to remote", errIncompatibleForks, name, height)
+		}
+	}
+	for name, height := range remote {
+		if _, exists := local[name]; !exists && height <= localHeight {
+			return fmt.Errorf("%w: remote fork %s at %d unknown", errIncompatibleForks, name, height)
+		}
+	}
+	return nil
+}
+
+// BlockSubsidy returns the subsidy of the block at height.
+func (c *ChainConfig) BlockSubsidy(height uint64) *big.Int {
+	if c.HalvingInterval == nil || *c.HalvingInterval == 0 {
+		return new(big.Int).Set(c.Subsidy)
+	}
+	return new(big.Int).Rsh(c.Subsidy, uint(height / *c.HalvingInterval))
+}
+
+// newUint64 returns a pointer to a copy of v, for the optional config fields.
+func newUint64(v uint64) *uint64 {
+	return &v
+}
+
+// BlocksPerRetarget returns the number of blocks between two difficulty adjustments.
+func (c *ChainConfig) BlocksPerRetarget() uint64 {
+	return uint64(c.RetargetTimespan / c.TargetBlockTime)
+}
@@ -0,0 +1,157 @@
+package xfsgo
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/storage/badger"
+	"xfsgo/test"
+)
+
+func TestChainConfig_BlockSubsidy(t *testing.T) {
+	config := DefaultMainNetChainConfig()
+	config.HalvingInterval = newUint64(10)
+	if got := config.BlockSubsidy(9); got.Cmp(config.Subsidy) != 0 {
+		t.Fatalf("want subsidy %s before halving, got %s", config.Subsidy, got)
+	}
+	if got := config.BlockSubsidy(25); got.Cmp(new(big.Int).Rsh(config.Subsidy, 2)) != 0 {
+		t.Fatalf("want subsidy halved twice, got %s", got)
+	}
+	config.HalvingInterval = newUint64(0)
+	if got := config.BlockSubsidy(1 << 40); got.Cmp(config.Subsidy) != 0 {
+		t.Fatalf("want fixed subsidy, got %s", got)
+	}
+	// An explicit zero disables the halving, it is not replaced by the default.
+	config = (&ChainConfig{HalvingInterval: newUint64(0)}).withDefaults(DefaultMainNetChainConfig())
+	if got := config.BlockSubsidy(defaultHalving + 1); got.Cmp(config.Subsidy) != 0 {
+		t.Fatalf("want flat subsidy past block %d, got %s", defaultHalving, got)
+	}
+}
+
+func TestWriteGenesisBlock_ChainConfig(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	genesis := `{
+	"bits": 534773790,
+	"config": {
+		"subsidy": 5000,
+		"halving_interval": 100,
+		"target_block_time": 10,
+		"block_gas_limit": 50000
+	}
+}`
+	block, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(genesis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := bc.Config()
+	if config.Subsidy.Int64() != 5000 || *config.HalvingInterval != 100 || config.TargetBlockTime != 10 {
+		t.Fatalf("unexpected chain config: %+v", config)
+	}
+	if config.BlockGasLimit.Int64() != 50000 {
+		t.Fatalf("want block gas limit 50000, got %s", config.BlockGasLimit)
+	}
+	def := DefaultMainNetChainConfig()
+	if config.RetargetTimespan != def.RetargetTimespan || config.GenesisGasLimit.Cmp(block.Header.GasLimit) != 0 {
+		t.Fatalf("unset fields should take defaults: %+v", config)
+	}
+	// Subsidy and halving interval take the defaults each on its own.
+	def = DefaultMainNetChainConfig()
+	config = (&ChainConfig{Subsidy: big.NewInt(5000)}).withDefaults(def)
+	if config.Subsidy.Int64() != 5000 || *config.HalvingInterval != *def.HalvingInterval {
+		t.Fatalf("want default halving interval with a subsidy set: %+v", config)
+	}
+	config = (&ChainConfig{HalvingInterval: newUint64(100)}).withDefaults(def)
+	if config.Subsidy.Cmp(def.Subsidy) != 0 || *config.HalvingInterval != 100 {
+		t.Fatalf("want halving interval kept without a subsidy set: %+v", config)
+	}
+	if _, err = WriteGenesisBlock(test.NewMemStorage(), test.NewMemStorage(),
+		strings.NewReader(`{"config": {"target_block_time": -1}}`)); err == nil {
+		t.Fatalf("want error for invalid config")
+	}
+}
+
+func TestChainConfig_Forks(t *testing.T) {
+	config := DefaultMainNetChainConfig()
+	config.Forks[ForkVersion1] = 100
+	if !config.IsForkActive(ForkNFToken, 0) || config.IsForkActive(ForkVersion1, 99) {
+		t.Fatalf("unexpected active forks: %v", config.ActiveForks(99))
+	}
+	if got := config.ProtocolVersion(99); got != version0 {
+		t.Fatalf("want version %d before fork, got %d", version0, got)
+	}
+	if got := config.ProtocolVersion(100); got != 1 {
+		t.Fatalf("want version 1 after fork, got %d", got)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	config.Forks["unknown"] = 1
+	if err := config.Validate(); err == nil {
+		t.Fatalf("want error for unknown fork")
+	}
+}
+
+func TestCheckForkCompatible(t *testing.T) {
+	local := map[string]uint64{ForkNFToken: 0, ForkVersion1: 100}
+	tests := []struct {
+		remote       map[string]uint64
+		remoteHeight uint64
+		ok           bool
+	}{
+		{map[string]uint64{ForkNFToken: 0, ForkVersion1: 100}, 200, true},
+		{map[string]uint64{ForkNFToken: 0, ForkVersion1: 150}, 50, false},
+		// The remote does not know a fork it has not reached yet.
+		{map[string]uint64{ForkNFToken: 0}, 99, true},
+		{map[string]uint64{ForkNFToken: 0}, 100, false},
+		{map[string]uint64{ForkNFToken: 0, ForkVersion1: 100, "other": 20}, 10, false},
+	}
+	for i, tt := range tests {
+		err := CheckForkCompatible(local, tt.remote, 50, tt.remoteHeight)
+		if (err == nil) != tt.ok {
+			t.Fatalf("case %d: want compatible %v, got err %v", i, tt.ok, err)
+		}
+	}
+}
+
+func TestNewBlockChain_NetworkForks(t *testing.T) {
+	if !DefaultMainNetChainConfig().IsForkActive(ForkBlockFees, mainNetBlockFeesHeight) ||
+		DefaultMainNetChainConfig().IsForkActive(ForkBlockFees, mainNetBlockFeesHeight-1) {
+		t.Fatalf("want blockfees active from height %d on the main network", mainNetBlockFeesHeight)
+	}
+	if !DefaultTestNetChainConfig().IsForkActive(ForkBlockFees, testNetBlockFeesHeight) {
+		t.Fatalf("want blockfees active from height %d on the test network", testNetBlockFeesHeight)
+	}
+	// The genesis state is committed with a write batch, which the memory
+	// storage lacks.
+	stateDb, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDb.Close()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteMainNetGenesisBlock(stateDb, chainDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.HeaderHash() != MainNetGenesisHash {
+		t.Fatalf("want main network genesis %x, got %x", MainNetGenesisHash, genesis.HeaderHash())
+	}
+	// A node stored the config before the fork was scheduled.
+	stale := DefaultMainNetChainConfig()
+	delete(stale.Forks, ForkBlockFees)
+	if err = newChainDBN(chainDb, false).WriteChainConfig(MainNetGenesisHash, stale); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.Config().Forks[ForkBlockFees]; got != mainNetBlockFeesHeight {
+		t.Fatalf("want blockfees at %d, got %d", mainNetBlockFeesHeight, got)
+	}
+}
@@ -19,6 +19,8 @@ package xfsgo
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"math/big"
 	"xfsgo/common"
 	"xfsgo/common/rawencode"
 	"xfsgo/storage/badger"
@@ -31,6 +33,8 @@ var (
 	blockHeightPre     = []byte("bn:")
 	blockHeightHashPre = []byte("bnh:")
 	lastBlockKey       = []byte("LastBlock")
+	chainConfigPre     = []byte("cfg:")
+	totalWorkPre       = []byte("tw:")
 )
 
 type chainDB struct {
@@ -109,6 +113,54 @@ func (db *chainDB) GetBlocksByNumber(num uint64) []*BlockHeader {
 	return blks
 }
 
+// GetChainConfig returns the chain config stored with the genesis block of hash.
+func (db *chainDB) GetChainConfig(genesisHash common.Hash) *ChainConfig {
+	key := append(chainConfigPre, genesisHash.Bytes()...)
+	val, err := db.storage.GetData(key)
+	if err != nil {
+		return nil
+	}
+	config := &ChainConfig{}
+	if err = json.Unmarshal(val, config); err != nil {
+		return nil
+	}
+	return config
+}
+
+// WriteChainConfig stores the chain config with the genesis block of hash.
+func (db *chainDB) WriteChainConfig(genesisHash common.Hash, config *ChainConfig) error {
+	key := append(chainConfigPre, genesisHash.Bytes()...)
+	val, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err = db.storage.SetData(key, val); err != nil {
+		logrus.Errorf("Write chain config err: %s", err)
+		return err
+	}
+	return nil
+}
+
+// GetTotalWork returns the cumulative work of the chain ending with the block of hash.
+func (db *chainDB) GetTotalWork(hash common.Hash) *big.Int {
+	key := append(totalWorkPre, hash.Bytes()...)
+	val, err := db.storage.GetData(key)
+	if err != nil || val == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(val)
+}
+
+// WriteTotalWork stores the cumulative work of the chain ending with the block of hash.
+func (db *chainDB) WriteTotalWork(hash common.Hash, work *big.Int) error {
+	key := append(totalWorkPre, hash.Bytes()...)
+	if err := db.storage.SetData(key, work.Bytes()); err != nil {
+		logrus.Errorf("Write total work err: %s", err)
+		return err
+	}
+	return nil
+}
+
 // Write BlockHeader links Hash to chainDB
 func (db *chainDB) WriteBHeaderWithHash(blockHeader *BlockHeader) error {
 	hash := blockHeader.HeaderHash()
@@ -181,6 +233,18 @@ func (db *chainDB) WriteBHeader2Chain(blockHeader *BlockHeader) error {
 	return nil
 }
 
+// DelBHeaderHashWithHeight removes the main chain block of height
+func (db *chainDB) DelBHeaderHashWithHeight(height uint64) error {
+	var numBuf [8]byte
+	binary.LittleEndian.PutUint64(numBuf[:], height)
+	key := append(blockHeightPre, numBuf[:]...)
+	if err := db.storage.DelData(key); err != nil {
+		logrus.Errorf("Remove canon number err: %s", err)
+		return err
+	}
+	return nil
+}
+
 //DelBHeaderByHeightAndHash Del BlockHeader linked with height and hash by height and hash
 func (db *chainDB) DelBHeaderByHeightAndHash(height uint64, hash common.Hash) error {
 	var heightbytes = make([]byte, 8)
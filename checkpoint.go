@@ -0,0 +1,113 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"xfsgo/common"
+)
+
+var (
+	ErrCheckpointMismatch   = errors.New("block does not match checkpoint")
+	ErrReorgBelowCheckpoint = errors.New("reorg below checkpoint")
+)
+
+// Checkpoint pins the hash of the main chain block at a height. Blocks
+// conflicting with a checkpoint are rejected, so that a node syncing from
+// scratch can't be led onto another chain whatever its work.
+type Checkpoint struct {
+	Height uint64
+	Hash   common.Hash
+}
+
+// networkCheckpoints holds the checkpoints of the public networks, keyed by
+// the hash of their genesis block. Each network is anchored at its genesis
+// block; later entries are taken from the published chains when a release is
+// cut, and the --checkpoint flag of the daemon adds more.
+var networkCheckpoints = map[common.Hash][]Checkpoint{
+	MainNetGenesisHash: {
+		{Height: 0, Hash: MainNetGenesisHash},
+	},
+	TestNetGenesisHash: {
+		{Height: 0, Hash: TestNetGenesisHash},
+	},
+}
+
+// ParseCheckpoint parses a checkpoint given as height:hash.
+func ParseCheckpoint(s string) (*Checkpoint, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("checkpoint %q: want height:hash", s)
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint %q: invalid height", s)
+	}
+	if err = common.HashCalibrator(parts[1]); err != nil {
+		return nil, fmt.Errorf("checkpoint %q: %v", s, err)
+	}
+	return &Checkpoint{
+		Height: height,
+		Hash:   common.Hex2Hash(parts[1]),
+	}, nil
+}
+
+// checkpointList is a set of checkpoints sorted by height.
+type checkpointList []Checkpoint
+
+// add inserts cp, replacing the checkpoint at the same height if any.
+func (l checkpointList) add(cp Checkpoint) checkpointList {
+	i := sort.Search(len(l), func(i int) bool {
+		return l[i].Height >= cp.Height
+	})
+	if i < len(l) && l[i].Height == cp.Height {
+		l[i] = cp
+		return l
+	}
+	l = append(l, Checkpoint{})
+	copy(l[i+1:], l[i:])
+	l[i] = cp
+	return l
+}
+
+// at returns the checkpoint at height, or nil if there is none.
+func (l checkpointList) at(height uint64) *Checkpoint {
+	i := sort.Search(len(l), func(i int) bool {
+		return l[i].Height >= height
+	})
+	if i < len(l) && l[i].Height == height {
+		cp := l[i]
+		return &cp
+	}
+	return nil
+}
+
+// last returns the highest checkpoint not above height, or nil if there is none.
+func (l checkpointList) last(height uint64) *Checkpoint {
+	i := sort.Search(len(l), func(i int) bool {
+		return l[i].Height > height
+	})
+	if i == 0 {
+		return nil
+	}
+	cp := l[i-1]
+	return &cp
+}
@@ -0,0 +1,122 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/common"
+	"xfsgo/storage/badger"
+	"xfsgo/test"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := common.Hex2Hash("0x00000000000000000000000000000000000000000000000000000000000000ff")
+	cp, err := ParseCheckpoint("120:" + hash.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Height != 120 || cp.Hash != hash {
+		t.Fatalf("unexpected checkpoint: %+v", cp)
+	}
+	for _, s := range []string{"120", "x:" + hash.Hex(), "120:0x01"} {
+		if _, err = ParseCheckpoint(s); err == nil {
+			t.Fatalf("want error for %q", s)
+		}
+	}
+}
+
+func TestCheckpointList(t *testing.T) {
+	var l checkpointList
+	for _, height := range []uint64{50, 10, 30, 30} {
+		l = l.add(Checkpoint{Height: height})
+	}
+	if len(l) != 3 || l[0].Height != 10 || l[2].Height != 50 {
+		t.Fatalf("unexpected checkpoints: %v", l)
+	}
+	if cp := l.at(30); cp == nil || cp.Height != 30 {
+		t.Fatalf("want checkpoint at 30, got %v", cp)
+	}
+	if cp := l.at(20); cp != nil {
+		t.Fatalf("want no checkpoint at 20, got %v", cp)
+	}
+	if cp := l.last(49); cp == nil || cp.Height != 30 {
+		t.Fatalf("want last checkpoint 30, got %v", cp)
+	}
+	if cp := l.last(9); cp != nil {
+		t.Fatalf("want no checkpoint below 10, got %v", cp)
+	}
+}
+
+func TestBlockChain_ReorgBelowCheckpoint(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 534773790}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBlock := func(parent *Block, bits uint32, timestamp uint64) (*Block, error) {
+		header := &BlockHeader{
+			Height:        parent.Height() + 1,
+			HashPrevBlock: parent.HeaderHash(),
+			Timestamp:     timestamp,
+			StateRoot:     genesis.Header.StateRoot,
+			GasLimit:      new(big.Int),
+			GasUsed:       new(big.Int),
+			Bits:          bits,
+		}
+		block := NewBlock(header, nil, nil)
+		return block, bc.writeBlock(block)
+	}
+	bits := genesis.Bits()
+	a1, err := newBlock(genesis, bits, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.AddCheckpoint(Checkpoint{Height: 1, Hash: genesis.HeaderHash()}); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("want err %v, got %v", ErrCheckpointMismatch, err)
+	}
+	if err = bc.AddCheckpoint(Checkpoint{Height: 1, Hash: a1.HeaderHash()}); err != nil {
+		t.Fatal(err)
+	}
+	// A heavier fork from the genesis block would replace the checkpointed block.
+	if _, err = newBlock(genesis, bits-1, 2); !errors.Is(err, ErrReorgBelowCheckpoint) {
+		t.Fatalf("want err %v, got %v", ErrReorgBelowCheckpoint, err)
+	}
+	if got := bc.CurrentBHeader().HeaderHash(); got != a1.HeaderHash() {
+		t.Fatalf("want head %x, got %x", a1.HeaderHash(), got)
+	}
+	if cp := bc.LastCheckpoint(); cp == nil || cp.Hash != a1.HeaderHash() {
+		t.Fatalf("unexpected last checkpoint: %v", cp)
+	}
+}
+
+func TestBlockChain_NetworkCheckpoints(t *testing.T) {
+	for genesis, cps := range networkCheckpoints {
+		if cp := checkpointList(cps).at(0); cp == nil || cp.Hash != genesis {
+			t.Fatalf("network %x: want genesis checkpoint, got %v", genesis, cp)
+		}
+	}
+	// The genesis state is committed with a write batch, which the memory
+	// storage lacks.
+	stateDb, err := badger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDb.Close()
+	chainDb := test.NewMemStorage()
+	if _, err = WriteTestNetGenesisBlock(stateDb, chainDb); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp := bc.LastCheckpoint(); cp == nil || cp.Height != 0 || cp.Hash != TestNetGenesisHash {
+		t.Fatalf("want test network genesis checkpoint, got %v", cp)
+	}
+}
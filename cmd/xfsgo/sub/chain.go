@@ -18,7 +18,6 @@ package sub
 
 import (
 	"fmt"
-	"xfsgo"
 	"xfsgo/common"
 
 	"github.com/spf13/cobra"
@@ -92,7 +91,7 @@ func getHead() error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var block *common.BlocksMap
 	err = cli.CallMethod(1, "Chain.GetHead", nil, &block)
 	if err != nil {
@@ -124,7 +123,7 @@ func getBlockByNum(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var result *common.BlocksMap
 	req := &getBlockByNumArgs{
 		Number: args[0],
@@ -156,7 +155,7 @@ func getBlockByHash(cmd *cobra.Command, args []string) error {
 		fmt.Println(err)
 		return nil
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var block *common.BlocksMap
 	req := &getBlockByHashArgs{
 		Hash: args[0],
@@ -193,7 +192,7 @@ func getTxsByBlockNum(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 
 	result := make([]map[string]interface{}, 0)
 	req := &getTxsByBlockNumArgs{
@@ -226,7 +225,7 @@ func getTxsByBlockHash(cmd *cobra.Command, args []string) error {
 	}
 
 	result := make([]map[string]interface{}, 0)
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	req := getTxsByBlockHashArgs{
 		Hash: args[0],
 	}
@@ -257,7 +256,7 @@ func getReceiptByTxHash(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	result := make(map[string]interface{})
 	req := &getReceiptByHashArgs{
 		Hash: args[0],
@@ -283,7 +282,7 @@ func getTransaction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	result := make(map[string]interface{})
 	req := &getTransactionArgs{
 		Hash: args[0],
@@ -312,7 +311,7 @@ func getSyncStatus(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	result := make(map[string]interface{})
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	if err = cli.CallMethod(1, "Chain.GetSyncStatus", nil, &result); err != nil {
 		return nil
 	}
@@ -27,6 +27,7 @@ import (
 	"xfsgo"
 	"xfsgo/backend"
 	"xfsgo/common"
+	"xfsgo/miner"
 	"xfsgo/node"
 
 	"github.com/spf13/viper"
@@ -41,6 +42,8 @@ const (
 	defaultExtraDir          = "extra"
 	defaultNodesDir          = "nodes"
 	defaultLogsDir           = "logs"
+	defaultLightDir          = "light"
+	defaultIPCFile           = "xfsgo.ipc"
 	defaultRPCClientAPIHost  = "127.0.0.1:9012"
 	defaultNodeRPCListenAddr = "127.0.0.1:9012"
 	defaultNodeP2PListenAddr = "0.0.0.0:9011"
@@ -85,6 +88,25 @@ type daemonConfig struct {
 type clientConfig struct {
 	rpcClientApiHost    string
 	rpcClientApiTimeOut string
+	rpcClientApiKey     string
+	rpcClientJWTSecret  string
+	rpcClientIPCPath    string
+}
+
+// newClient returns a RPC client authenticated by the credentials configured.
+// The unix socket of the node is preferred when present.
+func (c clientConfig) newClient() *xfsgo.Client {
+	if c.rpcClientIPCPath != "" {
+		return xfsgo.NewIPCClient(c.rpcClientIPCPath, c.rpcClientApiTimeOut)
+	}
+	cli := xfsgo.NewClient(c.rpcClientApiHost, c.rpcClientApiTimeOut)
+	if c.rpcClientApiKey != "" {
+		cli.SetAPIKey(c.rpcClientApiKey)
+	}
+	if c.rpcClientJWTSecret != "" {
+		cli.SetJWTSecret([]byte(c.rpcClientJWTSecret))
+	}
+	return cli
 }
 
 var defaultNumWorkers = uint32(runtime.NumCPU())
@@ -146,6 +168,27 @@ func setupDataDir(params *storageParams, datadir string) {
 	}
 }
 
+// setupLightDataDir moves the chain of a light node, which keeps partial
+// state, under the light directory apart from the one of a full node.
+// Directories set explicitly are kept.
+func setupLightDataDir(params *storageParams) {
+	lightDir := filepath.Join(params.dataDir, defaultLightDir)
+	dirs := []struct {
+		dir  *string
+		name string
+	}{
+		{&params.chainDir, defaultChainDir},
+		{&params.stateDir, defaultStateDir},
+		{&params.extraDir, defaultExtraDir},
+		{&params.logsDir, defaultLogsDir},
+	}
+	for _, d := range dirs {
+		if *d.dir == filepath.Join(params.dataDir, d.name) {
+			*d.dir = filepath.Join(lightDir, d.name)
+		}
+	}
+}
+
 func parseConfigStorageParams(v *viper.Viper) storageParams {
 	params := storageParams{}
 	params.dataDir = v.GetString("storage.datadir")
@@ -185,6 +228,19 @@ func parseConfigNodeParams(v *viper.Viper, netid uint32) node.Config {
 	config.P2PListenAddress = v.GetString("p2pnode.listen")
 	config.P2PBootstraps = v.GetStringSlice("p2pnode.bootstrap")
 	config.P2PStaticNodes = v.GetStringSlice("p2pnode.static")
+	config.P2PCompression = v.GetStringSlice("p2pnode.compression")
+	config.P2PTrustedNodes = v.GetStringSlice("p2pnode.trusted")
+	config.P2POnlyTrusted = v.GetBool("p2pnode.onlytrusted")
+	config.P2PNetRestrict = v.GetStringSlice("p2pnode.netrestrict")
+	config.P2PMaxPeers = v.GetInt("p2pnode.maxpeers")
+	config.P2PMaxInboundPeers = v.GetInt("p2pnode.maxinboundpeers")
+	config.P2PMaxPendingPeers = v.GetInt("p2pnode.maxpendingpeers")
+	config.P2PDialRatio = v.GetInt("p2pnode.dialratio")
+	config.P2PMaxPeersPerIP = v.GetInt("p2pnode.maxpeersperip")
+	config.P2PMaxPeersPerSubnet = v.GetInt("p2pnode.maxpeerspersubnet")
+	config.P2PHandshakeTimeout = v.GetDuration("p2pnode.handshaketimeout")
+	config.P2PDNSDiscovery = v.GetStringSlice("p2pnode.dnsdiscovery")
+	config.P2PListenIP6 = v.GetString("p2pnode.listen6")
 	config.ProtocolVersion = uint8(v.GetUint64("protocol.version"))
 	if config.RPCConfig.ListenAddr == "" {
 		config.RPCConfig.ListenAddr = defaultNodeRPCListenAddr
@@ -198,14 +254,66 @@ func parseConfigNodeParams(v *viper.Viper, netid uint32) node.Config {
 	return config
 }
 
-func parseConfigBackendParams(v *viper.Viper) backend.Params {
+// parseConfigRPCParams reads the authentication and the permissions of the
+// RPC server. API keys and permissions are lists of "<key>:<permission>",
+// as the keys of maps are not case-sensitive.
+func parseConfigRPCParams(v *viper.Viper, config *xfsgo.RPCConfig) error {
+	config.AdminListenAddr = v.GetString("rpcserver.adminlisten")
+	config.CORSOrigins = v.GetStringSlice("rpcserver.cors")
+	if secret := v.GetString("rpcserver.jwtsecret"); secret != "" {
+		config.JWTSecret = []byte(secret)
+	}
+	var err error
+	if config.APIKeys, err = parsePermissionList(v.GetStringSlice("rpcserver.apikeys")); err != nil {
+		return fmt.Errorf("rpcserver.apikeys: %w", err)
+	}
+	if config.Permissions, err = parsePermissionList(v.GetStringSlice("rpcserver.permissions")); err != nil {
+		return fmt.Errorf("rpcserver.permissions: %w", err)
+	}
+	return nil
+}
+
+// ipcPathOf returns the path of the IPC socket of a setting, the socket
+// in the data directory by default, none if disabled.
+func ipcPathOf(setting, dataDir string) string {
+	switch setting {
+	case "":
+		return filepath.Join(dataDir, defaultIPCFile)
+	case "none", "off":
+		return ""
+	}
+	return setting
+}
+
+func parsePermissionList(list []string) (map[string]xfsgo.RPCPermission, error) {
+	perms := make(map[string]xfsgo.RPCPermission)
+	for _, item := range list {
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid entry %q, want <key>:<permission>", item)
+		}
+		perm, err := xfsgo.ParseRPCPermission(item[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		perms[item[:i]] = perm
+	}
+	return perms, nil
+}
+
+func parseConfigBackendParams(v *viper.Viper) (backend.Params, error) {
 	var (
 		config = backend.Params{}
+		err    error
 	)
-	config.MinerConfig = backendMinerLoadConf(v)
+	if config.MinerConfig, err = backendMinerLoadConf(v); err != nil {
+		return config, err
+	}
 	config.ProtocolConfig = backendProtocolLoadConf(v)
 	config.TxPoolConfig = backendTxPoolLoadConf(v)
-	return config
+	config.SyncMode = backend.SyncMode(v.GetString("protocol.syncmode"))
+	config.Light = v.GetBool("protocol.light")
+	return config, nil
 }
 
 // position protocol loal tools viper protocol config
@@ -251,7 +359,7 @@ func backendTxPoolLoadConf(v *viper.Viper) *backend.TxPoolConfig {
 }
 
 // position miner loal tools viper miner config
-func backendMinerLoadConf(v *viper.Viper) *backend.MinerConfig {
+func backendMinerLoadConf(v *viper.Viper) (*backend.MinerConfig, error) {
 	config := new(backend.MinerConfig)
 
 	mCoinbase := v.GetString("miner.coinbase")
@@ -271,7 +379,59 @@ func backendMinerLoadConf(v *viper.Viper) *backend.MinerConfig {
 		minGasPrice = defaultMinGasPrice
 	}
 	config.MinGasPrice = minGasPrice
-	return config
+	policy, err := backendMinerPolicyLoadConf(v)
+	if err != nil {
+		return nil, err
+	}
+	config.Policy = policy
+	return config, nil
+}
+
+// backendMinerPolicyLoadConf loads the transaction selection policy of the miner.
+func backendMinerPolicyLoadConf(v *viper.Viper) (*miner.PolicyConfig, error) {
+	config := &miner.PolicyConfig{
+		Name: v.GetString("miner.policy.name"),
+	}
+	lists := []struct {
+		key   string
+		addrs *[]common.Address
+	}{
+		{"miner.policy.blacklistsenders", &config.BlacklistSenders},
+		{"miner.policy.blacklistcontracts", &config.BlacklistContracts},
+		{"miner.policy.localsenders", &config.LocalSenders},
+	}
+	for _, list := range lists {
+		addrs, err := loadAddressList(v, list.key)
+		if err != nil {
+			return nil, err
+		}
+		*list.addrs = addrs
+	}
+	if minGasPrice, ok := new(big.Int).SetString(v.GetString("miner.policy.mingasprice"), 10); ok {
+		config.MinGasPrice = minGasPrice
+	}
+	if reservedGas, ok := new(big.Int).SetString(v.GetString("miner.policy.reservedgas"), 10); ok {
+		config.ReservedGas = reservedGas
+	}
+	if targetGasLimit, ok := new(big.Int).SetString(v.GetString("miner.policy.targetgaslimit"), 10); ok {
+		config.TargetGasLimit = targetGasLimit
+	}
+	return config, nil
+}
+
+// loadAddressList loads the addresses of key, an invalid one fails the loading.
+func loadAddressList(v *viper.Viper, key string) ([]common.Address, error) {
+	addrs := make([]common.Address, 0)
+	for _, addr := range v.GetStringSlice(key) {
+		if addr == "" {
+			continue
+		}
+		if err := common.AddrCalibrator(addr); err != nil {
+			return nil, fmt.Errorf("%s: invalid address %q: %w", key, addr, err)
+		}
+		addrs = append(addrs, common.StrB58ToAddress(addr))
+	}
+	return addrs, nil
 }
 
 func parseDaemonConfig(configFilePath string) (daemonConfig, error) {
@@ -280,10 +440,17 @@ func parseDaemonConfig(configFilePath string) (daemonConfig, error) {
 		return daemonConfig{}, err
 	}
 	mStorageParams := parseConfigStorageParams(config)
-	mBackendParams := parseConfigBackendParams(config)
+	mBackendParams, err := parseConfigBackendParams(config)
+	if err != nil {
+		return daemonConfig{}, err
+	}
 	mLoggerParams := parseConfigLoggerParams(config)
 	nodeParams := parseConfigNodeParams(config, mBackendParams.ProtocolConfig.NetworkID)
 	nodeParams.NodeDBPath = mStorageParams.nodesDir
+	if err := parseConfigRPCParams(config, nodeParams.RPCConfig); err != nil {
+		return daemonConfig{}, err
+	}
+	nodeParams.RPCConfig.IPCPath = ipcPathOf(config.GetString("rpcserver.ipc"), mStorageParams.dataDir)
 	return daemonConfig{
 		loggerParams:  mLoggerParams,
 		storageParams: mStorageParams,
@@ -305,6 +472,14 @@ func parseClientConfig(configFilePath string) (clientConfig, error) {
 	} else {
 		mRpcClientApiHost = fmt.Sprintf("http://%s", rpchost)
 	}
+	// The socket is preferred unless a host is given.
+	var mRpcClientIPCPath string
+	if rpchost == "" {
+		ipcPath := ipcPathOf(config.GetString("rpclient.ipc"), parseConfigStorageParams(config).dataDir)
+		if ipcPath != "" && xfsgo.IsIPCSocket(ipcPath) {
+			mRpcClientIPCPath = ipcPath
+		}
+	}
 	mRpcClientApiTimeOut := config.GetString("rpclient.timeout")
 	if mRpcClientApiTimeOut == "" {
 		mRpcClientApiTimeOut = defaultCliTimeOut
@@ -320,5 +495,8 @@ func parseClientConfig(configFilePath string) (clientConfig, error) {
 	return clientConfig{
 		rpcClientApiHost:    mRpcClientApiHost,
 		rpcClientApiTimeOut: mRpcClientApiTimeOut,
+		rpcClientApiKey:     config.GetString("rpclient.apikey"),
+		rpcClientJWTSecret:  config.GetString("rpclient.jwtsecret"),
+		rpcClientIPCPath:    mRpcClientIPCPath,
 	}, nil
 }
@@ -0,0 +1,224 @@
+package sub
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"xfsgo/backend"
+	"xfsgo/crypto"
+	"xfsgo/log"
+	"xfsgo/p2p/discover"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	crawlBootstraps []string
+	crawlListen     string
+	crawlRounds     int
+	crawlTimeout    time.Duration
+	crawlWorkers    int
+	crawlOutput     string
+	crawlCommand    = &cobra.Command{
+		Use:                   "crawl [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Map the nodes of the discovery network and the chain they follow",
+		RunE:                  crawlNetwork,
+	}
+)
+
+type crawledNode struct {
+	Id              string   `json:"id"`
+	IP              string   `json:"ip"`
+	TCP             uint16   `json:"tcp"`
+	UDP             uint16   `json:"udp"`
+	LastPong        int64    `json:"last_pong,omitempty"`
+	Client          string   `json:"client,omitempty"`
+	Protocols       []string `json:"protocols,omitempty"`
+	Reachable       bool     `json:"reachable"`
+	P2PVersion      uint8    `json:"p2p_version,omitempty"`
+	ProtocolVersion uint32   `json:"protocol_version,omitempty"`
+	NetworkId       uint32   `json:"network_id,omitempty"`
+	Genesis         string   `json:"genesis,omitempty"`
+	Head            string   `json:"head,omitempty"`
+	Height          uint64   `json:"height,omitempty"`
+	Light           bool     `json:"light,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+type crawlSummary struct {
+	Nodes     int            `json:"nodes"`
+	Reachable int            `json:"reachable"`
+	Versions  map[string]int `json:"versions"`
+	Networks  map[string]int `json:"networks"`
+	MaxHeight uint64         `json:"max_height"`
+}
+
+type crawlResult struct {
+	Started  int64          `json:"started"`
+	Duration float64        `json:"duration"`
+	Summary  *crawlSummary  `json:"summary"`
+	Nodes    []*crawledNode `json:"nodes"`
+}
+
+func crawlNetwork(cmd *cobra.Command, args []string) error {
+	bootstraps := crawlBootstraps
+	if len(bootstraps) == 0 {
+		config, err := parseDaemonConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		bootstraps = config.nodeConfig.P2PBootstraps
+	}
+	nursery := make([]*discover.Node, 0, len(bootstraps))
+	for _, uri := range bootstraps {
+		node, err := discover.ParseNode(uri)
+		if err != nil {
+			return err
+		}
+		nursery = append(nursery, node)
+	}
+	if len(nursery) == 0 {
+		return fmt.Errorf("no bootstrap nodes to crawl from")
+	}
+	dbPath, err := ioutil.TempDir("", "xfsgo-crawl")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dbPath) }()
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	table, err := discover.ListenUDP(key, crawlListen, dbPath, nil, nil, log.DefaultLogger())
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	table.Bootstrap(nursery)
+
+	seen := make(map[discover.NodeId]*discover.Node)
+	for _, n := range nursery {
+		seen[n.ID] = n
+	}
+	for i := 0; i < crawlRounds; i++ {
+		var target discover.NodeId
+		_, _ = rand.Read(target[:])
+		for _, n := range table.Lookup(target) {
+			seen[n.ID] = n
+		}
+	}
+	for _, n := range table.Nodes() {
+		seen[n.ID] = n
+	}
+	nodes := make([]*crawledNode, 0, len(seen))
+	probes := make(chan *discover.Node)
+	results := make(chan *crawledNode)
+	var wg sync.WaitGroup
+	for i := 0; i < crawlWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range probes {
+				results <- probeCrawledNode(key, table, n)
+			}
+		}()
+	}
+	go func() {
+		for _, n := range seen {
+			probes <- n
+		}
+		close(probes)
+		wg.Wait()
+		close(results)
+	}()
+	for item := range results {
+		nodes = append(nodes, item)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+	bs, err := json.MarshalIndent(&crawlResult{
+		Started:  started.Unix(),
+		Duration: time.Since(started).Seconds(),
+		Summary:  summarizeCrawl(nodes),
+		Nodes:    nodes,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if crawlOutput == "" {
+		fmt.Println(string(bs))
+		return nil
+	}
+	return ioutil.WriteFile(crawlOutput, bs, 0644)
+}
+
+func probeCrawledNode(key *ecdsa.PrivateKey, table *discover.Table, n *discover.Node) *crawledNode {
+	item := &crawledNode{
+		Id:  n.ID.String(),
+		IP:  n.IP.String(),
+		TCP: n.TCP,
+		UDP: n.UDP,
+	}
+	if pong := table.LastPong(n.ID); pong.Unix() > 0 {
+		item.LastPong = pong.Unix()
+	}
+	if record := table.Record(n.ID); record != nil {
+		item.Client = record.Client
+		item.Protocols = record.Protocols
+	}
+	status, err := backend.ProbeNode(key, n, crawlTimeout)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.Reachable = true
+	item.P2PVersion = status.P2PVersion
+	item.ProtocolVersion = status.ProtocolVersion
+	item.NetworkId = status.Network
+	item.Genesis = status.Genesis.Hex()
+	item.Head = status.Head.Hex()
+	item.Height = status.Height
+	item.Light = status.Light
+	return item
+}
+
+func summarizeCrawl(nodes []*crawledNode) *crawlSummary {
+	summary := &crawlSummary{
+		Nodes:    len(nodes),
+		Versions: make(map[string]int),
+		Networks: make(map[string]int),
+	}
+	for _, n := range nodes {
+		if !n.Reachable {
+			continue
+		}
+		summary.Reachable++
+		summary.Versions[fmt.Sprintf("%d/%d", n.P2PVersion, n.ProtocolVersion)]++
+		summary.Networks[strconv.FormatUint(uint64(n.NetworkId), 10)]++
+		if n.Height > summary.MaxHeight {
+			summary.MaxHeight = n.Height
+		}
+	}
+	return summary
+}
+
+func init() {
+	netCommand.AddCommand(crawlCommand)
+	mFlags := crawlCommand.Flags()
+	mFlags.StringSliceVarP(&crawlBootstraps, "bootstrap", "", nil, "Set nodes to start the crawl from, the bootstrap nodes of the config by default")
+	mFlags.StringVarP(&crawlListen, "listen", "", "0.0.0.0:0", "Set UDP address of the discovery")
+	mFlags.IntVarP(&crawlRounds, "rounds", "", 30, "Set number of lookups of random targets")
+	mFlags.DurationVarP(&crawlTimeout, "timeout", "", 5*time.Second, "Set time for a node to answer the handshake")
+	mFlags.IntVarP(&crawlWorkers, "workers", "", 16, "Set number of nodes probed at once")
+	mFlags.StringVarP(&crawlOutput, "output", "o", "", "Write the result to the file instead of stdout")
+}
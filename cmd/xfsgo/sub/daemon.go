@@ -21,6 +21,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"xfsgo"
 	"xfsgo/backend"
 	"xfsgo/log"
 	"xfsgo/node"
@@ -40,6 +41,9 @@ var (
 	debug            bool
 	disableBootstrap bool
 	netid            int
+	checkpoints      []string
+	syncmode         string
+	light            bool
 	daemonCmd        = &cobra.Command{
 		Use:                   "daemon [options]",
 		DisableFlagsInUseLine: true,
@@ -59,8 +63,12 @@ func safeclose(fn func() error) {
 
 func resetConfig(config *daemonConfig) {
 	if datadir != "" {
+		defaultIPC := config.nodeConfig.RPCConfig.IPCPath == ipcPathOf("", config.storageParams.dataDir)
 		setupDataDir(&config.storageParams, datadir)
 		config.nodeConfig.NodeDBPath = config.storageParams.nodesDir
+		if defaultIPC {
+			config.nodeConfig.RPCConfig.IPCPath = ipcPathOf("", config.storageParams.dataDir)
+		}
 	}
 	if rpcaddr != "" {
 		config.nodeConfig.RPCConfig.ListenAddr = rpcaddr
@@ -77,6 +85,12 @@ func resetConfig(config *daemonConfig) {
 			config.nodeConfig.P2PBootstraps = defaultBootstrapNodes(defaultTestNetworkId)
 		}
 	}
+	if light {
+		config.backendParams.Light = true
+	}
+	if config.backendParams.Light {
+		setupLightDataDir(&config.storageParams)
+	}
 	if disableBootstrap {
 		config.nodeConfig.P2PBootstraps = make([]string, 0)
 	} else if bootstrap != "" {
@@ -136,6 +150,19 @@ func runDaemon() error {
 	}()
 	backparams := &config.backendParams
 	backparams.Debug = debug
+	for _, s := range checkpoints {
+		cp, err := xfsgo.ParseCheckpoint(s)
+		if err != nil {
+			return err
+		}
+		backparams.Checkpoints = append(backparams.Checkpoints, *cp)
+	}
+	if syncmode != "" {
+		backparams.SyncMode = backend.SyncMode(syncmode)
+	}
+	if backparams.SyncMode, err = backend.ParseSyncMode(string(backparams.SyncMode)); err != nil {
+		return err
+	}
 	if backparams.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 		logrus.Debugf("Set debug mode")
@@ -176,5 +203,8 @@ func init() {
 	mFlags.BoolVarP(&disableBootstrap, "dbootstrap", "", false, "Disable Bootstrap")
 	mFlags.BoolVarP(&debug, "debug", "", false, "Enable debug")
 	mFlags.IntVarP(&netid, "netid", "n", 0, "Explicitly set network id")
+	mFlags.StringSliceVarP(&checkpoints, "checkpoint", "", nil, "Pin the main chain block at a height, as height:hash")
+	mFlags.StringVarP(&syncmode, "syncmode", "", "", "Set blockchain sync mode (full or fast)")
+	mFlags.BoolVarP(&light, "light", "", false, "Run a light node keeping block headers only")
 	rootCmd.AddCommand(daemonCmd)
 }
@@ -0,0 +1,96 @@
+package sub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+	"xfsgo/p2p/dnsdisc"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dnsTreeNodeDB  string
+	dnsTreeKey     string
+	dnsTreeSeq     uint64
+	dnsTreeMaxAge  time.Duration
+	dnsTreeOutput  string
+	dnsTreeCommand = &cobra.Command{
+		Use:                   "dnstree <domain> --key <file> [options]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Build and sign the TXT records of the nodes known to the node database",
+		Args:                  cobra.ExactArgs(1),
+		RunE:                  buildDNSTree,
+	}
+)
+
+type dnsTreeResult struct {
+	URL     string            `json:"url"`
+	Seq     uint64            `json:"seq"`
+	Nodes   int               `json:"nodes"`
+	Records map[string]string `json:"records"`
+}
+
+func buildDNSTree(cmd *cobra.Command, args []string) error {
+	if dnsTreeKey == "" {
+		return errors.New("signing key file is required")
+	}
+	der, err := ioutil.ReadFile(dnsTreeKey)
+	if err != nil {
+		return err
+	}
+	_, key, err := crypto.DecodePrivateKey(der)
+	if err != nil {
+		return fmt.Errorf("decode signing key: %v", err)
+	}
+	nodedb := dnsTreeNodeDB
+	if nodedb == "" {
+		config, err := parseDaemonConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		nodedb = config.storageParams.nodesDir
+	}
+	nodes, err := discover.ReadNodes(nodedb, dnsTreeMaxAge)
+	if err != nil {
+		return fmt.Errorf("read node database: %v", err)
+	}
+	seq := dnsTreeSeq
+	if seq == 0 {
+		seq = uint64(time.Now().Unix())
+	}
+	domain := args[0]
+	tree := dnsdisc.MakeTree(seq, nodes)
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(&dnsTreeResult{
+		URL:     url,
+		Seq:     seq,
+		Nodes:   len(nodes),
+		Records: tree.ToTXT(domain),
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if dnsTreeOutput == "" {
+		fmt.Println(string(bs))
+		return nil
+	}
+	return ioutil.WriteFile(dnsTreeOutput, bs, 0644)
+}
+
+func init() {
+	netCommand.AddCommand(dnsTreeCommand)
+	mFlags := dnsTreeCommand.Flags()
+	mFlags.StringVarP(&dnsTreeNodeDB, "nodedb", "", "", "Set node database directory, the one of the config by default")
+	mFlags.StringVarP(&dnsTreeKey, "key", "k", "", "Set private key file signing the tree")
+	mFlags.Uint64VarP(&dnsTreeSeq, "seq", "", 0, "Set sequence number of the tree, the current unix time by default")
+	mFlags.DurationVarP(&dnsTreeMaxAge, "maxage", "", 24*time.Hour, "Only list nodes seen within this time, all nodes if 0")
+	mFlags.StringVarP(&dnsTreeOutput, "output", "o", "", "Write the records to the file instead of stdout")
+}
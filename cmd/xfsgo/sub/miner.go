@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
-	"xfsgo"
 	"xfsgo/common"
 
 	"github.com/spf13/cobra"
@@ -78,7 +77,7 @@ func runMinerStart(_ *cobra.Command, args []string) error {
 	req := &minerStartArgs{
 		Num: workers,
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	if err = cli.CallMethod(1, "Miner.Start", &req, &res); err != nil {
 		return err
 	}
@@ -92,7 +91,7 @@ func runMinerStop(_ *cobra.Command, _ []string) error {
 		return err
 	}
 	var res *string = nil
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Miner.Stop", nil, &res)
 	if err != nil {
 		return err
@@ -106,7 +105,7 @@ func setWorkers(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var res *string = nil
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	req := &MinerWorkerArgs{
 		Num: args[0],
 	}
@@ -129,7 +128,7 @@ func setGasPrice(cmd *cobra.Command, args []string) error {
 		Value: args[0],
 	}
 	var res *string = nil
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Miner.SetGasPrice", &req, &res)
 	if err != nil {
 		return err
@@ -143,7 +142,7 @@ func getStatus(_ *cobra.Command, _ []string) error {
 		return err
 	}
 	res := make(map[string]interface{})
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Miner.Status", nil, &res)
 	if err != nil {
 		return nil
@@ -2,13 +2,16 @@ package sub
 
 import (
 	"fmt"
-	"xfsgo"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	netCommand = &cobra.Command{
+	peersVerbose bool
+	netCommand   = &cobra.Command{
 		Use:                   "net <command> [options]",
 		DisableFlagsInUseLine: true,
 		Short:                 "Network related operations",
@@ -47,8 +50,11 @@ func getPeers(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if peersVerbose {
+		return getPeersInfo(config)
+	}
 	var res []string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Net.GetPeers", nil, &res)
 	if err != nil {
 		return err
@@ -62,6 +68,60 @@ func getPeers(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func getPeersInfo(config clientConfig) error {
+	res := new(peersInfo)
+	cli := config.newClient()
+	if err := cli.CallMethod(1, "Net.GetPeersInfo", nil, &res); err != nil {
+		return err
+	}
+	if s := res.Slots; s != nil {
+		fmt.Printf("Peers: %d/%d, inbound: %d/%d, outbound: %d (dialed max %d), pending: %d/%d\n",
+			s.Peers, s.MaxPeers, s.Inbound, s.MaxInbound, s.Outbound, s.MaxDialed, s.Pending, s.MaxPending)
+	}
+	if len(res.Peers) == 0 {
+		fmt.Println("Not found peers")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tADDRESS\tDIR\tTYPE\tVERSION\tHEIGHT\tHEAD\tSINCE\tIN\tOUT\tRATE")
+	for _, p := range res.Peers {
+		dir := "out"
+		if p.Inbound {
+			dir = "in"
+		}
+		kind := "-"
+		switch {
+		case p.Static:
+			kind = "static"
+		case p.Dynamic:
+			kind = "dynamic"
+		}
+		var in, out messageTraffic
+		for _, traffic := range p.Traffic {
+			for _, t := range traffic {
+				in.BytesIn += t.BytesIn
+				in.MsgsIn += t.MsgsIn
+				out.BytesOut += t.BytesOut
+				out.MsgsOut += t.MsgsOut
+			}
+		}
+		since := time.Since(time.Unix(p.ConnectedSince, 0)).Truncate(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%d\t%s\t%s\t%dB/%d\t%dB/%d\t%.2f/s\n",
+			shortString(p.Id, 16), p.RemoteAddr, dir, kind, p.P2PVersion, p.ProtocolVersion,
+			p.Height, shortString(p.Head, 10), since,
+			in.BytesIn, in.MsgsIn, out.BytesOut, out.MsgsOut, p.SyncRate)
+	}
+	return w.Flush()
+}
+
+// shortString cuts s to n characters.
+func shortString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
 func addPeer(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		return cmd.Help()
@@ -71,7 +131,7 @@ func addPeer(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var res string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	req := &AddPeerArgs{
 		Url: args[0],
 	}
@@ -91,7 +151,7 @@ func delPeer(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var res string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	req := &delPeerArgs{
 		Id: args[0],
 	}
@@ -108,7 +168,7 @@ func getNodeId(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var res string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Net.GetNodeId", nil, &res)
 	if err != nil {
 		return err
@@ -120,6 +180,7 @@ func getNodeId(cmd *cobra.Command, args []string) error {
 func init() {
 	rootCmd.AddCommand(netCommand)
 	netCommand.AddCommand(getPeersCommand)
+	getPeersCommand.Flags().BoolVarP(&peersVerbose, "verbose", "v", false, "Show the details of peers")
 	netCommand.AddCommand(addPeerCommand)
 	netCommand.AddCommand(delPeerCommand)
 	netCommand.AddCommand(getNodeIdCommand)
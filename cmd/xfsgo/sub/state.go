@@ -18,7 +18,6 @@ package sub
 
 import (
 	"fmt"
-	"xfsgo"
 	"xfsgo/common"
 
 	"github.com/spf13/cobra"
@@ -60,7 +59,7 @@ func GetAccount(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	result := make(map[string]interface{}, 1)
 	req := &getAccountArgs{
 		RootHash: rootHash,
@@ -91,7 +90,7 @@ func GetBalance(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var result string
 	req := &getAccountArgs{
 		RootHash: rootHash,
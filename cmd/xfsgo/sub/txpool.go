@@ -18,7 +18,6 @@ package sub
 
 import (
 	"fmt"
-	"xfsgo"
 	"xfsgo/common"
 
 	"github.com/spf13/cobra"
@@ -98,7 +97,7 @@ func RemoveTx(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var result string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	req := &removeTxArgs{
 		Hash: args[0],
 	}
@@ -116,7 +115,7 @@ func CleanTxPool(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var result string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "TxPool.Clean", nil, &result)
 	if err != nil {
 		return err
@@ -131,7 +130,7 @@ func RemoveQueues(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var result string
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "TxPool.RemoveQueues", nil, &result)
 	if err != nil {
 		return err
@@ -146,7 +145,7 @@ func GetPending(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var txPending interface{}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "TxPool.GetPending", nil, &txPending)
 	if err != nil {
 		return err
@@ -170,7 +169,7 @@ func GetQueue(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	var txQueue interface{}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "TxPool.GetQueue", nil, &txQueue)
 	if err != nil {
 		return err
@@ -193,7 +192,7 @@ func getTxPoolQueueSize(cmd *cobra.Command, args []string) error {
 		fmt.Println(err)
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var txPoolQueueCount int
 	err = cli.CallMethod(1, "TxPool.GetQueueSize", nil, &txPoolQueueCount)
 	if err != nil {
@@ -210,7 +209,7 @@ func getTxPoolPendingSize(cmd *cobra.Command, args []string) error {
 		fmt.Println(err)
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var txPoolPendingCount int
 	err = cli.CallMethod(1, "TxPool.GetPendingSize", nil, &txPoolPendingCount)
 	if err != nil {
@@ -227,7 +226,7 @@ func runTxPoolCount(cmd *cobra.Command, args []string) error {
 		fmt.Println(err)
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var txPoolCount int
 	err = cli.CallMethod(1, "TxPool.GetTxPoolSize", nil, &txPoolCount)
 	if err != nil {
@@ -253,7 +252,7 @@ func GetTransaction(cmd *cobra.Command, args []string) error {
 		Hash: args[0],
 	}
 
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "TxPool.GetTxByHash", &hash, &res)
 	if err != nil {
 		return err
@@ -139,3 +139,42 @@ type minerStartArgs struct {
 // type TransactionsResp []*TransactionResp
 
 // type DataSet []*map[string]interface{}
+
+type messageTraffic struct {
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+	MsgsIn   uint64 `json:"msgs_in"`
+	MsgsOut  uint64 `json:"msgs_out"`
+}
+
+type peerInfo struct {
+	Id              string                               `json:"id"`
+	RemoteAddr      string                               `json:"remote_addr"`
+	Inbound         bool                                 `json:"inbound"`
+	Outbound        bool                                 `json:"outbound"`
+	Static          bool                                 `json:"static"`
+	Dynamic         bool                                 `json:"dynamic"`
+	P2PVersion      uint8                                `json:"p2p_version"`
+	ProtocolVersion uint32                               `json:"protocol_version"`
+	Head            string                               `json:"head"`
+	Height          uint64                               `json:"height"`
+	ConnectedSince  int64                                `json:"connected_since"`
+	Traffic         map[string]map[uint8]*messageTraffic `json:"traffic"`
+	SyncRate        float64                              `json:"sync_rate"`
+}
+
+type peerSlots struct {
+	MaxPeers   int `json:"max_peers"`
+	MaxInbound int `json:"max_inbound"`
+	MaxDialed  int `json:"max_dialed"`
+	MaxPending int `json:"max_pending"`
+	Peers      int `json:"peers"`
+	Inbound    int `json:"inbound"`
+	Outbound   int `json:"outbound"`
+	Pending    int `json:"pending"`
+}
+
+type peersInfo struct {
+	Slots *peerSlots  `json:"slots"`
+	Peers []*peerInfo `json:"peers"`
+}
@@ -18,6 +18,7 @@ package sub
 
 import (
 	"fmt"
+	"math/big"
 	"xfsgo"
 	"xfsgo/common"
 
@@ -104,7 +105,7 @@ func sendTransaction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var result string
 	req := &sendTransactionArgs{
 		To:    args[0],
@@ -117,7 +118,14 @@ func sendTransaction(cmd *cobra.Command, args []string) error {
 	if gasLimit != "" {
 		req.GasLimit = gasLimit
 	}
-	if gasPrice != "" {
+	if gasPrice == "auto" {
+		suggested, err := suggestGasPrice(cli)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		req.GasPrice = suggested
+	} else if gasPrice != "" {
 		req.GasPrice = gasPrice
 	}
 	if nonce != "" {
@@ -132,12 +140,30 @@ func sendTransaction(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// suggestGasPrice asks the node for a gas price and converts it to nano,
+// rounding up so that the price is never below the suggestion.
+func suggestGasPrice(cli *xfsgo.Client) (string, error) {
+	var atto string
+	if err := cli.CallMethod(1, "Chain.SuggestGasPrice", nil, &atto); err != nil {
+		return "", err
+	}
+	price, ok := new(big.Int).SetString(atto, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid suggested gas price: %s", atto)
+	}
+	nano := common.AttoCoin2Nano(price)
+	if common.NanoCoin2Atto(nano).Cmp(price) < 0 {
+		nano.Add(nano, big.NewInt(1))
+	}
+	return nano.Text(10), nil
+}
+
 func walletNew() error {
 	config, err := parseClientConfig(cfgFile)
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var addr *string = nil
 	err = cli.CallMethod(1, "Wallet.Create", nil, &addr)
 	if err != nil {
@@ -157,7 +183,7 @@ func walletDel(cmd *cobra.Command, args []string) error {
 	addrq := &getWalletByAddressArgs{
 		Address: addr,
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var r *interface{} = nil
 	err = cli.CallMethod(1, "Wallet.Del", addrq, &r)
 	if err != nil {
@@ -177,7 +203,7 @@ func runWalletExport(cmd *cobra.Command, args []string) error {
 	addrq := &getWalletByAddressArgs{
 		Address: addr,
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var r *string = nil
 	err = cli.CallMethod(1, "Wallet.ExportByAddress", addrq, &r)
 	if err != nil {
@@ -196,7 +222,7 @@ func runWalletImport(cmd *cobra.Command, args []string) error {
 	importrq := &walletImportArgs{
 		Key: addr,
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var r *string = nil
 	err = cli.CallMethod(1, "Wallet.ImportByPrivateKey", importrq, &r)
 	if err != nil {
@@ -211,7 +237,7 @@ func setWalletAddrDef(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	addr := args[0]
 	req := &setWalletAddrDefArgs{
 		Address: addr,
@@ -230,7 +256,7 @@ func getWalletAddrDef() error {
 	if err != nil {
 		return err
 	}
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	var defStr *string = nil
 	err = cli.CallMethod(1, "Wallet.GetDefaultAddress", nil, &defStr)
 	if err != nil {
@@ -247,7 +273,7 @@ func getWalletList() error {
 	}
 	//Get wallet default address
 	var defAddr common.Address
-	cli := xfsgo.NewClient(config.rpcClientApiHost, config.rpcClientApiTimeOut)
+	cli := config.newClient()
 	err = cli.CallMethod(1, "Wallet.GetDefaultAddress", nil, &defAddr)
 	if err != nil {
 		return err
@@ -304,7 +330,7 @@ func init() {
 	walletCommand.AddCommand(walletTransferCommand)
 	mFlags := walletTransferCommand.PersistentFlags()
 	mFlags.StringVarP(&fromAddr, "address", "a", "", "Set from address")
-	mFlags.StringVarP(&gasPrice, "gasprice", "", "", "Set transaction gas price")
+	mFlags.StringVarP(&gasPrice, "gasprice", "", "", "Set transaction gas price in nano, or 'auto' to use the price suggested by the node")
 	mFlags.StringVarP(&gasLimit, "gaslimit", "", "", "Set transaction gas limit")
 	mFlags.StringVarP(&nonce, "nonce", "", "", "Set transaction nonce")
 	walletCommand.AddCommand(walletSetAddrDefCommand)
@@ -5,7 +5,7 @@ import "math/big"
 var TxGas = big.NewInt(25000)
 var TxGasPrice = big.NewInt(10)
 
-// var GasLimitBoundDivisor = big.NewInt(1024)
+var GasLimitBoundDivisor = big.NewInt(1024)
 var GenesisGasLimit = new(big.Int).Mul(TxGas, Big100)
 var MinGasLimit = TxGas
 
@@ -17,12 +17,16 @@
 package xfsgo
 
 import (
+	"errors"
 	"math/big"
 	"xfsgo/common"
 )
 
 var (
 	big0xff = big.NewInt(0xff)
+
+	errInvalidBits = errors.New("bits must be a non-negative integer")
+	errPowCheck    = errors.New("pow check err")
 )
 
 // BigByZip zips 256 bit difficulty to uint32
@@ -66,12 +70,32 @@ func BitsUnzip(bits uint32) *big.Int {
 	return bn
 }
 
+// CheckProofOfWork checks hash is within the target of bits, and that
+// target is not easier than the one of limitBits. It does not check bits
+// follow the difficulty adjustment of the chain.
+func CheckProofOfWork(hash common.Hash, bits, limitBits uint32) error {
+	target := BitsUnzip(bits)
+	if target.Sign() <= 0 {
+		return errInvalidBits
+	}
+	if target.Cmp(BitsUnzip(limitBits)) > 0 {
+		return errPowCheck
+	}
+	if new(big.Int).SetBytes(hash[:]).Cmp(target) > 0 {
+		return errPowCheck
+	}
+	return nil
+}
+
 func CalcDifficultyByBits(bits uint32) float64 {
 	return float64(GenesisBits) / float64(bits)
 }
 
 func CalcWorkloadByBits(bits uint32) *big.Int {
 	target := BitsUnzip(bits)
+	if target.Sign() <= 0 {
+		return new(big.Int)
+	}
 	max := BitsUnzip(GenesisBits)
 	difficulty := new(big.Int).Div(max, target)
 	n1 := new(big.Int).Mul(difficulty, common.Big256Bits)
@@ -79,11 +103,17 @@ func CalcWorkloadByBits(bits uint32) *big.Int {
 }
 
 func CalcHashRateByBits(bits uint32) common.HashRate {
+	return CalcHashRateByBitsN(bits, targetTimePerBlock)
+}
+
+// CalcHashRateByBitsN calculates the hash rate needed to find a block of bits
+// in targetBlockTime seconds.
+func CalcHashRateByBitsN(bits uint32, targetBlockTime int64) common.HashRate {
 	df := CalcDifficultyByBits(bits)
 	difficulty := new(big.Int).SetInt64(int64(df))
 	n1 := new(big.Int).Mul(difficulty, common.Big256Bits)
 	workload := new(big.Int).Div(n1, BitsUnzip(GenesisBits))
 	workload64 := workload.Uint64()
-	rateN := float64(workload64) / float64(targetTimePerBlock)
+	rateN := float64(workload64) / float64(targetBlockTime)
 	return common.HashRate(rateN)
 }
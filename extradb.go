@@ -249,6 +249,15 @@ func (db *extraDB) WriteBlockTransactionsWithTxIndex(bHash common.Hash, height u
 	return nil
 }
 
+// WriteTxIndex writes the position of the transaction of txHash to extra db
+func (db *extraDB) WriteTxIndex(txHash common.Hash, index *TxIndex) error {
+	indexData, err := rawencode.Encode(index)
+	if err != nil {
+		return err
+	}
+	return db.storage.SetData(append(txIndexPre, txHash[:]...), indexData)
+}
+
 // WriteBlockTransactions write transactions linked tx hash to extra db
 func (db *extraDB) WriteBlockTransactionWithTxHash(transactions []*Transaction) error {
 	for _, tx := range transactions {
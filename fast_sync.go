@@ -0,0 +1,144 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"xfsgo/avlmerkle"
+	"xfsgo/common"
+	"xfsgo/common/rawencode"
+)
+
+var (
+	ErrUnknownPivot = errors.New("unknown fast sync pivot block")
+	ErrMissingState = errors.New("state of block not available")
+)
+
+// StateSyncProgress describes the download of the state at the pivot
+// block of a fast sync.
+type StateSyncProgress struct {
+	Pivot        uint64
+	PivotHash    common.Hash
+	NodesDone    uint64
+	NodesPending uint64
+}
+
+// InsertFastBlock stores a block below the pivot of a fast sync. Its header
+// and transactions are validated but not executed, so the block has no
+// receipts nor state. The head of the chain does not move until the pivot
+// is committed by CommitFastSync.
+func (bc *BlockChain) InsertFastBlock(block *Block) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	hash := block.HeaderHash()
+	if bc.chainDB.GetBlockHeaderByHash(hash) != nil {
+		return ErrBlockIgnored
+	}
+	if bc.badBlocks.has(hash) {
+		return ErrBadBlock
+	}
+	parent := bc.chainDB.GetBlockHeaderByHash(block.HashPrevBlock())
+	if parent == nil {
+		return ErrOrphansBlock
+	}
+	if err := bc.validator.ValidateHeader(parent, block.Header); err != nil {
+		return bc.reportBadBlock(block, err)
+	}
+	if err := bc.validator.ValidateBody(block); err != nil {
+		return bc.reportBadBlock(block, err)
+	}
+	work := new(big.Int).Add(bc.GetTotalWork(parent.HeaderHash()), CalcWorkloadByBits(block.Bits()))
+	if err := bc.chainDB.WriteTotalWork(hash, work); err != nil {
+		return err
+	}
+	if err := bc.WriteTransactions2ExtraDB(hash, block.Height(), block.Transactions); err != nil {
+		return err
+	}
+	return bc.WriteBHeader2ChainDBWithHash(block.Header)
+}
+
+// CommitFastSync makes the pivot block of hash the head of the chain once
+// its state is downloaded, the blocks stored by InsertFastBlock below it
+// become the main chain. The root of the state is stored by the download
+// only once the storage trees of the accounts are complete.
+func (bc *BlockChain) CommitFastSync(hash common.Hash) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	pivot := bc.chainDB.GetBlockHeaderByHash(hash)
+	if pivot == nil {
+		return ErrUnknownPivot
+	}
+	if _, err := NewStateTreeN(bc.stateDB, pivot.StateRoot.Bytes()); err != nil {
+		return fmt.Errorf("%w: height=%d, root=%x", ErrMissingState, pivot.Height, pivot.StateRoot)
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.setHead(pivot); err != nil {
+		return err
+	}
+	block := &Block{Header: pivot, Transactions: bc.extraDB.GetBlockTransactionsByBHash(hash)}
+	bc.eventBus.Publish(ChainHeadEvent{block})
+	return nil
+}
+
+// GetStateNodeData returns the encoded state tree node of hash, or nil if
+// it is not stored.
+func (bc *BlockChain) GetStateNodeData(hash common.Hash) []byte {
+	data, err := avlmerkle.ReadNodeData(bc.stateDB, hash[:])
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// NewStateSync starts the download of the state tree of root, along with
+// the storage trees of its accounts.
+func (bc *BlockChain) NewStateSync(root common.Hash) *avlmerkle.TreeSync {
+	return avlmerkle.NewTreeSync(bc.stateDB, root[:], stateObjStorageRoot)
+}
+
+// stateObjStorageRoot returns the root of the storage tree of the account
+// encoded in value, if any.
+func stateObjStorageRoot(value []byte) [][]byte {
+	obj := &StateObj{}
+	if err := rawencode.Decode(value, obj); err != nil {
+		return nil
+	}
+	return [][]byte{obj.stateRoot.Bytes()}
+}
+
+// SetStateSyncProgress records the progress of the state download of a
+// fast sync.
+func (bc *BlockChain) SetStateSyncProgress(progress *StateSyncProgress) {
+	bc.syncStatsLock.Lock()
+	defer bc.syncStatsLock.Unlock()
+	bc.stateSync = progress
+}
+
+// StateSyncProgress returns the progress of the state download of a fast
+// sync, or nil if none was run.
+func (bc *BlockChain) StateSyncProgress() *StateSyncProgress {
+	bc.syncStatsLock.RLock()
+	defer bc.syncStatsLock.RUnlock()
+	if bc.stateSync == nil {
+		return nil
+	}
+	progress := *bc.stateSync
+	return &progress
+}
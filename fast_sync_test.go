@@ -0,0 +1,74 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/test"
+)
+
+func TestBlockChain_FastSync(t *testing.T) {
+	stateDb := test.NewMemStorage()
+	chainDb := test.NewMemStorage()
+	genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 2147483680, "timestamp": "1000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChainN(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey)
+	mine := func(parent *Block, stateRoot common.Hash) *Block {
+		header := &BlockHeader{
+			Height:           parent.Height() + 1,
+			HashPrevBlock:    parent.HeaderHash(),
+			Timestamp:        parent.Header.Timestamp + 60,
+			Coinbase:         coinbase,
+			StateRoot:        stateRoot,
+			TransactionsRoot: CalcTxsRootHash(nil),
+			GasLimit:         new(big.Int),
+			GasUsed:          new(big.Int),
+			Bits:             genesis.Bits(),
+		}
+		for CheckProofOfWork(header.HeaderHash(), header.Bits, header.Bits) != nil {
+			header.Nonce++
+		}
+		return NewBlock(header, nil, nil)
+	}
+	blocks := []*Block{genesis}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, mine(blocks[len(blocks)-1], genesis.Header.StateRoot))
+	}
+	// The state of the last block is never downloaded.
+	blocks = append(blocks, mine(blocks[len(blocks)-1], common.Hash{1}))
+
+	if err = bc.InsertFastBlock(blocks[2]); err != ErrOrphansBlock {
+		t.Fatalf("want err %v, got %v", ErrOrphansBlock, err)
+	}
+	for _, block := range blocks[1:] {
+		if err = bc.InsertFastBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bc.CurrentBHeader().Height != 0 {
+		t.Fatalf("want head unchanged, got height %d", bc.CurrentBHeader().Height)
+	}
+	if err = bc.CommitFastSync(blocks[4].HeaderHash()); !errors.Is(err, ErrMissingState) {
+		t.Fatalf("want err %v, got %v", ErrMissingState, err)
+	}
+	if err = bc.CommitFastSync(blocks[3].HeaderHash()); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.CurrentBHeader().HeaderHash(); got != blocks[3].HeaderHash() {
+		t.Fatalf("want head %x, got %x", blocks[3].HeaderHash(), got)
+	}
+	for _, block := range blocks[:4] {
+		if got := bc.GetBlockByNumber(block.Height()); got == nil || got.HeaderHash() != block.HeaderHash() {
+			t.Fatalf("block %d not on the main chain", block.Height())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"xfsgo/common"
+)
+
+const (
+	defaultOracleBlocks     = 20
+	defaultOraclePercentile = 60
+)
+
+type GasPriceOracleConfig struct {
+	Blocks     int      // Number of recent blocks to sample transaction gas prices from
+	Percentile int      // Percentile of the sampled gas prices to suggest
+	MaxPrice   *big.Int // Upper bound of a suggested price, no bound if nil
+}
+
+func defaultGasPriceOracleConfig() *GasPriceOracleConfig {
+	return &GasPriceOracleConfig{
+		Blocks:     defaultOracleBlocks,
+		Percentile: defaultOraclePercentile,
+	}
+}
+
+// GasPriceOracle recommends gas prices based on the gas prices of the
+// transactions included in the most recent blocks and the pressure
+// of the transaction pool.
+type GasPriceOracle struct {
+	config    *GasPriceOracleConfig
+	chain     *BlockChain
+	pool      *TxPool
+	mu        sync.Mutex
+	lastHead  common.Hash
+	lastPrice *big.Int
+}
+
+// NewGasPriceOracle creates a gas price oracle, default config is used if config is nil.
+func NewGasPriceOracle(config *GasPriceOracleConfig, chain *BlockChain, pool *TxPool) *GasPriceOracle {
+	if config == nil {
+		config = defaultGasPriceOracleConfig()
+	}
+	if config.Blocks <= 0 {
+		config.Blocks = defaultOracleBlocks
+	}
+	if config.Percentile < 0 || config.Percentile > 100 {
+		config.Percentile = defaultOraclePercentile
+	}
+	return &GasPriceOracle{
+		config: config,
+		chain:  chain,
+		pool:   pool,
+	}
+}
+
+// SuggestPrice returns a gas price (in atto) that is expected to get a transaction
+// included in the next few blocks. The result is never lower than the minimum
+// gas price accepted by the transaction pool.
+func (o *GasPriceOracle) SuggestPrice() *big.Int {
+	head := o.chain.CurrentBHeader()
+	headHash := head.HeaderHash()
+	o.mu.Lock()
+	if o.lastPrice != nil && headHash == o.lastHead {
+		price := o.lastPrice
+		o.mu.Unlock()
+		return o.withPoolPressure(head, price)
+	}
+	o.mu.Unlock()
+
+	prices := make([]*big.Int, 0)
+	hash := headHash
+	for i := 0; i < o.config.Blocks; i++ {
+		block := o.chain.GetBlockByHashWithoutRec(hash)
+		if block == nil {
+			break
+		}
+		for _, tx := range block.Transactions {
+			prices = append(prices, tx.GasPrice)
+		}
+		if block.Height() == 0 {
+			break
+		}
+		hash = block.HashPrevBlock()
+	}
+	price := percentilePrice(prices, o.config.Percentile)
+	if price == nil {
+		price = new(big.Int)
+	}
+	o.mu.Lock()
+	o.lastHead = headHash
+	o.lastPrice = price
+	o.mu.Unlock()
+	return o.withPoolPressure(head, price)
+}
+
+// withPoolPressure raises price to the clearing price of the pending transactions
+// when there are more of them than fit in a block, and applies the bounds.
+func (o *GasPriceOracle) withPoolPressure(head *BlockHeader, price *big.Int) *big.Int {
+	result := new(big.Int).Set(price)
+	if o.pool != nil {
+		if clearing := clearingPrice(o.pool.GetPendingTxs(), head.GasLimit); clearing != nil {
+			result = common.BigMax(result, clearing)
+		}
+		result = common.BigMax(result, o.pool.GetGasPrice())
+	}
+	if o.config.MaxPrice != nil {
+		result = common.BigMin(result, o.config.MaxPrice)
+	}
+	return result
+}
+
+// percentilePrice returns the price at the given percentile of prices,
+// or nil if there are no prices.
+func percentilePrice(prices []*big.Int, percentile int) *big.Int {
+	if len(prices) == 0 {
+		return nil
+	}
+	sorted := make([]*big.Int, len(prices))
+	copy(sorted, prices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) < 0
+	})
+	index := (len(sorted) - 1) * percentile / 100
+	return new(big.Int).Set(sorted[index])
+}
+
+// clearingPrice returns the gas price of the cheapest transaction that still fits
+// in a block of gasLimit when txs are packed from the highest price down.
+// It returns nil if all txs fit in the block.
+func clearingPrice(txs []*Transaction, gasLimit *big.Int) *big.Int {
+	if gasLimit == nil || len(txs) == 0 {
+		return nil
+	}
+	sorted := make([]*Transaction, len(txs))
+	copy(sorted, txs)
+	sort.Sort(TxByPrice(sorted))
+	total := new(big.Int)
+	for i, tx := range sorted {
+		total.Add(total, tx.GasLimit)
+		if total.Cmp(gasLimit) > 0 {
+			if i == 0 {
+				return new(big.Int).Set(tx.GasPrice)
+			}
+			return new(big.Int).Set(sorted[i-1].GasPrice)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package xfsgo
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPercentilePrice(t *testing.T) {
+	if got := percentilePrice(nil, 50); got != nil {
+		t.Fatalf("want nil for empty prices, got %s", got)
+	}
+	prices := []*big.Int{
+		big.NewInt(50), big.NewInt(10), big.NewInt(40), big.NewInt(20), big.NewInt(30),
+	}
+	tests := []struct {
+		percentile int
+		want       int64
+	}{
+		{0, 10},
+		{50, 30},
+		{60, 30},
+		{100, 50},
+	}
+	for _, tt := range tests {
+		if got := percentilePrice(prices, tt.percentile); got.Int64() != tt.want {
+			t.Errorf("percentile %d: want %d, got %s", tt.percentile, tt.want, got)
+		}
+	}
+	if prices[0].Int64() != 50 {
+		t.Fatalf("input prices should not be reordered")
+	}
+}
+
+func TestClearingPrice(t *testing.T) {
+	newTx := func(price int64) *Transaction {
+		return NewTransactionByStd(&StdTransaction{
+			GasPrice: big.NewInt(price),
+			GasLimit: big.NewInt(100),
+			Value:    new(big.Int),
+		})
+	}
+	txs := []*Transaction{newTx(1), newTx(5), newTx(3), newTx(4)}
+	if got := clearingPrice(txs, big.NewInt(400)); got != nil {
+		t.Fatalf("want nil when all txs fit, got %s", got)
+	}
+	if got := clearingPrice(txs, big.NewInt(250)); got == nil || got.Int64() != 4 {
+		t.Fatalf("want clearing price 4, got %v", got)
+	}
+	if got := clearingPrice(txs, big.NewInt(50)); got == nil || got.Int64() != 5 {
+		t.Fatalf("want clearing price 5, got %v", got)
+	}
+}
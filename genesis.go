@@ -35,6 +35,12 @@ var (
 	GenesisBits        = MainNetGenesisBits
 )
 
+// The hashes of the genesis blocks of the public networks.
+var (
+	MainNetGenesisHash = common.Hex2Hash("95e33e9f3c869510a6d58a7c50a8bc3681d74bd369ea9fde526a23a6d0321ed8")
+	TestNetGenesisHash = common.Hex2Hash("4af4ce2938a113f8e704151951f14611630718e0871bcc8843b2b40dc1b289db")
+)
+
 // WriteGenesisBlock constructs the genesis block for the blockchain and stores it in the hd.
 func WriteGenesisBlock(stateDB, chainDB badger.IStorage, reader io.Reader) (*Block, error) {
 	return WriteGenesisBlockN(stateDB, chainDB, reader, false)
@@ -57,10 +63,18 @@ func WriteGenesisBlockN(stateDB, chainDB badger.IStorage, reader io.Reader, debu
 		Accounts      map[string]struct {
 			Balance string `json:"balance"`
 		} `json:"accounts"`
+		Config *ChainConfig `json:"config"`
 	}
 	if err = json.Unmarshal(contents, &genesis); err != nil {
 		return nil, err
 	}
+	config := defaultChainConfigByBits(genesis.Bits)
+	if genesis.Config != nil {
+		config = genesis.Config.withDefaults(config)
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
 	chaindb := newChainDBN(chainDB, debug)
 	stateTree := NewStateTree(stateDB, nil)
 	//logrus.Debugf("initialize genesis account count: %d", len(genesis.Accounts))
@@ -86,13 +100,18 @@ func WriteGenesisBlockN(stateDB, chainDB badger.IStorage, reader io.Reader, debu
 		Timestamp:     timestamp.Uint64(),
 		Coinbase:      coinbase,
 		GasUsed:       new(big.Int),
-		GasLimit:      common.GenesisGasLimit,
+		GasLimit:      config.GenesisGasLimit,
 		Bits:          genesis.Bits,
 		StateRoot:     rootHash,
 	}, nil, nil)
 	if old := chaindb.GetBlockHeaderByHash(block.HeaderHash()); old != nil {
 		logrus.WithField("hash", old.HashHex()).Infof("Genesis Block")
 		oldGeneisBlock := &Block{Header: old, Transactions: nil, Receipts: nil}
+		if chaindb.GetChainConfig(old.HeaderHash()) == nil {
+			if err = chaindb.WriteChainConfig(old.HeaderHash(), config); err != nil {
+				return nil, err
+			}
+		}
 		return oldGeneisBlock, nil
 	}
 	logrus.WithField("hash", block.HashHex()).Infof("Write genesis block")
@@ -106,6 +125,9 @@ func WriteGenesisBlockN(stateDB, chainDB badger.IStorage, reader io.Reader, debu
 	if err = chaindb.WriteBHeader2Chain(block.Header); err != nil {
 		return nil, err
 	}
+	if err = chaindb.WriteChainConfig(block.HeaderHash(), config); err != nil {
+		return nil, err
+	}
 	return block, nil
 }
 
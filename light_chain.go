@@ -0,0 +1,252 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"xfsgo/avlmerkle"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/common/rawencode"
+	"xfsgo/storage/badger"
+)
+
+var (
+	ErrNoLightBackend    = errors.New("no light backend")
+	ErrInvalidLightProof = errors.New("invalid light proof")
+)
+
+// LightBackend retrieves from full peers the data a light chain does not
+// keep. The data returned is verified by the chain.
+type LightBackend interface {
+	// GetAccountProof returns the proof of the account of addr in the
+	// state tree of root.
+	GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error)
+	// GetReceiptProof returns the receipt of the transaction of txHash
+	// with its proof in the receipts tree of the block of the transaction.
+	GetReceiptProof(txHash common.Hash) (*ReceiptProof, error)
+}
+
+// ReceiptProof is the encoded receipt of a transaction, with the proof of
+// it in the receipts tree of the main chain block the transaction is in.
+type ReceiptProof struct {
+	Index   *TxIndex `json:"index"`
+	Receipt []byte   `json:"receipt"`
+	Proof   [][]byte `json:"proof"`
+}
+
+// NewLightChain returns a chain keeping the block headers only. The state
+// and the receipts are retrieved on demand through the light backend and
+// verified against the roots of the headers.
+func NewLightChain(stateDB, chainDB, extraDB, logDB badger.IStorage, eventBus *EventBus, debug bool) (*BlockChain, error) {
+	return newBlockChain(stateDB, chainDB, extraDB, logDB, eventBus, debug, true)
+}
+
+// IsLight reports whether the chain keeps the block headers only.
+func (bc *BlockChain) IsLight() bool {
+	return bc.light
+}
+
+// SetLightBackend sets where a light chain retrieves the data it does not keep.
+func (bc *BlockChain) SetLightBackend(backend LightBackend) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.lightBackend = backend
+}
+
+func (bc *BlockChain) getLightBackend() LightBackend {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.lightBackend
+}
+
+// headStateTree returns the state tree at header. A light chain does not
+// keep the state, its head tree is empty and accounts are read through
+// RetrieveAccount instead.
+func (bc *BlockChain) headStateTree(header *BlockHeader) *StateTree {
+	if bc.light {
+		return NewStateTree(bc.stateDB, nil)
+	}
+	return NewStateTree(bc.stateDB, header.StateRoot.Bytes())
+}
+
+// InsertHeaderChain adds headers to a light chain, each must follow a
+// stored header. The proof of work and the difficulty of the headers are
+// verified, and the head moves to the header with the most work. It returns
+// the number of headers processed before an error.
+func (bc *BlockChain) InsertHeaderChain(headers []*BlockHeader) (int, error) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	for i, header := range headers {
+		if err := bc.insertHeader(header); err != nil && err != ErrBlockIgnored {
+			return i, err
+		}
+	}
+	return len(headers), nil
+}
+
+func (bc *BlockChain) insertHeader(header *BlockHeader) error {
+	hash := header.HeaderHash()
+	if bc.chainDB.GetBlockHeaderByHash(hash) != nil {
+		return ErrBlockIgnored
+	}
+	if bc.badBlocks.has(hash) {
+		return ErrBadBlock
+	}
+	parent := bc.chainDB.GetBlockHeaderByHash(header.HashPrevBlock)
+	if parent == nil {
+		return ErrOrphansBlock
+	}
+	if err := bc.validator.ValidateHeader(parent, header); err != nil {
+		return bc.reportBadBlock(&Block{Header: header}, err)
+	}
+	work := new(big.Int).Add(bc.GetTotalWork(parent.HeaderHash()), CalcWorkloadByBits(header.Bits))
+	if err := bc.chainDB.WriteTotalWork(hash, work); err != nil {
+		return err
+	}
+	if err := bc.WriteBHeader2ChainDBWithHash(header); err != nil {
+		return err
+	}
+	bc.mu.Lock()
+	if work.Cmp(bc.GetTotalWork(bc.currentBHeader.HeaderHash())) <= 0 {
+		bc.mu.Unlock()
+		return nil
+	}
+	if err := bc.setHead(header); err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+	bc.mu.Unlock()
+	bc.eventBus.Publish(ChainHeadEvent{&Block{Header: header}})
+	return nil
+}
+
+// RetrieveAccount makes the account of addr in the state tree of root
+// readable from the state db. A light chain fetches the account with its
+// proof from the light backend unless it is stored already, a full chain
+// has it.
+func (bc *BlockChain) RetrieveAccount(root common.Hash, addr common.Address) error {
+	if !bc.light {
+		return nil
+	}
+	key := ahash.SHA256(addr.Bytes())
+	if tree, err := avlmerkle.NewTreeN(bc.stateDB, root[:]); err == nil {
+		if _, err = tree.Prove(key); err == nil {
+			return nil
+		}
+	}
+	backend := bc.getLightBackend()
+	if backend == nil {
+		return ErrNoLightBackend
+	}
+	proof, err := backend.GetAccountProof(root, addr)
+	if err != nil {
+		return err
+	}
+	if _, _, err = avlmerkle.VerifyProof(root[:], key, proof); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidLightProof, err)
+	}
+	return avlmerkle.WriteProof(bc.stateDB, proof)
+}
+
+// retrieveReceipt fetches the receipt of the transaction of txHash from the
+// light backend, and stores it once verified against the receipts root of
+// its main chain block.
+func (bc *BlockChain) retrieveReceipt(txHash common.Hash) (*Receipt, error) {
+	backend := bc.getLightBackend()
+	if backend == nil {
+		return nil, ErrNoLightBackend
+	}
+	rp, err := backend.GetReceiptProof(txHash)
+	if err != nil {
+		return nil, err
+	}
+	if rp == nil || rp.Index == nil {
+		return nil, fmt.Errorf("%w: no receipt index", ErrInvalidLightProof)
+	}
+	header := bc.chainDB.GetBlockHeaderByHeight(rp.Index.BlockIndex)
+	if header == nil || header.HeaderHash() != rp.Index.BlockHash {
+		return nil, fmt.Errorf("%w: block %x not on the main chain", ErrInvalidLightProof, rp.Index.BlockHash)
+	}
+	value, exists, err := avlmerkle.VerifyProof(header.ReceiptsRoot[:], ahash.SHA256(rp.Receipt), rp.Proof)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLightProof, err)
+	}
+	if !exists || !bytes.Equal(value, rp.Receipt) {
+		return nil, fmt.Errorf("%w: receipt not in block %x", ErrInvalidLightProof, rp.Index.BlockHash)
+	}
+	receipt := &Receipt{}
+	if err = rawencode.Decode(rp.Receipt, receipt); err != nil {
+		return nil, err
+	}
+	if receipt.TxHash != txHash {
+		return nil, fmt.Errorf("%w: receipt of %x", ErrInvalidLightProof, receipt.TxHash)
+	}
+	if err = bc.extraDB.WriteReceiptsWithRecHash([]*Receipt{receipt}); err != nil {
+		return nil, err
+	}
+	if err = bc.extraDB.WriteTxIndex(txHash, rp.Index); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetReceiptProof returns the receipt of the transaction of txHash with its
+// proof in the receipts tree of its block, for a light peer to verify.
+func (bc *BlockChain) GetReceiptProof(txHash common.Hash) (*ReceiptProof, error) {
+	index := bc.extraDB.GetReceiptByHashIndex(txHash)
+	if index == nil {
+		return nil, fmt.Errorf("unknown transaction %x", txHash)
+	}
+	tree := avlmerkle.NewTree(nil, nil)
+	var receipt []byte
+	for _, rec := range bc.extraDB.GetBlockReceiptsByBHash(index.BlockHash) {
+		data, err := rawencode.Encode(rec)
+		if err != nil {
+			return nil, err
+		}
+		if rec.TxHash == txHash {
+			receipt = data
+		}
+		tree.Put(ahash.SHA256(data), data)
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("no receipt of transaction %x", txHash)
+	}
+	proof, err := tree.Prove(ahash.SHA256(receipt))
+	if err != nil {
+		return nil, err
+	}
+	return &ReceiptProof{
+		Index:   index,
+		Receipt: receipt,
+		Proof:   proof,
+	}, nil
+}
+
+// GetAccountProof returns the proof of the account of addr in the state
+// tree of root, for a light peer to verify.
+func (bc *BlockChain) GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error) {
+	tree, err := avlmerkle.NewTreeN(bc.stateDB, root[:])
+	if err != nil {
+		return nil, err
+	}
+	return tree.Prove(ahash.SHA256(addr.Bytes()))
+}
@@ -0,0 +1,157 @@
+package xfsgo
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"xfsgo/avlmerkle"
+	"xfsgo/common"
+	"xfsgo/common/ahash"
+	"xfsgo/common/rawencode"
+	"xfsgo/crypto"
+	"xfsgo/test"
+)
+
+type testLightBackend struct {
+	chain  *BlockChain
+	forged bool
+}
+
+func (b *testLightBackend) GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error) {
+	return b.chain.GetAccountProof(root, addr)
+}
+
+func (b *testLightBackend) GetReceiptProof(txHash common.Hash) (*ReceiptProof, error) {
+	rp, err := b.chain.GetReceiptProof(txHash)
+	if err != nil || !b.forged {
+		return rp, err
+	}
+	receipt := &Receipt{}
+	if err = rawencode.Decode(rp.Receipt, receipt); err != nil {
+		return nil, err
+	}
+	receipt.Status = 1
+	rp.Receipt, err = rawencode.Encode(receipt)
+	return rp, err
+}
+
+func TestBlockChain_Light(t *testing.T) {
+	addr := crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey)
+	newChain := func(light bool) (*BlockChain, *test.MemStorage, *Block) {
+		stateDb := test.NewMemStorage()
+		chainDb := test.NewMemStorage()
+		genesis, err := WriteGenesisBlock(stateDb, chainDb, strings.NewReader(`{"bits": 2147483680, "timestamp": "1000"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc, err := newBlockChain(stateDb, chainDb, test.NewMemStorage(), test.NewMemStorage(), NewEventBus(), false, light)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bc, stateDb, genesis
+	}
+	full, fullStateDb, genesis := newChain(false)
+	light, lightStateDb, _ := newChain(true)
+	if !light.IsLight() || full.IsLight() {
+		t.Fatalf("unexpected light flags")
+	}
+	// The state of the full chain holds the paths to the accounts only.
+	stateTree := NewStateTree(fullStateDb, nil)
+	for i := int64(1); i <= 10; i++ {
+		stateTree.AddBalance(common.Address{byte(i)}, big.NewInt(i))
+	}
+	stateTree.AddBalance(addr, big.NewInt(1000))
+	stateTree.UpdateAll()
+	for _, a := range []common.Address{addr, {5}} {
+		proof, err := stateTree.merkleTree.Prove(ahash.SHA256(a.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = avlmerkle.WriteProof(fullStateDb, proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coinbase := crypto.DefaultPubKey2Addr(crypto.MustGenPrvKey().PublicKey)
+	mine := func(parent *BlockHeader, receipts []*Receipt) *Block {
+		header := &BlockHeader{
+			Height:           parent.Height + 1,
+			HashPrevBlock:    parent.HeaderHash(),
+			Timestamp:        parent.Timestamp + 60,
+			Coinbase:         coinbase,
+			StateRoot:        common.Bytes2Hash(stateTree.Root()),
+			TransactionsRoot: CalcTxsRootHash(nil),
+			ReceiptsRoot:     CalcReceiptRootHash(receipts),
+			GasLimit:         new(big.Int),
+			GasUsed:          new(big.Int),
+			Bits:             genesis.Bits(),
+		}
+		for CheckProofOfWork(header.HeaderHash(), header.Bits, header.Bits) != nil {
+			header.Nonce++
+		}
+		return NewBlock(header, nil, receipts)
+	}
+	var receipts []*Receipt
+	for i := byte(1); i <= 5; i++ {
+		receipts = append(receipts, &Receipt{TxHash: common.Hash{i}, GasUsed: big.NewInt(int64(i))})
+	}
+	headers := []*BlockHeader{genesis.Header}
+	for i := 0; i < 3; i++ {
+		var recs []*Receipt
+		if i == 1 {
+			recs = receipts
+		}
+		block := mine(headers[len(headers)-1], recs)
+		if err := full.writeBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		for j, rec := range recs {
+			if err := full.extraDB.WriteTxIndex(rec.TxHash, &TxIndex{
+				BlockHash: block.HeaderHash(), BlockIndex: block.Height(), Index: uint64(j),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		headers = append(headers, block.Header)
+	}
+	if _, err := light.InsertHeaderChain(headers[2:]); err != ErrOrphansBlock {
+		t.Fatalf("want err %v, got %v", ErrOrphansBlock, err)
+	}
+	bad := *headers[1]
+	bad.Bits++
+	if _, err := light.InsertHeaderChain([]*BlockHeader{&bad}); !errors.Is(err, ErrInvalidPow) {
+		t.Fatalf("want err %v, got %v", ErrInvalidPow, err)
+	}
+	if n, err := light.InsertHeaderChain(headers[1:]); err != nil || n != 3 {
+		t.Fatalf("want 3 headers inserted, got %d: %v", n, err)
+	}
+	if got := light.CurrentBHeader().HeaderHash(); got != headers[3].HeaderHash() {
+		t.Fatalf("want head %x, got %x", headers[3].HeaderHash(), got)
+	}
+
+	root := light.CurrentBHeader().StateRoot
+	if err := light.RetrieveAccount(root, addr); err != ErrNoLightBackend {
+		t.Fatalf("want err %v, got %v", ErrNoLightBackend, err)
+	}
+	backend := &testLightBackend{chain: full}
+	light.SetLightBackend(backend)
+	if err := light.RetrieveAccount(root, addr); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewStateTree(lightStateDb, root[:]).GetBalance(addr); got.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("want balance 1000, got %s", got)
+	}
+
+	backend.forged = true
+	if got := light.GetReceiptByHash(receipts[2].TxHash); got != nil {
+		t.Fatalf("want forged receipt rejected")
+	}
+	backend.forged = false
+	got := light.GetReceiptByHash(receipts[2].TxHash)
+	if got == nil || got.TxHash != receipts[2].TxHash || got.GasUsed.Cmp(receipts[2].GasUsed) != 0 {
+		t.Fatalf("unexpected receipt: %+v", got)
+	}
+	if index := light.GetReceiptByHashIndex(receipts[2].TxHash); index == nil || index.BlockHash != headers[2].HeaderHash() {
+		t.Fatalf("unexpected receipt index: %+v", index)
+	}
+}
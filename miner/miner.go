@@ -62,6 +62,7 @@ var (
 type Config struct {
 	Coinbase   common.Address
 	Numworkers uint32
+	Policy     Policy
 }
 
 // Miner creates blocks with transactions in tx pool and searches for proof-of-work values.
@@ -96,6 +97,9 @@ type Miner struct {
 func NewMiner(config *Config,
 	logsDB, stateDb badger.IStorage, chain xfsgo.IBlockChain, eventBus *xfsgo.EventBus, pool *xfsgo.TxPool,
 	gasPrice, gasLimit *big.Int) *Miner {
+	if config.Policy == nil {
+		config.Policy, _ = NewPolicy(nil)
+	}
 	m := &Miner{
 		Config:           config,
 		chain:            chain,
@@ -127,6 +131,10 @@ func (m *Miner) GetGasLimit() *big.Int {
 	return m.gasLimit
 }
 
+func (m *Miner) GetPolicy() Policy {
+	return m.Policy
+}
+
 func (m *Miner) GetWorkerNum() uint32 {
 	return m.numWorkers
 }
@@ -282,7 +290,7 @@ func (m *Miner) NextDifficulty() float64 {
 
 func (m *Miner) TargetHashRate() common.HashRate {
 	bits, _ := m.chain.CalcNextRequiredDifficulty()
-	return xfsgo.CalcHashRateByBits(bits)
+	return xfsgo.CalcHashRateByBitsN(bits, m.chain.Config().TargetBlockTime)
 }
 
 func (m *Miner) applyTransactions(
@@ -340,21 +348,27 @@ func (m *Miner) mimeBlockWithParent(
 	}
 	//create a Blockheader which will be the header of the new block.
 	lastGenerated := time.Now().Unix()
+	height := parentBlock.Height + 1
 	header := &xfsgo.BlockHeader{
-		Height:        parentBlock.Height + 1,
+		Version:       m.chain.Config().ProtocolVersion(height),
+		Height:        height,
 		HashPrevBlock: parentBlock.HeaderHash(),
 		Timestamp:     uint64(lastGenerated),
 		Coinbase:      coinbase,
 	}
 	header.GasUsed = new(big.Int)
 
-	header.GasLimit = common.TxPoolGasLimit
+	header.GasLimit = m.Policy.GasLimit(parentBlock)
+	if header.GasLimit == nil {
+		header.GasLimit = new(big.Int).Set(m.chain.Config().BlockGasLimit)
+	}
 	//calculate the next difficuty for hash value of next block.
 	var err error
 	header.Bits, err = m.chain.CalcNextRequiredDifficulty()
 	if err != nil {
 		return nil, err
 	}
+	txs = m.Policy.SelectTransactions(stateTree, filterTxsByVersion(txs, header.Version), header.GasLimit)
 	committx := make([]*xfsgo.Transaction, 0)
 	ignoretxs := make(map[common.Address]struct{})
 	gasused, res, err := m.applyTransactions(
@@ -363,7 +377,7 @@ func (m *Miner) mimeBlockWithParent(
 		return nil, applyTransactionsErr
 	}
 	header.GasUsed = gasused
-	xfsgo.AccumulateRewards(stateTree, header)
+	xfsgo.AccumulateRewards(m.chain.Config(), stateTree, header, committx, res)
 	stateTree.UpdateAll()
 	stateRootBytes := stateTree.Root()
 	stateRootHash := common.Bytes2Hash(stateRootBytes)
@@ -373,6 +387,17 @@ func (m *Miner) mimeBlockWithParent(
 	return m.execPow(parentBlock, perBlock, quit, ticker, fn)
 }
 
+// filterTxsByVersion drops the transactions whose version is not active in a block of version.
+func filterTxsByVersion(txs []*xfsgo.Transaction, version uint32) []*xfsgo.Transaction {
+	result := make([]*xfsgo.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.Version <= version {
+			result = append(result, tx)
+		}
+	}
+	return result
+}
+
 // run the consensus algorithms
 func (m *Miner) execPow(last *xfsgo.BlockHeader, perBlock *xfsgo.Block, quit chan struct{}, ticker *time.Ticker, report reportFn) (*xfsgo.Block, error) {
 	targetDifficulty := xfsgo.BitsUnzip(perBlock.Bits())
@@ -448,9 +473,6 @@ out:
 		default:
 		}
 		txs := m.pool.GetPendingTxs()
-		//js,_ :=  json.Marshal(txs)
-		//logrus.Debugf("txs(un-sort): %s", js)
-		xfsgo.SortByPriceAndNonce(txs)
 		lastBlock := m.chain.CurrentBHeader()
 		lastStateRoot := lastBlock.StateRoot
 		//lastBlockHash := lastBlock.Hash()
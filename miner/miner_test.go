@@ -65,6 +65,6 @@ func createMiner(t *testing.T) *Miner {
 		Numworkers: test.TestMinerWorkers,
 	}
 
-	return NewMiner(config, stateDb, bc, event, txPool, test.TestTxPoolGasPrice, test.TestTxPoolGasLimit)
+	return NewMiner(config, logsDb, stateDb, bc, event, txPool, test.TestTxPoolGasPrice, test.TestTxPoolGasLimit)
 
 }
@@ -0,0 +1,242 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package miner
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"xfsgo"
+	"xfsgo/common"
+)
+
+const DefaultPolicyName = "default"
+
+// NonceReader provides the current account nonces a block template is built on.
+type NonceReader interface {
+	GetNonce(addr common.Address) uint64
+}
+
+// Policy decides the gas limit of a block template and which pending
+// transactions are put into it, in which order.
+type Policy interface {
+	Name() string
+	// GasLimit returns the gas limit of the block built on top of parent,
+	// or nil to use the block gas limit of the chain config.
+	GasLimit(parent *xfsgo.BlockHeader) *big.Int
+	// SelectTransactions picks the transactions of the block template from the pending ones.
+	SelectTransactions(state NonceReader, pending []*xfsgo.Transaction, gasLimit *big.Int) []*xfsgo.Transaction
+	Status() *PolicyStatus
+}
+
+// PolicyConfig contains the rules a policy applies on top of its ordering.
+type PolicyConfig struct {
+	Name               string
+	MinGasPrice        *big.Int         // Transactions priced lower are ignored, local ones excepted
+	BlacklistSenders   []common.Address // Transactions sent by these accounts are ignored
+	BlacklistContracts []common.Address // Transactions sent to these accounts are ignored
+	LocalSenders       []common.Address // Accounts whose transactions are treated as local
+	ReservedGas        *big.Int         // Block space only local transactions may use
+	TargetGasLimit     *big.Int         // Gas limit the blocks move toward, fixed limit if nil
+}
+
+// PolicyStatus describes the policy used by the miner.
+type PolicyStatus struct {
+	Name                 string
+	MinGasPrice          *big.Int
+	BlacklistedSenders   int
+	BlacklistedContracts int
+	LocalSenders         int
+	ReservedGas          *big.Int
+	TargetGasLimit       *big.Int
+}
+
+type PolicyConstructor func(config *PolicyConfig) (Policy, error)
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string]PolicyConstructor{
+		DefaultPolicyName: newFeePolicy,
+	}
+)
+
+// RegisterPolicy makes a policy available by name to NewPolicy.
+func RegisterPolicy(name string, constructor PolicyConstructor) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[name] = constructor
+}
+
+// NewPolicy creates the policy named in config, the default policy is
+// created if config is nil or does not name one.
+func NewPolicy(config *PolicyConfig) (Policy, error) {
+	if config == nil {
+		config = &PolicyConfig{}
+	}
+	name := config.Name
+	if name == "" {
+		name = DefaultPolicyName
+	}
+	policiesMu.RLock()
+	constructor, exists := policies[name]
+	policiesMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown miner policy: %s", name)
+	}
+	return constructor(config)
+}
+
+// feePolicy orders transactions by gas price while keeping the nonces of
+// each sender continuous, and applies the filtering rules of its config.
+type feePolicy struct {
+	config    *PolicyConfig
+	senders   map[common.Address]struct{}
+	contracts map[common.Address]struct{}
+	locals    map[common.Address]struct{}
+}
+
+func toAddressSet(addrs []common.Address) map[common.Address]struct{} {
+	set := make(map[common.Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+	return set
+}
+
+func newFeePolicy(config *PolicyConfig) (Policy, error) {
+	if config.ReservedGas != nil && config.ReservedGas.Sign() < 0 {
+		return nil, fmt.Errorf("reserved gas must not be negative")
+	}
+	if config.TargetGasLimit != nil && config.TargetGasLimit.Cmp(common.MinGasLimit) < 0 {
+		return nil, fmt.Errorf("target gas limit lower than %s", common.MinGasLimit)
+	}
+	return &feePolicy{
+		config:    config,
+		senders:   toAddressSet(config.BlacklistSenders),
+		contracts: toAddressSet(config.BlacklistContracts),
+		locals:    toAddressSet(config.LocalSenders),
+	}, nil
+}
+
+func (p *feePolicy) Name() string {
+	return DefaultPolicyName
+}
+
+// GasLimit moves the gas limit of parent toward the target by at most
+// parent.GasLimit / GasLimitBoundDivisor per block.
+func (p *feePolicy) GasLimit(parent *xfsgo.BlockHeader) *big.Int {
+	target := p.config.TargetGasLimit
+	if target == nil {
+		return nil
+	}
+	if parent.GasLimit == nil || parent.GasLimit.Sign() == 0 {
+		return new(big.Int).Set(target)
+	}
+	step := new(big.Int).Div(parent.GasLimit, common.GasLimitBoundDivisor)
+	if step.Sign() == 0 {
+		step.SetInt64(1)
+	}
+	limit := new(big.Int).Set(parent.GasLimit)
+	switch limit.Cmp(target) {
+	case -1:
+		limit = common.BigMin(limit.Add(limit, step), target)
+	case 1:
+		limit = common.BigMax(limit.Sub(limit, step), target)
+	}
+	return common.BigMax(limit, common.MinGasLimit)
+}
+
+func (p *feePolicy) accept(tx *xfsgo.Transaction, from common.Address, local bool) bool {
+	if _, exists := p.senders[from]; exists {
+		return false
+	}
+	if _, exists := p.contracts[tx.To]; exists && !xfsgo.TxToAddrNotSet(tx) {
+		return false
+	}
+	if !local && p.config.MinGasPrice != nil && tx.GasPrice.Cmp(p.config.MinGasPrice) < 0 {
+		return false
+	}
+	return true
+}
+
+func (p *feePolicy) SelectTransactions(state NonceReader, pending []*xfsgo.Transaction, gasLimit *big.Int) []*xfsgo.Transaction {
+	txs := make([]*xfsgo.Transaction, len(pending))
+	copy(txs, pending)
+	xfsgo.SortByPriceAndNonce(txs)
+
+	remoteLimit := new(big.Int).Set(gasLimit)
+	if p.config.ReservedGas != nil {
+		remoteLimit.Sub(remoteLimit, p.config.ReservedGas)
+	}
+	var (
+		selected = make([]*xfsgo.Transaction, 0, len(txs))
+		nonces   = make(map[common.Address]uint64)
+		skipped  = make(map[common.Address]struct{})
+		used     = new(big.Int)
+	)
+	for _, tx := range txs {
+		from, err := tx.FromAddr()
+		if err != nil {
+			continue
+		}
+		if _, exists := skipped[from]; exists {
+			continue
+		}
+		nonce, exists := nonces[from]
+		if !exists {
+			nonce = state.GetNonce(from)
+		}
+		if tx.Nonce < nonce {
+			continue
+		}
+		// A sender whose transaction is left out can't have the later ones included.
+		if tx.Nonce > nonce {
+			skipped[from] = struct{}{}
+			continue
+		}
+		_, local := p.locals[from]
+		if !p.accept(tx, from, local) {
+			skipped[from] = struct{}{}
+			continue
+		}
+		limit := remoteLimit
+		if local {
+			limit = gasLimit
+		}
+		total := new(big.Int).Add(used, tx.GasLimit)
+		if total.Cmp(limit) > 0 {
+			skipped[from] = struct{}{}
+			continue
+		}
+		used = total
+		nonces[from] = nonce + 1
+		selected = append(selected, tx)
+	}
+	return selected
+}
+
+func (p *feePolicy) Status() *PolicyStatus {
+	return &PolicyStatus{
+		Name:                 p.Name(),
+		MinGasPrice:          p.config.MinGasPrice,
+		BlacklistedSenders:   len(p.senders),
+		BlacklistedContracts: len(p.contracts),
+		LocalSenders:         len(p.locals),
+		ReservedGas:          p.config.ReservedGas,
+		TargetGasLimit:       p.config.TargetGasLimit,
+	}
+}
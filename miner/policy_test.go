@@ -0,0 +1,122 @@
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"xfsgo"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+type testNonces map[common.Address]uint64
+
+func (n testNonces) GetNonce(addr common.Address) uint64 {
+	return n[addr]
+}
+
+func policyTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, price int64, to common.Address) *xfsgo.Transaction {
+	t.Helper()
+	return xfsgo.NewTransactionByStdAndSign(&xfsgo.StdTransaction{
+		To:       to,
+		GasPrice: big.NewInt(price),
+		GasLimit: new(big.Int).Set(common.TxGas),
+		Value:    big.NewInt(1),
+		Nonce:    nonce,
+	}, key)
+}
+
+func genKey(t *testing.T) (*ecdsa.PrivateKey, common.Address) {
+	t.Helper()
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, crypto.DefaultPubKey2Addr(key.PublicKey)
+}
+
+func TestFeePolicy_SelectTransactions(t *testing.T) {
+	keyA, addrA := genKey(t)
+	keyB, addrB := genKey(t)
+	keyC, _ := genKey(t)
+	to := common.Bytes2Address([]byte{1})
+	contract := common.Bytes2Address([]byte{2})
+	policy, err := NewPolicy(&PolicyConfig{
+		MinGasPrice:        big.NewInt(5),
+		BlacklistContracts: []common.Address{contract},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonces := testNonces{addrA: 1}
+	pending := []*xfsgo.Transaction{
+		policyTx(t, keyA, 0, 50, to), // stale nonce
+		policyTx(t, keyA, 1, 10, to),
+		policyTx(t, keyA, 2, 30, to),
+		policyTx(t, keyB, 0, 20, to),
+		policyTx(t, keyB, 1, 1, to),   // below min gas price
+		policyTx(t, keyB, 2, 100, to), // follows a left out transaction
+		policyTx(t, keyC, 0, 40, contract),
+	}
+	got := policy.SelectTransactions(nonces, pending, common.TxPoolGasLimit)
+	want := []struct {
+		from  common.Address
+		nonce uint64
+	}{{addrB, 0}, {addrA, 1}, {addrA, 2}}
+	if len(got) != len(want) {
+		t.Fatalf("want %d txs, got %d", len(want), len(got))
+	}
+	for i, tx := range got {
+		from, _ := tx.FromAddr()
+		if from != want[i].from || tx.Nonce != want[i].nonce {
+			t.Fatalf("tx %d: want %x/%d, got %x/%d", i, want[i].from, want[i].nonce, from, tx.Nonce)
+		}
+	}
+}
+
+func TestFeePolicy_ReservedGas(t *testing.T) {
+	keyLocal, addrLocal := genKey(t)
+	keyRemote, _ := genKey(t)
+	to := common.Bytes2Address([]byte{1})
+	policy, err := NewPolicy(&PolicyConfig{
+		LocalSenders: []common.Address{addrLocal},
+		ReservedGas:  new(big.Int).Set(common.TxGas),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasLimit := new(big.Int).Mul(common.TxGas, big.NewInt(2))
+	pending := []*xfsgo.Transaction{
+		policyTx(t, keyRemote, 0, 100, to),
+		policyTx(t, keyRemote, 1, 100, to),
+		policyTx(t, keyLocal, 0, 1, to),
+	}
+	got := policy.SelectTransactions(testNonces{}, pending, gasLimit)
+	if len(got) != 2 {
+		t.Fatalf("want 2 txs, got %d", len(got))
+	}
+	if from, _ := got[1].FromAddr(); from != addrLocal {
+		t.Fatalf("reserved space should go to the local transaction")
+	}
+}
+
+func TestFeePolicy_GasLimit(t *testing.T) {
+	target := new(big.Int).Mul(common.TxPoolGasLimit, big.NewInt(2))
+	policy, err := NewPolicy(&PolicyConfig{TargetGasLimit: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := &xfsgo.BlockHeader{GasLimit: common.TxPoolGasLimit}
+	step := new(big.Int).Div(common.TxPoolGasLimit, common.GasLimitBoundDivisor)
+	want := new(big.Int).Add(common.TxPoolGasLimit, step)
+	if got := policy.GasLimit(parent); got.Cmp(want) != 0 {
+		t.Fatalf("want gas limit %s, got %s", want, got)
+	}
+	parent.GasLimit = new(big.Int).Sub(target, big.NewInt(1))
+	if got := policy.GasLimit(parent); got.Cmp(target) != 0 {
+		t.Fatalf("want gas limit %s, got %s", target, got)
+	}
+	if _, err = NewPolicy(&PolicyConfig{Name: "unknown"}); err == nil {
+		t.Fatalf("want error for unknown policy")
+	}
+}
@@ -18,11 +18,14 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"time"
 	"xfsgo"
 	"xfsgo/api"
 	"xfsgo/common"
@@ -31,7 +34,9 @@ import (
 	"xfsgo/miner"
 	"xfsgo/p2p"
 	"xfsgo/p2p/discover"
+	"xfsgo/p2p/dnsdisc"
 	"xfsgo/p2p/nat"
+	"xfsgo/p2p/netutil"
 	"xfsgo/storage/badger"
 	"xfsgo/vm"
 )
@@ -49,12 +54,31 @@ type Config struct {
 	ProtocolVersion  uint8
 	P2PBootstraps    []string
 	P2PStaticNodes   []string
+	P2PCompression   []string
+	P2PTrustedNodes  []string
+	P2POnlyTrusted   bool
+	P2PNetRestrict   []string // CIDR masks of the networks peers may be in
 	NodeDBPath       string
 	RPCConfig        *xfsgo.RPCConfig
+
+	// Peer slots, the defaults of the p2p server if zero.
+	P2PMaxPeers          int
+	P2PMaxInboundPeers   int
+	P2PMaxPendingPeers   int
+	P2PDialRatio         int
+	P2PMaxPeersPerIP     int
+	P2PMaxPeersPerSubnet int
+	P2PHandshakeTimeout  time.Duration
+	// Urls of the node lists published in DNS.
+	P2PDNSDiscovery []string
+	// IPv6 address listened on besides P2PListenAddress, at its port.
+	P2PListenIP6 string
 }
 
 const datadirPrivateKey = "NODEKEY"
 
+const defaultMaxPeers = 10
+
 // New creates a new P2P node, ready for protocol registration.
 func New(config *Config) (*Node, error) {
 	bootstraps := make([]*discover.Node, 0)
@@ -76,6 +100,40 @@ func New(config *Config) (*Node, error) {
 		staticNodes = append(staticNodes, node)
 	}
 
+	trustedNodes := make([]*discover.Node, 0)
+	for _, nodeUri := range config.P2PTrustedNodes {
+		node, err := discover.ParseNode(nodeUri)
+		if err != nil {
+			return nil, err
+		}
+		trustedNodes = append(trustedNodes, node)
+	}
+
+	compression, err := p2p.ParseCompression(config.P2PCompression)
+	if err != nil {
+		return nil, err
+	}
+	var listenIP6 net.IP
+	if config.P2PListenIP6 != "" {
+		if listenIP6 = net.ParseIP(config.P2PListenIP6); listenIP6 == nil || listenIP6.To4() != nil {
+			return nil, fmt.Errorf("invalid IPv6 listen address %q", config.P2PListenIP6)
+		}
+	}
+	var netrestrict *netutil.Netlist
+	if len(config.P2PNetRestrict) > 0 {
+		if netrestrict, err = netutil.ParseNetlist(config.P2PNetRestrict); err != nil {
+			return nil, err
+		}
+	}
+	for _, url := range config.P2PDNSDiscovery {
+		if _, _, err = dnsdisc.ParseURL(url); err != nil {
+			return nil, err
+		}
+	}
+	maxPeers := config.P2PMaxPeers
+	if maxPeers <= 0 {
+		maxPeers = defaultMaxPeers
+	}
 	enc := new(rawencode.StdEncoder)
 	p2pServer := p2p.NewServer(p2p.Config{
 		Encoder:        enc,
@@ -85,9 +143,22 @@ func New(config *Config) (*Node, error) {
 		BootstrapNodes: bootstraps,
 		StaticNodes:    staticNodes,
 		Discover:       true,
-		MaxPeers:       10,
+		MaxPeers:       maxPeers,
 		NodeDBPath:     config.NodeDBPath,
 		Logger:         logrus.StandardLogger(),
+		Compression:    compression,
+		TrustedNodes:   trustedNodes,
+		OnlyTrusted:    config.P2POnlyTrusted,
+		NetRestrict:    netrestrict,
+
+		MaxInboundPeers:   config.P2PMaxInboundPeers,
+		MaxPendingPeers:   config.P2PMaxPendingPeers,
+		DialRatio:         config.P2PDialRatio,
+		MaxPeersPerIP:     config.P2PMaxPeersPerIP,
+		MaxPeersPerSubnet: config.P2PMaxPeersPerSubnet,
+		HandshakeTimeout:  config.P2PHandshakeTimeout,
+		DNSDiscovery:      config.P2PDNSDiscovery,
+		ListenIP6:         listenIP6,
 	})
 	n := &Node{
 		config:    config,
@@ -119,14 +190,17 @@ func (n *Node) RegisterBackend(
 	bc *xfsgo.BlockChain,
 	miner *miner.Miner,
 	wallet *xfsgo.Wallet,
-	txPool *xfsgo.TxPool) error {
+	txPool *xfsgo.TxPool,
+	syncState api.PeerSyncReader) error {
 	chainApiHandler := &api.ChainAPIHandler{
-		BlockChain:    bc,
-		TxPendingPool: txPool,
-		LogStorage:    vm.NewLogStorage(logsDB),
+		BlockChain:     bc,
+		TxPendingPool:  txPool,
+		LogStorage:     vm.NewLogStorage(logsDB),
+		GasPriceOracle: xfsgo.NewGasPriceOracle(nil, bc, txPool),
 	}
 	minerApiHandler := &api.MinerAPIHandler{
-		Miner: miner,
+		Miner:      miner,
+		BlockChain: bc,
 	}
 
 	walletApiHandler := &api.WalletHandler{
@@ -144,6 +218,7 @@ func (n *Node) RegisterBackend(
 	}
 	netAPIHandler := &api.NetAPIHandler{
 		NetServer: n.P2PServer(),
+		SyncState: syncState,
 	}
 	vmHandler := &api.VMHandler{
 		Chain:   bc,
@@ -162,9 +237,12 @@ func (n *Node) RegisterBackend(
 		log.Fatalf("RPC service register error: %s", err)
 		return err
 	}
-	if err := n.rpcServer.RegisterName("TxPool", txPoolHandler); err != nil {
-		log.Fatalf("RPC service register error: %s", err)
-		return err
+	// Light nodes keep no transaction pool.
+	if txPool != nil {
+		if err := n.rpcServer.RegisterName("TxPool", txPoolHandler); err != nil {
+			log.Fatalf("RPC service register error: %s", err)
+			return err
+		}
 	}
 	if err := n.rpcServer.RegisterName("State", stateHandler); err != nil {
 		log.Fatalf("RPC service register error: %s", err)
@@ -183,9 +261,28 @@ func (n *Node) RegisterBackend(
 		log.Fatalf("RPC service register error: %s", err)
 		return err
 	}
+	for _, target := range adminRPCMethods {
+		n.rpcServer.SetPermission(target, xfsgo.RPCPermAdmin)
+	}
+	for _, target := range readRPCMethods {
+		n.rpcServer.SetPermission(target, xfsgo.RPCPermRead)
+	}
 	return nil
 }
 
+// adminRPCMethods lists the services and the methods of the built-in APIs
+// that require admin permission, the others require read.
+var adminRPCMethods = []string{
+	"Wallet", "Miner",
+	"Chain.ExportBlocks", "Chain.ImportBlock",
+	"TxPool.RemoveTx", "TxPool.Clean", "TxPool.RemoveQueues",
+	"Net.AddPeer", "Net.DelPeer", "Net.BanPeer", "Net.UnbanPeer",
+	"Net.AddTrustedPeer", "Net.RemoveTrustedPeer",
+}
+
+// readRPCMethods lists the methods of admin services that require read.
+var readRPCMethods = []string{"Miner.Status"}
+
 func (n *Node) P2PServer() p2p.Server {
 	return n.p2pServer
 }
@@ -2,6 +2,9 @@ package p2p
 
 const (
 	version1 uint8 = 1
+	// version2 runs protocols in message spaces of their own, as agreed
+	// on in the capabilities message following the hello ones.
+	version2 uint8 = 2
 )
 
 const (
@@ -9,6 +12,7 @@ const (
 	typeReHelloRequest uint8 = 1
 	typePingMsg        uint8 = 2
 	typePongMsg        uint8 = 3
+	typeCapsMsg        uint8 = 4
 )
 
 func SendMsgData(p Peer, mType uint8, obj interface{}) error {
@@ -0,0 +1,125 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of message data, negotiated in the handshake.
+const (
+	CompressNone   uint8 = 0
+	CompressSnappy uint8 = 1
+	CompressZstd   uint8 = 1 << 1
+)
+
+var compressionNames = map[string]uint8{
+	"snappy": CompressSnappy,
+	"zstd":   CompressZstd,
+}
+
+var errInvalidCompressed = errors.New("invalid compressed data")
+
+// ParseCompression parses the names of compression algorithms, in the
+// order the node prefers them.
+func ParseCompression(names []string) ([]uint8, error) {
+	algos := make([]uint8, 0, len(names))
+	for _, name := range names {
+		algo, exists := compressionNames[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown compression: %s", name)
+		}
+		algos = append(algos, algo)
+	}
+	return algos, nil
+}
+
+// compressionMask returns the set of algos offered to a peer.
+func compressionMask(algos []uint8) (mask uint8) {
+	for _, algo := range algos {
+		mask |= algo
+	}
+	return
+}
+
+// chooseCompression returns the first of the preferred algos the peer
+// offered in mask.
+func chooseCompression(algos []uint8, mask uint8) uint8 {
+	for _, algo := range algos {
+		if mask&algo != 0 {
+			return algo
+		}
+	}
+	return CompressNone
+}
+
+// offeredCompression reports whether algo is none or one of the set offered in mask.
+func offeredCompression(mask, algo uint8) bool {
+	return algo == CompressNone || (algo&(algo-1) == 0 && mask&algo != 0)
+}
+
+// maxCompressedSize bounds the compressed size of data of n bytes.
+func maxCompressedSize(n uint32) uint32 {
+	return n + n/6 + 64
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		zstdDecoder, _ = zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxMessageSize)))
+	})
+}
+
+func compressData(algo uint8, data []byte) []byte {
+	switch algo {
+	case CompressSnappy:
+		return snappy.Encode(nil, data)
+	case CompressZstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil)
+	}
+	return data
+}
+
+// decompressData decompresses data, which must not exceed limit bytes
+// once decompressed.
+func decompressData(algo uint8, data []byte, limit uint32) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch algo {
+	case CompressSnappy:
+		var n int
+		if n, err = snappy.DecodedLen(data); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCompressed, err)
+		}
+		if uint32(n) > limit {
+			return nil, errMessageTooLarge
+		}
+		out, err = snappy.Decode(nil, data)
+	case CompressZstd:
+		initZstd()
+		out, err = zstdDecoder.DecodeAll(data, nil)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCompressed, err)
+	}
+	if uint32(len(out)) > limit {
+		return nil, errMessageTooLarge
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"time"
+	"xfsgo/log"
+	"xfsgo/p2p/discover"
+)
+
+// Conn is a connection to a node which completed the p2p handshake without
+// joining the peers of a server, e.g. to probe the node.
+type Conn struct {
+	c   *peerConn
+	rws []*protoRW
+}
+
+// Dial connects to node and runs the p2p handshake with key, both bounded
+// by timeout. The protocols are offered in the handshake, they are not run.
+func Dial(key *ecdsa.PrivateKey, node *discover.Node, timeout time.Duration, protocols []Protocol) (*Conn, error) {
+	rw, err := net.DialTimeout("tcp", node.TcpAddr().String(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &peerConn{
+		logger:  log.DefaultLogger(),
+		self:    discover.PubKey2NodeId(key.PublicKey),
+		id:      node.ID,
+		flag:    flagOutbound,
+		key:     key,
+		rw:      rw,
+		version: version2,
+		caps:    protocolCaps(protocols),
+	}
+	_ = rw.SetDeadline(time.Now().Add(timeout))
+	if err = c.clientHandshake(); err != nil {
+		_ = rw.Close()
+		return nil, err
+	}
+	if err = c.exchangeCaps(); err != nil {
+		_ = c.rw.Close()
+		return nil, err
+	}
+	rws, err := matchProtocols(protocols, c.remoteCaps)
+	if err != nil {
+		_ = c.rw.Close()
+		return nil, err
+	}
+	_ = rw.SetDeadline(time.Time{})
+	return &Conn{c: c, rws: rws}, nil
+}
+
+// Protocol returns the name of the protocol of the messages of mType and
+// their type in the protocol, false if no protocol shared has them.
+func (c *Conn) Protocol(mType uint8) (name string, code uint8, ok bool) {
+	rw := findProtocol(c.rws, mType)
+	if rw == nil {
+		return "", 0, false
+	}
+	return rw.Name(), mType - rw.offset, true
+}
+
+// Version returns the p2p version agreed on in the handshake.
+func (c *Conn) Version() uint8 {
+	return c.c.version
+}
+
+// SetDeadline sets the deadline of the reads and writes of the connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.c.rw.SetDeadline(t)
+}
+
+// ReadMessage reads the next message, built-in ones such as pings included.
+// Protocol maps the type of the messages of protocols.
+func (c *Conn) ReadMessage() (MessageReader, error) {
+	return c.c.readMessageLimit(defaultMessageSize)
+}
+
+func (c *Conn) WriteMessage(mType uint8, data []byte) error {
+	return c.c.writeMessage(mType, data)
+}
+
+func (c *Conn) Close() {
+	_ = c.c.rw.Close()
+}
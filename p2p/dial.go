@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"container/heap"
 	"crypto/rand"
+	mrand "math/rand"
 	"net"
 	"time"
 	"xfsgo/log"
 	"xfsgo/p2p/discover"
+	"xfsgo/p2p/dnsdisc"
+	"xfsgo/p2p/netutil"
 )
 
 const (
@@ -18,6 +21,13 @@ const (
 	// Discovery lookups are throttled and can only run
 	// once every few seconds.
 	lookupInterval = 4 * time.Second
+
+	// The node lists published in DNS are synced at this interval.
+	dnsSyncInterval = 30 * time.Minute
+
+	// A sync of the node lists which failed or found no node is retried
+	// after this delay, doubled at each failure up to dnsSyncInterval.
+	dnsRetryInterval = 30 * time.Second
 )
 
 type task interface {
@@ -31,6 +41,9 @@ type dialtask struct {
 }
 
 func (t *dialtask) Do(srv *server) {
+	if srv.existsIgnore(t.dest.ID) {
+		return
+	}
 	tcpAddr := t.dest.TcpAddr()
 	//t.log.Debugf("Dial task doing: addr=%s", tcpAddr.String())
 	coon, err := net.Dial("tcp", tcpAddr.String())
@@ -70,6 +83,21 @@ func (t *discoverTask) Do(srv *server) {
 	t.result = srv.table.Lookup(target)
 }
 
+// dnsTask syncs the node lists published in DNS.
+type dnsTask struct {
+	client *dnsdisc.Client
+	urls   []string
+	result []*discover.Node
+	err    error
+	log    log.Logger
+}
+
+func (t *dnsTask) Do(_ *server) {
+	if t.result, t.err = t.client.SyncNodes(t.urls); t.err != nil && t.log != nil {
+		t.log.Debugf("Failed to sync dns node list: %v", t.err)
+	}
+}
+
 type waitExpireTask struct {
 	time.Duration
 }
@@ -131,6 +159,17 @@ type dialstate struct {
 	bootstrapped  bool
 	randomNodes   []*discover.Node
 	hist          *dialHistory
+	netrestrict   *netutil.Netlist
+	// dns syncs the node lists at dnsURLs, whose nodes are dialed along
+	// with the random nodes of the table.
+	dns        *dnsdisc.Client
+	dnsURLs    []string
+	dnsNodes   []*discover.Node
+	dnsRunning bool
+	// dnsNext is when the node lists are synced next, dnsBackoff the delay
+	// of the last retry.
+	dnsNext    time.Time
+	dnsBackoff time.Duration
 }
 type discoverTable interface {
 	Self() *discover.Node
@@ -138,9 +177,11 @@ type discoverTable interface {
 	Bootstrap([]*discover.Node)
 	Lookup(target discover.NodeId) []*discover.Node
 	ReadRandomNodes([]*discover.Node) int
+	Record(id discover.NodeId) *discover.Record
+	LocalRecord() *discover.Record
 }
 
-func newDialState(static []*discover.Node, table discoverTable, maxdyn int, log log.Logger) *dialstate {
+func newDialState(static []*discover.Node, table discoverTable, maxdyn int, netrestrict *netutil.Netlist, log log.Logger) *dialstate {
 	ds := &dialstate{
 		log:         log,
 		ntab:        table,
@@ -149,6 +190,7 @@ func newDialState(static []*discover.Node, table discoverTable, maxdyn int, log
 		dialing:     make(map[discover.NodeId]int),
 		randomNodes: make([]*discover.Node, maxdyn/2),
 		hist:        new(dialHistory),
+		netrestrict: netrestrict,
 	}
 	for _, n := range static {
 		ds.addStatic(n)
@@ -171,6 +213,13 @@ func (ds *dialstate) newTasks(nRunning int, peers map[discover.NodeId]Peer, now
 		if dialing || peers[n.ID] != nil || ds.hist.contains(n.ID) {
 			return false
 		}
+		if ds.netrestrict != nil && !ds.netrestrict.Contains(n.IP) {
+			return false
+		}
+		// Spare the connection to nodes known to follow another chain.
+		if flag&flagDynamic != 0 && !ds.compatible(n) {
+			return false
+		}
 		ds.dialing[n.ID] = flag
 		tasks = append(tasks, &dialtask{
 			log:  ds.log,
@@ -206,6 +255,22 @@ func (ds *dialstate) newTasks(nRunning int, peers map[discover.NodeId]Peer, now
 			}
 		}
 	}
+	if randomCandidates > 0 {
+		picked := 0
+		for _, j := range mrand.Perm(len(ds.dnsNodes)) {
+			if picked >= randomCandidates {
+				break
+			}
+			if addDial(flagOutbound|flagDynamic, ds.dnsNodes[j]) {
+				needDynDials--
+				picked++
+			}
+		}
+	}
+	if ds.dns != nil && ds.maxDynDials > 0 && !ds.dnsRunning && !now.Before(ds.dnsNext) {
+		ds.dnsRunning = true
+		tasks = append(tasks, &dnsTask{client: ds.dns, urls: ds.dnsURLs, log: ds.log})
+	}
 	i := 0
 	for ; i < len(ds.lookupBuf) && needDynDials > 0; i++ {
 		if addDial(flagOutbound|flagDynamic, ds.lookupBuf[i]) {
@@ -227,6 +292,23 @@ func (ds *dialstate) newTasks(nRunning int, peers map[discover.NodeId]Peer, now
 	return tasks
 }
 
+// compatible reports whether the node may follow the chain of the local
+// one, as far as its latest record tells.
+func (ds *dialstate) compatible(n *discover.Node) bool {
+	if ds.ntab == nil {
+		return true
+	}
+	local := ds.ntab.LocalRecord()
+	if local == nil {
+		return true
+	}
+	record := n.Record
+	if r := ds.ntab.Record(n.ID); r != nil && (record == nil || r.Seq > record.Seq) {
+		record = r
+	}
+	return record == nil || record.Compatible(local)
+}
+
 func (ds *dialstate) taskDone(t task, now time.Time) {
 	switch mt := t.(type) {
 	case *discoverTask:
@@ -235,6 +317,22 @@ func (ds *dialstate) taskDone(t task, now time.Time) {
 		}
 		ds.lookupRunning = false
 		ds.lookupBuf = append(ds.lookupBuf, mt.result...)
+	case *dnsTask:
+		ds.dnsRunning = false
+		if mt.err != nil || len(mt.result) == 0 {
+			// Keep the nodes of the last sync and retry soon.
+			ds.dnsBackoff *= 2
+			if ds.dnsBackoff < dnsRetryInterval {
+				ds.dnsBackoff = dnsRetryInterval
+			} else if ds.dnsBackoff > dnsSyncInterval {
+				ds.dnsBackoff = dnsSyncInterval
+			}
+			ds.dnsNext = now.Add(ds.dnsBackoff)
+			break
+		}
+		ds.dnsBackoff = 0
+		ds.dnsNext = now.Add(dnsSyncInterval)
+		ds.dnsNodes = mt.result
 	case *dialtask:
 		ds.hist.add(mt.dest.ID, now.Add(dialHistoryExpiration))
 		delete(ds.dialing, mt.dest.ID)
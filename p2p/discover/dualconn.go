@@ -0,0 +1,97 @@
+package discover
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var errDualConnClosed = errors.New("use of closed dual-stack connection")
+
+// DualConn reads and writes the discovery packets of an IPv4 and an IPv6
+// socket, for nodes listening on a specific address of each family.
+// Packets to IPv4 addresses are written to the IPv4 socket, the others to
+// the IPv6 one.
+type DualConn struct {
+	v4, v6  *net.UDPConn
+	packets chan dualPacket
+	closing chan struct{}
+	once    sync.Once
+}
+
+type dualPacket struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+// NewDualConn starts reading the packets of both sockets.
+func NewDualConn(v4, v6 *net.UDPConn) *DualConn {
+	c := &DualConn{
+		v4:      v4,
+		v6:      v6,
+		packets: make(chan dualPacket),
+		closing: make(chan struct{}),
+	}
+	go c.readLoop(v4)
+	go c.readLoop(v6)
+	return c
+}
+
+func (c *DualConn) readLoop(conn *net.UDPConn) {
+	for {
+		buf := make([]byte, 1280)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// A socket failing leaves the node unreachable on its family,
+			// the other one is closed too so that the table notices.
+			_ = c.Close()
+			return
+		}
+		select {
+		case c.packets <- dualPacket{data: buf[:n], addr: addr}:
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+// ReadFromUDP returns the next packet read by either socket.
+func (c *DualConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case p := <-c.packets:
+		return copy(b, p.data), p.addr, nil
+	case <-c.closing:
+		return 0, nil, errDualConnClosed
+	}
+}
+
+// WriteToUDP writes b by the socket of the family of addr.
+func (c *DualConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	if addr.IP.To4() != nil {
+		return c.v4.WriteToUDP(b, addr)
+	}
+	return c.v6.WriteToUDP(b, addr)
+}
+
+// Close closes both sockets.
+func (c *DualConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closing)
+		err = c.v4.Close()
+		if err6 := c.v6.Close(); err == nil {
+			err = err6
+		}
+	})
+	return err
+}
+
+// LocalAddr returns the address of the IPv4 socket.
+func (c *DualConn) LocalAddr() net.Addr {
+	return c.v4.LocalAddr()
+}
+
+// LocalAddrs returns the addresses of both sockets, IPv4 first.
+func (c *DualConn) LocalAddrs() []net.Addr {
+	return []net.Addr{c.v4.LocalAddr(), c.v6.LocalAddr()}
+}
@@ -52,12 +52,19 @@ type Node struct {
 	TCP, UDP uint16
 	ID       NodeId
 	Hash     common.Hash
+	// Record is the latest signed metadata of the node, nil if unknown.
+	Record *Record `json:",omitempty"`
 }
 
 func NewNode(ip net.IP, tcpPort, udpPort uint16, id NodeId) *Node {
 	return newNode(ip, tcpPort, udpPort, id)
 }
 func newNode(ip net.IP, tcpPort, udpPort uint16, id NodeId) *Node {
+	// IPv4 peers of dual-stack sockets have IPv4-mapped IPv6 addresses,
+	// they are kept in the 4 byte form to compare equal to the others.
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
 	n := &Node{
 		IP:  ip,
 		TCP: tcpPort,
@@ -79,6 +86,8 @@ func (n *Node) addr() *net.UDPAddr {
 	return &net.UDPAddr{IP: n.IP, Port: int(n.UDP)}
 }
 
+// String returns the URL of the node, IPv6 addresses are enclosed in
+// brackets as in xfsnode://[::1]:9011?id=...
 func (n *Node) String() string {
 	addr := net.TCPAddr{IP: n.IP, Port: int(n.TCP)}
 	u := url.URL{
@@ -109,9 +118,6 @@ func ParseNode(rawurl string) (*Node, error) {
 	if ip = net.ParseIP(host); ip == nil {
 		return nil, errors.New("invalid ip host")
 	}
-	if ipv4 := ip.To4(); ipv4 != nil {
-		ip = ipv4
-	}
 	if tcpPort, err = strconv.ParseUint(port, 10, 16); err != nil {
 		return nil, errors.New("invalid port")
 	}
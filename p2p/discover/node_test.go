@@ -0,0 +1,33 @@
+package discover
+
+import (
+	"net"
+	"testing"
+	"xfsgo/crypto"
+)
+
+func TestNode_ipv6URL(t *testing.T) {
+	id := PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	tests := []struct {
+		ip   net.IP
+		host string
+	}{
+		{net.ParseIP("::1"), "[::1]:9011"},
+		{net.ParseIP("2001:db8::7"), "[2001:db8::7]:9011"},
+		{net.ParseIP("::ffff:10.0.0.1"), "10.0.0.1:9011"},
+	}
+	for _, test := range tests {
+		n := NewNode(test.ip, 9011, 9011, id)
+		want := "xfsnode://" + test.host + "?id=" + id.String()
+		if got := n.String(); got != want {
+			t.Fatalf("want url %s, got %s", want, got)
+		}
+		parsed, err := ParseNode(n.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.IP.Equal(test.ip) || len(parsed.IP) != len(n.IP) || parsed.TCP != 9011 || parsed.ID != id {
+			t.Fatalf("want node %v, got %v", n, parsed)
+		}
+	}
+}
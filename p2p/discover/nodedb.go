@@ -24,6 +24,7 @@ var (
 	nodeDBNodeExpiration    = 24 * time.Hour // Time after which an unseen node should be dropped.
 	nodeDBCleanupCycle      = time.Hour      // Time period for running the expiration task.
 	nodeDBItemPrefix        = []byte("n:")
+	nodeDBBanPrefix         = []byte("ban:") // Bans outlive the expiry of the node items.
 	nodeDBDiscoverRoot      = ":discover"
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
 	nodeDBDiscoverPong      = nodeDBDiscoverRoot + ":lastpong"
@@ -160,6 +161,46 @@ func (db *nodeDB) updateLastPong(id NodeId, instance time.Time) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverPong), instance.Unix())
 }
 
+// bannedUntil retrieves the time until which a remote node is banned.
+func (db *nodeDB) bannedUntil(id NodeId) time.Time {
+	return time.Unix(db.fetchInt64(append(nodeDBBanPrefix, id[:]...)), 0)
+}
+
+// updateBan bans a remote node until the given time.
+func (db *nodeDB) updateBan(id NodeId, until time.Time) error {
+	return db.storeInt64(append(nodeDBBanPrefix, id[:]...), until.Unix())
+}
+
+// deleteBan lifts the ban of a remote node.
+func (db *nodeDB) deleteBan(id NodeId) error {
+	return db.storage.DelData(append(nodeDBBanPrefix, id[:]...))
+}
+
+// bans returns the nodes banned at present, dropping the expired bans.
+func (db *nodeDB) bans() map[NodeId]time.Time {
+	now := time.Now()
+	out := make(map[NodeId]time.Time)
+	expired := make([]NodeId, 0)
+	_ = db.storage.ForeachData(func(k []byte, v []byte) error {
+		if !bytes.HasPrefix(k, nodeDBBanPrefix) || len(k) != len(nodeDBBanPrefix)+len(NodeId{}) {
+			return nil
+		}
+		var id NodeId
+		copy(id[:], k[len(nodeDBBanPrefix):])
+		val, _ := binary.Varint(v)
+		if until := time.Unix(val, 0); until.After(now) {
+			out[id] = until
+		} else {
+			expired = append(expired, id)
+		}
+		return nil
+	})
+	for _, id := range expired {
+		_ = db.deleteBan(id)
+	}
+	return out
+}
+
 // expireNodes iterates over the database and deletes all nodes that have not
 // been seen (i.e. received a pong from) for some alloted time.
 func (db *nodeDB) expireNodes() error {
@@ -238,3 +279,48 @@ func (db *nodeDB) querySeeds(n int) []*Node {
 	}
 	return nodes
 }
+
+// liveNodes returns the nodes which answered a ping within maxAge,
+// all the nodes of the database if maxAge is zero.
+func (db *nodeDB) liveNodes(maxAge time.Duration) []*Node {
+	blobs := make(map[NodeId][]byte)
+	pongs := make(map[NodeId]int64)
+	_ = db.storage.ForeachData(func(k []byte, v []byte) error {
+		id, field := splitKey(k)
+		if bytes.Equal(id[:], nodeDBNilNodeID[:]) || bytes.Equal(id[:], db.self[:]) {
+			return nil
+		}
+		switch field {
+		case nodeDBDiscoverRoot:
+			blobs[id] = append([]byte{}, v...)
+		case nodeDBDiscoverPong:
+			pongs[id], _ = binary.Varint(v)
+		}
+		return nil
+	})
+	threshold := time.Now().Add(-maxAge).Unix()
+	nodes := make([]*Node, 0, len(blobs))
+	for id, blob := range blobs {
+		if maxAge > 0 && pongs[id] < threshold {
+			continue
+		}
+		node := new(Node)
+		if err := rawencode.Decode(blob, node); err != nil {
+			continue
+		}
+		node.Hash = crypto.ByteHash256(node.ID[:])
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// ReadNodes opens the node database at path and returns the nodes which
+// answered a ping within maxAge, all the nodes if maxAge is zero.
+func ReadNodes(path string, maxAge time.Duration) ([]*Node, error) {
+	db, err := newNodeDB(path, Version, NodeId{})
+	if err != nil {
+		return nil, err
+	}
+	defer db.close()
+	return db.liveNodes(maxAge), nil
+}
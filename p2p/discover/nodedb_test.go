@@ -0,0 +1,87 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNodeDB_bans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	db, err := newNodeDB(dir, Version, NodeId{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	banned, expired := NodeId{1}, NodeId{2}
+	until := time.Now().Add(time.Hour)
+	if err = db.updateBan(banned, until); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.updateBan(expired, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	db.close()
+
+	// Bans survive reopening the database.
+	db, err = newNodeDB(dir, Version, NodeId{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.close()
+	bans := db.bans()
+	if len(bans) != 1 || bans[banned].Unix() != until.Unix() {
+		t.Fatalf("unexpected bans: %v", bans)
+	}
+	if got := db.bannedUntil(expired); got.Unix() != 0 {
+		t.Fatalf("want expired ban dropped, got %s", got)
+	}
+	if err = db.deleteBan(banned); err != nil {
+		t.Fatal(err)
+	}
+	if bans = db.bans(); len(bans) != 0 {
+		t.Fatalf("want no bans, got %v", bans)
+	}
+}
+
+func TestNodeDB_liveNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	db, err := newNodeDB(dir, Version, NodeId{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := newNode(net.ParseIP("10.0.0.1"), 9011, 9011, NodeId{1})
+	stale := newNode(net.ParseIP("10.0.0.2"), 9011, 9011, NodeId{2})
+	for _, n := range []*Node{live, stale} {
+		if err = db.updateNode(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.updateLastPong(live.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.updateLastPong(stale.ID, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	db.close()
+
+	nodes, err := ReadNodes(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].ID != live.ID || !nodes[0].IP.Equal(live.IP) {
+		t.Fatalf("want only the live node, got %v", nodes)
+	}
+	if nodes, err = ReadNodes(dir, 0); err != nil || len(nodes) != 2 {
+		t.Fatalf("want all nodes, got %v, err %v", nodes, err)
+	}
+}
@@ -0,0 +1,150 @@
+package discover
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"time"
+	"xfsgo/common"
+	"xfsgo/common/rawencode"
+	"xfsgo/crypto"
+)
+
+// Names of the protocols a node serves.
+const (
+	ProtocolFull  = "full"  // blocks and transactions of the chain sync
+	ProtocolLight = "light" // headers and proofs for light clients
+	ProtocolSnap  = "snap"  // state for fast sync
+)
+
+// maxRecords bounds the records kept of the nodes not bonded yet.
+const maxRecords = 1000
+
+var errInvalidRecord = errors.New("invalid node record")
+
+// Record is the metadata a node advertises in discovery, signed by its key.
+// A record replaces the ones of the node with a lower sequence number.
+type Record struct {
+	Seq       uint64
+	NetworkID uint32
+	Genesis   common.Hash
+	Protocols []string
+	Client    string
+	Signature []byte
+}
+
+func (r *Record) sigHash() []byte {
+	cpy := *r
+	cpy.Signature = nil
+	bs, _ := rawencode.Encode(&cpy)
+	h := crypto.ByteHash256(bs)
+	return h[:]
+}
+
+func (r *Record) sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.ECDSASign(r.sigHash(), key)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// verify checks the record was signed by the key of node id.
+func (r *Record) verify(id NodeId) error {
+	pub, err := crypto.SigToPub(r.sigHash(), r.Signature)
+	if err != nil {
+		return errInvalidRecord
+	}
+	if PubKey2NodeId(*pub) != id {
+		return errInvalidRecord
+	}
+	return nil
+}
+
+// HasProtocol reports whether the node serves the protocol of name.
+func (r *Record) HasProtocol(name string) bool {
+	for _, p := range r.Protocols {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Compatible reports whether the node of the record follows the chain of
+// the local one, and serves any protocol.
+func (r *Record) Compatible(local *Record) bool {
+	if r.NetworkID != local.NetworkID {
+		return false
+	}
+	var zero common.Hash
+	if r.Genesis != zero && local.Genesis != zero && r.Genesis != local.Genesis {
+		return false
+	}
+	return len(r.Protocols) > 0
+}
+
+// SetRecord signs the record with key and advertises it as the one of the
+// local node, numbered after the records advertised before.
+func (tab *Table) SetRecord(r *Record, key *ecdsa.PrivateKey) error {
+	cpy := *r
+	tab.recordMu.Lock()
+	defer tab.recordMu.Unlock()
+	// Records outlive restarts in the tables of other nodes, the clock
+	// keeps the numbers growing across them.
+	cpy.Seq = uint64(time.Now().Unix())
+	if tab.record != nil && cpy.Seq <= tab.record.Seq {
+		cpy.Seq = tab.record.Seq + 1
+	}
+	if err := cpy.sign(key); err != nil {
+		return err
+	}
+	tab.record = &cpy
+	return nil
+}
+
+// LocalRecord returns the record of the local node, nil if not set.
+func (tab *Table) LocalRecord() *Record {
+	tab.recordMu.RLock()
+	defer tab.recordMu.RUnlock()
+	return tab.record
+}
+
+// Record returns the latest record of the node of id, nil if unknown.
+func (tab *Table) Record(id NodeId) *Record {
+	tab.recordMu.RLock()
+	r := tab.records[id]
+	tab.recordMu.RUnlock()
+	if r != nil {
+		return r
+	}
+	if n := tab.db.node(id); n != nil {
+		return n.Record
+	}
+	return nil
+}
+
+// storeRecord keeps the record received from the node of id, if it is
+// signed by the node and newer than the one known.
+func (tab *Table) storeRecord(id NodeId, r *Record) {
+	if r == nil || r.verify(id) != nil {
+		return
+	}
+	tab.recordMu.Lock()
+	if prev := tab.records[id]; prev != nil && prev.Seq >= r.Seq {
+		tab.recordMu.Unlock()
+		return
+	}
+	if len(tab.records) >= maxRecords {
+		for other := range tab.records {
+			delete(tab.records, other)
+			break
+		}
+	}
+	tab.records[id] = r
+	tab.recordMu.Unlock()
+	if n := tab.db.node(id); n != nil && (n.Record == nil || n.Record.Seq < r.Seq) {
+		n.Record = r
+		_ = tab.db.updateNode(n)
+	}
+}
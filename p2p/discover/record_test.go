@@ -0,0 +1,101 @@
+package discover
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"xfsgo/common"
+	"xfsgo/crypto"
+)
+
+func newTestTable(t *testing.T, laddr string) (*Table, func()) {
+	dir, err := ioutil.TempDir("", "nodedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := ListenUDP(crypto.MustGenPrvKey(), laddr, dir, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tab, func() {
+		tab.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestTable_SetRecord(t *testing.T) {
+	tab, closeTab := newTestTable(t, "127.0.0.1:0")
+	defer closeTab()
+	key := crypto.MustGenPrvKey()
+	if err := tab.SetRecord(&Record{NetworkID: 1}, key); err != nil {
+		t.Fatal(err)
+	}
+	first := tab.LocalRecord()
+	if err := first.verify(PubKey2NodeId(key.PublicKey)); err != nil {
+		t.Fatalf("want record signed by the key, got %v", err)
+	}
+	if err := tab.SetRecord(&Record{NetworkID: 2}, key); err != nil {
+		t.Fatal(err)
+	}
+	second := tab.LocalRecord()
+	if second.Seq <= first.Seq {
+		t.Fatalf("want sequence above %d, got %d", first.Seq, second.Seq)
+	}
+	tampered := *second
+	tampered.NetworkID = 3
+	if err := tampered.verify(PubKey2NodeId(key.PublicKey)); err != errInvalidRecord {
+		t.Fatalf("want err %v, got %v", errInvalidRecord, err)
+	}
+
+	// Only records signed by the node and newer than the known one are kept.
+	id := PubKey2NodeId(key.PublicKey)
+	tab.storeRecord(id, second)
+	tab.storeRecord(id, first)
+	tab.storeRecord(id, &tampered)
+	if got := tab.Record(id); got == nil || got.Seq != second.Seq || got.NetworkID != 2 {
+		t.Fatalf("want the latest record kept, got %+v", got)
+	}
+}
+
+func TestRecord_Compatible(t *testing.T) {
+	genesis := common.Hash{1}
+	local := &Record{NetworkID: 1, Genesis: genesis, Protocols: []string{ProtocolFull}}
+	tests := []struct {
+		record *Record
+		want   bool
+	}{
+		{&Record{NetworkID: 1, Genesis: genesis, Protocols: []string{ProtocolFull}}, true},
+		{&Record{NetworkID: 1, Protocols: []string{ProtocolLight}}, true},
+		{&Record{NetworkID: 2, Genesis: genesis, Protocols: []string{ProtocolFull}}, false},
+		{&Record{NetworkID: 1, Genesis: common.Hash{2}, Protocols: []string{ProtocolFull}}, false},
+		{&Record{NetworkID: 1, Genesis: genesis}, false},
+	}
+	for i, test := range tests {
+		if got := test.record.Compatible(local); got != test.want {
+			t.Fatalf("test %d: want %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+func TestUDP_recordExchange(t *testing.T) {
+	a, closeA := newTestTable(t, "127.0.0.1:0")
+	defer closeA()
+	b, closeB := newTestTable(t, "127.0.0.1:0")
+	defer closeB()
+	keyA, keyB := a.net.(*udp).priv, b.net.(*udp).priv
+	if err := a.SetRecord(&Record{NetworkID: 1, Protocols: []string{ProtocolFull}}, keyA); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetRecord(&Record{NetworkID: 2, Protocols: []string{ProtocolLight}, Client: "test"}, keyB); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ping(b.Self().ID, b.Self().UdpAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Record(b.Self().ID); got == nil || got.NetworkID != 2 || got.Client != "test" {
+		t.Fatalf("want record of b received in pong, got %+v", got)
+	}
+	if got := b.Record(a.Self().ID); got == nil || got.NetworkID != 1 || !got.HasProtocol(ProtocolFull) {
+		t.Fatalf("want record of a received in ping, got %+v", got)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"xfsgo/common"
 	"xfsgo/crypto"
 	"xfsgo/log"
+	"xfsgo/p2p/netutil"
 )
 
 const (
@@ -20,6 +21,11 @@ const (
 
 	maxBondingPingPongs = 16
 	maxFindnodeFailures = 5
+
+	// Nodes of one subnet, /24 for IPv4 and /64 for IPv6, kept in a bucket
+	// and in the whole table. LAN addresses are not limited.
+	bucketIPLimit = 2
+	tableIPLimit  = 10
 )
 
 type Table struct {
@@ -36,6 +42,14 @@ type Table struct {
 
 	net  transport
 	self *Node // metadata of the local node
+
+	// record is the one of the local node, records the latest ones
+	// received of other nodes.
+	recordMu sync.RWMutex
+	record   *Record
+	records  map[NodeId]*Record
+
+	ips netutil.DistinctNetSet // subnets of the nodes in buckets
 }
 
 type bondproc struct {
@@ -51,6 +65,7 @@ type transport interface {
 	ping(NodeId, *net.UDPAddr) error
 	waitping(NodeId) error
 	findnode(toid NodeId, addr *net.UDPAddr, target NodeId) ([]*Node, error)
+	external() (ip4, ip6 net.IP)
 	close()
 }
 
@@ -60,6 +75,7 @@ type transport interface {
 type bucket struct {
 	lastLookup time.Time
 	entries    []*Node
+	ips        netutil.DistinctNetSet
 }
 
 func newTable(t transport, ourID NodeId, ourAddr *net.UDPAddr, nodeDBPath string, log log.Logger) *Table {
@@ -75,12 +91,14 @@ func newTable(t transport, ourID NodeId, ourAddr *net.UDPAddr, nodeDBPath string
 		self:      newNode(ourAddr.IP, uint16(ourAddr.Port), uint16(ourAddr.Port), ourID),
 		bonding:   make(map[NodeId]*bondproc),
 		bondslots: make(chan struct{}, maxBondingPingPongs),
+		records:   make(map[NodeId]*Record),
 	}
+	tab.ips.Limit = tableIPLimit
 	for i := 0; i < cap(tab.bondslots); i++ {
 		tab.bondslots <- struct{}{}
 	}
 	for i := range tab.buckets {
-		tab.buckets[i] = new(bucket)
+		tab.buckets[i] = &bucket{ips: netutil.DistinctNetSet{Limit: bucketIPLimit}}
 	}
 	return tab
 }
@@ -91,6 +109,12 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// External returns the external IPs of the local node by family, nil for
+// a family not listened on or not learned yet from the nodes pinged.
+func (tab *Table) External() (ip4, ip6 net.IP) {
+	return tab.net.external()
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -132,6 +156,25 @@ func (tab *Table) ReadRandomNodes(buf []*Node) (n int) {
 	return i + 1
 }
 
+// Nodes returns the nodes in the buckets of the table.
+func (tab *Table) Nodes() []*Node {
+	tab.mu.Lock()
+	defer tab.mu.Unlock()
+	var nodes []*Node
+	for _, b := range tab.buckets {
+		for _, n := range b.entries {
+			cpy := *n
+			nodes = append(nodes, &cpy)
+		}
+	}
+	return nodes
+}
+
+// LastPong returns the time the node last answered a ping.
+func (tab *Table) LastPong(id NodeId) time.Time {
+	return tab.db.lastPong(id)
+}
+
 func randUint(max uint32) uint32 {
 	if max == 0 {
 		return 0
@@ -150,6 +193,22 @@ func (tab *Table) Close() {
 	tab.net.close()
 }
 
+// Ban records in the node database that a node is banned until the given time.
+func (tab *Table) Ban(id NodeId, until time.Time) error {
+	return tab.db.updateBan(id, until)
+}
+
+// Unban lifts the ban of a node.
+func (tab *Table) Unban(id NodeId) error {
+	return tab.db.deleteBan(id)
+}
+
+// Bans returns the nodes banned at present, with the time until which
+// each stays banned.
+func (tab *Table) Bans() map[NodeId]time.Time {
+	return tab.db.bans()
+}
+
 // Bootstrap sets the bootstrap nodes. These nodes are used to connect
 // to the network if the table is empty. Bootstrap will also attempt to
 // fill the table by performing random lookup operations on the
@@ -402,7 +461,7 @@ func (tab *Table) bond(pinged bool, id NodeId, addr *net.UDPAddr, tcpPort uint16
 		bucketsIndex := logdist(tab.self.Hash[:], node.Hash[:])
 		b := tab.buckets[bucketsIndex]
 		//tab.Logger.Debugf("bond target id: %s, get buckets by index: %d", id, bucketsIndex)
-		if !b.bump(node) {
+		if !tab.bump(b, node) {
 			tab.pingreplace(node, b)
 		}
 		if err := tab.db.updateFindFails(id, 0); err != nil {
@@ -435,6 +494,9 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeId, addr *net.UDPAdd
 	}
 	// Bonding succeeded, update the node database
 	w.n = newNode(addr.IP, uint16(addr.Port), tcpPort, id)
+	tab.recordMu.RLock()
+	w.n.Record = tab.records[id]
+	tab.recordMu.RUnlock()
 	//if err := tab.db.updateNode(w.n); err != nil {
 	//	close(w.done)
 	//	return
@@ -444,13 +506,18 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeId, addr *net.UDPAdd
 }
 
 func (tab *Table) pingreplace(new *Node, b *bucket) {
+	if !tab.addIP(b, new.IP) {
+		return
+	}
 	if len(b.entries) == bucketSize {
 		oldest := b.entries[bucketSize-1]
 		if err := tab.ping(oldest.ID, oldest.addr()); err == nil {
 			//tab.Logger.Debugf("table pingreplace try ping by id: %s success", new.ID)
 			// The node responded, we don't need to replace it.
+			tab.removeIP(b, new.IP)
 			return
 		}
+		tab.removeIP(b, oldest.IP)
 	} else {
 		// Add a slot at the end so the last entry doesn't
 		// fall off when adding the new node.
@@ -501,7 +568,7 @@ outer:
 				continue outer
 			}
 		}
-		if len(bucket.entries) < bucketSize {
+		if len(bucket.entries) < bucketSize && tab.addIP(bucket, n.IP) {
 			bucket.entries = append(bucket.entries, n)
 			if tab.nodeAddedHook != nil {
 				tab.nodeAddedHook(n)
@@ -519,15 +586,25 @@ func (tab *Table) del(node *Node) {
 	bucket := tab.buckets[bucketsIndex]
 	for i := range bucket.entries {
 		if bucket.entries[i].ID == node.ID {
+			tab.removeIP(bucket, bucket.entries[i].IP)
 			bucket.entries = append(bucket.entries[:i], bucket.entries[i+1:]...)
 			return
 		}
 	}
 }
 
-func (b *bucket) bump(n *Node) bool {
+// bump moves the entry of n to the front of bucket b, at the IP of n
+// unless its subnet is full. It reports false if n is not in b.
+func (tab *Table) bump(b *bucket, n *Node) bool {
 	for i := range b.entries {
 		if b.entries[i].ID == n.ID {
+			if old := b.entries[i]; !old.IP.Equal(n.IP) {
+				tab.removeIP(b, old.IP)
+				if !tab.addIP(b, n.IP) {
+					tab.addIP(b, old.IP)
+					n = old
+				}
+			}
 			// move it to the front
 			copy(b.entries[1:], b.entries[:i])
 			b.entries[0] = n
@@ -537,6 +614,30 @@ func (b *bucket) bump(n *Node) bool {
 	return false
 }
 
+// addIP counts ip in bucket b and the table, it reports false if either
+// has no room left for the subnet of ip.
+func (tab *Table) addIP(b *bucket, ip net.IP) bool {
+	if netutil.IsLAN(ip) {
+		return true
+	}
+	if !tab.ips.Add(ip) {
+		return false
+	}
+	if !b.ips.Add(ip) {
+		tab.ips.Remove(ip)
+		return false
+	}
+	return true
+}
+
+func (tab *Table) removeIP(b *bucket, ip net.IP) {
+	if netutil.IsLAN(ip) {
+		return
+	}
+	tab.ips.Remove(ip)
+	b.ips.Remove(ip)
+}
+
 // nodesByDistance is a list of nodes, ordered by
 // distance to target.
 type nodesByDistance struct {
@@ -12,6 +12,8 @@ type ping struct {
 	Version    int
 	From, To   rpcEndpoint
 	Expiration uint64
+	// Record of the sender, omitted by nodes which predate records.
+	Record *Record `json:",omitempty"`
 }
 
 // pong is the reply to ping.
@@ -21,6 +23,14 @@ type pong struct {
 	// the external address (after NAT).
 	To         rpcEndpoint
 	Expiration uint64 // Absolute timestamp at which the packet becomes invalid.
+
+	// Record of the sender, omitted by nodes which predate records.
+	Record *Record `json:",omitempty"`
+
+	// IPv4 and IPv6 are the external endpoints of the sender, nil for a
+	// family it does not know one of. Dual-stack nodes report both.
+	IPv4 *rpcEndpoint `json:",omitempty"`
+	IPv6 *rpcEndpoint `json:",omitempty"`
 }
 
 // findnode is a query for nodes close to the given target.
@@ -59,10 +69,25 @@ func (req *ping) handle(t *udp, from *net.UDPAddr, fromID NodeId) error {
 	if req.Version != Version {
 		return errBadVersion
 	}
-	_ = t.sendN(from, pongPacket, pong{
+	if !t.allowed(from.IP) {
+		return errNetRestrict
+	}
+	t.storeRecord(fromID, req.Record)
+	ip4, ip6 := t.external()
+	resp := pong{
 		To:         makeEndpoint(from, req.From.TCP),
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
-	}, fromID)
+		Record:     t.LocalRecord(),
+	}
+	if ip4 != nil {
+		ep := t.endpoint(ip4)
+		resp.IPv4 = &ep
+	}
+	if ip6 != nil {
+		ep := t.endpoint(ip6)
+		resp.IPv6 = &ep
+	}
+	_ = t.sendN(from, pongPacket, resp, fromID)
 	if !t.handleReply(fromID, pingPacket, req) {
 		// Note: we're ignoring the provided IP address right now
 		go func() {
@@ -79,6 +104,8 @@ func (req *pong) handle(t *udp, from *net.UDPAddr, fromID NodeId) error {
 	if !t.handleReply(fromID, pongPacket, req) {
 		return errUnsolicitedReply
 	}
+	t.storeRecord(fromID, req.Record)
+	t.learnEndpoint(req.To)
 	return nil
 }
 
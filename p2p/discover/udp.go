@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 	"xfsgo/common/ahash"
 	"xfsgo/common/rawencode"
 	"xfsgo/crypto"
 	"xfsgo/log"
 	"xfsgo/p2p/nat"
+	"xfsgo/p2p/netutil"
 )
 
 const Version = 1
@@ -28,6 +30,7 @@ var (
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
+	errNetRestrict      = errors.New("not contained in netrestrict list")
 )
 
 // Timeouts
@@ -81,15 +84,21 @@ type conn interface {
 // udp implements the RPC protocol.
 type udp struct {
 	//logger log.Logger
-	conn        conn
-	priv        *ecdsa.PrivateKey
-	ourEndpoint rpcEndpoint
+	conn conn
+	priv *ecdsa.PrivateKey
+
+	// endpoints are our external ones, IPv4 then IPv6, as listened on,
+	// mapped by the NAT or seen by the nodes which answered our pings.
+	endpointMu sync.Mutex
+	endpoints  [2]rpcEndpoint
 
 	addpending chan *pending
 	gotreply   chan reply
 
 	closing chan struct{}
 	log     log.Logger
+	// netrestrict limits the nodes talked to, if set.
+	netrestrict *netutil.Netlist
 	*Table
 }
 
@@ -131,7 +140,7 @@ type reply struct {
 }
 
 // ListenUDP returns a new table that listens for UDP packets on laddr.
-func ListenUDP(priv *ecdsa.PrivateKey, laddr string, nodeDBPath string, mapper nat.Mapper, log log.Logger) (*Table, error) {
+func ListenUDP(priv *ecdsa.PrivateKey, laddr string, nodeDBPath string, mapper nat.Mapper, netrestrict *netutil.Netlist, log log.Logger) (*Table, error) {
 	addr, err := net.ResolveUDPAddr("udp", laddr)
 	if err != nil {
 		return nil, err
@@ -140,13 +149,13 @@ func ListenUDP(priv *ecdsa.PrivateKey, laddr string, nodeDBPath string, mapper n
 	if err != nil {
 		return nil, err
 	}
-	tab, _ := newUDP(priv, conn, nodeDBPath, mapper, log)
+	tab, _ := newUDP(priv, conn, nodeDBPath, mapper, netrestrict, log)
 	return tab, nil
 }
-func NewUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper, log log.Logger) (*Table, *udp) {
-	return newUDP(priv, c, nodeDBPath, mapper, log)
+func NewUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper, netrestrict *netutil.Netlist, log log.Logger) (*Table, *udp) {
+	return newUDP(priv, c, nodeDBPath, mapper, netrestrict, log)
 }
-func newUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper, log log.Logger) (*Table, *udp) {
+func newUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper, netrestrict *netutil.Netlist, log log.Logger) (*Table, *udp) {
 	udp := &udp{
 		log:        log,
 		conn:       c,
@@ -155,7 +164,13 @@ func newUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper
 		gotreply:   make(chan reply),
 		addpending: make(chan *pending),
 	}
+	udp.netrestrict = netrestrict
 	realaddr := c.LocalAddr().(*net.UDPAddr)
+	// IPv6 addresses are not translated, only IPv4 ports are mapped.
+	isIPv6 := realaddr.IP.To4() == nil && !realaddr.IP.IsUnspecified()
+	if isIPv6 {
+		mapper = nil
+	}
 	if mapper != nil && !realaddr.IP.IsLoopback() {
 		go nat.Map(mapper, udp.closing, "udp", realaddr.Port, realaddr.Port, "xlibp2p discovery")
 	} else if mapper != nil {
@@ -163,13 +178,84 @@ func newUDP(priv *ecdsa.PrivateKey, c conn, nodeDBPath string, mapper nat.Mapper
 			realaddr = &net.UDPAddr{IP: ext, Port: realaddr.Port}
 		}
 	}
-	udp.ourEndpoint = makeEndpoint(realaddr, uint16(realaddr.Port))
+	udp.initEndpoints(c, realaddr)
 	udp.Table = newTable(udp, PubKey2NodeId(priv.PublicKey), realaddr, nodeDBPath, log)
 	go udp.loop()
 	go udp.readLoop()
 	return udp.Table, udp
 }
 
+// family returns the index of the family of ip in udp.endpoints.
+func family(ip net.IP) int {
+	if ip.To4() != nil {
+		return 0
+	}
+	return 1
+}
+
+// initEndpoints sets our endpoints to the addresses listened on, realaddr
+// for the IPv4 one if the NAT reported it. Unspecified addresses listen on
+// both families.
+func (t *udp) initEndpoints(c conn, realaddr *net.UDPAddr) {
+	addrs := []net.Addr{c.LocalAddr()}
+	if dual, ok := c.(interface{ LocalAddrs() []net.Addr }); ok {
+		addrs = dual.LocalAddrs()
+	}
+	for _, a := range addrs {
+		addr := a.(*net.UDPAddr)
+		if addr.IP.IsUnspecified() {
+			t.endpoints[0] = makeEndpoint(&net.UDPAddr{IP: net.IPv4zero, Port: addr.Port}, uint16(addr.Port))
+			t.endpoints[1] = makeEndpoint(&net.UDPAddr{IP: net.IPv6unspecified, Port: addr.Port}, uint16(addr.Port))
+			continue
+		}
+		t.endpoints[family(addr.IP)] = makeEndpoint(addr, uint16(addr.Port))
+	}
+	if realaddr.IP.To4() != nil && !realaddr.IP.IsUnspecified() {
+		t.endpoints[0] = makeEndpoint(realaddr, uint16(realaddr.Port))
+	}
+}
+
+// endpoint returns our external endpoint of the family of ip.
+func (t *udp) endpoint(ip net.IP) rpcEndpoint {
+	t.endpointMu.Lock()
+	defer t.endpointMu.Unlock()
+	return t.endpoints[family(ip)]
+}
+
+// learnEndpoint takes the IP a node saw our packets come from as external
+// one of its family, unless a public one is known already.
+func (t *udp) learnEndpoint(seen rpcEndpoint) {
+	if seen.IP == nil || seen.IP.IsUnspecified() || netutil.IsLAN(seen.IP) {
+		return
+	}
+	t.endpointMu.Lock()
+	defer t.endpointMu.Unlock()
+	ep := &t.endpoints[family(seen.IP)]
+	if ep.IP != nil && !ep.IP.IsUnspecified() && !netutil.IsLAN(ep.IP) {
+		return
+	}
+	ep.IP = seen.IP
+}
+
+// external returns the IPs of our external endpoints, nil for a family
+// not listened on or not known yet.
+func (t *udp) external() (ip4, ip6 net.IP) {
+	t.endpointMu.Lock()
+	defer t.endpointMu.Unlock()
+	known := func(ep rpcEndpoint) net.IP {
+		if ep.IP == nil || ep.IP.IsUnspecified() {
+			return nil
+		}
+		return ep.IP
+	}
+	return known(t.endpoints[0]), known(t.endpoints[1])
+}
+
+// allowed reports whether ip is in the netrestrict list, if any.
+func (t *udp) allowed(ip net.IP) bool {
+	return t.netrestrict == nil || t.netrestrict.Contains(ip)
+}
+
 func (t *udp) close() {
 	close(t.closing)
 	_ = t.conn.Close()
@@ -182,9 +268,10 @@ func (t *udp) ping(toid NodeId, toaddr *net.UDPAddr) error {
 	errc := t.pending(toid, pongPacket, func(interface{}) bool { return true })
 	_ = t.sendN(toaddr, pingPacket, ping{
 		Version:    Version,
-		From:       t.ourEndpoint,
+		From:       t.endpoint(toaddr.IP),
 		To:         makeEndpoint(toaddr, 0), // TODO: maybe use known TCP port from DB
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Record:     t.LocalRecord(),
 	}, toid)
 	return <-errc
 }
@@ -202,7 +289,7 @@ func (t *udp) findnode(toid NodeId, toaddr *net.UDPAddr, target NodeId) ([]*Node
 		reply := r.(*neighbors)
 		for _, rn := range reply.Nodes {
 			nreceived++
-			if n, valid := nodeFromRPC(rn); valid {
+			if n, valid := nodeFromRPC(rn); valid && t.allowed(n.IP) {
 				nodes = append(nodes, n)
 			}
 		}
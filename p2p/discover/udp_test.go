@@ -2,7 +2,9 @@ package discover
 
 import (
 	"bytes"
+	"io/ioutil"
 	"net"
+	"os"
 	"testing"
 	"xfsgo/common/ahash"
 	"xfsgo/common/rawencode"
@@ -205,3 +207,103 @@ func Test_udp_decodePacket(t *testing.T) {
 		t.Fatal("invalid packet node id")
 	}
 }
+
+func TestUDP_ipv6(t *testing.T) {
+	a, closeA := newTestTable(t, "[::1]:0")
+	defer closeA()
+	b, closeB := newTestTable(t, "[::1]:0")
+	defer closeB()
+	if err := a.ping(b.Self().ID, b.Self().UdpAddr()); err != nil {
+		t.Fatal(err)
+	}
+	n, err := a.bond(false, b.Self().ID, b.Self().UdpAddr(), b.Self().TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.IP.Equal(net.IPv6loopback) || n.String() != b.Self().String() {
+		t.Fatalf("want node %v bonded, got %v", b.Self(), n)
+	}
+	if _, ip6 := a.External(); !ip6.Equal(net.IPv6loopback) {
+		t.Fatalf("want IPv6 endpoint ::1, got %v", ip6)
+	}
+}
+
+func TestUDP_dualStack(t *testing.T) {
+	conn4, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn4.LocalAddr().(*net.UDPAddr).Port
+	conn6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback, Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "nodedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, _ := NewUDP(crypto.MustGenPrvKey(), NewDualConn(conn4, conn6), dir, nil, nil, nil)
+	defer a.Close()
+	b, closeB := newTestTable(t, "[::1]:0")
+	defer closeB()
+	c, closeC := newTestTable(t, "127.0.0.1:0")
+	defer closeC()
+	for _, remote := range []*Table{b, c} {
+		if err := a.ping(remote.Self().ID, remote.Self().UdpAddr()); err != nil {
+			t.Fatalf("ping %v: %v", remote.Self(), err)
+		}
+		// The remote answers a ping of its own at the address of the family
+		// it was reached on.
+		self := &net.UDPAddr{IP: net.IPv6loopback, Port: port}
+		if remote == c {
+			self.IP = net.IPv4(127, 0, 0, 1)
+		}
+		if err := remote.ping(a.Self().ID, self); err != nil {
+			t.Fatalf("ping from %v: %v", remote.Self(), err)
+		}
+	}
+	ip4, ip6 := a.External()
+	if !ip4.Equal(net.IPv4(127, 0, 0, 1)) || !ip6.Equal(net.IPv6loopback) {
+		t.Fatalf("want endpoints 127.0.0.1 and ::1, got %v and %v", ip4, ip6)
+	}
+}
+
+func TestTable_subnetLimits(t *testing.T) {
+	tab, closeTab := newTestTable(t, "[::1]:0")
+	defer closeTab()
+	nodes := make([]*Node, 0, 200)
+	for i := 0; i < 200; i++ {
+		// One /64 subnet, differing in the interface id only.
+		ip := net.ParseIP("2001:db8:1:2::")
+		ip[14], ip[15] = byte(i>>8), byte(i)
+		nodes = append(nodes, NewNode(ip, 9011, 9011, PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)))
+	}
+	tab.mu.Lock()
+	tab.add(nodes)
+	tab.mu.Unlock()
+	if n := tab.len(); n != tableIPLimit {
+		t.Fatalf("want %d nodes of one subnet in the table, got %d", tableIPLimit, n)
+	}
+	for i, b := range tab.buckets {
+		if len(b.entries) > bucketIPLimit {
+			t.Fatalf("want at most %d nodes of one subnet in bucket %d, got %d", bucketIPLimit, i, len(b.entries))
+		}
+	}
+	// Nodes of other subnets and of the LAN are not limited by it.
+	other := NewNode(net.ParseIP("2001:db8:1:3::1"), 9011, 9011, PubKey2NodeId(crypto.MustGenPrvKey().PublicKey))
+	lan := NewNode(net.ParseIP("fd00::1"), 9011, 9011, PubKey2NodeId(crypto.MustGenPrvKey().PublicKey))
+	tab.mu.Lock()
+	tab.add([]*Node{other, lan})
+	tab.mu.Unlock()
+	if n := tab.len(); n != tableIPLimit+2 {
+		t.Fatalf("want %d nodes in the table, got %d", tableIPLimit+2, n)
+	}
+	tab.del(nodes[0])
+	for _, n := range tab.Nodes() {
+		tab.del(n)
+	}
+	if n := tab.ips.Len(); n != 0 {
+		t.Fatalf("want no subnets counted after removal, got %d", n)
+	}
+}
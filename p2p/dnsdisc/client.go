@@ -0,0 +1,172 @@
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"xfsgo/p2p/discover"
+)
+
+const (
+	defaultTimeout    = 5 * time.Second
+	defaultMaxEntries = 10000
+)
+
+// Resolver looks up the TXT records of a domain, *net.Resolver implements it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// Config configures the client, the defaults are used for zero values.
+type Config struct {
+	Timeout    time.Duration // timeout of a lookup
+	Resolver   Resolver      // net.DefaultResolver if nil
+	MaxEntries int           // bound of the entries of a tree
+}
+
+// Client resolves the trees of nodes published in DNS.
+type Client struct {
+	cfg   Config
+	mu    sync.Mutex
+	trees map[string]*Tree // the last tree synced by url
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMaxEntries
+	}
+	return &Client{
+		cfg:   cfg,
+		trees: make(map[string]*Tree),
+	}
+}
+
+// SyncTree resolves the tree at url and verifies it against the key of the
+// url. The entries unchanged since the last sync are not resolved again.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	domain, key, err := ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.resolveRoot(domain, key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	prev := c.trees[url]
+	c.mu.Unlock()
+	if prev != nil {
+		if root.seq < prev.root.seq {
+			return nil, fmt.Errorf("tree sequence went back from %d to %d", prev.root.seq, root.seq)
+		}
+		if root.eroot == prev.root.eroot {
+			return prev, nil
+		}
+	}
+	t := &Tree{root: root, entries: make(map[string]entry)}
+	queue := []string{root.eroot}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, exists := t.entries[hash]; exists {
+			continue
+		}
+		if len(t.entries) >= c.cfg.MaxEntries {
+			return nil, fmt.Errorf("tree has more than %d entries", c.cfg.MaxEntries)
+		}
+		var e entry
+		if prev != nil {
+			e = prev.entries[hash]
+		}
+		if e == nil {
+			if e, err = c.resolveEntry(domain, hash); err != nil {
+				return nil, err
+			}
+		}
+		t.entries[hash] = e
+		if branch, ok := e.(*branchEntry); ok {
+			queue = append(queue, branch.children...)
+		}
+	}
+	c.mu.Lock()
+	c.trees[url] = t
+	c.mu.Unlock()
+	return t, nil
+}
+
+// SyncNodes syncs the trees at urls and returns their nodes, along with the
+// error of the first tree which failed to sync.
+func (c *Client) SyncNodes(urls []string) ([]*discover.Node, error) {
+	var (
+		nodes    []*discover.Node
+		firstErr error
+	)
+	for _, url := range urls {
+		t, err := c.SyncTree(url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sync %s: %v", url, err)
+			}
+			continue
+		}
+		nodes = append(nodes, t.Nodes()...)
+	}
+	return nodes, firstErr
+}
+
+func (c *Client) lookupTXT(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	return c.cfg.Resolver.LookupTXT(ctx, name)
+}
+
+func (c *Client) resolveRoot(domain string, key discover.NodeId) (*rootEntry, error) {
+	txts, err := c.lookupTXT(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, rootPrefix) {
+			continue
+		}
+		root, err := parseRoot(txt)
+		if err != nil {
+			return nil, err
+		}
+		if !root.verify(key) {
+			return nil, errInvalidSig
+		}
+		return root, nil
+	}
+	return nil, errNoRoot
+}
+
+func (c *Client) resolveEntry(domain, hash string) (entry, error) {
+	txts, err := c.lookupTXT(hash + "." + domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt)
+		if err == errUnknownEntry {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if subdomain(e) != hash {
+			return nil, errHashMismatch
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("no entry found at %s.%s", hash, domain)
+}
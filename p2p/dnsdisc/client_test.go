@@ -0,0 +1,126 @@
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+)
+
+// mapResolver is a DNS stub serving the TXT records of a map.
+type mapResolver map[string]string
+
+func (r mapResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if txt, exists := r[name]; exists {
+		return []string{txt}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func testNodes(n int) []*discover.Node {
+	nodes := make([]*discover.Node, n)
+	for i := range nodes {
+		id := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+		nodes[i] = discover.NewNode(net.ParseIP(fmt.Sprintf("10.0.%d.%d", i/250, i%250+1)), 9011, 9011, id)
+	}
+	return nodes
+}
+
+func nodeURLs(nodes []*discover.Node) []string {
+	urls := make([]string, len(nodes))
+	for i, n := range nodes {
+		urls[i] = n.String()
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestClient_SyncTree(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	for _, n := range []int{0, 1, 5, 100} {
+		nodes := testNodes(n)
+		tree := MakeTree(1, nodes)
+		url, err := tree.Sign(key, "nodes.example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewClient(Config{Resolver: mapResolver(tree.ToTXT("nodes.example.org"))})
+		got, err := c.SyncTree(url)
+		if err != nil {
+			t.Fatalf("%d nodes: sync err: %v", n, err)
+		}
+		want, have := nodeURLs(nodes), nodeURLs(got.Nodes())
+		if fmt.Sprint(want) != fmt.Sprint(have) {
+			t.Fatalf("%d nodes: want %v, got %v", n, want, have)
+		}
+	}
+}
+
+func TestClient_SyncTreeInvalid(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	tree := MakeTree(2, testNodes(20))
+	url, err := tree.Sign(key, "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := mapResolver(tree.ToTXT("nodes.example.org"))
+
+	// A tree signed by another key is rejected.
+	other := fmt.Sprintf("%s%s@nodes.example.org", urlScheme, discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey))
+	if _, err = NewClient(Config{Resolver: records}).SyncTree(other); err != errInvalidSig {
+		t.Fatalf("want err %v, got %v", errInvalidSig, err)
+	}
+
+	// A node entry swapped for another is rejected.
+	tampered := make(mapResolver)
+	for name, txt := range records {
+		tampered[name] = txt
+	}
+	for name, txt := range tampered {
+		if e, _ := parseEntry(txt); e != nil {
+			if _, ok := e.(*nodeEntry); ok {
+				tampered[name] = (&nodeEntry{node: testNodes(1)[0]}).String()
+				break
+			}
+		}
+	}
+	if _, err = NewClient(Config{Resolver: tampered}).SyncTree(url); err != errHashMismatch {
+		t.Fatalf("want err %v, got %v", errHashMismatch, err)
+	}
+
+	// A tree older than the one synced is rejected.
+	c := NewClient(Config{Resolver: records})
+	if _, err = c.SyncTree(url); err != nil {
+		t.Fatal(err)
+	}
+	old := MakeTree(1, testNodes(3))
+	if _, err = old.Sign(key, "nodes.example.org"); err != nil {
+		t.Fatal(err)
+	}
+	c.cfg.Resolver = mapResolver(old.ToTXT("nodes.example.org"))
+	if _, err = c.SyncTree(url); err == nil {
+		t.Fatal("want err syncing an older tree")
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	key := crypto.MustGenPrvKey()
+	id := discover.PubKey2NodeId(key.PublicKey)
+	domain, got, err := ParseURL(fmt.Sprintf("xfstree://%s@nodes.example.org", id))
+	if err != nil || domain != "nodes.example.org" || got != id {
+		t.Fatalf("unexpected result: %s, %s, %v", domain, got, err)
+	}
+	for _, url := range []string{
+		"xfsnode://127.0.0.1:9011",
+		fmt.Sprintf("xfstree://%s", id),
+		fmt.Sprintf("xfstree://%s@", id),
+		"xfstree://00@nodes.example.org",
+	} {
+		if _, _, err = ParseURL(url); err == nil {
+			t.Fatalf("want err parsing %q", url)
+		}
+	}
+}
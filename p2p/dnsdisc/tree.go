@@ -0,0 +1,266 @@
+package dnsdisc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+)
+
+// A tree is published as TXT records of a domain. The record of the domain
+// itself is the signed root, which names the top entry of a Merkle tree of
+// branches and nodes. Every other entry is the record of the subdomain
+// named by the hash of its content:
+//
+//	xfs-root:v1 e=<hash> seq=<seq> sig=<signature>
+//	xfs-branch:<hash>,<hash>,...
+//	xfs-node:xfsnode://<ip>:<port>?id=<node id>
+const (
+	rootPrefix   = "xfs-root:v1"
+	branchPrefix = "xfs-branch:"
+	nodePrefix   = "xfs-node:"
+	urlScheme    = "xfstree://"
+
+	// maxChildren keeps the branches within one TXT string of 255 bytes.
+	maxChildren = 8
+	hashLength  = 16
+)
+
+var (
+	errUnknownEntry = errors.New("unknown entry type")
+	errNoRoot       = errors.New("no root found")
+	errInvalidSig   = errors.New("invalid root signature")
+	errInvalidURL   = errors.New("invalid tree url")
+	errHashMismatch = errors.New("entry does not match its hash")
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type entry interface {
+	fmt.Stringer
+}
+
+type rootEntry struct {
+	eroot string
+	seq   uint64
+	sig   []byte
+}
+
+type branchEntry struct {
+	children []string
+}
+
+type nodeEntry struct {
+	node *discover.Node
+}
+
+func (e *rootEntry) String() string {
+	return fmt.Sprintf("%s sig=%s", e.content(), base64.RawURLEncoding.EncodeToString(e.sig))
+}
+
+// content returns the root without its signature.
+func (e *rootEntry) content() string {
+	return fmt.Sprintf("%s e=%s seq=%d", rootPrefix, e.eroot, e.seq)
+}
+
+func (e *rootEntry) sigHash() []byte {
+	h := crypto.ByteHash256([]byte(e.content()))
+	return h[:]
+}
+
+// verify reports whether the root is signed by the key of the node id.
+func (e *rootEntry) verify(key discover.NodeId) bool {
+	pub, err := crypto.SigToPub(e.sigHash(), e.sig)
+	if err != nil {
+		return false
+	}
+	id := discover.PubKey2NodeId(*pub)
+	return bytes.Equal(id[:], key[:])
+}
+
+func (e *branchEntry) String() string {
+	return branchPrefix + strings.Join(e.children, ",")
+}
+
+func (e *nodeEntry) String() string {
+	return nodePrefix + e.node.String()
+}
+
+// subdomain returns the hash of the entry, which names its record.
+func subdomain(e entry) string {
+	h := crypto.ByteHash256([]byte(e.String()))
+	return b32.EncodeToString(h[:hashLength])
+}
+
+func parseRoot(text string) (*rootEntry, error) {
+	var (
+		e      rootEntry
+		sig    string
+		fields = strings.Fields(text)
+	)
+	if len(fields) != 4 || fields[0] != rootPrefix {
+		return nil, fmt.Errorf("invalid root %q", text)
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid root %q", text)
+		}
+		switch kv[0] {
+		case "e":
+			e.eroot = kv[1]
+		case "seq":
+			seq, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid root sequence: %v", err)
+			}
+			e.seq = seq
+		case "sig":
+			sig = kv[1]
+		}
+	}
+	if !isHash(e.eroot) {
+		return nil, fmt.Errorf("invalid root hash %q", e.eroot)
+	}
+	var err error
+	if e.sig, err = base64.RawURLEncoding.DecodeString(sig); err != nil || len(e.sig) != 65 {
+		return nil, errInvalidSig
+	}
+	return &e, nil
+}
+
+func parseEntry(text string) (entry, error) {
+	switch {
+	case strings.HasPrefix(text, branchPrefix):
+		children := strings.Split(text[len(branchPrefix):], ",")
+		if len(children) == 1 && children[0] == "" {
+			return &branchEntry{}, nil
+		}
+		for _, child := range children {
+			if !isHash(child) {
+				return nil, fmt.Errorf("invalid branch child %q", child)
+			}
+		}
+		return &branchEntry{children: children}, nil
+	case strings.HasPrefix(text, nodePrefix):
+		node, err := discover.ParseNode(text[len(nodePrefix):])
+		if err != nil {
+			return nil, err
+		}
+		return &nodeEntry{node: node}, nil
+	}
+	return nil, errUnknownEntry
+}
+
+func isHash(s string) bool {
+	b, err := b32.DecodeString(s)
+	return err == nil && len(b) == hashLength
+}
+
+// ParseURL splits a tree url of the form xfstree://<node id>@<domain> into
+// the domain of the tree and the id of the key signing it.
+func ParseURL(url string) (domain string, key discover.NodeId, err error) {
+	if !strings.HasPrefix(url, urlScheme) {
+		return "", key, errInvalidURL
+	}
+	parts := strings.SplitN(url[len(urlScheme):], "@", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", key, errInvalidURL
+	}
+	if key, err = discover.Hex2NodeId(parts[0]); err != nil {
+		return "", key, fmt.Errorf("invalid tree key: %v", err)
+	}
+	return parts[1], key, nil
+}
+
+// Tree is a signed list of nodes.
+type Tree struct {
+	root    *rootEntry
+	entries map[string]entry
+}
+
+// MakeTree builds the tree of the nodes with sequence number seq, it must
+// be signed before it is published.
+func MakeTree(seq uint64, nodes []*discover.Node) *Tree {
+	t := &Tree{entries: make(map[string]entry)}
+	sorted := append([]*discover.Node{}, nodes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].ID[:], sorted[j].ID[:]) < 0
+	})
+	leaves := make([]entry, 0, len(sorted))
+	for _, n := range sorted {
+		leaves = append(leaves, &nodeEntry{node: n})
+	}
+	top := t.build(leaves)
+	eroot := subdomain(top)
+	t.entries[eroot] = top
+	t.root = &rootEntry{eroot: eroot, seq: seq}
+	return t
+}
+
+func (t *Tree) build(entries []entry) entry {
+	if len(entries) == 1 {
+		return entries[0]
+	}
+	if len(entries) <= maxChildren {
+		children := make([]string, len(entries))
+		for i, e := range entries {
+			children[i] = subdomain(e)
+			t.entries[children[i]] = e
+		}
+		return &branchEntry{children: children}
+	}
+	var subtrees []entry
+	for len(entries) > 0 {
+		n := maxChildren
+		if len(entries) < n {
+			n = len(entries)
+		}
+		subtrees = append(subtrees, t.build(entries[:n]))
+		entries = entries[n:]
+	}
+	return t.build(subtrees)
+}
+
+// Sign signs the root of the tree with key and returns the url of the tree
+// published at domain.
+func (t *Tree) Sign(key *ecdsa.PrivateKey, domain string) (string, error) {
+	sig, err := crypto.ECDSASign(t.root.sigHash(), key)
+	if err != nil {
+		return "", err
+	}
+	t.root.sig = sig
+	return fmt.Sprintf("%s%s@%s", urlScheme, discover.PubKey2NodeId(key.PublicKey), domain), nil
+}
+
+// Seq returns the sequence number of the tree.
+func (t *Tree) Seq() uint64 {
+	return t.root.seq
+}
+
+// Nodes returns the nodes of the tree.
+func (t *Tree) Nodes() []*discover.Node {
+	nodes := make([]*discover.Node, 0)
+	for _, e := range t.entries {
+		if n, ok := e.(*nodeEntry); ok {
+			nodes = append(nodes, n.node)
+		}
+	}
+	return nodes
+}
+
+// ToTXT returns the TXT records of the tree published at domain by name.
+func (t *Tree) ToTXT(domain string) map[string]string {
+	records := map[string]string{domain: t.root.String()}
+	for hash, e := range t.entries {
+		records[hash+"."+domain] = e.String()
+	}
+	return records
+}
@@ -3,8 +3,10 @@ package p2p
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"xfsgo/common/ahash"
 	"xfsgo/p2p/discover"
 )
 
@@ -53,112 +55,210 @@ func (m *messageReader) DataReader() io.Reader {
 	return m.data
 }
 
+// maxMessageSize bounds the data of a message, protocols may bound the
+// data of their messages lower by implementing MessageSizer.
+var maxMessageSize uint32 = 8 << 20
+
+var (
+	errMessageTooLarge = errors.New("message too large")
+)
+
+// builtinMessageSize returns the bound of the data of the messages of the
+// p2p layer, 0 for the messages of protocols.
+func builtinMessageSize(mType uint8) uint32 {
+	switch mType {
+	case typeHelloRequest, typeReHelloRequest:
+		return uint32(helloBodyLen)
+	case typePingMsg, typePongMsg:
+		return 64
+	case typeCapsMsg:
+		return capsMessageSize
+	}
+	return 0
+}
+
+func defaultMessageSize(mType uint8) uint32 {
+	if n := builtinMessageSize(mType); n > 0 {
+		return n
+	}
+	return maxMessageSize
+}
+
+func newMessageReader(version, mType uint8, data []byte) *messageReader {
+	raw := make([]byte, headerLen+len(data))
+	raw[0], raw[1] = version, mType
+	binary.LittleEndian.PutUint32(raw[2:headerLen], uint32(len(data)))
+	copy(raw[headerLen:], data)
+	return &messageReader{
+		version: version,
+		mType:   mType,
+		raw:     bytes.NewBuffer(raw),
+		data:    bytes.NewReader(raw[headerLen:]),
+	}
+}
+
 // ReadMessage reads message from other peer and returns MessageReader by header of message.
 // message = version(1byte)+type(1byte)+length(4byte)+data
 func ReadMessage(reader io.Reader) (MessageReader, error) {
-	mBuffer := bytes.NewBuffer(nil)
-
-	//vertion and type
-	for mBuffer.Len() < 6 {
-		b := make([]byte, 1)
-		if _, err := reader.Read(b); err != nil {
-			return nil, err
-		}
-		mBuffer.Write(b)
+	return readMessage(reader, defaultMessageSize)
+}
+
+// readMessage reads a message whose data may not exceed limit of its type,
+// the length is checked before the data is read.
+func readMessage(reader io.Reader, limit func(mType uint8) uint32) (*messageReader, error) {
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
 	}
-	header := mBuffer.Bytes()
 	//length of data in message.4 bytes stored by LittleEndian model.
 	n := binary.LittleEndian.Uint32(header[2:])
-
-	for mBuffer.Len() < 6+int(n) {
-		b := make([]byte, 1)
-
-		if _, err := reader.Read(b); err != nil {
-			return nil, err
-		}
-
-		mBuffer.Write(b)
+	if n > limit(header[1]) {
+		return nil, fmt.Errorf("%w: type=%d, size=%d", errMessageTooLarge, header[1], n)
 	}
-
-	data := mBuffer.Bytes()
-
-	return &messageReader{
-		raw:   mBuffer,
-		mType: data[1],
-		data:  bytes.NewReader(data[6:]),
-	}, nil
+	data := make([]byte, n)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return newMessageReader(header[0], header[1], data), nil
 }
 
+// helloBodyLen is the length of the body of the hello messages:
+// id+receiveId+ephemeral+nonce+compression+signature.
+const helloBodyLen = 2*len(discover.NodeId{}) + ephemeralLen + nonceLen + 1 + signatureLen
+
+// helloRequestMsg opens the handshake of the dialing node. It carries an
+// ephemeral key for ECDH, signed with the node key of id.
 type helloRequestMsg struct {
 	raw       []byte
 	version   uint8
 	id        discover.NodeId
 	receiveId discover.NodeId
+	ephemeral [ephemeralLen]byte
+	nonce     [nonceLen]byte
+	// compression is the set of algorithms the dialing node accepts.
+	compression uint8
+	signature   []byte
+}
+
+func marshalHello(version, mType uint8, id, receiveId discover.NodeId,
+	ephemeral [ephemeralLen]byte, nonce [nonceLen]byte, compression uint8, signature []byte) []byte {
+	val := make([]byte, 4, 4+helloBodyLen)
+	binary.LittleEndian.PutUint32(val, uint32(helloBodyLen))
+	val = append(val, id[:]...)
+	val = append(val, receiveId[:]...)
+	val = append(val, ephemeral[:]...)
+	val = append(val, nonce[:]...)
+	val = append(val, compression)
+	sig := make([]byte, signatureLen)
+	copy(sig, signature)
+	val = append(val, sig...)
+	return append([]byte{version, mType}, val...)
+}
+
+func unmarshalHello(data []byte, mType uint8) (body []byte, ok bool) {
+	if len(data) < headerLen || data[1] != mType {
+		return nil, false
+	}
+	cLen := binary.LittleEndian.Uint32(data[2:headerLen])
+	if cLen != uint32(helloBodyLen) || len(data) < headerLen+helloBodyLen {
+		return nil, false
+	}
+	return data[headerLen : headerLen+helloBodyLen], true
 }
 
 func (m *helloRequestMsg) marshal() []byte {
 	if m.raw != nil {
 		return m.raw
 	}
-	cLen := len(m.id) + len(m.receiveId)
-	val := make([]byte, cLen+4)
-	binary.LittleEndian.PutUint32(val, uint32(cLen))
-	copy(val[4:], append(m.id[:], m.receiveId[:]...))
-	base := []byte{m.version, typeHelloRequest}
-	base = append(base, val...)
-	return base
+	return marshalHello(m.version, typeHelloRequest, m.id, m.receiveId, m.ephemeral, m.nonce, m.compression, m.signature)
+}
+
+// sigHash returns the hash the dialing node signs.
+func (m *helloRequestMsg) sigHash() []byte {
+	buf := []byte{m.version}
+	buf = append(buf, m.id[:]...)
+	buf = append(buf, m.receiveId[:]...)
+	buf = append(buf, m.ephemeral[:]...)
+	buf = append(buf, m.nonce[:]...)
+	buf = append(buf, m.compression)
+	return ahash.SHA256(buf)
 }
 
 func (m *helloRequestMsg) String() string {
 	return fmt.Sprintf(`type=%d, version=%d, id=%s, receiveId=%s`,
-		typeHelloRequest, version1, m.id, m.receiveId)
+		typeHelloRequest, m.version, m.id, m.receiveId)
 }
 
 func (m *helloRequestMsg) unmarshal(data []byte) bool {
-	m.raw = data
-	m.version = data[0]
-	if data[1] != typeHelloRequest {
+	body, ok := unmarshalHello(data, typeHelloRequest)
+	if !ok {
 		return false
 	}
-	cLen := binary.LittleEndian.Uint32(data[2:headerLen])
-	body := data[headerLen : headerLen+cLen]
-	copy(m.id[:], body[:len(m.id)])
-	copy(m.receiveId[:], body[len(m.id):])
+	m.raw = data
+	m.version = data[0]
+	n := copy(m.id[:], body)
+	n += copy(m.receiveId[:], body[n:])
+	n += copy(m.ephemeral[:], body[n:])
+	n += copy(m.nonce[:], body[n:])
+	m.compression = body[n]
+	n++
+	m.signature = append([]byte{}, body[n:]...)
 	return true
 }
 
+// helloReRequestMsg answers a helloRequestMsg with the ephemeral key of the
+// listening node, signed along with the request.
 type helloReRequestMsg struct {
 	raw       []byte
 	version   uint8
 	id        discover.NodeId
 	receiveId discover.NodeId
+	ephemeral [ephemeralLen]byte
+	nonce     [nonceLen]byte
+	// compression is the algorithm chosen of the ones offered.
+	compression uint8
+	signature   []byte
 }
 
 func (m *helloReRequestMsg) marshal() []byte {
 	if m.raw != nil {
 		return m.raw
 	}
-	cLen := len(m.id) + len(m.receiveId)
-	val := make([]byte, cLen+4)
-	binary.LittleEndian.PutUint32(val, uint32(cLen))
-	copy(val[4:], append(m.id[:], m.receiveId[:]...))
-	base := []byte{m.version, typeReHelloRequest}
-	base = append(base, val...)
-	return base
+	return marshalHello(m.version, typeReHelloRequest, m.id, m.receiveId, m.ephemeral, m.nonce, m.compression, m.signature)
+}
+
+// sigHash returns the hash the listening node signs, which covers the
+// request too.
+func (m *helloReRequestMsg) sigHash(request *helloRequestMsg) []byte {
+	buf := []byte{m.version}
+	buf = append(buf, m.id[:]...)
+	buf = append(buf, m.receiveId[:]...)
+	buf = append(buf, m.ephemeral[:]...)
+	buf = append(buf, m.nonce[:]...)
+	buf = append(buf, m.compression)
+	buf = append(buf, request.ephemeral[:]...)
+	buf = append(buf, request.nonce[:]...)
+	return ahash.SHA256(buf)
 }
+
 func (m *helloReRequestMsg) String() string {
 	return fmt.Sprintf(`type=%d, version=%d, id=%s, receiveId=%s`,
-		typeHelloRequest, version1, m.id, m.receiveId)
+		typeReHelloRequest, m.version, m.id, m.receiveId)
 }
+
 func (m *helloReRequestMsg) unmarshal(data []byte) bool {
-	m.raw = data
-	m.version = data[0]
-	if data[1] != typeReHelloRequest {
+	body, ok := unmarshalHello(data, typeReHelloRequest)
+	if !ok {
 		return false
 	}
-	cLen := binary.LittleEndian.Uint32(data[2:headerLen])
-	body := data[headerLen : headerLen+cLen]
-	copy(m.id[:], body[:len(m.id)])
-	copy(m.receiveId[:], body[len(m.id):])
+	m.raw = data
+	m.version = data[0]
+	n := copy(m.id[:], body)
+	n += copy(m.receiveId[:], body[n:])
+	n += copy(m.ephemeral[:], body[n:])
+	n += copy(m.nonce[:], body[n:])
+	m.compression = body[n]
+	n++
+	m.signature = append([]byte{}, body[n:]...)
 	return true
 }
@@ -10,6 +10,8 @@ import (
 	"time"
 )
 
+// Mapper maps ports of the IPv4 gateway to the local node. IPv6 addresses
+// are reachable as they are, their ports are not mapped.
 type Mapper interface {
 	AddMapping(protocol string, extport, intport int, name string, lifetime time.Duration) error
 	DeleteMapping(protocol string, extport, intport int) error
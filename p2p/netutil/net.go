@@ -0,0 +1,100 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Netlist is a list of IP networks.
+type Netlist []net.IPNet
+
+// ParseNetlist parses a list of CIDR masks.
+func ParseNetlist(cidrs []string) (*Netlist, error) {
+	l := make(Netlist, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid netrestrict mask %q: %v", cidr, err)
+		}
+		l = append(l, *n)
+	}
+	return &l, nil
+}
+
+// Contains reports whether the given IP is contained in the list.
+func (l *Netlist) Contains(ip net.IP) bool {
+	if l == nil {
+		return false
+	}
+	for _, n := range *l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Netlist) String() string {
+	masks := make([]string, 0, len(l))
+	for _, n := range l {
+		masks = append(masks, n.String())
+	}
+	return strings.Join(masks, ",")
+}
+
+// Subnet returns the network of ip which is usually run by one operator,
+// /24 for IPv4 and /64 for IPv6.
+func Subnet(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(64, 128))
+}
+
+// IsLAN reports whether ip is a loopback or private address.
+func IsLAN(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// DistinctNetSet counts IPs by their subnet, admitting at most Limit of
+// each one.
+type DistinctNetSet struct {
+	Limit   int
+	members map[string]int
+}
+
+// Add counts ip, it reports false if the subnet of ip is full.
+func (s *DistinctNetSet) Add(ip net.IP) bool {
+	key := Subnet(ip).String()
+	if s.members == nil {
+		s.members = make(map[string]int)
+	}
+	if s.members[key] >= s.Limit {
+		return false
+	}
+	s.members[key]++
+	return true
+}
+
+// Remove uncounts ip.
+func (s *DistinctNetSet) Remove(ip net.IP) {
+	key := Subnet(ip).String()
+	if n := s.members[key]; n <= 1 {
+		delete(s.members, key)
+	} else {
+		s.members[key] = n - 1
+	}
+}
+
+// Len returns the number of IPs counted.
+func (s *DistinctNetSet) Len() (n int) {
+	for _, c := range s.members {
+		n += c
+	}
+	return n
+}
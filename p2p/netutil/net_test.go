@@ -0,0 +1,58 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetlist_contains(t *testing.T) {
+	l, err := ParseNetlist([]string{"10.0.0.0/8", " 192.168.1.0/24", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.77", true},
+		{"192.168.2.1", false},
+		{"8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		if got := l.Contains(net.ParseIP(tt.ip)); got != tt.want {
+			t.Fatalf("%s: want %v, got %v", tt.ip, tt.want, got)
+		}
+	}
+	if _, err = ParseNetlist([]string{"10.0.0.1"}); err == nil {
+		t.Fatalf("want invalid mask rejected")
+	}
+	var nilList *Netlist
+	if nilList.Contains(net.ParseIP("10.1.2.3")) {
+		t.Fatalf("want nil list containing nothing")
+	}
+}
+
+func TestDistinctNetSet(t *testing.T) {
+	set := DistinctNetSet{Limit: 2}
+	for _, ip := range []string{"10.1.2.3", "10.1.2.4", "2001:db8::1", "2001:db8::ffff"} {
+		if !set.Add(net.ParseIP(ip)) {
+			t.Fatalf("want %s added", ip)
+		}
+	}
+	for _, ip := range []string{"10.1.2.200", "::ffff:10.1.2.9", "2001:db8::1:2"} {
+		if set.Add(net.ParseIP(ip)) {
+			t.Fatalf("want %s rejected, its subnet is full", ip)
+		}
+	}
+	if !set.Add(net.ParseIP("10.1.3.1")) || !set.Add(net.ParseIP("2001:db8:0:1::1")) {
+		t.Fatalf("want other subnets added")
+	}
+	set.Remove(net.ParseIP("10.1.2.3"))
+	if !set.Add(net.ParseIP("10.1.2.5")) {
+		t.Fatalf("want room after removal")
+	}
+	if n := set.Len(); n != 6 {
+		t.Fatalf("want 6 IPs counted, got %d", n)
+	}
+}
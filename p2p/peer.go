@@ -1,10 +1,10 @@
 package p2p
 
 import (
-	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"net"
+	"sync"
 	"time"
 	"xfsgo/log"
 	"xfsgo/p2p/discover"
@@ -35,12 +35,71 @@ type peer struct {
 	rw       net.Conn
 	close    chan struct{}
 	lastTime int64
-	readBuf  bytes.Buffer
-	ps       []Protocol
 	quit     chan struct{}
-	psCh     chan MessageReader
 	encoder  encoder
 	logger   log.Logger
+	// rws are the protocols shared with the peer, in their message spaces.
+	rws []*protoRW
+	// connectedAt is the time the peer joined, traffic counts its messages by type.
+	connectedAt time.Time
+	trafficLock sync.Mutex
+	traffic     map[uint8]*MessageStats
+}
+
+// MessageStats counts the messages of one type exchanged with a peer and
+// the bytes of their data.
+type MessageStats struct {
+	BytesIn  uint64
+	BytesOut uint64
+	MsgsIn   uint64
+	MsgsOut  uint64
+}
+
+// PeerInfo describes a connected peer.
+type PeerInfo struct {
+	ID          discover.NodeId
+	RemoteAddr  string
+	Inbound     bool
+	Outbound    bool
+	Static      bool
+	Dynamic     bool
+	Version     uint8
+	Protocols   []string
+	ConnectedAt time.Time
+	// Traffic counts the messages by protocol name and by type in the
+	// protocol, the ones of the p2p layer under "p2p".
+	Traffic map[string]map[uint8]MessageStats
+}
+
+// protoPeer is the peer as seen by a protocol, which reads and writes the
+// messages of its own space.
+type protoPeer struct {
+	*peer
+	rw *protoRW
+}
+
+func (p *protoPeer) GetProtocolMsgCh() (chan MessageReader, error) {
+	select {
+	case _ = <-p.close:
+		return nil, errors.New("peer closed")
+	default:
+	}
+	return p.rw.msgCh, nil
+}
+
+func (p *protoPeer) WriteMessage(mType uint8, bs []byte) error {
+	if mType >= p.rw.Length() {
+		return fmt.Errorf("message type %d out of protocol %s", mType, p.rw.Name())
+	}
+	return p.peer.WriteMessage(p.rw.offset+mType, bs)
+}
+
+func (p *protoPeer) WriteMessageObj(mType uint8, obj interface{}) error {
+	bs, err := p.encoder.Encode(obj)
+	if err != nil {
+		return err
+	}
+	return p.WriteMessage(mType, bs)
 }
 
 // create peer [Peer to peer connection session,Network protocol]
@@ -50,15 +109,83 @@ func newPeer(conn *peerConn, ps []Protocol, en encoder) Peer {
 		id:      conn.id,
 		rw:      conn.rw,
 		logger:  conn.logger,
-		ps:      ps,
 		close:   make(chan struct{}),
-		psCh:    make(chan MessageReader),
 		encoder: en,
+		traffic: make(map[uint8]*MessageStats),
 	}
+	// The server refuses the peers which offer too many protocols, no
+	// protocol is run with them otherwise.
+	p.rws, _ = matchProtocols(ps, conn.remoteCaps)
 	now := time.Now()
 	p.lastTime = now.Unix()
+	p.connectedAt = now
 	return p
 }
+
+// countTraffic records a message of mType with n bytes of data, received
+// if in is true, sent otherwise.
+func (p *peer) countTraffic(mType uint8, n int, in bool) {
+	p.trafficLock.Lock()
+	defer p.trafficLock.Unlock()
+	stats, exists := p.traffic[mType]
+	if !exists {
+		stats = new(MessageStats)
+		p.traffic[mType] = stats
+	}
+	if in {
+		stats.MsgsIn++
+		stats.BytesIn += uint64(n)
+	} else {
+		stats.MsgsOut++
+		stats.BytesOut += uint64(n)
+	}
+}
+
+func (p *peer) info() *PeerInfo {
+	info := &PeerInfo{
+		ID:          p.id,
+		Inbound:     p.Is(flagInbound),
+		Outbound:    p.Is(flagOutbound),
+		Static:      p.Is(flagStatic),
+		Dynamic:     p.Is(flagDynamic),
+		Version:     p.conn.version,
+		ConnectedAt: p.connectedAt,
+		Traffic:     make(map[string]map[uint8]MessageStats),
+	}
+	for _, rw := range p.rws {
+		info.Protocols = append(info.Protocols, Cap{Name: rw.Name(), Version: rw.Version()}.String())
+	}
+	if addr := p.rw.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	p.trafficLock.Lock()
+	defer p.trafficLock.Unlock()
+	for mType, stats := range p.traffic {
+		name, code := baseProtocolName, mType
+		if mType >= baseProtocolLength {
+			// Messages of no protocol shared were dropped.
+			rw := findProtocol(p.rws, mType)
+			if rw == nil {
+				continue
+			}
+			name, code = rw.Name(), mType-rw.offset
+		}
+		if info.Traffic[name] == nil {
+			info.Traffic[name] = make(map[uint8]MessageStats)
+		}
+		info.Traffic[name][code] = *stats
+	}
+	return info
+}
+
+// writeMessage sends a message to the peer, counting its traffic.
+func (p *peer) writeMessage(mType uint8, data []byte) error {
+	if err := p.conn.writeMessage(mType, data); err != nil {
+		return err
+	}
+	p.countTraffic(mType, len(data), false)
+	return nil
+}
 func (p *peer) RemoteNode() *discover.Node {
 	addr := p.RemoteAddr()
 	return discover.NewNode(addr.IP, uint16(addr.Port), uint16(addr.Port), p.id)
@@ -83,8 +210,11 @@ func (p *peer) readLoop() {
 			return
 		default:
 		}
-		msg, err := ReadMessage(p.rw)
+		msg, err := p.conn.readMessageLimit(p.maxMessageSize)
 		if err != nil {
+			if isProtocolViolation(err) {
+				p.conn.penalize(err)
+			}
 			p.Close()
 			return
 		}
@@ -97,11 +227,12 @@ func (p *peer) handle(msg MessageReader) {
 	if err != nil {
 		return
 	}
+	p.countTraffic(msg.Type(), len(data), true)
 	//p.logger.Infof("peer handle message type %d, data: %s", msg.Type(), string(data))
 	switch msg.Type() {
 	case typePingMsg:
 		//p.logger.Debugln("receive heartbeat request")
-		err = p.conn.writeMessage(typePongMsg, []byte("hello"))
+		err = p.writeMessage(typePongMsg, []byte("hello"))
 		if err != nil {
 			p.Close()
 		}
@@ -110,24 +241,53 @@ func (p *peer) handle(msg MessageReader) {
 		now := time.Now()
 		p.lastTime = now.Unix()
 	default:
-		bodyBs := msg.RawReader()
-		cpy := &messageReader{
-			raw:   bodyBs,
-			mType: msg.Type(),
-			data:  bytes.NewReader(data),
+		// Messages of no protocol shared are dropped, the others are
+		// delivered with the type of their protocol.
+		rw := findProtocol(p.rws, msg.Type())
+		if rw == nil {
+			return
+		}
+		cpy := newMessageReader(p.conn.version, msg.Type()-rw.offset, data)
+		select {
+		case rw.msgCh <- cpy:
+		case <-p.close:
+			return
 		}
-		p.psCh <- cpy
-		_, _ = io.Copy(&p.readBuf, bodyBs)
 	}
 }
 
-func (p *peer) GetProtocolMsgCh() (chan MessageReader, error) {
-	select {
-	case _ = <-p.close:
-		return nil, errors.New("peer closed")
-	default:
+// maxMessageSize returns the bound of the data of messages of mType, set by
+// the protocol handling them if it implements MessageSizer.
+func (p *peer) maxMessageSize(mType uint8) uint32 {
+	if n := builtinMessageSize(mType); n > 0 {
+		return n
 	}
-	return p.psCh, nil
+	if rw := findProtocol(p.rws, mType); rw != nil {
+		return protocolMessageSize(rw.Protocol, mType-rw.offset)
+	}
+	return maxMessageSize
+}
+
+func protocolMessageSize(item Protocol, mType uint8) uint32 {
+	if sizer, ok := item.(MessageSizer); ok {
+		if n := sizer.MaxMessageSize(mType); n > 0 && n < maxMessageSize {
+			return n
+		}
+	}
+	return maxMessageSize
+}
+
+// protocolPeer returns the peer as seen by the protocol of rw.
+func (p *peer) protocolPeer(rw *protoRW) Peer {
+	return &protoPeer{peer: p, rw: rw}
+}
+
+var errNoProtocol = errors.New("messages of no protocol")
+
+// GetProtocolMsgCh fails on the peer itself, the protocols read their
+// messages of the peer passed to Run.
+func (p *peer) GetProtocolMsgCh() (chan MessageReader, error) {
+	return nil, errNoProtocol
 }
 
 func (p *peer) WriteMessage(mType uint8, bs []byte) error {
@@ -136,7 +296,7 @@ func (p *peer) WriteMessage(mType uint8, bs []byte) error {
 		return errors.New("peer closed")
 	default:
 	}
-	return p.conn.writeMessage(mType, bs)
+	return p.writeMessage(mType, bs)
 }
 
 func (p *peer) WriteMessageObj(mType uint8, obj interface{}) error {
@@ -153,7 +313,7 @@ func (p *peer) pingLoop() {
 	for {
 		select {
 		case <-ping.C:
-			if err := p.conn.writeMessage(typePingMsg, []byte("hello")); err != nil {
+			if err := p.writeMessage(typePingMsg, []byte("hello")); err != nil {
 				p.Close()
 				return
 			}
@@ -187,13 +347,13 @@ func (p *peer) Run() {
 	go p.readLoop()
 	go p.pingLoop()
 	runProtocol := func() {
-		for _, item := range p.ps {
-			go func(p *peer, item Protocol) {
+		for _, rw := range p.rws {
+			go func(p Peer, item Protocol) {
 				err := item.Run(p)
 				if err != nil {
 					p.Close()
 				}
-			}(p, item)
+			}(p.protocolPeer(rw), rw.Protocol)
 		}
 	}
 	runProtocol()
@@ -0,0 +1,127 @@
+package p2p
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type testProtocol struct {
+	name    string
+	version uint8
+	length  uint8
+}
+
+func (p *testProtocol) Name() string   { return p.name }
+func (p *testProtocol) Version() uint8 { return p.version }
+func (p *testProtocol) Length() uint8  { return p.length }
+func (*testProtocol) Run(Peer) error   { return nil }
+
+func TestMatchProtocols(t *testing.T) {
+	full := &testProtocol{name: "full", version: 1, length: 20}
+	light := &testProtocol{name: "light", version: 1, length: 8}
+	light2 := &testProtocol{name: "light", version: 2, length: 10}
+	snap := &testProtocol{name: "snap", version: 1, length: 4}
+	caps, err := decodeCaps(encodeCaps([]Cap{{"snap", 2}, {"light", 2}, {"light", 1}, {"full", 1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rws, err := matchProtocols([]Protocol{snap, light, light2, full}, caps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spaces follow the names, of the latest version shared.
+	want := []struct {
+		p      Protocol
+		offset uint8
+	}{{full, baseProtocolLength}, {light2, baseProtocolLength + 20}}
+	if len(rws) != len(want) {
+		t.Fatalf("want %d protocols matched, got %d", len(want), len(rws))
+	}
+	for i, w := range want {
+		if rws[i].Protocol != w.p || rws[i].offset != w.offset {
+			t.Fatalf("protocol %d: want %s at %d, got %s/%d at %d", i, w.p.Name(), w.offset, rws[i].Name(), rws[i].Version(), rws[i].offset)
+		}
+	}
+	if findProtocol(rws, 35) != rws[0] || findProtocol(rws, 36) != rws[1] || findProtocol(rws, 46) != nil {
+		t.Fatalf("message types mapped to the wrong protocol")
+	}
+	huge := []Protocol{&testProtocol{name: "a", version: 1, length: 200}, &testProtocol{name: "b", version: 1, length: 100}}
+	if _, err = matchProtocols(huge, protocolCaps(huge)); err != errTooManyProtocols {
+		t.Fatalf("want err %v, got %v", errTooManyProtocols, err)
+	}
+	if _, err = decodeCaps([]byte{1, 5, 'f'}); err != errInvalidCaps {
+		t.Fatalf("want err %v, got %v", errInvalidCaps, err)
+	}
+}
+
+func TestPeer_protocolSpaces(t *testing.T) {
+	full := &testProtocol{name: "full", version: 1, length: 20}
+	light := &testProtocol{name: "light", version: 1, length: 8}
+	conn := &peerConn{remoteCaps: protocolCaps([]Protocol{full, light})}
+	p := newPeer(conn, []Protocol{full, light}, nil).(*peer)
+	fullPeer, lightPeer := p.protocolPeer(p.rws[0]), p.protocolPeer(p.rws[1])
+	fullCh, err := fullPeer.GetProtocolMsgCh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lightCh, err := lightPeer.GetProtocolMsgCh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fullCh == lightCh {
+		t.Fatalf("want a channel of its own for each protocol")
+	}
+	// Type 0 of the light protocol follows the space of the full one.
+	go p.handle(&messageReader{mType: baseProtocolLength + 20, raw: bytes.NewReader(nil), data: bytes.NewReader([]byte("light"))})
+	select {
+	case msg := <-lightCh:
+		if data, _ := msg.ReadAll(); msg.Type() != 0 || string(data) != "light" {
+			t.Fatalf("unexpected message: type=%d, data=%q", msg.Type(), data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("message not delivered")
+	}
+	if err = lightPeer.WriteMessage(8, nil); err == nil {
+		t.Fatalf("want messages out of the protocol space refused")
+	}
+	// Messages of no protocol shared are dropped.
+	p = newPeer(&peerConn{remoteCaps: protocolCaps([]Protocol{light})}, []Protocol{full, light}, nil).(*peer)
+	if len(p.rws) != 1 || findProtocol(p.rws, baseProtocolLength+5) != p.rws[0] || findProtocol(p.rws, baseProtocolLength+8) != nil {
+		t.Fatalf("want the light protocol only")
+	}
+}
+
+func TestPeer_info(t *testing.T) {
+	client, server := newTestPeerConns(t)
+	errc := make(chan error, 1)
+	go func() { errc <- server.serverHandshake() }()
+	if err := client.clientHandshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	full := &testProtocol{name: "full", version: 1, length: 32}
+	p := newPeer(client, nil, nil).(*peer)
+	p.rws, _ = matchProtocols([]Protocol{full}, protocolCaps([]Protocol{full}))
+	go func() { errc <- p.WriteMessage(40, []byte("abc")) }()
+	if _, err := server.readMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	go p.handle(&messageReader{mType: 40, raw: bytes.NewReader(nil), data: bytes.NewReader([]byte("hello"))})
+	<-p.rws[0].msgCh
+
+	info := p.info()
+	if info.ID != client.id || !info.Outbound || info.Inbound || info.Version != version1 {
+		t.Fatalf("unexpected peer info: %+v", info)
+	}
+	want := MessageStats{BytesIn: 5, BytesOut: 3, MsgsIn: 1, MsgsOut: 1}
+	// Type 40 is type 24 of the protocol following the p2p layer.
+	if got := info.Traffic["full"][40-baseProtocolLength]; got != want {
+		t.Fatalf("want traffic %+v, got %+v", want, got)
+	}
+}
@@ -1,12 +1,17 @@
 package p2p
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net"
+	"time"
+	"xfsgo/crypto"
 	"xfsgo/log"
 	"xfsgo/p2p/discover"
 )
@@ -27,12 +32,25 @@ type peerConn struct {
 	version         uint8
 	handshakeStatus int
 	flag            int
+	// compression lists the algorithms accepted, codec is the one agreed
+	// on in the handshake.
+	compression []uint8
+	codec       uint8
+	reader      *bufio.Reader
+	// timeout bounds the handshake, no limit if zero.
+	timeout time.Duration
+	// caps are the protocols offered, remoteCaps the ones of the peer.
+	caps       []Cap
+	remoteCaps []Cap
 }
 
 func (c *peerConn) serve() {
 	// Get the address and port number of the client
 	fromAddr := c.rw.RemoteAddr()
 	inbound := c.flag&flagInbound != 0
+	if c.timeout > 0 {
+		_ = c.rw.SetDeadline(time.Now().Add(c.timeout))
+	}
 	if inbound {
 		if err := c.serverHandshake(); err != nil {
 			//c.logger.Errorf("handshake error server from %s: %v", fromAddr, err)
@@ -46,24 +64,58 @@ func (c *peerConn) serve() {
 			return
 		}
 	}
+	if err := c.exchangeCaps(); err != nil {
+		c.close()
+		return
+	}
+	if c.timeout > 0 {
+		_ = c.rw.SetDeadline(time.Time{})
+	}
 	c.logger.Debugf("Successfully handshake by p2p transport: addr=%s, id=%s", fromAddr, c.id)
 	c.server.addpeer <- c
 }
 
-//Client handshake sending method
+// newHelloKeys returns the ephemeral key and the nonce of a handshake.
+func newHelloKeys() (*ecdsa.PrivateKey, [nonceLen]byte, error) {
+	var nonce [nonceLen]byte
+	key, err := crypto.GenPrvKey()
+	if err != nil {
+		return nil, nonce, err
+	}
+	_, err = rand.Read(nonce[:])
+	return key, nonce, err
+}
+
+// Client handshake sending method
+//
+// The dialing node sends its ephemeral key signed with its node key, and the
+// listening node answers likewise. Each side checks the signature of the
+// other was made by the key of the node id it claims, then the traffic is
+// encrypted with keys derived from the ECDH secret of the ephemeral keys.
 func (c *peerConn) clientHandshake() error {
 
 	// Whether the handshake status is based on handshake
 	if c.handshakeCompiled() {
 		return nil
 	}
+	ephemeral, nonce, err := newHelloKeys()
+	if err != nil {
+		return err
+	}
 	request := &helloRequestMsg{
 		version:   c.version,
 		id:        c.self,
 		receiveId: c.id,
+		ephemeral: encodeEphemeral(ephemeral),
+		nonce:     nonce,
+		// offer the algorithms accepted, the listening node picks one.
+		compression: compressionMask(c.compression),
+	}
+	if request.signature, err = crypto.ECDSASign(request.sigHash(), c.key); err != nil {
+		return err
 	}
 	//c.logger.Debugf("send hello request version: %d, id: %s, to receiveId: %s", c.version,c.self, c.id)
-	_, err := c.rw.Write(request.marshal())
+	_, err = c.rw.Write(request.marshal())
 	if err != nil {
 		return err
 	}
@@ -85,6 +137,24 @@ func (c *peerConn) clientHandshake() error {
 		//	gotId[:], wantId[:])
 		return errHandshakeFailed
 	}
+	// The node answering must be the one dialed.
+	if hello.id != c.id {
+		return errHandshakeFailed
+	}
+	if err = verifyNodeSignature(hello.id, hello.sigHash(request), hello.signature); err != nil {
+		return err
+	}
+	if !offeredCompression(request.compression, hello.compression) {
+		return errHandshakeFailed
+	}
+	secret, err := ecdhSecret(ephemeral, hello.ephemeral)
+	if err != nil {
+		return err
+	}
+	if c.rw, err = newSecureConn(c.rw, secret, request.nonce[:], hello.nonce[:], true); err != nil {
+		return err
+	}
+	c.setupCodec(hello.compression)
 	c.handshakeStatus = 1
 	return nil
 }
@@ -110,17 +180,39 @@ func (c *peerConn) serverHandshake() error {
 	if !bytes.Equal(gotId[:], wantId[:]) {
 		return errHandshakeFailed
 	}
+	if err = verifyNodeSignature(hello.id, hello.sigHash(), hello.signature); err != nil {
+		return err
+	}
 	c.id = hello.id
 
+	ephemeral, nonce, err := newHelloKeys()
+	if err != nil {
+		return err
+	}
 	reply := &helloReRequestMsg{
-		id:        c.self,
-		receiveId: hello.id,
-		version:   c.version,
+		id:          c.self,
+		receiveId:   hello.id,
+		version:     c.version,
+		ephemeral:   encodeEphemeral(ephemeral),
+		nonce:       nonce,
+		compression: chooseCompression(c.compression, hello.compression),
+	}
+	if reply.signature, err = crypto.ECDSASign(reply.sigHash(hello), c.key); err != nil {
+		return err
+	}
+	secret, err := ecdhSecret(ephemeral, hello.ephemeral)
+	if err != nil {
+		return err
 	}
 	//c.logger.Debugf("send handshake reply to nodeId %s", reply.receiveId)
 	if _, err = c.rw.Write(reply.marshal()); err != nil {
 		return err
 	}
+	if c.rw, err = newSecureConn(c.rw, secret, hello.nonce[:], reply.nonce[:], false); err != nil {
+		return err
+	}
+	c.setupCodec(reply.compression)
+	c.handshakeStatus = 1
 	return nil
 }
 
@@ -131,7 +223,7 @@ func (c *peerConn) readHelloReRequestMsg() (*helloReRequestMsg, error) {
 		return nil, err
 	}
 	if msg.Type() != typeReHelloRequest {
-		return nil, err
+		return nil, errHandshakeFailed
 	}
 	nMsg := new(helloReRequestMsg)
 	raw, _ := ioutil.ReadAll(msg.RawReader())
@@ -148,7 +240,7 @@ func (c *peerConn) readHelloRequestMsg() (*helloRequestMsg, error) {
 		return nil, err
 	}
 	if msg.Type() != typeHelloRequest {
-		return nil, err
+		return nil, errHandshakeFailed
 	}
 	nMsg := new(helloRequestMsg)
 	raw, _ := ioutil.ReadAll(msg.RawReader())
@@ -158,8 +250,49 @@ func (c *peerConn) readHelloRequestMsg() (*helloRequestMsg, error) {
 	return nMsg, nil
 }
 
+// setupCodec sets the compression agreed on, and buffers the reads of
+// the established connection.
+func (c *peerConn) setupCodec(codec uint8) {
+	c.codec = codec
+	c.reader = bufio.NewReader(c.rw)
+}
+
+// exchangeCaps sends the protocols offered to the peer and reads the ones
+// it offers, once the connection is encrypted. The dialing node sends
+// first.
+func (c *peerConn) exchangeCaps() error {
+	send := func() error {
+		return c.writeMessage(typeCapsMsg, encodeCaps(c.caps))
+	}
+	inbound := c.flag&flagInbound != 0
+	if !inbound {
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	msg, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	if msg.Type() != typeCapsMsg {
+		return errHandshakeFailed
+	}
+	data, err := msg.ReadAll()
+	if err != nil {
+		return err
+	}
+	if c.remoteCaps, err = decodeCaps(data); err != nil {
+		return err
+	}
+	if inbound {
+		return send()
+	}
+	return nil
+}
+
 // Write peer session messages
 func (c *peerConn) writeMessage(mType uint8, data []byte) error {
+	data = compressData(c.codec, data)
 	cLen := len(data)
 	val := make([]byte, cLen+4)
 	//logrus.Debugf("Write raw message type=%d, dataLen: %d", mType, len(data))
@@ -175,7 +308,50 @@ func (c *peerConn) writeMessage(mType uint8, data []byte) error {
 }
 
 func (c *peerConn) readMessage() (MessageReader, error) {
-	return ReadMessage(c.rw)
+	return c.readMessageLimit(defaultMessageSize)
+}
+
+// readMessageLimit reads a message whose data, once decompressed, may not
+// exceed limit of its type.
+func (c *peerConn) readMessageLimit(limit func(mType uint8) uint32) (MessageReader, error) {
+	var reader io.Reader = c.rw
+	if c.reader != nil {
+		reader = c.reader
+	}
+	if c.codec == CompressNone {
+		return readMessage(reader, limit)
+	}
+	msg, err := readMessage(reader, func(mType uint8) uint32 {
+		return maxCompressedSize(limit(mType))
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := msg.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decompressData(c.codec, data, limit(msg.mType)); err != nil {
+		return nil, err
+	}
+	return newMessageReader(msg.version, msg.mType, data), nil
+}
+
+// isProtocolViolation reports whether err is caused by a peer sending a
+// message it should not.
+func isProtocolViolation(err error) bool {
+	return errors.Is(err, errMessageTooLarge) ||
+		errors.Is(err, errFrameTooLarge) ||
+		errors.Is(err, errInvalidFrame) ||
+		errors.Is(err, errInvalidCompressed)
+}
+
+// penalize bans the peer for breaking the protocol.
+func (c *peerConn) penalize(err error) {
+	c.logger.Warnf("Penalize peer for breaking the protocol: id=%s, err=%v", c.id, err)
+	if c.server != nil {
+		c.server.AdjustScore(c.id, scoreProtocolViolation)
+	}
 }
 
 func (c *peerConn) close() {
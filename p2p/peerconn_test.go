@@ -0,0 +1,263 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+)
+
+func newTestPeerConns(t *testing.T) (*peerConn, *peerConn) {
+	clientKey, serverKey := crypto.MustGenPrvKey(), crypto.MustGenPrvKey()
+	crw, srw := net.Pipe()
+	client := &peerConn{
+		self:    discover.PubKey2NodeId(clientKey.PublicKey),
+		id:      discover.PubKey2NodeId(serverKey.PublicKey),
+		key:     clientKey,
+		rw:      crw,
+		version: version1,
+		flag:    flagOutbound,
+	}
+	server := &peerConn{
+		self:    discover.PubKey2NodeId(serverKey.PublicKey),
+		key:     serverKey,
+		rw:      srw,
+		version: version1,
+		flag:    flagInbound,
+	}
+	return client, server
+}
+
+func TestPeerConn_handshake(t *testing.T) {
+	client, server := newTestPeerConns(t)
+	errc := make(chan error, 1)
+	go func() { errc <- server.serverHandshake() }()
+	if err := client.clientHandshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if server.id != client.self {
+		t.Fatalf("want remote id %s, got %s", client.self, server.id)
+	}
+	if _, ok := client.rw.(*secureConn); !ok {
+		t.Fatalf("want an encrypted connection")
+	}
+	go func() { errc <- client.writeMessage(typePingMsg, []byte("hello")) }()
+	msg, err := server.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := msg.ReadAll(); msg.Type() != typePingMsg || string(data) != "hello" {
+		t.Fatalf("unexpected message: type=%d, data=%q", msg.Type(), data)
+	}
+	if err = <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeerConn_handshakeImpersonation(t *testing.T) {
+	client, server := newTestPeerConns(t)
+	// The client claims the id of another node it has no key of.
+	client.self = discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	errc := make(chan error, 1)
+	go func() {
+		err := server.serverHandshake()
+		server.close()
+		errc <- err
+	}()
+	if err := client.clientHandshake(); err == nil {
+		t.Fatalf("want client handshake failed")
+	}
+	if err := <-errc; err != errInvalidSignature {
+		t.Fatalf("want err %v, got %v", errInvalidSignature, err)
+	}
+
+	// A node answering for another one is rejected by the dialer.
+	client, server = newTestPeerConns(t)
+	server.self = discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	client.id = server.self
+	go func() { errc <- server.serverHandshake() }()
+	if err := client.clientHandshake(); err != errInvalidSignature {
+		t.Fatalf("want err %v, got %v", errInvalidSignature, err)
+	}
+}
+
+func TestPeerConn_compression(t *testing.T) {
+	tests := []struct {
+		client, server []uint8
+		want           uint8
+	}{
+		{[]uint8{CompressZstd, CompressSnappy}, []uint8{CompressSnappy, CompressZstd}, CompressSnappy},
+		{[]uint8{CompressZstd}, []uint8{CompressSnappy, CompressZstd}, CompressZstd},
+		{[]uint8{CompressZstd}, []uint8{CompressSnappy}, CompressNone},
+		{nil, []uint8{CompressSnappy}, CompressNone},
+	}
+	for i, tt := range tests {
+		client, server := newTestPeerConns(t)
+		client.compression, server.compression = tt.client, tt.server
+		errc := make(chan error, 1)
+		go func() { errc <- server.serverHandshake() }()
+		if err := client.clientHandshake(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if client.codec != tt.want || server.codec != tt.want {
+			t.Fatalf("test %d: want codec %d, got client=%d, server=%d", i, tt.want, client.codec, server.codec)
+		}
+		data := bytes.Repeat([]byte("hello"), 1000)
+		go func() { errc <- client.writeMessage(typePongMsg+1, data) }()
+		msg, err := server.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := msg.ReadAll(); !bytes.Equal(got, data) {
+			t.Fatalf("test %d: unexpected data of length %d", i, len(got))
+		}
+		if err = <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadMessage_limit(t *testing.T) {
+	// The claimed length is checked before the data is read.
+	header := []byte{version1, typePingMsg, 0xff, 0xff, 0xff, 0xff}
+	if _, err := ReadMessage(bytes.NewReader(header)); !errors.Is(err, errMessageTooLarge) || !isProtocolViolation(err) {
+		t.Fatalf("want err %v, got %v", errMessageTooLarge, err)
+	}
+	limit := func(uint8) uint32 { return 100 }
+	msg := newMessageReader(version1, 10, make([]byte, 101))
+	raw, _ := ioutil.ReadAll(msg.RawReader())
+	if _, err := readMessage(bytes.NewReader(raw), limit); !errors.Is(err, errMessageTooLarge) {
+		t.Fatalf("want err %v, got %v", errMessageTooLarge, err)
+	}
+	// Data under the limit compressed may not exceed it decompressed.
+	for _, algo := range []uint8{CompressSnappy, CompressZstd} {
+		compressed := compressData(algo, make([]byte, 1000))
+		if _, err := decompressData(algo, compressed, 100); !errors.Is(err, errMessageTooLarge) {
+			t.Fatalf("algo %d: want err %v, got %v", algo, errMessageTooLarge, err)
+		}
+		if _, err := decompressData(algo, []byte("garbage"), 100); !isProtocolViolation(err) {
+			t.Fatalf("algo %d: want invalid data rejected, got %v", algo, err)
+		}
+	}
+}
+
+func TestSecureConn_tampered(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, 32)
+	nonce := bytes.Repeat([]byte{2}, nonceLen)
+	crw, srw := net.Pipe()
+	sender, err := newSecureConn(crw, secret, nonce, nonce, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := newSecureConn(srw, secret, nonce, nonce, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = sender.Write([]byte("first"))
+		// Flip a bit of the ciphertext of the next frame.
+		tamper := &tamperConn{Conn: crw}
+		sender.Conn = tamper
+		_, _ = sender.Write([]byte("second"))
+	}()
+	buf := make([]byte, 5)
+	if _, err = receiver.Read(buf); err != nil || string(buf) != "first" {
+		t.Fatalf("unexpected first frame: %q, %v", buf, err)
+	}
+	if _, err = ioutil.ReadAll(receiver); err == nil {
+		t.Fatalf("want tampered frame rejected")
+	}
+}
+
+type tamperConn struct {
+	net.Conn
+}
+
+func (c *tamperConn) Write(b []byte) (int, error) {
+	b = append([]byte{}, b...)
+	b[len(b)-1] ^= 1
+	return c.Conn.Write(b)
+}
+
+func TestDial(t *testing.T) {
+	serverKey := crypto.MustGenPrvKey()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	errc := make(chan error, 1)
+	go func() {
+		rw, err := ln.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		server := &peerConn{
+			self:    discover.PubKey2NodeId(serverKey.PublicKey),
+			key:     serverKey,
+			rw:      rw,
+			version: version2,
+			flag:    flagInbound,
+		}
+		if err = server.serverHandshake(); err != nil {
+			errc <- err
+			return
+		}
+		server.caps = []Cap{{"full", 1}, {"light", 1}}
+		if err = server.exchangeCaps(); err != nil {
+			errc <- err
+			return
+		}
+		errc <- server.writeMessage(baseProtocolLength+1, []byte("hello"))
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	node := discover.NewNode(addr.IP, uint16(addr.Port), uint16(addr.Port), discover.PubKey2NodeId(serverKey.PublicKey))
+	light := &testProtocol{name: "light", version: 1, length: 8}
+	conn, err := Dial(crypto.MustGenPrvKey(), node, time.Second, []Protocol{light})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := msg.ReadAll(); msg.Type() != baseProtocolLength+1 || string(data) != "hello" {
+		t.Fatalf("unexpected message: type=%d, data=%q", msg.Type(), data)
+	}
+	if name, code, ok := conn.Protocol(msg.Type()); !ok || name != "light" || code != 1 {
+		t.Fatalf("want message 1 of light, got %d of %q", code, name)
+	}
+	if err = <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// A node answering for another id is rejected.
+	go func() {
+		if rw, err := ln.Accept(); err == nil {
+			server := &peerConn{
+				self:    discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey),
+				key:     serverKey,
+				rw:      rw,
+				version: version2,
+				flag:    flagInbound,
+			}
+			_ = server.serverHandshake()
+			_ = rw.Close()
+		}
+	}()
+	if _, err = Dial(crypto.MustGenPrvKey(), node, time.Second, nil); err == nil {
+		t.Fatal("want dial of impersonated node failed")
+	}
+}
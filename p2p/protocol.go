@@ -1,5 +1,146 @@
 package p2p
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Protocol is run with the peers which bind a protocol of the same name
+// and version, as agreed on in the handshake.
 type Protocol interface {
+	Name() string
+	Version() uint8
+	// Length returns the number of message types of the protocol. They are
+	// numbered from 0, the peer maps them to a space of the connection of
+	// their own.
+	Length() uint8
 	Run(p Peer) error
 }
+
+// MessageSizer is implemented by the protocols which bound the size of
+// their messages below the default. Larger messages disconnect the peer.
+type MessageSizer interface {
+	// MaxMessageSize returns the largest data of messages of mType, 0 for the default.
+	MaxMessageSize(mType uint8) uint32
+}
+
+// Cap is a protocol offered in the handshake.
+type Cap struct {
+	Name    string
+	Version uint8
+}
+
+func (c Cap) String() string {
+	return fmt.Sprintf("%s/%d", c.Name, c.Version)
+}
+
+// baseProtocolLength is the number of message types of the p2p layer, the
+// spaces of protocols follow.
+const baseProtocolLength = 16
+
+// baseProtocolName names the messages of the p2p layer in the traffic of a peer.
+const baseProtocolName = "p2p"
+
+// maxCaps bounds the protocols offered in the handshake.
+const maxCaps = 32
+
+var errTooManyProtocols = errors.New("message spaces of the protocols exceed the message types")
+
+func protocolCaps(ps []Protocol) []Cap {
+	caps := make([]Cap, 0, len(ps))
+	for _, p := range ps {
+		caps = append(caps, Cap{Name: p.Name(), Version: p.Version()})
+	}
+	return caps
+}
+
+// protoRW is a protocol run with a peer, at offset in the message types.
+type protoRW struct {
+	Protocol
+	offset uint8
+	msgCh  chan MessageReader
+}
+
+// matchProtocols returns the protocols of ps the remote offers in caps,
+// the latest version of each name. Their message spaces are laid out by
+// the order of their names, so that both peers agree on them.
+func matchProtocols(ps []Protocol, caps []Cap) ([]*protoRW, error) {
+	offered := make(map[Cap]bool, len(caps))
+	for _, c := range caps {
+		offered[c] = true
+	}
+	latest := make(map[string]Protocol)
+	for _, p := range ps {
+		if !offered[Cap{Name: p.Name(), Version: p.Version()}] {
+			continue
+		}
+		if prev, exists := latest[p.Name()]; !exists || prev.Version() < p.Version() {
+			latest[p.Name()] = p
+		}
+	}
+	rws := make([]*protoRW, 0, len(latest))
+	for _, p := range latest {
+		rws = append(rws, &protoRW{Protocol: p, msgCh: make(chan MessageReader)})
+	}
+	sort.Slice(rws, func(i, j int) bool {
+		return rws[i].Name() < rws[j].Name()
+	})
+	offset := baseProtocolLength
+	for _, rw := range rws {
+		if offset+int(rw.Length()) > 256 {
+			return nil, errTooManyProtocols
+		}
+		rw.offset = uint8(offset)
+		offset += int(rw.Length())
+	}
+	return rws, nil
+}
+
+// findProtocol returns the protocol of rws whose space has mType, nil if
+// none has.
+func findProtocol(rws []*protoRW, mType uint8) *protoRW {
+	for _, rw := range rws {
+		if mType >= rw.offset && int(mType) < int(rw.offset)+int(rw.Length()) {
+			return rw
+		}
+	}
+	return nil
+}
+
+// encodeCaps encodes caps as count(1byte) then name length(1byte), name
+// and version(1byte) of each.
+func encodeCaps(caps []Cap) []byte {
+	buf := []byte{uint8(len(caps))}
+	for _, c := range caps {
+		buf = append(buf, uint8(len(c.Name)))
+		buf = append(buf, c.Name...)
+		buf = append(buf, c.Version)
+	}
+	return buf
+}
+
+var errInvalidCaps = errors.New("invalid capabilities")
+
+func decodeCaps(data []byte) ([]Cap, error) {
+	if len(data) < 1 || int(data[0]) > maxCaps {
+		return nil, errInvalidCaps
+	}
+	caps := make([]Cap, 0, data[0])
+	rest := data[1:]
+	for i := 0; i < int(data[0]); i++ {
+		if len(rest) < 1 || len(rest) < 2+int(rest[0]) {
+			return nil, errInvalidCaps
+		}
+		n := int(rest[0])
+		caps = append(caps, Cap{Name: string(rest[1 : 1+n]), Version: rest[1+n]})
+		rest = rest[2+n:]
+	}
+	if len(rest) != 0 {
+		return nil, errInvalidCaps
+	}
+	return caps, nil
+}
+
+// capsMessageSize bounds the data of the capabilities message.
+const capsMessageSize = 1 + maxCaps*(2+255)
@@ -0,0 +1,110 @@
+package p2p
+
+import (
+	"time"
+	"xfsgo/p2p/discover"
+)
+
+// The score of a peer starts at zero, misbehaviour lowers it and useful
+// work raises it up to maxScore. Scores decay back towards zero by
+// scoreDecay every scoreDecayInterval, so that occasional faults do not
+// add up over a long connection. A peer whose score falls to banScore is
+// disconnected and banned for banTTL.
+const (
+	maxScore = 100
+	banScore = -100
+	// scoreProtocolViolation bans a peer breaking the wire protocol at once.
+	scoreProtocolViolation = banScore
+	scoreDecay             = 1
+)
+
+var scoreDecayInterval = time.Minute
+
+// banTTL is how long a peer is banned by default.
+var banTTL = 30 * time.Minute
+
+// AdjustScore adds delta to the score of the peer, banning it if the
+// score falls to the ban threshold.
+func (srv *server) AdjustScore(id discover.NodeId, delta int) {
+	srv.scoreLock.Lock()
+	score := srv.scores[id] + delta
+	if score > maxScore {
+		score = maxScore
+	}
+	banned := score <= banScore
+	if banned {
+		delete(srv.scores, id)
+	} else {
+		srv.scores[id] = score
+	}
+	srv.scoreLock.Unlock()
+	if banned {
+		srv.logger.Warnf("Ban peer of low score: id=%s, ttl=%s", id, banTTL)
+		srv.BanPeer(id, banTTL)
+	}
+}
+
+// decayScores moves the scores towards zero by scoreDecay, dropping the
+// ones which reach it.
+func (srv *server) decayScores() {
+	srv.scoreLock.Lock()
+	defer srv.scoreLock.Unlock()
+	for id, score := range srv.scores {
+		switch {
+		case score > scoreDecay:
+			srv.scores[id] = score - scoreDecay
+		case score < -scoreDecay:
+			srv.scores[id] = score + scoreDecay
+		default:
+			delete(srv.scores, id)
+		}
+	}
+}
+
+// forgetScore drops the score of a disconnected peer. A bad reputation is
+// kept so that reconnecting does not clear it.
+func (srv *server) forgetScore(id discover.NodeId) {
+	srv.scoreLock.Lock()
+	defer srv.scoreLock.Unlock()
+	if srv.scores[id] >= 0 {
+		delete(srv.scores, id)
+	}
+}
+
+// PeerScores returns the scores of the connected peers.
+func (srv *server) PeerScores() map[discover.NodeId]int {
+	srv.scoreLock.Lock()
+	defer srv.scoreLock.Unlock()
+	out := make(map[discover.NodeId]int)
+	for _, p := range srv.Peers() {
+		out[p.ID()] = srv.scores[p.ID()]
+	}
+	return out
+}
+
+// BanPeer disconnects the peer and refuses connections with it for d,
+// or banTTL if d is not positive.
+func (srv *server) BanPeer(id discover.NodeId, d time.Duration) {
+	if d <= 0 {
+		d = banTTL
+	}
+	srv.appendIgnore(id, time.Now().Add(d))
+	srv.mu.Lock()
+	running := srv.running
+	srv.mu.Unlock()
+	if !running {
+		return
+	}
+	select {
+	case srv.banpeer <- id:
+	case <-srv.close:
+	}
+}
+
+// UnbanPeer lifts the ban of the peer and resets its score.
+func (srv *server) UnbanPeer(id discover.NodeId) {
+	srv.rmIgnore(id)
+	srv.scoreLock.Lock()
+	defer srv.scoreLock.Unlock()
+	delete(srv.scores, id)
+}
@@ -0,0 +1,173 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"xfsgo/common"
+	"xfsgo/crypto"
+	"xfsgo/crypto/secp256k1"
+	"xfsgo/p2p/discover"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	ephemeralLen = 64
+	nonceLen     = 32
+	signatureLen = 65
+	// maxFrameSize is the largest encrypted frame accepted from a peer.
+	maxFrameSize = 16 << 20
+)
+
+var (
+	errInvalidSignature = errors.New("invalid handshake signature")
+	errInvalidEphemeral = errors.New("invalid ephemeral key")
+	errFrameTooLarge    = errors.New("frame too large")
+	errInvalidFrame     = errors.New("invalid frame")
+)
+
+// encodeEphemeral encodes the public key of an ephemeral key as X and Y
+// padded to 32 bytes each.
+func encodeEphemeral(key *ecdsa.PrivateKey) (out [ephemeralLen]byte) {
+	copy(out[:32], common.PaddedBigBytes(key.X, 32))
+	copy(out[32:], common.PaddedBigBytes(key.Y, 32))
+	return
+}
+
+// ecdhSecret returns the shared secret of the local ephemeral key and the
+// ephemeral public key of the remote.
+func ecdhSecret(key *ecdsa.PrivateKey, remote [ephemeralLen]byte) ([]byte, error) {
+	curve := secp256k1.S256()
+	x := new(big.Int).SetBytes(remote[:32])
+	y := new(big.Int).SetBytes(remote[32:])
+	if !curve.IsOnCurve(x, y) {
+		return nil, errInvalidEphemeral
+	}
+	sx, _ := curve.ScalarMult(x, y, common.PaddedBigBytes(key.D, 32))
+	if sx == nil || sx.Sign() == 0 {
+		return nil, errInvalidEphemeral
+	}
+	return common.PaddedBigBytes(sx, 32), nil
+}
+
+// verifyNodeSignature checks sig over hash was made by the key of id.
+func verifyNodeSignature(id discover.NodeId, hash, sig []byte) error {
+	if len(sig) != signatureLen {
+		return errInvalidSignature
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil || pub.X == nil {
+		return errInvalidSignature
+	}
+	if discover.PubKey2NodeId(*pub) != id {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// secureConn encrypts the traffic of a connection with the keys agreed on
+// in the handshake. Each Write is sealed into one frame of
+// length(4byte)+ciphertext, the length authenticated along.
+type secureConn struct {
+	net.Conn
+	rmu      sync.Mutex
+	wmu      sync.Mutex
+	enc      cipher.AEAD
+	dec      cipher.AEAD
+	encNonce uint64
+	decNonce uint64
+	readBuf  bytes.Buffer
+}
+
+// newSecureConn derives the keys of both directions from the shared secret
+// and the nonces of the initiator and the responder of the handshake.
+func newSecureConn(conn net.Conn, secret, initNonce, respNonce []byte, initiator bool) (*secureConn, error) {
+	salt := append(append([]byte{}, initNonce...), respNonce...)
+	kdf := hkdf.New(sha256.New, secret, salt, []byte("xfsgo p2p"))
+	newAEAD := func() (cipher.AEAD, error) {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(kdf, key); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+	initAEAD, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	respAEAD, err := newAEAD()
+	if err != nil {
+		return nil, err
+	}
+	c := &secureConn{Conn: conn, enc: initAEAD, dec: respAEAD}
+	if !initiator {
+		c.enc, c.dec = respAEAD, initAEAD
+	}
+	return c, nil
+}
+
+func frameNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.LittleEndian.PutUint64(nonce, n)
+	return nonce
+}
+
+func (c *secureConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	frame := make([]byte, 4, 4+len(b)+c.enc.Overhead())
+	binary.LittleEndian.PutUint32(frame, uint32(len(b)+c.enc.Overhead()))
+	frame = c.enc.Seal(frame, frameNonce(c.enc, c.encNonce), b, frame[:4])
+	c.encNonce++
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *secureConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for c.readBuf.Len() == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	return c.readBuf.Read(b)
+}
+
+func (c *secureConn) readFrame() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return err
+	}
+	size := binary.LittleEndian.Uint32(header)
+	if size > maxFrameSize {
+		return errFrameTooLarge
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, sealed); err != nil {
+		return err
+	}
+	plain, err := c.dec.Open(sealed[:0], frameNonce(c.dec, c.decNonce), sealed, header)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidFrame, err)
+	}
+	c.decNonce++
+	c.readBuf.Write(plain)
+	return nil
+}
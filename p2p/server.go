@@ -6,10 +6,13 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 	"xfsgo/log"
 	"xfsgo/p2p/discover"
+	"xfsgo/p2p/dnsdisc"
 	"xfsgo/p2p/nat"
+	"xfsgo/p2p/netutil"
 )
 
 const (
@@ -21,12 +24,28 @@ const (
 
 var logReportTimeTTL = 10 * time.Second
 
+var (
+	errNotTrusted   = errors.New("peer not trusted")
+	errTooManyPeers = errors.New("too many peers")
+
+	errNoSharedProtocols = errors.New("no protocols shared with the peer")
+)
+
 type Server interface {
 	Node() *discover.Node
 	NodeId() discover.NodeId
 	Peers() []Peer
+	PeersInfo() []*PeerInfo
+	Slots() *PeerSlots
+	SetRecord(r *discover.Record) error
 	AddPeer(node *discover.Node)
 	RemovePeer(node discover.NodeId)
+	AdjustScore(id discover.NodeId, delta int)
+	PeerScores() map[discover.NodeId]int
+	BanPeer(id discover.NodeId, d time.Duration)
+	UnbanPeer(id discover.NodeId)
+	AddTrustedPeer(node *discover.Node)
+	RemoveTrustedPeer(id discover.NodeId)
 	Bind(p Protocol)
 	Start() error
 	Stop()
@@ -51,12 +70,28 @@ type server struct {
 	addstatic  chan *discover.Node
 	rmstatic   chan discover.NodeId
 	delpeer    chan Peer
+	banpeer    chan discover.NodeId
 	peers      map[discover.NodeId]Peer
 	table      *discover.Table
 	logger     log.Logger
 	lastLookup time.Time
 	igLock     sync.RWMutex
-	ignores    map[discover.NodeId]struct{}
+	// ignores holds the banned peers until the time the ban ends.
+	ignores   map[discover.NodeId]time.Time
+	scoreLock sync.Mutex
+	scores    map[discover.NodeId]int
+	trustLock sync.RWMutex
+	trusted   map[discover.NodeId]bool
+	// peerLock guards the peers against the readers other than the run
+	// loop, which alone writes them.
+	peerLock sync.RWMutex
+	// counters of the peers by direction and of the inbound connections
+	// in handshake.
+	inboundCount  int32
+	outboundCount int32
+	pendingCount  int32
+	// record is the one advertised in discovery, set before the table is.
+	record *discover.Record
 }
 
 // Config Background network service configuration
@@ -71,6 +106,35 @@ type Config struct {
 	MaxPeers       int
 	Logger         log.Logger
 	Encoder        encoder
+	// Compression lists the algorithms accepted to compress messages,
+	// the preferred one first.
+	Compression []uint8
+	// TrustedNodes are kept connected like static nodes and always accepted,
+	// even above MaxPeers. With OnlyTrusted no other peer is accepted.
+	TrustedNodes []*discover.Node
+	OnlyTrusted  bool
+	// NetRestrict limits the peers to the IP networks listed, if set.
+	NetRestrict *netutil.Netlist
+	// MaxInboundPeers caps the peers which connected to the node, the slots
+	// of MaxPeers not dialed if zero. 1/DialRatio of MaxPeers is dialed.
+	MaxInboundPeers int
+	DialRatio       int
+	// MaxPendingPeers caps the inbound connections in handshake, which
+	// fails after HandshakeTimeout.
+	MaxPendingPeers  int
+	HandshakeTimeout time.Duration
+	// MaxPeersPerIP and MaxPeersPerSubnet cap the inbound peers from one
+	// IP and from one subnet, no limit if zero.
+	MaxPeersPerIP     int
+	MaxPeersPerSubnet int
+	// DNSDiscovery lists the urls of the node lists published in DNS,
+	// resolved by DNSResolver or the system resolver if nil.
+	DNSDiscovery []string
+	DNSResolver  dnsdisc.Resolver
+	// ListenIP6 is an IPv6 address listened on besides ListenAddr, at the
+	// same port, for dual-stack nodes on specific addresses. A ListenAddr
+	// of an unspecified IP listens on both families already.
+	ListenIP6 net.IP
 }
 
 // NewServer Creates background service object
@@ -78,7 +142,12 @@ func NewServer(config Config) *server {
 	srv := &server{
 		config:  config,
 		logger:  config.Logger,
-		ignores: make(map[discover.NodeId]struct{}),
+		ignores: make(map[discover.NodeId]time.Time),
+		scores:  make(map[discover.NodeId]int),
+		trusted: make(map[discover.NodeId]bool),
+	}
+	for _, n := range config.TrustedNodes {
+		srv.trusted[n.ID] = true
 	}
 	if srv.logger == nil {
 		srv.logger = log.DefaultLogger()
@@ -88,28 +157,38 @@ func NewServer(config Config) *server {
 	return srv
 }
 
-func (srv *server) appendIgnore(id discover.NodeId) {
+// appendIgnore bans the peer until the given time, the ban is kept in the
+// node database to survive restarts.
+func (srv *server) appendIgnore(id discover.NodeId, until time.Time) {
 	srv.igLock.Lock()
 	defer srv.igLock.Unlock()
-	if _, exists := srv.ignores[id]; exists {
-		return
+	srv.ignores[id] = until
+	if srv.table != nil {
+		if err := srv.table.Ban(id, until); err != nil {
+			srv.logger.Warnf("Save peer ban err: id=%s, err=%v", id, err)
+		}
 	}
-	srv.ignores[id] = struct{}{}
 }
 
 func (srv *server) existsIgnore(id discover.NodeId) (exists bool) {
-	srv.igLock.RLock()
-	defer srv.igLock.RUnlock()
-	_, exists = srv.ignores[id]
+	srv.igLock.Lock()
+	defer srv.igLock.Unlock()
+	var until time.Time
+	if until, exists = srv.ignores[id]; exists && time.Now().After(until) {
+		delete(srv.ignores, id)
+		exists = false
+	}
 	return
 }
 func (srv *server) rmIgnore(id discover.NodeId) {
 	srv.igLock.Lock()
 	defer srv.igLock.Unlock()
-	if _, exists := srv.ignores[id]; !exists {
-		return
-	}
 	delete(srv.ignores, id)
+	if srv.table != nil {
+		if err := srv.table.Unban(id); err != nil {
+			srv.logger.Warnf("Delete peer ban err: id=%s, err=%v", id, err)
+		}
+	}
 }
 
 // Bind network protocol function
@@ -132,16 +211,33 @@ type udpcnn interface {
 }
 
 func (srv *server) listenUDP() (*discover.Table, udpcnn, error) {
-	addr, err := net.ResolveUDPAddr("udp", srv.config.ListenAddr)
+	network := "udp"
+	if srv.config.ListenIP6 != nil {
+		// The IPv6 socket is a separate one, ListenAddr must not take
+		// the port of both families.
+		network = "udp4"
+	}
+	addr, err := net.ResolveUDPAddr(network, srv.config.ListenAddr)
 	if err != nil {
 		return nil, nil, err
 	}
-	conn, err := net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if srv.config.ListenIP6 == nil {
+		table, _ := discover.NewUDP(srv.config.Key, conn, srv.config.NodeDBPath, srv.config.Nat, srv.config.NetRestrict, srv.logger)
+		return table, conn, nil
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: srv.config.ListenIP6, Port: port})
 	if err != nil {
+		_ = conn.Close()
 		return nil, nil, err
 	}
-	table, _ := discover.NewUDP(srv.config.Key, conn, srv.config.NodeDBPath, srv.config.Nat, srv.logger)
-	return table, conn, nil
+	dual := discover.NewDualConn(conn, conn6)
+	table, _ := discover.NewUDP(srv.config.Key, dual, srv.config.NodeDBPath, srv.config.Nat, srv.config.NetRestrict, srv.logger)
+	return table, dual, nil
 }
 
 // Start start running the server.
@@ -158,6 +254,7 @@ func (srv *server) Start() error {
 	srv.addstatic = make(chan *discover.Node)
 	srv.rmstatic = make(chan discover.NodeId)
 	srv.delpeer = make(chan Peer)
+	srv.banpeer = make(chan discover.NodeId)
 	srv.close = make(chan struct{})
 	var err error
 	var uconn udpcnn = nil
@@ -167,13 +264,24 @@ func (srv *server) Start() error {
 		if err != nil {
 			return err
 		}
-
+		srv.igLock.Lock()
+		for id, until := range srv.table.Bans() {
+			srv.ignores[id] = until
+		}
+		srv.igLock.Unlock()
+		if srv.record != nil {
+			if err = srv.table.SetRecord(srv.record, srv.config.Key); err != nil {
+				return err
+			}
+		}
 	}
-	dynPeers := srv.config.MaxPeers / 2
-	if !srv.config.Discover {
-		dynPeers = 0
+	dynPeers := srv.maxDialedPeers()
+	static := append(append([]*discover.Node{}, srv.config.StaticNodes...), srv.config.TrustedNodes...)
+	dialer := newDialState(static, srv.table, dynPeers, srv.config.NetRestrict, srv.logger)
+	if len(srv.config.DNSDiscovery) > 0 {
+		dialer.dns = dnsdisc.NewClient(dnsdisc.Config{Resolver: srv.config.DNSResolver})
+		dialer.dnsURLs = srv.config.DNSDiscovery
 	}
-	dialer := newDialState(srv.config.StaticNodes, srv.table, dynPeers, srv.logger)
 	// launch TCP listener to accept connection
 	realaddr := uconn.LocalAddr().(*net.UDPAddr)
 	if err = srv.listenAndServe(realaddr.Port); err != nil {
@@ -188,7 +296,9 @@ func (srv *server) logStats(dialer *dialstate) {
 
 }
 func (srv *server) run(dialer *dialstate) {
+	srv.peerLock.Lock()
 	srv.peers = make(map[discover.NodeId]Peer)
+	srv.peerLock.Unlock()
 	tasks := make([]task, 0)
 	pendingTasks := make([]task, 0)
 	taskdone := make(chan task)
@@ -221,6 +331,8 @@ func (srv *server) run(dialer *dialstate) {
 			pendingTasks = pt[:len(pt)-start]
 		}
 	}
+	decay := time.NewTicker(scoreDecayInterval)
+	defer decay.Stop()
 	lastReportTime := time.Now()
 	lastPeers := -1
 	logStats := func(now time.Time) {
@@ -251,13 +363,34 @@ func (srv *server) run(dialer *dialstate) {
 					v.Close()
 				}
 			}
+			srv.peerLock.Lock()
 			delete(srv.peers, n)
+			srv.peerLock.Unlock()
 		// add peer
 		case c := <-srv.addpeer:
+			if srv.existsIgnore(c.id) {
+				c.close()
+				break
+			}
+			if err := srv.checkPeer(c); err != nil {
+				srv.logger.Debugf("Refuse peer: id=%s, err=%v", c.id, err)
+				c.close()
+				break
+			}
 			p := newPeer(c, srv.protocols, srv.config.Encoder)
+			srv.peerLock.Lock()
 			srv.peers[c.id] = p
+			srv.peerLock.Unlock()
+			srv.countSlots()
 			srv.logger.Debugf("Successfully join peers: id=%s, from:%s", c.id, p.RemoteAddr())
 			go srv.runPeer(p)
+		// disconnect banned peer
+		case id := <-srv.banpeer:
+			if p, exists := srv.peers[id]; exists {
+				p.Close()
+			}
+		case <-decay.C:
+			srv.decayScores()
 		// task is done
 		case t := <-taskdone:
 			dialer.taskDone(t, now)
@@ -265,7 +398,11 @@ func (srv *server) run(dialer *dialstate) {
 		// delete peer
 		case p := <-srv.delpeer:
 			pId := p.ID()
+			srv.peerLock.Lock()
 			delete(srv.peers, pId)
+			srv.peerLock.Unlock()
+			srv.countSlots()
+			srv.forgetScore(pId)
 			srv.logger.Debugf("Removed peer id: %s", pId)
 		}
 	}
@@ -277,15 +414,28 @@ func (srv *server) runPeer(peer Peer) {
 }
 
 func (srv *server) listenAndServe(realPort int) error {
-	addr, err := net.ResolveTCPAddr("tcp", srv.config.ListenAddr)
+	network := "tcp"
+	if srv.config.ListenIP6 != nil {
+		network = "tcp4"
+	}
+	addr, err := net.ResolveTCPAddr(network, srv.config.ListenAddr)
 	if err != nil {
 		return err
 	}
 	addr.Port = realPort
-	ln, err := net.ListenTCP("tcp", addr)
+	ln, err := net.ListenTCP(network, addr)
 	if err != nil {
 		return err
 	}
+	if srv.config.ListenIP6 != nil {
+		ln6, err := net.ListenTCP("tcp6", &net.TCPAddr{IP: srv.config.ListenIP6, Port: realPort})
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		srv.logger.Infof("P2P listen and serve on %s", ln6.Addr())
+		go srv.listenLoop(ln6)
+	}
 	laddr := ln.Addr().(*net.TCPAddr)
 	if err != nil {
 		srv.logger.Errorf("P2P listen and serve on %s err: %v", laddr, err)
@@ -296,7 +446,9 @@ func (srv *server) listenAndServe(realPort int) error {
 	srv.node = discover.NewNode(addr.IP, uint16(addr.Port), uint16(addr.Port), srv.nodeId)
 	srv.logger.Infof("P2P server node id: %s", srv.nodeId)
 	go srv.listenLoop(ln)
-	if !laddr.IP.IsLoopback() && srv.config.Nat != nil {
+	// IPv6 addresses are not translated, only IPv4 ports are mapped.
+	isIPv6 := laddr.IP.To4() == nil && !laddr.IP.IsUnspecified()
+	if !laddr.IP.IsLoopback() && !isIPv6 && srv.config.Nat != nil {
 		//srv.loopWG.Add(1)
 		go func() {
 			srv.logger.Debugf("nat mapping \"xlibp2p server\" port: %d", laddr.Port)
@@ -315,15 +467,90 @@ func (srv *server) listenLoop(ln net.Listener) {
 			srv.logger.Errorln(err)
 		}
 	}()
+	// Connections in handshake take a slot each, no more are accepted
+	// until one is freed.
+	slots := make(chan struct{}, srv.maxPendingPeers())
 	for {
+		slots <- struct{}{}
 		rw, err := ln.Accept()
 		if err != nil {
 			srv.logger.Errorf("p2p listenner accept err %v", err)
 			return
 		}
+		if addr, ok := rw.RemoteAddr().(*net.TCPAddr); ok && srv.config.NetRestrict != nil &&
+			!srv.config.NetRestrict.Contains(addr.IP) {
+			srv.logger.Debugf("Refuse connection not in netrestrict list: addr=%s", addr)
+			_ = rw.Close()
+			<-slots
+			continue
+		}
 		c := srv.newPeerConn(rw, flagInbound, nil)
-		go c.serve()
+		atomic.AddInt32(&srv.pendingCount, 1)
+		go func() {
+			c.serve()
+			atomic.AddInt32(&srv.pendingCount, -1)
+			<-slots
+		}()
+	}
+}
+
+// SetRecord sets the record advertised in discovery, which tells other nodes
+// the chain and protocols of the node.
+func (srv *server) SetRecord(r *discover.Record) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.record = r
+	if !srv.running || srv.table == nil {
+		return nil
+	}
+	return srv.table.SetRecord(r, srv.config.Key)
+}
+
+// checkPeer returns why a connected peer may not join the peers, nil if it may.
+func (srv *server) checkPeer(c *peerConn) error {
+	if rws, err := matchProtocols(srv.protocols, c.remoteCaps); err != nil {
+		return err
+	} else if len(rws) == 0 && len(srv.protocols) > 0 {
+		return errNoSharedProtocols
+	}
+	if srv.isTrusted(c.id) {
+		return nil
+	}
+	if srv.config.OnlyTrusted {
+		return errNotTrusted
+	}
+	if srv.config.MaxPeers > 0 && len(srv.peers) >= srv.config.MaxPeers {
+		return errTooManyPeers
+	}
+	if c.flag&flagInbound != 0 {
+		if addr, ok := c.rw.RemoteAddr().(*net.TCPAddr); ok {
+			return srv.checkInbound(addr.IP)
+		}
 	}
+	return nil
+}
+
+func (srv *server) isTrusted(id discover.NodeId) bool {
+	srv.trustLock.RLock()
+	defer srv.trustLock.RUnlock()
+	return srv.trusted[id]
+}
+
+// AddTrustedPeer trusts the node and keeps it connected.
+func (srv *server) AddTrustedPeer(node *discover.Node) {
+	srv.trustLock.Lock()
+	srv.trusted[node.ID] = true
+	srv.trustLock.Unlock()
+	srv.AddPeer(node)
+}
+
+// RemoveTrustedPeer stops trusting the node, it is disconnected and no
+// longer dialed.
+func (srv *server) RemoveTrustedPeer(id discover.NodeId) {
+	srv.trustLock.Lock()
+	delete(srv.trusted, id)
+	srv.trustLock.Unlock()
+	srv.RemovePeer(id)
 }
 
 func (srv *server) AddPeer(node *discover.Node) {
@@ -331,6 +558,8 @@ func (srv *server) AddPeer(node *discover.Node) {
 }
 
 func (srv *server) Peers() []Peer {
+	srv.peerLock.RLock()
+	defer srv.peerLock.RUnlock()
 	tmp := make([]Peer, 0)
 	for _, v := range srv.peers {
 		tmp = append(tmp, v)
@@ -338,6 +567,17 @@ func (srv *server) Peers() []Peer {
 	return tmp
 }
 
+// PeersInfo returns the descriptions of the connected peers.
+func (srv *server) PeersInfo() []*PeerInfo {
+	infos := make([]*PeerInfo, 0)
+	for _, v := range srv.Peers() {
+		if p, ok := v.(*peer); ok {
+			infos = append(infos, p.info())
+		}
+	}
+	return infos
+}
+
 func (srv *server) RemovePeer(nId discover.NodeId) {
 	srv.rmstatic <- nId
 }
@@ -346,21 +586,37 @@ func (srv *server) NodeId() discover.NodeId {
 	return srv.nodeId
 }
 
+// Node returns the local node, at its external IP if it listens on an
+// unspecified one and discovery learned the external one, IPv4 first.
 func (srv *server) Node() *discover.Node {
-	return srv.node
+	if srv.node == nil || !srv.node.IP.IsUnspecified() || srv.table == nil {
+		return srv.node
+	}
+	ip4, ip6 := srv.table.External()
+	ip := ip4
+	if ip == nil {
+		ip = ip6
+	}
+	if ip == nil {
+		return srv.node
+	}
+	return discover.NewNode(ip, srv.node.TCP, srv.node.UDP, srv.node.ID)
 }
 
 func (srv *server) newPeerConn(rw net.Conn, flag int, dst *discover.NodeId) *peerConn {
 	pubKey := srv.config.Key.PublicKey
 	mId := discover.PubKey2NodeId(pubKey)
 	c := &peerConn{
-		logger:  srv.logger,
-		self:    mId,
-		flag:    flag,
-		server:  srv,
-		key:     srv.config.Key,
-		rw:      rw,
-		version: version1,
+		logger:      srv.logger,
+		self:        mId,
+		flag:        flag,
+		server:      srv,
+		key:         srv.config.Key,
+		rw:          rw,
+		version:     version2,
+		compression: srv.config.Compression,
+		timeout:     srv.handshakeTimeout(),
+		caps:        protocolCaps(srv.protocols),
 	}
 	if dst != nil {
 		c.id = *dst
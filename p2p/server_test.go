@@ -1,5 +1,311 @@
 package p2p
 
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"xfsgo/crypto"
+	"xfsgo/p2p/discover"
+	"xfsgo/p2p/dnsdisc"
+	"xfsgo/p2p/netutil"
+)
+
 // func createStartTestServer(t *testing.T, P2PListenAddress string) *server {
 // 	return &server{}
 // }
+
+func TestServer_adjustScore(t *testing.T) {
+	srv := NewServer(Config{Key: crypto.MustGenPrvKey()})
+	id := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	srv.AdjustScore(id, 2*maxScore)
+	if got := srv.scores[id]; got != maxScore {
+		t.Fatalf("want score %d, got %d", maxScore, got)
+	}
+	srv.AdjustScore(id, banScore-maxScore+1)
+	if srv.existsIgnore(id) {
+		t.Fatalf("want peer of score %d not banned", srv.scores[id])
+	}
+	srv.AdjustScore(id, -1)
+	if !srv.existsIgnore(id) {
+		t.Fatalf("want peer banned at score %d", banScore)
+	}
+	if _, exists := srv.scores[id]; exists {
+		t.Fatalf("want score of banned peer dropped")
+	}
+	srv.UnbanPeer(id)
+	if srv.existsIgnore(id) {
+		t.Fatalf("want peer unbanned")
+	}
+
+	srv.BanPeer(id, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if srv.existsIgnore(id) {
+		t.Fatalf("want ban expired")
+	}
+}
+
+func TestServer_decayScores(t *testing.T) {
+	srv := NewServer(Config{Key: crypto.MustGenPrvKey()})
+	good := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	bad := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	srv.AdjustScore(good, 2)
+	srv.AdjustScore(bad, -2)
+	srv.decayScores()
+	if srv.scores[good] != 1 || srv.scores[bad] != -1 {
+		t.Fatalf("want scores decayed towards zero, got %v", srv.scores)
+	}
+	srv.decayScores()
+	if len(srv.scores) != 0 {
+		t.Fatalf("want scores of zero dropped, got %v", srv.scores)
+	}
+}
+
+func TestServer_checkPeer(t *testing.T) {
+	trusted := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	other := discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey)
+	srv := NewServer(Config{
+		Key:          crypto.MustGenPrvKey(),
+		MaxPeers:     1,
+		TrustedNodes: []*discover.Node{{ID: trusted}},
+	})
+	srv.peers = map[discover.NodeId]Peer{{1}: nil}
+	if err := srv.checkPeer(&peerConn{id: other, flag: flagOutbound}); err != errTooManyPeers {
+		t.Fatalf("want err %v, got %v", errTooManyPeers, err)
+	}
+	if err := srv.checkPeer(&peerConn{id: trusted, flag: flagOutbound}); err != nil {
+		t.Fatalf("want trusted peer accepted above max peers, got %v", err)
+	}
+	srv.config.OnlyTrusted = true
+	srv.peers = map[discover.NodeId]Peer{}
+	if err := srv.checkPeer(&peerConn{id: other, flag: flagOutbound}); err != errNotTrusted {
+		t.Fatalf("want err %v, got %v", errNotTrusted, err)
+	}
+	srv.trustLock.Lock()
+	srv.trusted[other] = true
+	srv.trustLock.Unlock()
+	if err := srv.checkPeer(&peerConn{id: other, flag: flagOutbound}); err != nil {
+		t.Fatalf("want peer trusted at runtime accepted, got %v", err)
+	}
+}
+
+type testInboundPeer struct {
+	Peer
+	addr *net.TCPAddr
+}
+
+func (p *testInboundPeer) Is(flag int) bool {
+	return flag&flagInbound != 0
+}
+
+func (p *testInboundPeer) RemoteAddr() *net.TCPAddr {
+	return p.addr
+}
+
+func TestServer_checkInbound(t *testing.T) {
+	srv := NewServer(Config{
+		Key:               crypto.MustGenPrvKey(),
+		MaxPeers:          10,
+		Discover:          true,
+		MaxPeersPerIP:     1,
+		MaxPeersPerSubnet: 2,
+	})
+	inbound := func(ip string) Peer {
+		return &testInboundPeer{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 9011}}
+	}
+	srv.peers = map[discover.NodeId]Peer{
+		{1}: inbound("10.0.0.1"),
+	}
+	if err := srv.checkInbound(net.ParseIP("10.0.0.1")); err != errTooManyFromIP {
+		t.Fatalf("want err %v, got %v", errTooManyFromIP, err)
+	}
+	if err := srv.checkInbound(net.ParseIP("10.0.0.2")); err != nil {
+		t.Fatalf("want peer accepted, got %v", err)
+	}
+	srv.peers[discover.NodeId{2}] = inbound("10.0.0.2")
+	if err := srv.checkInbound(net.ParseIP("10.0.0.3")); err != errTooManyFromSubnet {
+		t.Fatalf("want err %v, got %v", errTooManyFromSubnet, err)
+	}
+	if err := srv.checkInbound(net.ParseIP("10.0.1.1")); err != nil {
+		t.Fatalf("want peer from other subnet accepted, got %v", err)
+	}
+	srv.peers[discover.NodeId{3}] = inbound("10.0.1.1")
+	srv.peers[discover.NodeId{4}] = inbound("10.0.2.1")
+	srv.peers[discover.NodeId{5}] = inbound("10.0.3.1")
+	if err := srv.checkInbound(net.ParseIP("10.0.4.1")); err != errTooManyInbound {
+		t.Fatalf("want err %v, got %v", errTooManyInbound, err)
+	}
+}
+
+func TestServer_slotsDefaults(t *testing.T) {
+	srv := NewServer(Config{
+		Key:      crypto.MustGenPrvKey(),
+		MaxPeers: 10,
+		Discover: true,
+	})
+	slots := srv.Slots()
+	if slots.MaxDialed != 5 || slots.MaxInbound != 5 {
+		t.Fatalf("want 5 dialed and 5 inbound slots, got %d and %d", slots.MaxDialed, slots.MaxInbound)
+	}
+	if slots.MaxPending != defaultMaxPendingPeers {
+		t.Fatalf("want %d pending slots, got %d", defaultMaxPendingPeers, slots.MaxPending)
+	}
+	srv.config.DialRatio = 3
+	srv.config.OnlyTrusted = true
+	if n := srv.maxDialedPeers(); n != 0 {
+		t.Fatalf("want no dialed slots with only trusted peers, got %d", n)
+	}
+	if n := srv.maxInboundPeers(); n != 7 {
+		t.Fatalf("want 7 inbound slots, got %d", n)
+	}
+}
+
+func TestDialState_netrestrict(t *testing.T) {
+	netrestrict, err := netutil.ParseNetlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inside := discover.NewNode(net.ParseIP("10.0.0.1"), 9011, 9011, discover.NodeId{1})
+	outside := discover.NewNode(net.ParseIP("192.168.0.1"), 9011, 9011, discover.NodeId{2})
+	ds := newDialState([]*discover.Node{inside, outside}, nil, 0, netrestrict, nil)
+	tasks := ds.newTasks(0, map[discover.NodeId]Peer{}, time.Now())
+	if len(tasks) != 1 || tasks[0].(*dialtask).dest != inside {
+		t.Fatalf("want only the node inside the netrestrict list dialed, got %v", tasks)
+	}
+}
+
+type testResolver map[string]string
+
+func (r testResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if txt, exists := r[name]; exists {
+		return []string{txt}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestDialState_dnsNodes(t *testing.T) {
+	node := discover.NewNode(net.ParseIP("10.0.0.1"), 9011, 9011,
+		discover.PubKey2NodeId(crypto.MustGenPrvKey().PublicKey))
+	tree := dnsdisc.MakeTree(1, []*discover.Node{node})
+	url, err := tree.Sign(crypto.MustGenPrvKey(), "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := newDialState(nil, nil, 4, nil, nil)
+	ds.dns = dnsdisc.NewClient(dnsdisc.Config{Resolver: testResolver(tree.ToTXT("nodes.example.org"))})
+	ds.dnsURLs = []string{url}
+	now := time.Now()
+	var sync *dnsTask
+	for _, task := range ds.newTasks(0, map[discover.NodeId]Peer{}, now) {
+		if dt, ok := task.(*dnsTask); ok {
+			sync = dt
+		}
+	}
+	if sync == nil {
+		t.Fatal("want dns sync task")
+	}
+	sync.Do(nil)
+	ds.taskDone(sync, now)
+	var dialed bool
+	for _, task := range ds.newTasks(1, map[discover.NodeId]Peer{}, now) {
+		switch dt := task.(type) {
+		case *dnsTask:
+			t.Fatal("want no dns sync before the sync interval")
+		case *dialtask:
+			dialed = dialed || dt.dest.ID == node.ID
+		}
+	}
+	if !dialed {
+		t.Fatal("want node of the dns list dialed")
+	}
+}
+
+func TestDialState_dnsRetry(t *testing.T) {
+	tree := dnsdisc.MakeTree(1, nil)
+	url, err := tree.Sign(crypto.MustGenPrvKey(), "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := newDialState(nil, nil, 4, nil, nil)
+	ds.dns = dnsdisc.NewClient(dnsdisc.Config{Resolver: testResolver{}})
+	ds.dnsURLs = []string{url}
+	sync := func(now time.Time) *dnsTask {
+		for _, task := range ds.newTasks(0, map[discover.NodeId]Peer{}, now) {
+			if dt, ok := task.(*dnsTask); ok {
+				dt.Do(nil)
+				ds.taskDone(dt, now)
+				return dt
+			}
+		}
+		return nil
+	}
+	// A failed sync is retried after a delay doubled at each failure.
+	now := time.Now()
+	if dt := sync(now); dt == nil || dt.err == nil {
+		t.Fatal("want failed dns sync")
+	}
+	for _, delay := range []time.Duration{dnsRetryInterval, 2 * dnsRetryInterval} {
+		if sync(now.Add(delay-time.Second)) != nil {
+			t.Fatalf("want no dns sync before %v", delay)
+		}
+		now = now.Add(delay)
+		if sync(now) == nil {
+			t.Fatalf("want dns sync retried after %v", delay)
+		}
+	}
+	// So is a sync finding no node, the sync interval follows a sync
+	// finding some only.
+	ds.dns = dnsdisc.NewClient(dnsdisc.Config{Resolver: testResolver(tree.ToTXT("nodes.example.org"))})
+	now = now.Add(4 * dnsRetryInterval)
+	if dt := sync(now); dt == nil || dt.err != nil || len(dt.result) != 0 {
+		t.Fatal("want empty dns sync")
+	}
+	if sync(now.Add(8*dnsRetryInterval)) == nil {
+		t.Fatal("want empty dns sync retried before the sync interval")
+	}
+}
+
+// recordTable is a discovery table knowing the records of nodes.
+type recordTable struct {
+	discoverTable
+	local   *discover.Record
+	records map[discover.NodeId]*discover.Record
+}
+
+func (t *recordTable) Record(id discover.NodeId) *discover.Record {
+	return t.records[id]
+}
+
+func (t *recordTable) LocalRecord() *discover.Record {
+	return t.local
+}
+
+func TestDialState_skipOtherNetworks(t *testing.T) {
+	same := discover.NewNode(net.ParseIP("10.0.0.1"), 9011, 9011, discover.NodeId{1})
+	other := discover.NewNode(net.ParseIP("10.0.0.2"), 9011, 9011, discover.NodeId{2})
+	unknown := discover.NewNode(net.ParseIP("10.0.0.3"), 9011, 9011, discover.NodeId{3})
+	static := discover.NewNode(net.ParseIP("10.0.0.4"), 9011, 9011, discover.NodeId{4})
+	protocols := []string{discover.ProtocolFull}
+	table := &recordTable{
+		local: &discover.Record{NetworkID: 1, Protocols: protocols},
+		records: map[discover.NodeId]*discover.Record{
+			same.ID:   {NetworkID: 1, Protocols: protocols},
+			other.ID:  {NetworkID: 2, Protocols: protocols},
+			static.ID: {NetworkID: 2, Protocols: protocols},
+		},
+	}
+	ds := newDialState([]*discover.Node{static}, table, 10, nil, nil)
+	ds.lookupBuf = []*discover.Node{same, other, unknown}
+	dialed := make(map[discover.NodeId]bool)
+	for _, task := range ds.newTasks(0, map[discover.NodeId]Peer{}, time.Now()) {
+		if dt, ok := task.(*dialtask); ok {
+			dialed[dt.dest.ID] = true
+		}
+	}
+	if !dialed[same.ID] || !dialed[unknown.ID] || dialed[other.ID] {
+		t.Fatalf("want nodes of other networks skipped, dialed %v", dialed)
+	}
+	if !dialed[static.ID] {
+		t.Fatal("want static node dialed whatever its record")
+	}
+}
@@ -0,0 +1,135 @@
+package p2p
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+	"xfsgo/p2p/netutil"
+)
+
+const (
+	defaultDialRatio        = 2
+	defaultMaxPendingPeers  = 50
+	defaultHandshakeTimeout = 5 * time.Second
+)
+
+var (
+	errTooManyInbound    = errors.New("too many inbound peers")
+	errTooManyFromIP     = errors.New("too many peers from the IP")
+	errTooManyFromSubnet = errors.New("too many peers from the subnet")
+)
+
+// PeerSlots counts the peers against their limits.
+type PeerSlots struct {
+	MaxPeers   int
+	MaxInbound int
+	MaxDialed  int
+	MaxPending int
+	Peers      int
+	Inbound    int
+	Outbound   int
+	Pending    int
+}
+
+// maxDialedPeers returns the number of peers dialed from discovery, the
+// other slots are left to inbound peers.
+func (srv *server) maxDialedPeers() int {
+	if !srv.config.Discover || srv.config.OnlyTrusted {
+		return 0
+	}
+	ratio := srv.config.DialRatio
+	if ratio <= 0 {
+		ratio = defaultDialRatio
+	}
+	return srv.config.MaxPeers / ratio
+}
+
+func (srv *server) maxInboundPeers() int {
+	if srv.config.MaxInboundPeers > 0 {
+		return srv.config.MaxInboundPeers
+	}
+	ratio := srv.config.DialRatio
+	if ratio <= 0 {
+		ratio = defaultDialRatio
+	}
+	return srv.config.MaxPeers - srv.config.MaxPeers/ratio
+}
+
+func (srv *server) maxPendingPeers() int {
+	if srv.config.MaxPendingPeers > 0 {
+		return srv.config.MaxPendingPeers
+	}
+	return defaultMaxPendingPeers
+}
+
+func (srv *server) handshakeTimeout() time.Duration {
+	if srv.config.HandshakeTimeout > 0 {
+		return srv.config.HandshakeTimeout
+	}
+	return defaultHandshakeTimeout
+}
+
+// checkInbound returns why an inbound peer from ip may not join the peers,
+// nil if it may. Subnets are /24 for IPv4 and /64 for IPv6.
+func (srv *server) checkInbound(ip net.IP) error {
+	maxInbound := srv.maxInboundPeers()
+	inbound, fromIP, fromSubnet := 0, 0, 0
+	subnet := netutil.Subnet(ip)
+	for _, p := range srv.peers {
+		if !p.Is(flagInbound) {
+			continue
+		}
+		inbound++
+		addr := p.RemoteAddr()
+		if addr == nil {
+			continue
+		}
+		if addr.IP.Equal(ip) {
+			fromIP++
+		}
+		if netutil.Subnet(addr.IP).Equal(subnet) {
+			fromSubnet++
+		}
+	}
+	switch {
+	case maxInbound > 0 && inbound >= maxInbound:
+		return errTooManyInbound
+	case srv.config.MaxPeersPerIP > 0 && fromIP >= srv.config.MaxPeersPerIP:
+		return errTooManyFromIP
+	case srv.config.MaxPeersPerSubnet > 0 && fromSubnet >= srv.config.MaxPeersPerSubnet:
+		return errTooManyFromSubnet
+	}
+	return nil
+}
+
+// countSlots updates the counters of the peers by direction, it is called
+// by the run loop as the peers change.
+func (srv *server) countSlots() {
+	var inbound, outbound int32
+	for _, p := range srv.peers {
+		if p.Is(flagInbound) {
+			inbound++
+		} else {
+			outbound++
+		}
+	}
+	atomic.StoreInt32(&srv.inboundCount, inbound)
+	atomic.StoreInt32(&srv.outboundCount, outbound)
+}
+
+// Slots returns the counters of the peers and their limits.
+func (srv *server) Slots() *PeerSlots {
+	inbound := int(atomic.LoadInt32(&srv.inboundCount))
+	outbound := int(atomic.LoadInt32(&srv.outboundCount))
+	return &PeerSlots{
+		MaxPeers:   srv.config.MaxPeers,
+		MaxInbound: srv.maxInboundPeers(),
+		MaxDialed:  srv.maxDialedPeers(),
+		MaxPending: srv.maxPendingPeers(),
+		Peers:      inbound + outbound,
+		Inbound:    inbound,
+		Outbound:   outbound,
+		Pending:    int(atomic.LoadInt32(&srv.pendingCount)),
+	}
+}
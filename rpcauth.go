@@ -0,0 +1,253 @@
+// Copyright 2018 The xfsgo Authors
+// This file is part of the xfsgo library.
+//
+// The xfsgo library is free software: you can redistribute it and/or modify
+// it under the terms of the MIT Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The xfsgo library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// MIT Lesser General Public License for more details.
+//
+// You should have received a copy of the MIT Lesser General Public License
+// along with the xfsgo library. If not, see <https://mit-license.org/>.
+
+package xfsgo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RPCPermission is the level of access a RPC call requires, or a caller
+// is granted.
+type RPCPermission uint8
+
+const (
+	// RPCPermRead allows the calls that only read the chain, the pool
+	// and the network, or submit signed transactions.
+	RPCPermRead RPCPermission = iota + 1
+	// RPCPermAdmin allows every call, including the ones of the wallet
+	// and of the miner.
+	RPCPermAdmin
+)
+
+// apiKeyHeader is the HTTP header carrying an API key.
+const apiKeyHeader = "X-API-Key"
+
+var errInvalidToken = errors.New("invalid token")
+
+// ParseRPCPermission parses "read" or "admin".
+func ParseRPCPermission(s string) (RPCPermission, error) {
+	switch strings.ToLower(s) {
+	case "read", "readonly":
+		return RPCPermRead, nil
+	case "admin":
+		return RPCPermAdmin, nil
+	}
+	return 0, fmt.Errorf("unknown rpc permission %q", s)
+}
+
+func (p RPCPermission) String() string {
+	switch p {
+	case RPCPermRead:
+		return "read"
+	case RPCPermAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type tokenClaims struct {
+	Perm string `json:"perm,omitempty"`
+	Iat  int64  `json:"iat,omitempty"`
+	Exp  int64  `json:"exp,omitempty"`
+}
+
+var tokenEncoding = base64.RawURLEncoding
+
+func signToken(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// NewRPCToken returns a JWT signed with secret by HS256, which grants perm
+// until ttl elapses.
+func NewRPCToken(secret []byte, perm RPCPermission, ttl time.Duration) (string, error) {
+	header, err := json.Marshal(&tokenHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(&tokenClaims{
+		Perm: perm.String(),
+		Iat:  now.Unix(),
+		Exp:  now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := tokenEncoding.EncodeToString(header) + "." + tokenEncoding.EncodeToString(claims)
+	return signingInput + "." + tokenEncoding.EncodeToString(signToken(secret, signingInput)), nil
+}
+
+// verifyRPCToken checks the signature and the expiry of a HS256 JWT and
+// returns the permission it grants, read if it names none.
+func verifyRPCToken(secret []byte, token string, now time.Time) (RPCPermission, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errInvalidToken
+	}
+	sig, err := tokenEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	if !hmac.Equal(sig, signToken(secret, parts[0]+"."+parts[1])) {
+		return 0, errInvalidToken
+	}
+	var header tokenHeader
+	if raw, err := tokenEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(raw, &header) != nil {
+		return 0, errInvalidToken
+	}
+	if header.Alg != "HS256" {
+		return 0, errInvalidToken
+	}
+	var claims tokenClaims
+	if raw, err := tokenEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(raw, &claims) != nil {
+		return 0, errInvalidToken
+	}
+	if claims.Exp != 0 && now.Unix() >= claims.Exp {
+		return 0, fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if claims.Perm == "" {
+		return RPCPermRead, nil
+	}
+	perm, err := ParseRPCPermission(claims.Perm)
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	return perm, nil
+}
+
+// originAllowed reports whether origin is in the list, "*" allowing any.
+func originAllowed(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *RPCServer) authEnabled() bool {
+	return len(server.config.APIKeys) > 0 || len(server.config.JWTSecret) > 0
+}
+
+// authorize returns the permission of the caller of r. Callers without
+// credentials are granted read, or admin while no authentication is
+// configured if they call the admin listener or from the loopback address.
+// On the public listener callers are granted read at most once a separate
+// admin listener is configured. The callers of the IPC socket, which the
+// file permissions guard, are granted admin.
+func (server *RPCServer) authorize(r *http.Request, listener rpcListener) (RPCPermission, error) {
+	if listener == ipcListener {
+		return RPCPermAdmin, nil
+	}
+	perm := RPCPermRead
+	if !server.authEnabled() && (listener == adminListener || isLoopbackAddr(r.RemoteAddr)) {
+		perm = RPCPermAdmin
+	}
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		var ok bool
+		if perm, ok = server.lookupAPIKey(key); !ok {
+			return 0, UnauthorizedError("invalid api key")
+		}
+	} else if auth := r.Header.Get("Authorization"); auth != "" {
+		const prefix = "Bearer "
+		if len(server.config.JWTSecret) == 0 || !strings.HasPrefix(auth, prefix) {
+			return 0, UnauthorizedError("invalid authorization")
+		}
+		var err error
+		if perm, err = verifyRPCToken(server.config.JWTSecret, auth[len(prefix):], time.Now()); err != nil {
+			return 0, UnauthorizedError("%s", err)
+		}
+	}
+	if listener == publicListener && server.config.AdminListenAddr != "" && perm > RPCPermRead {
+		perm = RPCPermRead
+	}
+	return perm, nil
+}
+
+// isLoopbackAddr reports whether the host of addr, a host:port, is a loopback address.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (server *RPCServer) lookupAPIKey(key string) (RPCPermission, bool) {
+	for k, perm := range server.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return perm, true
+		}
+	}
+	return 0, false
+}
+
+// SetPermission sets the permission the calls of target require, a service
+// name or a "Service.Method". The permissions of the config take precedence.
+func (server *RPCServer) SetPermission(target string, perm RPCPermission) {
+	server.permissions[target] = perm
+}
+
+// requiredPermission returns the permission a call of the method of the
+// service requires, the method taking precedence over the service. Calls
+// require read unless set otherwise.
+func (server *RPCServer) requiredPermission(serviceName, methodName string) RPCPermission {
+	full := serviceName + "." + methodName
+	for _, perms := range []map[string]RPCPermission{server.config.Permissions, server.permissions} {
+		if perm, ok := perms[full]; ok {
+			return perm
+		}
+		if perm, ok := perms[serviceName]; ok {
+			return perm
+		}
+	}
+	return RPCPermRead
+}
+
+// corsOrigin returns the value of Access-Control-Allow-Origin for origin,
+// empty if it is not allowed.
+func (server *RPCServer) corsOrigin(origin string) string {
+	if origin == "" || !originAllowed(server.config.CORSOrigins, origin) {
+		return ""
+	}
+	return origin
+}
+
+// checkOrigin allows the websocket connections of clients that are not
+// browsers, which send no origin, and of the allowed origins.
+func (server *RPCServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || originAllowed(server.config.CORSOrigins, origin)
+}
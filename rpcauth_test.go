@@ -0,0 +1,184 @@
+package xfsgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRPCService struct{}
+
+func (*testRPCService) Get(_ *struct{}, reply *string) error {
+	*reply = "get"
+	return nil
+}
+
+func (*testRPCService) Set(_ *struct{}, reply *string) error {
+	*reply = "set"
+	return nil
+}
+
+func newTestRPCServer(t *testing.T, config *RPCConfig) *RPCServer {
+	server := NewRPCServer(config)
+	if err := server.RegisterName("Test", new(testRPCService)); err != nil {
+		t.Fatal(err)
+	}
+	server.SetPermission("Test", RPCPermAdmin)
+	server.SetPermission("Test.Get", RPCPermRead)
+	return server
+}
+
+// callTestRPC calls method through h and returns the http status and the
+// code of the rpc error, 0 on success.
+func callTestRPC(t *testing.T, h http.Handler, method string, header map[string]string) (int, int) {
+	body, _ := json.Marshal(&RPCMessageRequest{Jsonrpc: jsonrpcVersion, Id: 1, Method: method, Params: json.RawMessage("null")})
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp struct {
+		Error *RPCMessageErrorObj `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v: %s", method, err, w.Body)
+	}
+	if resp.Error == nil {
+		return w.Code, 0
+	}
+	return w.Code, resp.Error.Code
+}
+
+func TestRPCToken(t *testing.T) {
+	secret := []byte("secret")
+	token, err := NewRPCToken(secret, RPCPermAdmin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm, err := verifyRPCToken(secret, token, time.Now()); err != nil || perm != RPCPermAdmin {
+		t.Fatalf("want admin, got %s, err %v", perm, err)
+	}
+	if _, err = verifyRPCToken(secret, token, time.Now().Add(2*time.Minute)); err == nil {
+		t.Fatalf("want expired token refused")
+	}
+	if _, err = verifyRPCToken([]byte("other"), token, time.Now()); err == nil {
+		t.Fatalf("want token of another secret refused")
+	}
+	parts := strings.Split(token, ".")
+	none := tokenEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	if _, err = verifyRPCToken(secret, none, time.Now()); err == nil {
+		t.Fatalf("want unsigned token refused")
+	}
+}
+
+func TestRPCServer_permissions(t *testing.T) {
+	secret := []byte("secret")
+	server := newTestRPCServer(t, &RPCConfig{
+		APIKeys:     map[string]RPCPermission{"adminkey": RPCPermAdmin, "readkey": RPCPermRead},
+		JWTSecret:   secret,
+		Permissions: map[string]RPCPermission{"Test.Get": RPCPermAdmin},
+	})
+	public := server.handler(publicListener)
+	token, _ := NewRPCToken(secret, RPCPermAdmin, time.Minute)
+	tests := []struct {
+		method string
+		header map[string]string
+		status int
+		code   int
+	}{
+		{"Test.Set", nil, 200, UnauthorizedErrorCode},
+		{"Test.Set", map[string]string{apiKeyHeader: "readkey"}, 200, UnauthorizedErrorCode},
+		{"Test.Set", map[string]string{apiKeyHeader: "adminkey"}, 200, 0},
+		{"Test.Set", map[string]string{apiKeyHeader: "badkey"}, 401, UnauthorizedErrorCode},
+		{"Test.Set", map[string]string{"Authorization": "Bearer " + token}, 200, 0},
+		{"Test.Set", map[string]string{"Authorization": "Bearer " + token + "x"}, 401, UnauthorizedErrorCode},
+		// The config overrides the permission set.
+		{"Test.Get", map[string]string{apiKeyHeader: "readkey"}, 200, UnauthorizedErrorCode},
+		{"Test.Get", map[string]string{apiKeyHeader: "adminkey"}, 200, 0},
+		{"Test.None", map[string]string{apiKeyHeader: "adminkey"}, 200, methodNotFoundError.Code},
+	}
+	for _, tt := range tests {
+		if status, code := callTestRPC(t, public, tt.method, tt.header); status != tt.status || code != tt.code {
+			t.Errorf("%s %v: want status %d code %d, got status %d code %d", tt.method, tt.header, tt.status, tt.code, status, code)
+		}
+	}
+}
+
+func TestRPCServer_adminListener(t *testing.T) {
+	// Without authentication the callers of the loopback address or of the
+	// admin listener are admins, the remote callers of the public listener
+	// are not.
+	server := newTestRPCServer(t, &RPCConfig{})
+	loopback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = "127.0.0.1:40000"
+		server.handler(publicListener).ServeHTTP(w, r)
+	})
+	if _, code := callTestRPC(t, loopback, "Test.Set", nil); code != 0 {
+		t.Fatalf("want admin on loopback without authentication, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(publicListener), "Test.Set", nil); code != UnauthorizedErrorCode {
+		t.Fatalf("want remote admin calls refused without authentication, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(publicListener), "Test.Get", nil); code != 0 {
+		t.Fatalf("want remote read calls allowed without authentication, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(adminListener), "Test.Set", nil); code != 0 {
+		t.Fatalf("want admin on the admin listener without authentication, got code %d", code)
+	}
+	server = newTestRPCServer(t, &RPCConfig{AdminListenAddr: "127.0.0.1:0", APIKeys: map[string]RPCPermission{"adminkey": RPCPermAdmin}})
+	admin := map[string]string{apiKeyHeader: "adminkey"}
+	if _, code := callTestRPC(t, server.handler(publicListener), "Test.Set", admin); code != UnauthorizedErrorCode {
+		t.Fatalf("want admin calls refused on the public listener, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(publicListener), "Test.Get", nil); code != 0 {
+		t.Fatalf("want read calls allowed on the public listener, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(adminListener), "Test.Set", admin); code != 0 {
+		t.Fatalf("want admin calls allowed on the admin listener, got code %d", code)
+	}
+	if _, code := callTestRPC(t, server.handler(adminListener), "Test.Set", nil); code != UnauthorizedErrorCode {
+		t.Fatalf("want credentials required on the admin listener, got code %d", code)
+	}
+}
+
+func TestRPCServer_cors(t *testing.T) {
+	server := newTestRPCServer(t, &RPCConfig{CORSOrigins: []string{"http://wallet.example"}})
+	for origin, want := range map[string]string{
+		"http://wallet.example": "http://wallet.example",
+		"http://evil.example":   "",
+	} {
+		r := httptest.NewRequest("OPTIONS", "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		server.handler(publicListener).ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("origin %s: want allowed origin %q, got %q", origin, want, got)
+		}
+		if allowed := server.checkOrigin(r); allowed != (want != "") {
+			t.Errorf("origin %s: want websocket allowed %v", origin, want != "")
+		}
+	}
+}
+
+func TestClient_auth(t *testing.T) {
+	secret := []byte("secret")
+	server := newTestRPCServer(t, &RPCConfig{JWTSecret: secret, APIKeys: map[string]RPCPermission{"readkey": RPCPermRead}})
+	ts := httptest.NewServer(server.handler(publicListener))
+	defer ts.Close()
+	var reply string
+	if err := NewClient(ts.URL, "5s").CallMethod(1, "Test.Set", nil, &reply); err == nil {
+		t.Fatalf("want call without credentials refused")
+	}
+	if err := NewClient(ts.URL, "5s").SetAPIKey("badkey").CallMethod(1, "Test.Get", nil, &reply); err == nil {
+		t.Fatalf("want call with an invalid key refused")
+	}
+	if err := NewClient(ts.URL, "5s").SetJWTSecret(secret).CallMethod(1, "Test.Set", nil, &reply); err != nil || reply != "set" {
+		t.Fatalf("want call with a token allowed, got %q, err %v", reply, err)
+	}
+}
@@ -27,6 +27,11 @@ import (
 type Client struct {
 	hostUrl string
 	timeOut string
+
+	apiKey    string
+	jwtSecret []byte
+	// ipcPath is the unix socket the client dials, if any.
+	ipcPath string
 }
 
 type jsonRPCReq struct {
@@ -50,6 +55,38 @@ func NewClient(url, timeOut string) *Client {
 	}
 }
 
+// SetAPIKey sets the API key the client sends with its calls.
+func (cli *Client) SetAPIKey(key string) *Client {
+	cli.apiKey = key
+	return cli
+}
+
+// SetJWTSecret sets the secret the client signs an admin token with for each
+// of its calls.
+func (cli *Client) SetJWTSecret(secret []byte) *Client {
+	cli.jwtSecret = secret
+	return cli
+}
+
+// authHeaders returns the headers that authenticate the calls of the client.
+func (cli *Client) authHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	if cli.apiKey != "" {
+		headers[apiKeyHeader] = cli.apiKey
+	}
+	if len(cli.jwtSecret) > 0 {
+		token, err := NewRPCToken(cli.jwtSecret, RPCPermAdmin, clientTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+	return headers, nil
+}
+
+// clientTokenTTL is the lifetime of the tokens the client signs.
+const clientTokenTTL = time.Minute
+
 // CallMethod executes a JSON-RPC call with the given psrameters,which is important to the rpc server.
 func (cli *Client) CallMethod(id int, methodname string, params interface{}, out interface{}) error {
 	client := resty.New()
@@ -59,18 +96,27 @@ func (cli *Client) CallMethod(id int, methodname string, params interface{}, out
 		return err
 	}
 	client = client.SetTimeout(timeDur)
+	if cli.ipcPath != "" {
+		client = client.SetTransport(ipcTransport(cli.ipcPath))
+	}
 	req := &jsonRPCReq{
 		JsonRPC: "2.0",
 		ID:      id,
 		Method:  methodname,
 		Params:  params,
 	}
+	headers, err := cli.authHeaders()
+	if err != nil {
+		return err
+	}
 	// The result must be a pointer so that response json can unmarshal into it.
 	var resp *jsonRPCResp = nil
 	r, err := client.R().
 		SetHeader("Content-Type", "application/json").
+		SetHeaders(headers).
 		SetBody(req).
 		SetResult(&resp). // or SetResult(AuthSuccess{}).
+		SetError(&resp).
 		Post(cli.hostUrl)
 	if err != nil {
 		return err
@@ -43,8 +43,16 @@ var (
 	LoadStateTreeError = func(msg string, params ...interface{}) *rpcError {
 		return NewRPCError(-32002, fmt.Sprintf(msg, params...))
 	}
+	// UnauthorizedError is returned for calls with invalid credentials or
+	// without the permission the method requires.
+	UnauthorizedError = func(msg string, params ...interface{}) *rpcError {
+		return NewRPCError(UnauthorizedErrorCode, fmt.Sprintf(msg, params...))
+	}
 )
 
+// UnauthorizedErrorCode is the code of UnauthorizedError.
+const UnauthorizedErrorCode = -32003
+
 func NewRPCError(code int, message string) *rpcError {
 	return &rpcError{
 		Code:    code,
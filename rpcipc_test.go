@@ -0,0 +1,89 @@
+package xfsgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type testRPCSubscriber struct{}
+
+func (*testRPCSubscriber) Events(conn RPCConn, _ *struct{}, reply *string) error {
+	*reply = "subscribed"
+	return conn.SendMessage(uuid.New(), "event")
+}
+
+func TestRPCServer_ipc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xfsgo.ipc")
+	server := newTestRPCServer(t, &RPCConfig{APIKeys: map[string]RPCPermission{"adminkey": RPCPermAdmin}})
+	if err := server.RegisterSubscribe("Subscriber", new(testRPCSubscriber)); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenIPC(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() { _ = http.Serve(ln, server.handler(ipcListener)) }()
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 || !IsIPCSocket(path) {
+		t.Fatalf("want a socket of the owner only, got %v, err %v", fi.Mode(), err)
+	}
+	if _, err = listenIPC(path); err == nil {
+		t.Fatalf("want the socket of a running node kept")
+	}
+
+	// The callers of the socket are admins without credentials.
+	var reply string
+	if err = NewIPCClient(path, "5s").CallMethod(1, "Test.Set", nil, &reply); err != nil || reply != "set" {
+		t.Fatalf("want admin call allowed, got %q, err %v", reply, err)
+	}
+
+	// Subscriptions are served over websocket on the socket.
+	dialer := websocket.Dialer{NetDial: func(_, _ string) (net.Conn, error) {
+		return net.Dial("unix", path)
+	}}
+	conn, _, err := dialer.Dial("ws://ipc/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.WriteJSON(&RPCMessageRequest{Jsonrpc: jsonrpcVersion, Id: 1, Method: "Subscriber.Events", Params: json.RawMessage("null")}); err != nil {
+		t.Fatal(err)
+	}
+	var event RPCBroadcastMsg
+	if err = conn.ReadJSON(&event); err != nil || event.Result != "event" || event.Subscription == "" {
+		t.Fatalf("want event delivered, got %+v, err %v", event, err)
+	}
+	var resp RPCMessageRespSuccess
+	if err = conn.ReadJSON(&resp); err != nil || resp.Result != "subscribed" {
+		t.Fatalf("want subscription reply, got %+v, err %v", resp, err)
+	}
+}
+
+func TestListenIPC_stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xfsgo.ipc")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the socket file behind as a node killed would.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if ln, err = listenIPC(path); err != nil {
+		t.Fatalf("want a stale socket replaced, got err %v", err)
+	}
+	ln.Close()
+	if err = ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = listenIPC(path); err == nil {
+		t.Fatalf("want a file other than a socket kept")
+	}
+}
@@ -17,6 +17,7 @@
 package xfsgo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
@@ -81,6 +82,24 @@ type service struct {
 type RPCConfig struct {
 	ListenAddr string
 	Logger     log.Logger
+
+	// AdminListenAddr is the address of a listener for the admin calls,
+	// the callers of ListenAddr are granted read at most once it is set.
+	AdminListenAddr string
+	// APIKeys maps the keys accepted in the X-API-Key header to the
+	// permission they grant.
+	APIKeys map[string]RPCPermission
+	// JWTSecret is the secret of the HS256 tokens accepted as bearer
+	// tokens, whose "perm" claim is the permission they grant.
+	JWTSecret []byte
+	// CORSOrigins lists the origins allowed for browsers, "*" allowing any.
+	CORSOrigins []string
+	// Permissions overrides the permission a service or a "Service.Method"
+	// requires.
+	Permissions map[string]RPCPermission
+	// IPCPath is the path of a unix socket serving every call, whose
+	// file permissions restrict it to the user running the node.
+	IPCPath string
 }
 
 // RPCServer is an RPC server.
@@ -90,8 +109,22 @@ type RPCServer struct {
 	ginEngine  *gin.Engine
 	upgrader   websocket.Upgrader
 	serviceMap map[string]*service
+	// permissions holds the permissions set by SetPermission.
+	permissions map[string]RPCPermission
 }
 
+// rpcListener is the kind of listener a request was received by.
+type rpcListener uint8
+
+const (
+	publicListener rpcListener = iota
+	adminListener
+	ipcListener
+)
+
+// listenerKey is the context key of the listener of a request.
+type listenerKey struct{}
+
 func ginlogger(log log.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Errors) > 0 {
@@ -100,14 +133,14 @@ func ginlogger(log log.Logger) gin.HandlerFunc {
 	}
 }
 
-func ginCors() gin.HandlerFunc {
+func ginCors(allowOrigin func(origin string) string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		method := c.Request.Method
-		origin := c.Request.Header.Get("Origin")
-		if origin != "" {
-			c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Vary", "Origin")
+		if origin := allowOrigin(c.Request.Header.Get("Origin")); origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
-			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
+			c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-API-Key")
 			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -128,6 +161,8 @@ func NewRPCServer(config *RPCConfig) *RPCServer {
 			WriteBufferSize: 1024,
 		},
 	}
+	server.permissions = make(map[string]RPCPermission)
+	server.upgrader.CheckOrigin = server.checkOrigin
 	if server.logger == nil {
 		server.logger = log.DefaultLogger()
 	}
@@ -136,7 +171,8 @@ func NewRPCServer(config *RPCConfig) *RPCServer {
 	server.ginEngine = gin.New()
 	server.ginEngine.Use(ginlogger(server.logger))
 	server.ginEngine.Use(gin.Recovery())
-	server.ginEngine.Use(ginCors())
+	server.ginEngine.Use(ginCors(server.corsOrigin))
+	server.ginEngine.Any("/", server.handleRequest)
 	return server
 }
 
@@ -238,16 +274,13 @@ func isWebsocketRequest(c *gin.Context) bool {
 	upgrade := c.GetHeader("Upgrade")
 	return connection == "Upgrade" && upgrade == "websocket"
 }
-func (server *RPCServer) handleWebsocket(c *gin.Context) error {
-	server.upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
-	}
+func (server *RPCServer) handleWebsocket(c *gin.Context, perm RPCPermission) error {
 	conn, err := server.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logrus.Warnf("upgrad err: %s", err)
 		return err
 	}
-	server.readLoop(conn)
+	server.readLoop(conn, perm)
 	return nil
 }
 
@@ -306,7 +339,7 @@ func sendWSRPCError(conn *websocket.Conn, id interface{}, err error) error {
 	errobj := packErrorMessage(id, err)
 	return sendWSRPCResponse(conn, errobj)
 }
-func (server *RPCServer) readLoop(conn *websocket.Conn) {
+func (server *RPCServer) readLoop(conn *websocket.Conn, perm RPCPermission) {
 	defer func() {
 		if conn == nil {
 			return
@@ -329,7 +362,7 @@ func (server *RPCServer) readLoop(conn *websocket.Conn) {
 			if err = server.gotRPCRequestReply(request, &replay, &rpcConn{
 				request: request,
 				conn:    conn,
-			}); err != nil {
+			}, perm); err != nil {
 				_ = sendWSRPCError(conn, request.Id, err)
 				continue
 			}
@@ -375,82 +408,124 @@ func sendHTTPRPCError(c *gin.Context, code int, id interface{}, err error) {
 
 //Start starts rpc server.
 func (server *RPCServer) Start() error {
-	server.ginEngine.Any("/", func(c *gin.Context) {
-		//handle websocket request
-		defer c.Abort()
-		if isWebsocketRequest(c) {
-			if err := server.handleWebsocket(c); err != nil {
-				server.logger.Warnf("ws connect err")
+	if addr := server.config.AdminListenAddr; addr != "" {
+		adminLn, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		server.logger.Infof("RPC admin service listen on: %s", adminLn.Addr())
+		go func() {
+			if err := http.Serve(adminLn, server.handler(adminListener)); err != nil {
+				server.logger.Errorf("RPC admin service err: %s", err)
 			}
-			return
+		}()
+	}
+	if path := server.config.IPCPath; path != "" {
+		ipcLn, err := listenIPC(path)
+		if err != nil {
+			return err
 		}
+		server.logger.Infof("RPC IPC service listen on: %s", path)
+		go func() {
+			if err := http.Serve(ipcLn, server.handler(ipcListener)); err != nil {
+				server.logger.Errorf("RPC IPC service err: %s", err)
+			}
+		}()
+	}
+	ln, err := net.Listen("tcp", server.config.ListenAddr)
+	if err != nil {
+		return err
+	}
+	server.logger.Infof("RPC Service listen on: %s", ln.Addr())
+	return http.Serve(ln, server.handler(publicListener))
+}
+
+// handler returns the handler of a kind of listener.
+func (server *RPCServer) handler(listener rpcListener) http.Handler {
+	if listener == publicListener {
+		return server.ginEngine
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), listenerKey{}, listener)
+		server.ginEngine.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (server *RPCServer) handleRequest(c *gin.Context) {
+	defer c.Abort()
+	listener, _ := c.Request.Context().Value(listenerKey{}).(rpcListener)
+	perm, err := server.authorize(c.Request, listener)
+	if err != nil {
 		c.Header("Content-Type", "application/json; charset=utf-8")
-		if "POST" != c.Request.Method {
-			sendHTTPRPCError(c, 400, nil, invalidRequestError)
-			return
-		}
-		contentType := c.ContentType()
-		if contentType != "application/json" {
-			sendHTTPRPCError(c, 400, nil, invalidRequestError)
-			return
+		sendHTTPRPCError(c, http.StatusUnauthorized, nil, err)
+		return
+	}
+	//handle websocket request
+	if isWebsocketRequest(c) {
+		if err := server.handleWebsocket(c, perm); err != nil {
+			server.logger.Warnf("ws connect err")
 		}
-		if nil == c.Request.Body {
-			sendHTTPRPCError(c, 400, nil, invalidRequestError)
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	if "POST" != c.Request.Method {
+		sendHTTPRPCError(c, 400, nil, invalidRequestError)
+		return
+	}
+	contentType := c.ContentType()
+	if contentType != "application/json" {
+		sendHTTPRPCError(c, 400, nil, invalidRequestError)
+		return
+	}
+	if nil == c.Request.Body {
+		sendHTTPRPCError(c, 400, nil, invalidRequestError)
+		return
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		sendHTTPRPCError(c, 400, nil, parseError)
+		return
+	}
+	var request *RPCMessageRequest
+	if err = json.Unmarshal(body, &request); err == nil {
+		var reply interface{}
+		if err = server.gotRPCRequestReply(request, &reply, nil, perm); err != nil {
+			sendHTTPRPCError(c, 200, request.Id, err)
 			return
 		}
-		body, err := ioutil.ReadAll(c.Request.Body)
-		if err != nil {
-			sendHTTPRPCError(c, 400, nil, parseError)
-			return
+		data := &RPCMessageRespSuccess{
+			Jsonrpc: jsonrpcVersion,
+			Id:      request.Id,
+			Result:  reply,
 		}
-		var request *RPCMessageRequest
-		if err = json.Unmarshal(body, &request); err == nil {
+		sendHTTPRPCResponse(c, 200, data)
+		return
+	}
+	var batchs []*RPCMessageRequest
+	if err = json.Unmarshal(body, &batchs); err == nil {
+		var resps []interface{}
+		resps = make([]interface{}, len(batchs))
+		for i := 0; i < len(batchs); i++ {
+			requestSigle := batchs[i]
 			var reply interface{}
-			if err = server.gotRPCRequestReply(request, &reply, nil); err != nil {
-				sendHTTPRPCError(c, 200, request.Id, err)
-				return
-			}
-			data := &RPCMessageRespSuccess{
-				Jsonrpc: jsonrpcVersion,
-				Id:      request.Id,
-				Result:  reply,
-			}
-			sendHTTPRPCResponse(c, 200, data)
-			return
-		}
-		var batchs []*RPCMessageRequest
-		if err = json.Unmarshal(body, &batchs); err == nil {
-			var resps []interface{}
-			resps = make([]interface{}, len(batchs))
-			for i := 0; i < len(batchs); i++ {
-				requestSigle := batchs[i]
-				var reply interface{}
-				var resp interface{}
-				if err = server.gotRPCRequestReply(requestSigle, &reply, nil); err != nil {
-					resp = packErrorMessage(requestSigle.Id, err)
-				} else {
-					resp = &RPCMessageRespSuccess{
-						Jsonrpc: jsonrpcVersion,
-						Id:      request.Id,
-						Result:  reply,
-					}
+			var resp interface{}
+			if err = server.gotRPCRequestReply(requestSigle, &reply, nil, perm); err != nil {
+				resp = packErrorMessage(requestSigle.Id, err)
+			} else {
+				resp = &RPCMessageRespSuccess{
+					Jsonrpc: jsonrpcVersion,
+					Id:      request.Id,
+					Result:  reply,
 				}
-				resps[i] = resp
 			}
-			sendHTTPRPCResponse(c, 200, resps)
-			return
+			resps[i] = resp
 		}
-		sendHTTPRPCError(c, 400, nil, parseError)
-	})
-
-	ln, err := net.Listen("tcp", server.config.ListenAddr)
-	if err != nil {
-		return err
+		sendHTTPRPCResponse(c, 200, resps)
+		return
 	}
-	server.logger.Infof("RPC Service listen on: %s", ln.Addr())
-	return server.ginEngine.RunListener(ln)
+	sendHTTPRPCError(c, 400, nil, parseError)
 }
-func (server *RPCServer) readRequest(request *RPCMessageRequest) (
+func (server *RPCServer) readRequest(request *RPCMessageRequest, perm RPCPermission) (
 	s *service, m *method, argv reflect.Value, replyv reflect.Value, err error) {
 	if request.Method == "" {
 		err = methodNotFoundError
@@ -473,6 +548,10 @@ func (server *RPCServer) readRequest(request *RPCMessageRequest) (
 		err = methodNotFoundError
 		return
 	}
+	if required := server.requiredPermission(serviceName, methodName); perm < required {
+		err = UnauthorizedError("%s requires %s permission", request.Method, required)
+		return
+	}
 	argTypeKind := m.ArgType.Kind()
 	argIsValue := false
 	if argTypeKind == reflect.Ptr {
@@ -554,8 +633,8 @@ func (s *service) call(
 	}
 	return errInter.(error)
 }
-func (server *RPCServer) gotRPCRequestReply(request *RPCMessageRequest, reply *interface{}, conn *rpcConn) error {
-	s, m, argv, replyv, err := server.readRequest(request)
+func (server *RPCServer) gotRPCRequestReply(request *RPCMessageRequest, reply *interface{}, conn *rpcConn, perm RPCPermission) error {
+	s, m, argv, replyv, err := server.readRequest(request, perm)
 	if err != nil {
 		return err
 	}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"math/big"
+	"sort"
 	"xfsgo/avlmerkle"
 	"xfsgo/common"
 	"xfsgo/common/ahash"
@@ -398,3 +399,71 @@ func (st *StateTree) Commit() error {
     }
 	return st.merkleTree.Commit()
 }
+
+// StorageDiff describes the change of a single storage slot of an account.
+type StorageDiff struct {
+	Key    common.Hash
+	Before []byte
+	After  []byte
+}
+
+// AccountDiff describes the changes made to an account compared to a base state.
+type AccountDiff struct {
+	Address       common.Address
+	BalanceBefore *big.Int
+	BalanceAfter  *big.Int
+	NonceBefore   uint64
+	NonceAfter    uint64
+	Storage       []*StorageDiff
+}
+
+// DiffFrom compares the accounts loaded in st with their state in base and
+// returns the accounts whose balance, nonce or storage differ, ordered by address.
+func (st *StateTree) DiffFrom(base *StateTree) []*AccountDiff {
+	diffs := make([]*AccountDiff, 0)
+	for addr, obj := range st.objs {
+		diff := &AccountDiff{
+			Address:       addr,
+			BalanceBefore: new(big.Int),
+			BalanceAfter:  new(big.Int),
+			NonceAfter:    obj.nonce,
+			Storage:       make([]*StorageDiff, 0),
+		}
+		if obj.balance != nil {
+			diff.BalanceAfter.Set(obj.balance)
+		}
+		old := base.GetStateObj(addr)
+		if old != nil {
+			if old.balance != nil {
+				diff.BalanceBefore.Set(old.balance)
+			}
+			diff.NonceBefore = old.nonce
+		}
+		for key, val := range obj.cacheStorage {
+			var before []byte
+			if old != nil {
+				before = old.GetStateValue(key)
+			}
+			if bytes.Equal(before, val) {
+				continue
+			}
+			diff.Storage = append(diff.Storage, &StorageDiff{
+				Key:    common.Bytes2Hash(key[:]),
+				Before: before,
+				After:  val,
+			})
+		}
+		if diff.BalanceBefore.Cmp(diff.BalanceAfter) == 0 &&
+			diff.NonceBefore == diff.NonceAfter && len(diff.Storage) == 0 {
+			continue
+		}
+		sort.Slice(diff.Storage, func(i, j int) bool {
+			return bytes.Compare(diff.Storage[i].Key[:], diff.Storage[j].Key[:]) < 0
+		})
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return bytes.Compare(diffs[i].Address[:], diffs[j].Address[:]) < 0
+	})
+	return diffs
+}
@@ -0,0 +1,56 @@
+package xfsgo
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"xfsgo/common"
+	"xfsgo/test"
+)
+
+func TestStateTree_DiffFrom(t *testing.T) {
+	alice := common.Bytes2Address([]byte{1})
+	bob := common.Bytes2Address([]byte{2})
+	idle := common.Bytes2Address([]byte{3})
+	newState := func() *StateTree {
+		st, err := NewStateTreeN(test.NewMemStorage(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.AddBalance(alice, big.NewInt(100))
+		st.AddBalance(idle, big.NewInt(7))
+		st.UpdateAll()
+		return st
+	}
+	base := newState()
+	changed := newState()
+	changed.GetStateObj(alice).SubBalance(big.NewInt(40))
+	changed.AddNonce(alice, 1)
+	changed.AddBalance(bob, big.NewInt(40))
+	var key [32]byte
+	key[0] = 1
+	changed.SetState(bob, key, []byte{0xff})
+	_ = changed.GetBalance(idle)
+	changed.UpdateAll()
+
+	diffs := changed.DiffFrom(base)
+	if len(diffs) != 2 {
+		t.Fatalf("want 2 changed accounts, got %d", len(diffs))
+	}
+	a, b := diffs[0], diffs[1]
+	if a.Address != alice || b.Address != bob {
+		t.Fatalf("unexpected accounts order: %x, %x", a.Address, b.Address)
+	}
+	if a.BalanceBefore.Int64() != 100 || a.BalanceAfter.Int64() != 60 {
+		t.Fatalf("alice balance diff: %s -> %s", a.BalanceBefore, a.BalanceAfter)
+	}
+	if a.NonceBefore != 0 || a.NonceAfter != 1 {
+		t.Fatalf("alice nonce diff: %d -> %d", a.NonceBefore, a.NonceAfter)
+	}
+	if b.BalanceBefore.Sign() != 0 || b.BalanceAfter.Int64() != 40 {
+		t.Fatalf("bob balance diff: %s -> %s", b.BalanceBefore, b.BalanceAfter)
+	}
+	if len(b.Storage) != 1 || b.Storage[0].Before != nil || !bytes.Equal(b.Storage[0].After, []byte{0xff}) {
+		t.Fatalf("bob storage diff: %v", b.Storage)
+	}
+}
@@ -40,6 +40,7 @@ var (
 	nonceErr         = errors.New("nonce too low")
 	balanceErr       = errors.New("account not enough balance")
 	gasLimitErr      = errors.New("gas limit too low")
+	txVersionErr     = errors.New("transaction version not active")
 	// ErrUnderpriced is returned if a transaction's gas price is below the minimum
 	// configured for the transaction pool.
 	ErrUnderpriced = errors.New("transaction underpriced")
@@ -56,6 +57,7 @@ type TxPoolConfig struct {
 	PriceBump        int64         //// Minimum price bump percentage to replace an already existing transaction (nonce)
 	Lifetime         time.Duration // Maximum amount of time non-executable transaction are queued
 	EvictionInterval time.Duration // Time interval to check for evictable transactions
+	TxVersionFn      func() uint32 // Highest transaction version of the next block, version0 if nil
 }
 
 func defaultTxPoolConfig() *TxPoolConfig {
@@ -218,6 +220,13 @@ func (pool *TxPool) validateTx(tx *Transaction) error {
 	if pool.minGasPrice.Cmp(tx.GasPrice) > 0 {
 		return gasPriceErr
 	}
+	maxVersion := version0
+	if pool.config.TxVersionFn != nil {
+		maxVersion = pool.config.TxVersionFn()
+	}
+	if tx.Version > maxVersion {
+		return txVersionErr
+	}
 	if from, err = tx.FromAddr(); err != nil {
 		return invalidSenderErr
 	}
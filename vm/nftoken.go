@@ -62,6 +62,11 @@ func (t *nftoken) BuiltinId() uint8 {
 	return 0x02
 }
 
+// Fork returns the name of the fork activating the contract.
+func (t *nftoken) Fork() string {
+	return ForkNFToken
+}
+
 func (t *nftoken) GetName() CTypeString {
 	return t.Name
 }
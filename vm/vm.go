@@ -29,17 +29,39 @@ var (
 	errInvalidContractCode = errors.New("invalid contract code")
 )
 
+// ForkChecker reports whether the fork of name is active where the code runs.
+type ForkChecker func(name string) bool
+
+// ForkNFToken is the fork activating the non-fungible token builtin contract,
+// scheduled by the chain config under this name.
+const ForkNFToken = "nftoken"
+
+// forkedBuiltin is implemented by the builtin contracts which are only
+// available once a fork is active.
+type forkedBuiltin interface {
+	Fork() string
+}
+
 type xvm struct {
-	stateTree core.StateTree
-	builtins  map[uint8]reflect.Type
-	logger    Logger
+	stateTree  core.StateTree
+	builtins   map[uint8]reflect.Type
+	logger     Logger
+	forkActive ForkChecker
 }
 
+// NewXVM creates a vm with all the builtin contracts available.
 func NewXVM(st core.StateTree) *xvm {
+	return NewXVMWithForks(st, nil)
+}
+
+// NewXVMWithForks creates a vm whose builtin contracts are limited to the ones
+// activated by the forks forkActive reports, all are available if it is nil.
+func NewXVMWithForks(st core.StateTree, forkActive ForkChecker) *xvm {
 	vm := &xvm{
-		stateTree: st,
-		builtins:  make(map[uint8]reflect.Type),
-		logger:    NewLogger(),
+		stateTree:  st,
+		builtins:   make(map[uint8]reflect.Type),
+		logger:     NewLogger(),
+		forkActive: forkActive,
 	}
 	vm.registerBuiltinId(new(token))
 	vm.registerBuiltinId(new(nftoken))
@@ -61,6 +83,9 @@ func (vm *xvm) newBuiltinContractExec(
 	return nil, errUnknownContractId
 }
 func (vm *xvm) registerBuiltinId(b BuiltinContract) {
+	if f, ok := b.(forkedBuiltin); ok && vm.forkActive != nil && !vm.forkActive(f.Fork()) {
+		return
+	}
 	bid := b.BuiltinId()
 	if _, exists := vm.builtins[bid]; !exists {
 		rt := reflect.TypeOf(b)